@@ -0,0 +1,64 @@
+package toolkit
+
+import (
+	"errors"
+	"time"
+)
+
+// The outcomes of an UploadEvent
+const (
+	// UploadSaved is a file that was saved
+	UploadSaved = "saved"
+	// UploadRejected is a file that was not saved, because it was rejected or something went wrong
+	UploadRejected = "rejected"
+)
+
+// UploadEvent is the record of an uploaded file passed to AuditFunc
+type UploadEvent struct {
+	// Time is when the file was saved or rejected
+	Time time.Time
+	// RemoteAddr is the network address the file was sent from, as in http.Request, when it was sent in a request
+	RemoteAddr string
+	// UserAgent is the User-Agent header of the request the file was sent with, if any
+	UserAgent string
+	// FieldName is the name of the form field the file was sent in, if any
+	FieldName string
+	// OriginalFileName is the name of the file, as sent by the client
+	OriginalFileName string
+	// NewFileName is the name the file was saved under, when it was saved
+	NewFileName string
+	// Size is the size of the file saved, in bytes
+	Size int64
+	// ContentType is the type detected from the file contents, when it was known
+	ContentType string
+	// Outcome is UploadSaved or UploadRejected
+	Outcome string
+	// Error is the text of the error the file was rejected with
+	Error string
+}
+
+// audit reports the outcome of saving file, which is either uploadedFile or err, to AuditFunc, when set
+func (t *Tools) audit(file partInfo, uploadedFile *UploadedFile, err error) {
+	if t.AuditFunc == nil {
+		return
+	}
+
+	e := UploadEvent{Time: time.Now(), FieldName: file.fieldName, OriginalFileName: file.fileName, Outcome: UploadSaved}
+	if file.request != nil {
+		e.RemoteAddr = file.request.RemoteAddr
+		e.UserAgent = file.request.UserAgent()
+	}
+	if err != nil {
+		e.Outcome = UploadRejected
+		e.Error = err.Error()
+		var uploadErr *UploadError
+		if errors.As(err, &uploadErr) {
+			e.ContentType = uploadErr.FileType
+		}
+	} else {
+		e.NewFileName = uploadedFile.NewFileName
+		e.Size = uploadedFile.FileSize
+		e.ContentType = uploadedFile.ContentType
+	}
+	t.AuditFunc(e)
+}
@@ -0,0 +1,83 @@
+package toolkit
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+var auditTests = []struct {
+	name     string
+	parsed   bool
+	tools    Tools
+	files    []testFile
+	expected []string
+}{
+	{
+		name:     "mixed batch",
+		parsed:   true,
+		tools:    Tools{AllowedFileTypes: []string{"text/plain"}},
+		files:    []testFile{{name: "a.txt", content: []byte("first notes")}, {name: "img.png", content: pngHeader}, {name: "b.txt", content: []byte("more notes")}},
+		expected: []string{"a.txt saved text/plain; charset=utf-8 11", "img.png rejected image/png 0", "b.txt saved text/plain; charset=utf-8 10"},
+	},
+	{
+		name:     "streamed batch stops at the first rejection",
+		tools:    Tools{AllowedFileTypes: []string{"text/plain"}},
+		files:    []testFile{{name: "a.txt", content: []byte("first notes")}, {name: "img.png", content: pngHeader}, {name: "b.txt", content: []byte("more notes")}},
+		expected: []string{"a.txt saved text/plain; charset=utf-8 11", "img.png rejected image/png 0"},
+	},
+	{
+		name:     "too many files",
+		tools:    Tools{MaxUploadCount: 1},
+		files:    []testFile{{name: "a.txt", content: []byte("first notes")}, {name: "b.txt", content: []byte("more notes")}},
+		expected: []string{"a.txt saved text/plain; charset=utf-8 11", "b.txt rejected  0"},
+	},
+	{
+		name:     "too many parsed files",
+		parsed:   true,
+		tools:    Tools{MaxUploadCount: 1},
+		files:    []testFile{{name: "a.txt", content: []byte("first notes")}, {name: "b.txt", content: []byte("more notes")}},
+		expected: []string{"a.txt rejected  0", "b.txt rejected  0"},
+	},
+}
+
+func TestTools_AuditFunc(t *testing.T) {
+	for _, e := range auditTests {
+		var mu sync.Mutex
+		var events []UploadEvent
+		testTools := e.tools
+		testTools.FS = &MemoryFS{}
+		testTools.AuditFunc = func(event UploadEvent) {
+			mu.Lock()
+			defer mu.Unlock()
+			events = append(events, event)
+		}
+
+		request := newUploadRequest(t, e.files...)
+		if e.parsed {
+			request = newParsedUploadRequest(t, e.files...)
+		}
+		request.Header.Set("User-Agent", "audit-test/1.0")
+		_, _ = testTools.UploadFiles(request, "uploads", false)
+
+		if len(events) != len(e.expected) {
+			t.Errorf("%s: expected %d events, but got %d", e.name, len(e.expected), len(events))
+			continue
+		}
+		for i, event := range events {
+			got := fmt.Sprintf("%s %s %s %d", event.OriginalFileName, event.Outcome, event.ContentType, event.Size)
+			if got != e.expected[i] {
+				t.Errorf("%s: expected event %q, but got %q", e.name, e.expected[i], got)
+			}
+			if event.RemoteAddr != request.RemoteAddr || event.UserAgent != "audit-test/1.0" || event.FieldName != "file" || event.Time.IsZero() {
+				t.Errorf("%s: wrong request metadata in %+v", e.name, event)
+			}
+			if (event.Outcome == UploadRejected) != (event.Error != "") {
+				t.Errorf("%s: expected an error only for rejected files, but got %q", e.name, event.Error)
+			}
+			if event.Outcome == UploadSaved && event.NewFileName != event.OriginalFileName {
+				t.Errorf("%s: wrong new file name %q", e.name, event.NewFileName)
+			}
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package toolkit
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+)
+
+// TokenSource returns the bearer token a call to a remote service is authenticated with, for tokens that
+// expire and have to be refreshed. It is called before every attempt of the call
+type TokenSource func(ctx context.Context) (string, error)
+
+// WithBearerToken sends token in the Authorization header, as "Bearer <token>"
+func WithBearerToken(token string) RemoteOption {
+	return func(o *remoteOptions) {
+		o.setHeader("Authorization", "Bearer "+token)
+	}
+}
+
+// WithBasicAuth sends username and password in the Authorization header, with the Basic scheme of RFC 7617
+func WithBasicAuth(username, password string) RemoteOption {
+	return func(o *remoteOptions) {
+		o.setHeader("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(username+":"+password)))
+	}
+}
+
+// WithAPIKeyHeader sends the API key value in the header name, such as X-Api-Key. The header is redacted from
+// the dumps of RemoteDebug, as those of SensitiveHeaders are
+func WithAPIKeyHeader(name, value string) RemoteOption {
+	return func(o *remoteOptions) {
+		o.setHeader(name, value)
+		o.sensitive = append(o.sensitive, name)
+	}
+}
+
+// WithTokenSource sends the token source returns in the Authorization header, as "Bearer <token>". When source
+// fails, the call is given up before anything is sent, with an error wrapping the error of source
+func WithTokenSource(source TokenSource) RemoteOption {
+	return func(o *remoteOptions) {
+		o.tokenSource = source
+	}
+}
+
+// setHeader sets the header key to value, replacing what the options before did
+func (o *remoteOptions) setHeader(key, value string) {
+	if o.header == nil {
+		o.header = make(http.Header)
+	}
+	o.header.Set(key, value)
+}
+
+// redactURL returns uri with the password it may carry replaced, so it can be put in errors
+func redactURL(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return uri
+	}
+	return u.Redacted()
+}
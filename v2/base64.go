@@ -0,0 +1,50 @@
+package toolkit
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+// Base64Upload is a file sent as a base64 string, typically as part of a JSON payload
+type Base64Upload struct {
+	// FileName is the original name of the file
+	FileName string `json:"file_name"`
+	// Data is the base64 encoded file contents, optionally as a data URI such as data:image/png;base64,iVBOR...
+	Data string `json:"data"`
+}
+
+// UploadBase64File saves the file in field to uploadDir, with the same checks and options as UploadFiles.
+// The data is decoded while it is being saved, so the decoded file is never held in memory, and MaxFileSize
+// limits its decoded size, returning ErrRequestTooLarge for a larger file. The file is renamed unless rename is false.
+func (t *Tools) UploadBase64File(field Base64Upload, uploadDir string, rename ...bool) (*UploadedFile, error) {
+	renameFile := true
+	if len(rename) > 0 {
+		renameFile = rename[0]
+	}
+
+	data, err := base64Payload(field.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := t.prepareUploadDir(uploadDir); err != nil {
+		return nil, err
+	}
+
+	decoder := base64.NewDecoder(base64.StdEncoding, strings.NewReader(data))
+	return t.uploadPart(context.Background(), partInfo{fileName: field.FileName}, decoder, uploadDir, renameFile, t.maxUploadSize())
+}
+
+// base64Payload returns the base64 data of a data URI, or data itself when it is not a data URI
+func base64Payload(data string) (string, error) {
+	if !strings.HasPrefix(data, "data:") {
+		return data, nil
+	}
+	header, payload, found := strings.Cut(data, ",")
+	if !found || !strings.HasSuffix(header, ";base64") {
+		return "", errors.New("the data URI is not base64 encoded")
+	}
+	return payload, nil
+}
@@ -0,0 +1,73 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+var base64Tests = []struct {
+	name          string
+	prefix        string
+	maxFileSize   int
+	allowedTypes  []string
+	corrupt       bool
+	errorExpected bool
+}{
+	{name: "data URI", prefix: "data:image/png;base64,", allowedTypes: []string{"image/png"}},
+	{name: "raw base64"},
+	{name: "not allowed", allowedTypes: []string{"image/jpeg"}, errorExpected: true},
+	{name: "too big", maxFileSize: 1000, errorExpected: true},
+	{name: "corrupt", corrupt: true, errorExpected: true},
+	{name: "not base64 data URI", prefix: "data:image/png,", errorExpected: true},
+}
+
+func TestTools_UploadBase64File(t *testing.T) {
+	img, err := os.ReadFile("./testdata/img.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded := base64.StdEncoding.EncodeToString(img)
+
+	for _, e := range base64Tests {
+		uploadDir := t.TempDir()
+		testTools := Tools{MaxFileSize: e.maxFileSize, AllowedFileTypes: e.allowedTypes}
+
+		data := e.prefix + encoded
+		if e.corrupt {
+			data = encoded[:1000] + "!!!!" + encoded[1000:]
+		}
+
+		uploadedFile, err := testTools.UploadBase64File(Base64Upload{FileName: "img.png", Data: data}, uploadDir, false)
+		if e.errorExpected {
+			if err == nil {
+				t.Errorf("%s: error expected, but none received", e.name)
+			}
+			if entries, _ := os.ReadDir(uploadDir); len(entries) != 0 {
+				t.Errorf("%s: expected no files in upload directory, but found %d", e.name, len(entries))
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: error not expected, but one received: %s", e.name, err)
+			continue
+		}
+
+		if uploadedFile.ContentType != "image/png" || uploadedFile.FileSize != int64(len(img)) {
+			t.Errorf("%s: wrong content type %s or size %d", e.name, uploadedFile.ContentType, uploadedFile.FileSize)
+		}
+		if data, _ := os.ReadFile(uploadedFile.SavedPath); !bytes.Equal(data, img) {
+			t.Errorf("%s: saved file differs from the upload", e.name)
+		}
+	}
+
+	// The size limit is reported with the usual error
+	testTools := Tools{MaxFileSize: 10}
+	_, err = testTools.UploadBase64File(Base64Upload{FileName: "notes.txt", Data: base64.StdEncoding.EncodeToString([]byte(strings.Repeat("x", 11)))}, t.TempDir())
+	if !errors.Is(err, ErrRequestTooLarge) {
+		t.Errorf("expected ErrRequestTooLarge, but got %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"strings"
+)
+
+// checksumHeader returns the value of the VerifyChecksumHeader header in the first of headers that has it, or
+// an empty string when VerifyChecksumHeader is not set
+func (t *Tools) checksumHeader(headers ...http.Header) string {
+	if t.VerifyChecksumHeader == "" {
+		return ""
+	}
+	for _, header := range headers {
+		if value := strings.TrimSpace(header.Get(t.VerifyChecksumHeader)); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// checksumVerifier hashes an uploaded file, and checks it against the checksum sent by the client
+type checksumVerifier struct {
+	hash     hash.Hash
+	expected []byte
+}
+
+// newChecksumVerifier returns a checksumVerifier for the checksum value sent in the header headerName, as
+// described for Tools.VerifyChecksumHeader
+func newChecksumVerifier(headerName, value string) (*checksumVerifier, error) {
+	algorithm := "sha256"
+	if strings.Contains(strings.ToLower(headerName), "md5") {
+		algorithm = "md5"
+	}
+	if prefix, digest, found := strings.Cut(value, ":"); found {
+		algorithm, value = strings.ToLower(prefix), digest
+		if algorithm != "sha256" && algorithm != "md5" {
+			return nil, fmt.Errorf("the checksum algorithm %q is not supported", prefix)
+		}
+	}
+
+	h, err := newHash(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	expected, err := hex.DecodeString(value)
+	if err != nil || len(expected) != h.Size() {
+		expected, err = base64.StdEncoding.DecodeString(value)
+	}
+	if err != nil || len(expected) != h.Size() {
+		return nil, fmt.Errorf("the checksum %q is not a valid %s digest", value, algorithm)
+	}
+	return &checksumVerifier{hash: h, expected: expected}, nil
+}
+
+// verify fails if the bytes hashed so far don't match the expected checksum
+func (v *checksumVerifier) verify() error {
+	if actual := v.hash.Sum(nil); !bytes.Equal(actual, v.expected) {
+		return fmt.Errorf("expected %x, but got %x", v.expected, actual)
+	}
+	return nil
+}
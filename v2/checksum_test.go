@@ -0,0 +1,97 @@
+package toolkit
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"strings"
+	"testing"
+)
+
+var checksumTests = []struct {
+	name          string
+	header        string
+	requestValue  string
+	partValue     string
+	errorExpected error
+	errorContains string
+}{
+	{name: "sha256 hex", header: "X-Content-SHA256", requestValue: "{sha256}"},
+	{name: "md5 base64", header: "Content-MD5", requestValue: "{md5-base64}"},
+	{name: "prefix", header: "X-Checksum", requestValue: "md5:{md5}"},
+	{name: "part header", header: "X-Content-SHA256", partValue: "{sha256}", requestValue: "{corrupt}"},
+	{name: "no checksum sent", header: "X-Content-SHA256"},
+	{name: "corrupted", header: "X-Content-SHA256", requestValue: "{corrupt}", errorExpected: ErrChecksumMismatch, errorContains: "but got {sha256}"},
+	{name: "wrong algorithm", header: "X-Content-SHA256", requestValue: "{md5}", errorContains: "is not a valid sha256 digest"},
+	{name: "unsupported algorithm", header: "X-Checksum", requestValue: "crc32:1234", errorContains: `algorithm "crc32" is not supported`},
+}
+
+func TestTools_VerifyChecksumHeader(t *testing.T) {
+	img, err := os.ReadFile("./testdata/img.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sha := sha256.Sum256(img)
+	md := md5.Sum(img)
+	corrupt := sha256.Sum256(img[1:])
+	digests := strings.NewReplacer(
+		"{sha256}", hex.EncodeToString(sha[:]),
+		"{md5}", hex.EncodeToString(md[:]),
+		"{md5-base64}", base64.StdEncoding.EncodeToString(md[:]),
+		"{corrupt}", hex.EncodeToString(corrupt[:]),
+	)
+
+	for _, e := range checksumTests {
+		fs := &MemoryFS{}
+		testTools := Tools{FS: fs, VerifyChecksumHeader: e.header}
+
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		partHeader := textproto.MIMEHeader{}
+		partHeader.Set("Content-Disposition", `form-data; name="file"; filename="img.png"`)
+		if e.partValue != "" {
+			partHeader.Set(e.header, digests.Replace(e.partValue))
+		}
+		part, err := writer.CreatePart(partHeader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = part.Write(img)
+		_ = writer.Close()
+
+		request := httptest.NewRequest("POST", "/", body)
+		request.Header.Set("Content-Type", writer.FormDataContentType())
+		if e.requestValue != "" {
+			request.Header.Set(e.header, digests.Replace(e.requestValue))
+		}
+
+		_, err = testTools.UploadFiles(request, "uploads", false)
+		if e.errorContains != "" {
+			if err == nil || !strings.Contains(err.Error(), digests.Replace(e.errorContains)) {
+				t.Errorf("%s: expected error containing %q, but got %v", e.name, digests.Replace(e.errorContains), err)
+			}
+			if e.errorExpected != nil && !errors.Is(err, e.errorExpected) {
+				t.Errorf("%s: expected error to match %v, but got %v", e.name, e.errorExpected, err)
+			}
+			if names := fs.FileNames("uploads"); len(names) != 0 {
+				t.Errorf("%s: expected the file to be removed, but found %v", e.name, names)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: error not expected, but one received: %s", e.name, err)
+			continue
+		}
+		if names := fs.FileNames("uploads"); fmt.Sprint(names) != "[img.png]" {
+			t.Errorf("%s: expected img.png to be saved, but found %v", e.name, names)
+		}
+	}
+}
@@ -0,0 +1,321 @@
+package toolkit
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ChunkedUploadMeta describes a file uploaded in chunks, which may be sent in any order and retried
+type ChunkedUploadMeta struct {
+	// FileName is the original name of the file
+	FileName string `json:"file_name"`
+	// TotalSize is the size of the complete file, in bytes
+	TotalSize int64 `json:"total_size"`
+	// Checksum is the hex encoded hash of the complete file, computed with the algorithm set in
+	// Tools.HashUploads, or sha256 when that is empty. It is only verified when set
+	Checksum string `json:"checksum,omitempty"`
+	// UploadDir is the upload directory the file is saved in once it is complete
+	UploadDir string `json:"upload_dir"`
+}
+
+// partialDirName is the directory, under ChunkedUploadDir, the chunks of unfinished uploads are kept in
+const partialDirName = ".partial"
+
+// ErrUnknownUpload is returned for an upload ID that was never started, or was completed, aborted or swept
+var ErrUnknownUpload = errors.New("unknown chunked upload")
+
+// StartChunkedUpload starts a chunked upload of the file described by meta, and returns the ID its chunks are
+// sent with. The chunks are kept in a .partial directory under ChunkedUploadDir until the upload completes.
+func (t *Tools) StartChunkedUpload(meta ChunkedUploadMeta) (string, error) {
+	if meta.TotalSize < 0 {
+		return "", errors.New("the total size of a chunked upload cannot be negative")
+	}
+	if meta.TotalSize > t.maxUploadSize() {
+		return "", ErrRequestTooLarge
+	}
+	if _, err := sanitizeFileName(meta.FileName); err != nil {
+		return "", err
+	}
+	if meta.Checksum != "" {
+		if _, err := newHash(t.hashAlgorithm()); err != nil {
+			return "", err
+		}
+	}
+
+	// The chunks are always kept on the local disk, whatever FS is
+	if err := os.MkdirAll(t.partialDir(), 0700); err != nil {
+		return "", err
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	uploadID := hex.EncodeToString(b)
+
+	metaJSON, err := json.Marshal(meta)
+	if err != nil {
+		return "", err
+	}
+	base := t.partialPath(uploadID)
+	if err := os.WriteFile(base+".json", metaJSON, 0600); err != nil {
+		return "", err
+	}
+	f, err := os.OpenFile(base+".data", os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		_ = os.Remove(base + ".json")
+		return "", err
+	}
+	_ = f.Close()
+
+	return uploadID, nil
+}
+
+// AppendChunk writes everything read from r at offset in the file of the chunked upload uploadID. Chunks may
+// be sent in any order, and a chunk may be sent again, for instance after a connection was lost.
+func (t *Tools) AppendChunk(uploadID string, offset int64, r io.Reader) error {
+	meta, err := t.chunkedUploadMeta(uploadID)
+	if err != nil {
+		return err
+	}
+	if offset < 0 || offset > meta.TotalSize {
+		return fmt.Errorf("the chunk offset %d is outside of the file, which is %d bytes", offset, meta.TotalSize)
+	}
+
+	base := t.partialPath(uploadID)
+
+	// The chunk is staged in a file of its own, so one going past the declared size of the file is rejected
+	// before any of it is written, leaving what was received at its offset already as it was
+	staged, err := os.CreateTemp(filepath.Dir(base), filepath.Base(base)+".chunk-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = staged.Close()
+		_ = os.Remove(staged.Name())
+	}()
+	n, err := io.Copy(staged, io.LimitReader(r, meta.TotalSize-offset+1))
+	if err != nil {
+		return err
+	}
+	if offset+n > meta.TotalSize {
+		return fmt.Errorf("the chunk at offset %d goes past the end of the file, which is %d bytes", offset, meta.TotalSize)
+	}
+	if _, err := staged.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(base+".data", os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := io.Copy(io.NewOffsetWriter(f, offset), staged); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	// Record the range received, so CompleteChunkedUpload can tell whether any is missing. Small appends to
+	// a file opened with O_APPEND don't interleave, so chunks can be sent concurrently
+	ranges, err := os.OpenFile(base+".ranges", os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(ranges, "%d %d\n", offset, offset+n); err != nil {
+		_ = ranges.Close()
+		return err
+	}
+	return ranges.Close()
+}
+
+// CompleteChunkedUpload checks that every byte of the chunked upload uploadID was received, and that the file
+// matches the declared checksum, and saves it to its upload directory, with the same checks and options as
+// UploadFiles. The partial upload is removed, unless a chunk is missing, so it can still be sent. The file is
+// renamed unless rename is false.
+func (t *Tools) CompleteChunkedUpload(uploadID string, rename ...bool) (*UploadedFile, error) {
+	renameFile := true
+	if len(rename) > 0 {
+		renameFile = rename[0]
+	}
+
+	meta, err := t.chunkedUploadMeta(uploadID)
+	if err != nil {
+		return nil, err
+	}
+	base := t.partialPath(uploadID)
+	if missing, err := missingChunk(base+".ranges", meta.TotalSize); err != nil {
+		return nil, err
+	} else if missing >= 0 {
+		return nil, fmt.Errorf("the chunked upload is incomplete: no data was received at offset %d", missing)
+	}
+
+	// Anything going wrong past this point would happen again, so the partial upload is removed
+	defer func() { _ = t.AbortChunkedUpload(uploadID) }()
+
+	f, err := os.Open(base + ".data")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if meta.Checksum != "" {
+		hasher, err := newHash(t.hashAlgorithm())
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.Copy(hasher, f); err != nil {
+			return nil, err
+		}
+		if checksum := hex.EncodeToString(hasher.Sum(nil)); !strings.EqualFold(checksum, meta.Checksum) {
+			return nil, fmt.Errorf("the checksum of the chunked upload is %s, but %s was expected", checksum, meta.Checksum)
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := t.prepareUploadDir(meta.UploadDir); err != nil {
+		return nil, err
+	}
+
+	return t.uploadPart(context.Background(), partInfo{fileName: meta.FileName}, io.LimitReader(f, meta.TotalSize), meta.UploadDir, renameFile, t.maxUploadSize())
+}
+
+// AbortChunkedUpload removes the chunks received for the chunked upload uploadID
+func (t *Tools) AbortChunkedUpload(uploadID string) error {
+	if !validUploadID(uploadID) {
+		return ErrUnknownUpload
+	}
+	base := t.partialPath(uploadID)
+	err := os.Remove(base + ".json")
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrUnknownUpload
+	}
+	_ = os.Remove(base + ".data")
+	_ = os.Remove(base + ".ranges")
+	return err
+}
+
+// SweepChunkedUploads aborts the chunked uploads that have not received a chunk for longer than maxAge, and
+// returns how many were removed. It is meant to be run periodically, to clean up abandoned uploads.
+func (t *Tools) SweepChunkedUploads(maxAge time.Duration) (int, error) {
+	entries, err := os.ReadDir(t.partialDir())
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	swept := 0
+	for _, entry := range entries {
+		uploadID, found := strings.CutSuffix(entry.Name(), ".data")
+		if !found || !validUploadID(uploadID) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if time.Since(info.ModTime()) > maxAge && t.AbortChunkedUpload(uploadID) == nil {
+			swept++
+		}
+	}
+	return swept, nil
+}
+
+// partialDir returns the directory the chunks of unfinished uploads are kept in
+func (t *Tools) partialDir() string {
+	dir := t.ChunkedUploadDir
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, partialDirName)
+}
+
+// partialPath returns the path, without extension, of the files kept for the chunked upload uploadID
+func (t *Tools) partialPath(uploadID string) string {
+	return filepath.Join(t.partialDir(), uploadID)
+}
+
+// chunkedUploadMeta returns the description of the chunked upload uploadID
+func (t *Tools) chunkedUploadMeta(uploadID string) (*ChunkedUploadMeta, error) {
+	if !validUploadID(uploadID) {
+		return nil, ErrUnknownUpload
+	}
+	data, err := os.ReadFile(t.partialPath(uploadID) + ".json")
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrUnknownUpload
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var meta ChunkedUploadMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, err
+	}
+	return &meta, nil
+}
+
+// validUploadID reports whether uploadID could have been returned by StartChunkedUpload, so it is safe to use
+// in a path
+func validUploadID(uploadID string) bool {
+	b, err := hex.DecodeString(uploadID)
+	return err == nil && len(b) == 16 && uploadID == strings.ToLower(uploadID)
+}
+
+// missingChunk reads the ranges recorded in rangesPath, and returns the first offset below totalSize that none
+// of them covers, or -1 when the whole file was received
+func missingChunk(rangesPath string, totalSize int64) (int64, error) {
+	f, err := os.Open(rangesPath)
+	if errors.Is(err, os.ErrNotExist) {
+		if totalSize == 0 {
+			return -1, nil
+		}
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var ranges [][2]int64
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var start, end int64
+		if _, err := fmt.Sscanf(scanner.Text(), "%d %d", &start, &end); err != nil {
+			return 0, err
+		}
+		ranges = append(ranges, [2]int64{start, end})
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i][0] < ranges[j][0] })
+	covered := int64(0)
+	for _, r := range ranges {
+		if r[0] > covered {
+			break
+		}
+		covered = max(covered, r[1])
+	}
+	if covered < totalSize {
+		return covered, nil
+	}
+	return -1, nil
+}
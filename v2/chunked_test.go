@@ -0,0 +1,172 @@
+package toolkit
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTools_ChunkedUpload(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 100)
+	sum := sha256.Sum256(content)
+	uploadDir := t.TempDir()
+	testTools := Tools{ChunkedUploadDir: t.TempDir()}
+
+	uploadID, err := testTools.StartChunkedUpload(ChunkedUploadMeta{
+		FileName:  "numbers.txt",
+		TotalSize: int64(len(content)),
+		Checksum:  hex.EncodeToString(sum[:]),
+		UploadDir: uploadDir,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Send the chunks out of order, with one of them sent twice
+	for _, offset := range []int{600, 0, 300, 900, 300} {
+		if err := testTools.AppendChunk(uploadID, int64(offset), bytes.NewReader(content[offset:min(offset+300, len(content))])); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	uploadedFile, err := testTools.CompleteChunkedUpload(uploadID, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(uploadedFile.SavedPath); !bytes.Equal(data, content) {
+		t.Error("assembled file differs from the original")
+	}
+	if uploadedFile.FileSize != int64(len(content)) || uploadedFile.NewFileName != "numbers.txt" {
+		t.Errorf("wrong size %d or name %s", uploadedFile.FileSize, uploadedFile.NewFileName)
+	}
+
+	// The partial upload is gone
+	if entries, _ := os.ReadDir(testTools.partialDir()); len(entries) != 0 {
+		t.Errorf("expected no partial uploads left, but found %d files", len(entries))
+	}
+	if _, err := testTools.CompleteChunkedUpload(uploadID); !errors.Is(err, ErrUnknownUpload) {
+		t.Errorf("expected ErrUnknownUpload, but got %v", err)
+	}
+}
+
+var chunkedErrorTests = []struct {
+	name          string
+	checksum      string
+	chunks        map[int64]string
+	expectedError string
+}{
+	{name: "missing chunk", chunks: map[int64]string{0: "some", 5: "notes"}, expectedError: "no data was received at offset 4"},
+	{name: "wrong checksum", checksum: strings.Repeat("0", 64), chunks: map[int64]string{0: "some notes"}, expectedError: "but " + strings.Repeat("0", 64) + " was expected"},
+	{name: "past the end", chunks: map[int64]string{5: "notes and more"}, expectedError: "goes past the end of the file"},
+	{name: "bad offset", chunks: map[int64]string{-1: "x"}, expectedError: "outside of the file"},
+}
+
+func TestTools_ChunkedUpload_Errors(t *testing.T) {
+	for _, e := range chunkedErrorTests {
+		testTools := Tools{ChunkedUploadDir: t.TempDir()}
+		uploadID, err := testTools.StartChunkedUpload(ChunkedUploadMeta{FileName: "notes.txt", TotalSize: 10, Checksum: e.checksum, UploadDir: t.TempDir()})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for offset, chunk := range e.chunks {
+			err = testTools.AppendChunk(uploadID, offset, strings.NewReader(chunk))
+			if err != nil {
+				break
+			}
+		}
+		if err == nil {
+			_, err = testTools.CompleteChunkedUpload(uploadID)
+		}
+		if err == nil || !strings.Contains(err.Error(), e.expectedError) {
+			t.Errorf("%s: expected error containing %q, but got %v", e.name, e.expectedError, err)
+		}
+	}
+
+	// Upload IDs are never used as paths unless they are valid
+	var testTools Tools
+	if err := testTools.AppendChunk("../../etc/passwd", 0, strings.NewReader("x")); !errors.Is(err, ErrUnknownUpload) {
+		t.Errorf("expected ErrUnknownUpload, but got %v", err)
+	}
+
+	// The declared size is checked against MaxFileSize up front
+	testTools = Tools{MaxFileSize: 10, ChunkedUploadDir: t.TempDir()}
+	if _, err := testTools.StartChunkedUpload(ChunkedUploadMeta{FileName: "big.bin", TotalSize: 11}); !errors.Is(err, ErrRequestTooLarge) {
+		t.Errorf("expected ErrRequestTooLarge, but got %v", err)
+	}
+}
+
+func TestTools_ChunkedUpload_OverlongChunk(t *testing.T) {
+	testTools := Tools{ChunkedUploadDir: t.TempDir()}
+	uploadID, err := testTools.StartChunkedUpload(ChunkedUploadMeta{FileName: "notes.txt", TotalSize: 10, UploadDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := testTools.AppendChunk(uploadID, 0, strings.NewReader("some ")); err != nil {
+		t.Fatal(err)
+	}
+	if err := testTools.AppendChunk(uploadID, 5, strings.NewReader("notes")); err != nil {
+		t.Fatal(err)
+	}
+
+	// An overlong chunk sent again at the same offset is rejected without touching what was received
+	if err := testTools.AppendChunk(uploadID, 5, strings.NewReader("NOTES and more")); err == nil || !strings.Contains(err.Error(), "goes past the end of the file") {
+		t.Fatalf("expected the chunk to be rejected, but got %v", err)
+	}
+	base := testTools.partialPath(uploadID)
+	if data, _ := os.ReadFile(base + ".data"); string(data) != "some notes" {
+		t.Errorf("expected the file to be left as it was, but got %q", data)
+	}
+	if entries, _ := os.ReadDir(testTools.partialDir()); len(entries) != 3 {
+		t.Errorf("expected the staged chunk to be removed, but found %d files", len(entries))
+	}
+
+	uploadedFile, err := testTools.CompleteChunkedUpload(uploadID, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(uploadedFile.SavedPath); string(data) != "some notes" {
+		t.Errorf("expected the valid chunks, but got %q", data)
+	}
+}
+
+func TestTools_ChunkedUpload_AbortAndSweep(t *testing.T) {
+	testTools := Tools{ChunkedUploadDir: t.TempDir()}
+	meta := ChunkedUploadMeta{FileName: "notes.txt", TotalSize: 10, UploadDir: t.TempDir()}
+
+	aborted, _ := testTools.StartChunkedUpload(meta)
+	if err := testTools.AbortChunkedUpload(aborted); err != nil {
+		t.Error(err)
+	}
+	if err := testTools.AppendChunk(aborted, 0, strings.NewReader("some notes")); !errors.Is(err, ErrUnknownUpload) {
+		t.Errorf("expected ErrUnknownUpload after abort, but got %v", err)
+	}
+
+	// Only the uploads that have not received a chunk for a while are swept
+	abandoned, _ := testTools.StartChunkedUpload(meta)
+	active, _ := testTools.StartChunkedUpload(meta)
+	past := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(filepath.Join(testTools.partialDir(), abandoned+".data"), past, past); err != nil {
+		t.Fatal(err)
+	}
+
+	swept, err := testTools.SweepChunkedUploads(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if swept != 1 {
+		t.Errorf("expected 1 upload swept, but got %d", swept)
+	}
+	if _, err := testTools.chunkedUploadMeta(abandoned); !errors.Is(err, ErrUnknownUpload) {
+		t.Error("expected the abandoned upload to be swept")
+	}
+	if _, err := testTools.chunkedUploadMeta(active); err != nil {
+		t.Errorf("expected the active upload to be kept, but got %v", err)
+	}
+}
@@ -0,0 +1,92 @@
+package toolkit
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// defaultRemoteTimeout is how long calls to remote services may take when RemoteTimeout is not set
+const defaultRemoteTimeout = 30 * time.Second
+
+// RemoteClientOption configures the client NewRemoteClient returns
+type RemoteClientOption func(*remoteClientOptions)
+
+// remoteClientOptions are the settings of NewRemoteClient, as the RemoteClientOptions passed to it set them
+type remoteClientOptions struct {
+	timeout             time.Duration
+	tlsConfig           *tls.Config
+	proxy               func(*http.Request) (*url.URL, error)
+	maxIdleConnsPerHost int
+}
+
+// WithClientTimeout limits how long a call may take, including reading the body of its response, rather than
+// the default of 30s. A negative timeout removes the limit
+func WithClientTimeout(timeout time.Duration) RemoteClientOption {
+	return func(o *remoteClientOptions) {
+		o.timeout = timeout
+	}
+}
+
+// WithTLSConfig makes the client use config for TLS connections, such as to trust a private CA, or send a
+// client certificate
+func WithTLSConfig(config *tls.Config) RemoteClientOption {
+	return func(o *remoteClientOptions) {
+		o.tlsConfig = config
+	}
+}
+
+// WithProxy makes the client send its requests through the proxy proxy returns for them, as
+// http.ProxyURL(u) does, rather than the one of the HTTP_PROXY and HTTPS_PROXY environment variables
+func WithProxy(proxy func(*http.Request) (*url.URL, error)) RemoteClientOption {
+	return func(o *remoteClientOptions) {
+		o.proxy = proxy
+	}
+}
+
+// WithMaxIdleConnsPerHost keeps up to n idle connections to each host for reuse, rather than 2, for clients
+// making many concurrent calls to the same service
+func WithMaxIdleConnsPerHost(n int) RemoteClientOption {
+	return func(o *remoteClientOptions) {
+		o.maxIdleConnsPerHost = n
+	}
+}
+
+// NewRemoteClient returns a client for calling remote services, whose calls time out after 30s unless the
+// WithClientTimeout option is passed. Without the options changing its transport, it uses
+// http.DefaultTransport, and so shares its connections with the other clients that do
+func NewRemoteClient(opts ...RemoteClientOption) *http.Client {
+	options := remoteClientOptions{timeout: defaultRemoteTimeout}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	client := &http.Client{}
+	if options.timeout > 0 {
+		client.Timeout = options.timeout
+	}
+	if options.tlsConfig != nil || options.proxy != nil || options.maxIdleConnsPerHost > 0 {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		if options.tlsConfig != nil {
+			transport.TLSClientConfig = options.tlsConfig
+		}
+		if options.proxy != nil {
+			transport.Proxy = options.proxy
+		}
+		if options.maxIdleConnsPerHost > 0 {
+			transport.MaxIdleConnsPerHost = options.maxIdleConnsPerHost
+		}
+		client.Transport = transport
+	}
+	return client
+}
+
+// remoteClient returns the client calls to remote services are made with when none is passed, which times
+// out after RemoteTimeout
+func (t *Tools) remoteClient() *http.Client {
+	if t.RemoteTimeout == 0 {
+		return NewRemoteClient()
+	}
+	return NewRemoteClient(WithClientTimeout(t.RemoteTimeout))
+}
@@ -0,0 +1,76 @@
+package toolkit
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestNewRemoteClient(t *testing.T) {
+	client := NewRemoteClient()
+	if client.Timeout != 30*time.Second || client.Transport != nil {
+		t.Errorf("expected a 30s timeout and the default transport, but got %v, %T", client.Timeout, client.Transport)
+	}
+	if client = NewRemoteClient(WithClientTimeout(-1)); client.Timeout != 0 {
+		t.Errorf("expected no timeout, but got %v", client.Timeout)
+	}
+
+	proxy := http.ProxyURL(&url.URL{Scheme: "http", Host: "proxy.example.com:3128"})
+	config := &tls.Config{ServerName: "example.com"}
+	client = NewRemoteClient(WithClientTimeout(time.Second), WithTLSConfig(config), WithProxy(proxy), WithMaxIdleConnsPerHost(32))
+	transport, ok := client.Transport.(*http.Transport)
+	if !ok || client.Timeout != time.Second {
+		t.Fatalf("expected a transport of its own and a 1s timeout, but got %T, %v", client.Transport, client.Timeout)
+	}
+	if transport.TLSClientConfig != config || transport.MaxIdleConnsPerHost != 32 || transport == http.DefaultTransport {
+		t.Errorf("expected the transport to be configured, but got %+v", transport)
+	}
+	request, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+	if u, err := transport.Proxy(request); err != nil || u.Host != "proxy.example.com:3128" {
+		t.Errorf("expected the proxy to be used, but got %v, %v", u, err)
+	}
+}
+
+func TestNewRemoteClient_Timeout(t *testing.T) {
+	client := NewRemoteClient(WithClientTimeout(20 * time.Millisecond))
+	client.Transport = transportFunc(func(request *http.Request) (*http.Response, error) {
+		// A transport that never answers, unless the request is canceled
+		<-request.Context().Done()
+		return nil, request.Context().Err()
+	})
+
+	var testTools Tools
+	started := time.Now()
+	_, _, err := testTools.PushJSONToRemote("http://example.com", "data", client)
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() || time.Since(started) > 500*time.Millisecond {
+		t.Errorf("expected the call to time out, but got %v after %v", err, time.Since(started))
+	}
+}
+
+func TestTools_RemoteTimeout(t *testing.T) {
+	stalled := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		select {
+		case <-stalled:
+		case <-request.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(stalled)
+
+	// The default client is used, as no client is passed
+	testTools := Tools{RemoteTimeout: 50 * time.Millisecond}
+	started := time.Now()
+	_, err := testTools.CallRemote(context.Background(), http.MethodGet, server.URL, nil)
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() || time.Since(started) > 2*time.Second {
+		t.Errorf("expected the call to time out, but got %v after %v", err, time.Since(started))
+	}
+}
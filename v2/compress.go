@@ -0,0 +1,65 @@
+package toolkit
+
+import (
+	"compress/gzip"
+	"io"
+	"strings"
+)
+
+// compressibleTypes are the media types, besides text/*, that CompressUploads compresses
+var compressibleTypes = map[string]bool{
+	"application/json":       true,
+	"application/xml":        true,
+	"application/javascript": true,
+	"application/x-ndjson":   true,
+	"image/svg+xml":          true,
+	"image/bmp":              true,
+	"image/x-icon":           true,
+	"application/wasm":       true,
+	"application/postscript": true,
+}
+
+// compressible reports whether files of fileType are worth compressing. Most binary formats, such as images,
+// archives and video, are compressed already
+func compressible(fileType string) bool {
+	mediaType := mediaType(fileType)
+	return strings.HasPrefix(mediaType, "text/") || compressibleTypes[mediaType]
+}
+
+// gzipReader is an io.Reader yielding the gzip compressed contents of another reader, which are compressed in
+// the background as they are read
+type gzipReader struct {
+	pr   *io.PipeReader
+	done chan struct{}
+	n    int64
+}
+
+// newGzipReader starts compressing r
+func newGzipReader(r io.Reader) *gzipReader {
+	pr, pw := io.Pipe()
+	g := &gzipReader{pr: pr, done: make(chan struct{})}
+	go func() {
+		defer close(g.done)
+		gz := gzip.NewWriter(pw)
+		n, err := io.Copy(gz, r)
+		if err == nil {
+			err = gz.Close()
+		}
+		g.n = n
+		_ = pw.CloseWithError(err)
+	}()
+	return g
+}
+
+// Read reads the compressed contents
+func (g *gzipReader) Read(p []byte) (int, error) {
+	return g.pr.Read(p)
+}
+
+// finish stops the compression, if the compressed contents were not read to the end, and returns the number
+// of bytes read from the uncompressed reader
+func (g *gzipReader) finish() int64 {
+	_ = g.pr.Close()
+	<-g.done
+	return g.n
+}
@@ -0,0 +1,73 @@
+package toolkit
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+var compressTests = []struct {
+	name       string
+	file       testFile
+	compressed bool
+}{
+	{name: "csv", file: testFile{name: "data.csv", content: []byte(strings.Repeat("id,name,email\n1,Jane,jane@example.com\n", 200))}, compressed: true},
+	{name: "html", file: testFile{name: "page.html", content: []byte("<!DOCTYPE html><html><body>" + strings.Repeat("<p>hello</p>", 100) + "</body></html>")}, compressed: true},
+	{name: "png", file: testFile{name: "img.png", content: pngHeader}, compressed: false},
+}
+
+func TestTools_UploadFiles_CompressUploads(t *testing.T) {
+	for _, e := range compressTests {
+		testTools := Tools{CompressUploads: true}
+
+		uploadedFiles, err := testTools.UploadFiles(newUploadRequest(t, e.file), t.TempDir(), false)
+		if err != nil {
+			t.Errorf("%s: %s", e.name, err)
+			continue
+		}
+		uploadedFile := uploadedFiles[0]
+		if uploadedFile.FileSize != int64(len(e.file.content)) {
+			t.Errorf("%s: expected the original size %d, but got %d", e.name, len(e.file.content), uploadedFile.FileSize)
+		}
+
+		data, err := os.ReadFile(uploadedFile.SavedPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if int64(len(data)) != uploadedFile.StoredSize {
+			t.Errorf("%s: expected a stored size of %d, but got %d", e.name, len(data), uploadedFile.StoredSize)
+		}
+
+		if !e.compressed {
+			if uploadedFile.NewFileName != e.file.name || !bytes.Equal(data, e.file.content) {
+				t.Errorf("%s: expected the file to be saved as it is", e.name)
+			}
+			continue
+		}
+
+		if uploadedFile.NewFileName != e.file.name+".gz" {
+			t.Errorf("%s: expected the name %s.gz, but got %s", e.name, e.file.name, uploadedFile.NewFileName)
+		}
+		if uploadedFile.StoredSize >= uploadedFile.FileSize {
+			t.Errorf("%s: expected the stored file to be smaller, but it is %d bytes", e.name, uploadedFile.StoredSize)
+		}
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			t.Errorf("%s: not a valid gzip file: %s", e.name, err)
+			continue
+		}
+		if decompressed, err := io.ReadAll(gz); err != nil || !bytes.Equal(decompressed, e.file.content) {
+			t.Errorf("%s: decompressed file differs from the upload", e.name)
+		}
+	}
+
+	// The size limit applies to the uncompressed file
+	testTools := Tools{CompressUploads: true, MaxSingleFileSize: 100}
+	request := newUploadRequest(t, testFile{name: "big.txt", content: []byte(strings.Repeat("x", 101))})
+	if _, err := testTools.UploadFiles(request, t.TempDir()); err == nil {
+		t.Error("expected an error for a file over the size limit")
+	}
+}
@@ -0,0 +1,121 @@
+package toolkit
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// WriteCSV writes rows as a CSV file download named filename. rows is either a [][]string, written as it is,
+// or a slice of structs, or pointers to structs, written after a header row. The columns of a struct are its
+// exported fields, named by their csv tag, such as `csv:"Full name"`, or else by the field name, and a csv tag
+// of "-" skips a field. Values are formatted with their String method when they have one, or else with
+// fmt.Sprint. The rows are streamed to the client as they are encoded, so an error can only be returned, not
+// sent, once writing has started.
+func (t *Tools) WriteCSV(writer http.ResponseWriter, filename string, rows any) error {
+	v := reflect.ValueOf(rows)
+	if rows != nil && v.Kind() != reflect.Slice {
+		return fmt.Errorf("cannot write %T as CSV: a slice is expected", rows)
+	}
+
+	var columns []int
+	var header []string
+	records, isRecords := rows.([][]string)
+	if rows != nil && !isRecords {
+		elem := v.Type().Elem()
+		if elem.Kind() == reflect.Pointer {
+			elem = elem.Elem()
+		}
+		if elem.Kind() != reflect.Struct {
+			return fmt.Errorf("cannot write %T as CSV: a [][]string or a slice of structs is expected", rows)
+		}
+		columns, header = csvColumns(elem)
+	}
+
+	writer.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	writer.Header().Set("Content-Disposition", attachmentDisposition(filename))
+	writer.WriteHeader(http.StatusOK)
+
+	w := csv.NewWriter(writer)
+	if isRecords {
+		for _, record := range records {
+			if err := w.Write(record); err != nil {
+				return err
+			}
+		}
+	} else if rows != nil {
+		if err := w.Write(header); err != nil {
+			return err
+		}
+		record := make([]string, len(columns))
+		for i := 0; i < v.Len(); i++ {
+			row := v.Index(i)
+			if row.Kind() == reflect.Pointer {
+				if row.IsNil() {
+					continue
+				}
+				row = row.Elem()
+			}
+			for j, column := range columns {
+				record[j] = csvValue(row.Field(column))
+			}
+			if err := w.Write(record); err != nil {
+				return err
+			}
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// csvColumns returns the indexes and names of the fields of the struct type typ written as columns by WriteCSV
+func csvColumns(typ reflect.Type) ([]int, []string) {
+	var columns []int
+	var names []string
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := field.Tag.Get("csv")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		columns = append(columns, i)
+		names = append(names, name)
+	}
+	return columns, names
+}
+
+// csvValue formats value for WriteCSV
+func csvValue(value reflect.Value) string {
+	if value.Kind() == reflect.Pointer && value.IsNil() {
+		return ""
+	}
+	if stringer, ok := value.Interface().(fmt.Stringer); ok {
+		return stringer.String()
+	}
+	if value.Kind() == reflect.Pointer {
+		value = value.Elem()
+	}
+	return fmt.Sprint(value.Interface())
+}
+
+// attachmentDisposition returns the Content-Disposition header making a browser download a response as a file
+// named displayName. Quotes and backslashes are escaped, and control characters dropped, so the name cannot
+// break out of the header
+func attachmentDisposition(displayName string) string {
+	displayName = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, displayName)
+	displayName = strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(displayName)
+	return fmt.Sprintf("attachment; filename=\"%s\"", displayName)
+}
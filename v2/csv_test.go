@@ -0,0 +1,107 @@
+package toolkit
+
+import (
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// csvUser is a row of the CSV tests
+type csvUser struct {
+	Name    string    `csv:"Full name"`
+	Age     int       `csv:"age"`
+	Joined  time.Time `csv:"joined"`
+	Note    *string
+	Secret  string `csv:"-"`
+	private string
+}
+
+var writeCSVTests = []struct {
+	name          string
+	rows          any
+	errorExpected bool
+	expected      [][]string
+}{
+	{name: "records", rows: [][]string{{"a", "b"}, {"1, 2", `say "hi"`}, {"multi\nline", ""}}, expected: [][]string{{"a", "b"}, {"1, 2", `say "hi"`}, {"multi\nline", ""}}},
+	{name: "nil records", rows: [][]string(nil), expected: nil},
+	{name: "nil", rows: nil, expected: nil},
+	{name: "structs", rows: []csvUser{{Name: "Ann, Jr.", Age: 30, Joined: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), Secret: "x", private: "y"}}, expected: [][]string{{"Full name", "age", "joined", "Note"}, {"Ann, Jr.", "30", "2024-01-02 00:00:00 +0000 UTC", ""}}},
+	{name: "pointers to structs", rows: []*csvUser{{Name: "Bob", Note: new(string)}, nil}, expected: [][]string{{"Full name", "age", "joined", "Note"}, {"Bob", "0", "0001-01-01 00:00:00 +0000 UTC", ""}}},
+	{name: "nil structs", rows: []csvUser(nil), expected: [][]string{{"Full name", "age", "joined", "Note"}}},
+	{name: "not a slice", rows: csvUser{}, errorExpected: true},
+	{name: "slice of strings", rows: []string{"a"}, errorExpected: true},
+}
+
+func TestTools_WriteCSV(t *testing.T) {
+	var testTools Tools
+	for _, e := range writeCSVTests {
+		rr := httptest.NewRecorder()
+		err := testTools.WriteCSV(rr, "export.csv", e.rows)
+
+		if e.errorExpected {
+			if err == nil || rr.Body.Len() > 0 || rr.Header().Get("Content-Disposition") != "" {
+				t.Errorf("%s: expected an error and nothing written, but got %v", e.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: error not expected, but one received: %s", e.name, err.Error())
+		}
+		if !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/csv") || rr.Header().Get("Content-Disposition") != `attachment; filename="export.csv"` {
+			t.Errorf("%s: wrong headers %v", e.name, rr.Header())
+		}
+
+		records, err := csv.NewReader(rr.Body).ReadAll()
+		if err != nil {
+			t.Errorf("%s: the output cannot be parsed: %v", e.name, err)
+		}
+		if len(records) != len(e.expected) || (len(records) > 0 && !reflect.DeepEqual(records, e.expected)) {
+			t.Errorf("%s: expected %q, but got %q", e.name, e.expected, records)
+		}
+	}
+}
+
+// countingResponseWriter records the size of the largest write, and the number of writes
+type countingResponseWriter struct {
+	header  http.Header
+	writes  int
+	largest int
+	total   int
+}
+
+func (w *countingResponseWriter) Header() http.Header { return w.header }
+func (w *countingResponseWriter) WriteHeader(int)     {}
+func (w *countingResponseWriter) Write(p []byte) (int, error) {
+	w.writes++
+	w.total += len(p)
+	w.largest = max(w.largest, len(p))
+	return len(p), nil
+}
+
+func TestTools_WriteCSV_Streams(t *testing.T) {
+	var testTools Tools
+	rows := make([]csvUser, 100000)
+	for i := range rows {
+		rows[i].Name = "user " + strconv.Itoa(i)
+	}
+
+	w := &countingResponseWriter{header: make(http.Header)}
+	if err := testTools.WriteCSV(w, "users.csv", rows); err != nil {
+		t.Fatal(err)
+	}
+	if w.writes < 100 || w.largest > 64*1024 || w.total < 1000000 {
+		t.Errorf("expected the rows to be streamed in small writes, but got %d writes of up to %d bytes, %d in total", w.writes, w.largest, w.total)
+	}
+}
+
+func TestAttachmentDisposition(t *testing.T) {
+	got := attachmentDisposition("my \"report\"\r\nSet-Cookie: a\\b.csv")
+	if got != `attachment; filename="my \"report\"Set-Cookie: a\\b.csv"` {
+		t.Errorf("wrong disposition %s", got)
+	}
+}
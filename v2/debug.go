@@ -0,0 +1,56 @@
+package toolkit
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+// maxDebugFrames is the most stack frames ErrorJSON sends in Debug mode
+const maxDebugFrames = 32
+
+// debugInfo is the Data ErrorJSON sends in Debug mode
+type debugInfo struct {
+	// Message is the message of the error, when the one sent was translated by ErrorJSONLocalized
+	Message string `json:"message,omitempty"`
+	// Stack are the frames of the caller of ErrorJSON, as "function (file:line)"
+	Stack []string `json:"stack"`
+	// Causes are the messages of the errors err wraps, outermost first
+	Causes []string `json:"causes,omitempty"`
+}
+
+// newDebugInfo returns the stack of the caller, without the frames of the toolkit, and the causes of err
+func newDebugInfo(err error) debugInfo {
+	var info debugInfo
+
+	pcs := make([]uintptr, 64)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(1, pcs)])
+	for {
+		frame, more := frames.Next()
+		if !toolkitFrame(frame) && len(info.Stack) < maxDebugFrames {
+			info.Stack = append(info.Stack, fmt.Sprintf("%s (%s:%d)", frame.Function, frame.File, frame.Line))
+		}
+		if !more {
+			break
+		}
+	}
+
+	if localized, ok := err.(*localizedError); ok {
+		info.Message = localized.err.Error()
+		err = localized.err
+	}
+	for cause := errors.Unwrap(err); cause != nil; cause = errors.Unwrap(cause) {
+		info.Causes = append(info.Causes, cause.Error())
+	}
+	return info
+}
+
+// toolkitPackage is the prefix of the names of the functions of this package
+var toolkitPackage = reflect.TypeOf(Tools{}).PkgPath() + "."
+
+// toolkitFrame reports whether frame is in a function of this package, other than its tests
+func toolkitFrame(frame runtime.Frame) bool {
+	return strings.HasPrefix(frame.Function, toolkitPackage) && !strings.HasSuffix(frame.File, "_test.go")
+}
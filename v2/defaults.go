@@ -0,0 +1,205 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInvalidDefault is returned by ReadJSON when the default tag of a field of the struct it decodes into
+// cannot be converted to the type of the field, which is a mistake of the program rather than of the client
+type ErrInvalidDefault struct {
+	// Field is the name of the field, as in Go
+	Field string
+	// Err is the reason
+	Err error
+}
+
+func (e *ErrInvalidDefault) Error() string {
+	return fmt.Sprintf("invalid default for field %s: %v", e.Field, e.Err)
+}
+
+func (e *ErrInvalidDefault) Unwrap() error { return e.Err }
+
+// durationType is the type of time.Duration, whose defaults are parsed by time.ParseDuration, as in "30s"
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// jsonDefault is a field of a struct with a default tag, or with fields that have one
+type jsonDefault struct {
+	// index is the index of the field, through the structs embedded on the way
+	index []int
+	// name is the key of the field
+	name string
+	// value is the default, of the type of the field, or of the type it points to. It is not valid when the
+	// field only has nested defaults
+	value reflect.Value
+	// nested are the defaults of the fields of the field, when it is a struct or a pointer to one
+	nested []jsonDefault
+	// recursive is the type of the field, when it is a struct containing it, whose defaults are looked up
+	// once it is decoded
+	recursive reflect.Type
+}
+
+// jsonDefaultsCache holds the jsonDefaults of each struct type ReadJSON decoded into, keyed by reflect.Type
+var jsonDefaultsCache sync.Map
+
+// jsonDefaults are the defaults of a struct type, or the error of one of its default tags
+type jsonDefaults struct {
+	fields []jsonDefault
+	err    error
+}
+
+// defaultsOf returns the jsonDefaults of the struct type typ, computing them once per type
+func defaultsOf(typ reflect.Type) *jsonDefaults {
+	if defaults, ok := jsonDefaultsCache.Load(typ); ok {
+		return defaults.(*jsonDefaults)
+	}
+	fields, err := collectJSONDefaults(typ, nil, map[reflect.Type]bool{typ: true})
+	cached, _ := jsonDefaultsCache.LoadOrStore(typ, &jsonDefaults{fields: fields, err: err})
+	return cached.(*jsonDefaults)
+}
+
+// structDefaults returns the defaults of the struct data points to, if it does
+func structDefaults(data any) ([]jsonDefault, error) {
+	typ := reflect.TypeOf(data)
+	for typ != nil && typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	if typ == nil || typ.Kind() != reflect.Struct {
+		return nil, nil
+	}
+	defaults := defaultsOf(typ)
+	return defaults.fields, defaults.err
+}
+
+// collectJSONDefaults returns the defaults of the struct type typ, whose fields are at index in the struct
+// being decoded, when typ is embedded in it. visiting holds the types being collected, so the fields of a type
+// that contains itself, as a linked list does, are looked up when they are applied rather than walked forever
+func collectJSONDefaults(typ reflect.Type, index []int, visiting map[reflect.Type]bool) ([]jsonDefault, error) {
+	var defaults []jsonDefault
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		fieldIndex := append(append([]int(nil), index...), i)
+
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+			embedded, err := collectJSONDefaults(fieldType, fieldIndex, visiting)
+			if err != nil {
+				return nil, err
+			}
+			defaults = append(defaults, embedded...)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		d := jsonDefault{index: fieldIndex, name: name}
+		if value, ok := field.Tag.Lookup("default"); ok {
+			v, err := parseDefault(fieldType, value)
+			if err != nil {
+				return nil, &ErrInvalidDefault{Field: typ.Name() + "." + field.Name, Err: err}
+			}
+			d.value = v
+		} else if visiting[fieldType] {
+			d.recursive = fieldType
+		} else if fieldType.Kind() == reflect.Struct && fieldType != timeType {
+			visiting[fieldType] = true
+			nested, err := collectJSONDefaults(fieldType, nil, visiting)
+			delete(visiting, fieldType)
+			if err != nil {
+				return nil, err
+			}
+			d.nested = nested
+		}
+		if d.value.IsValid() || len(d.nested) > 0 || d.recursive != nil {
+			defaults = append(defaults, d)
+		}
+	}
+	return defaults, nil
+}
+
+// parseDefault returns value, the default tag of a field, converted to typ. Durations are parsed by
+// time.ParseDuration, and the other types as ReadForm does
+func parseDefault(typ reflect.Type, value string) (reflect.Value, error) {
+	v := reflect.New(typ).Elem()
+	if typ == durationType {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("%q is not a duration", value)
+		}
+		v.SetInt(int64(d))
+		return v, nil
+	}
+	if err := setFormString(v, "", value); err != nil {
+		return reflect.Value{}, err
+	}
+	return v, nil
+}
+
+// applyJSONDefaults sets the fields of the struct v that are still zero, and whose key is not in body, the
+// JSON object v was decoded from, to their default. Keys are matched regardless of case, as encoding/json does
+func applyJSONDefaults(v reflect.Value, defaults []jsonDefault, body json.RawMessage) {
+	var members map[string]json.RawMessage
+	_ = json.Unmarshal(body, &members)
+
+	for _, d := range defaults {
+		// The field is left alone when it is in an embedded struct the body did not set
+		field, err := v.FieldByIndexErr(d.index)
+		if err != nil {
+			continue
+		}
+		raw, present := memberFolding(members, d.name)
+
+		if d.value.IsValid() {
+			if present || !field.IsZero() {
+				continue
+			}
+			if field.Kind() == reflect.Pointer {
+				field.Set(reflect.New(d.value.Type()))
+				field = field.Elem()
+			}
+			field.Set(d.value)
+			continue
+		}
+
+		if field.Kind() == reflect.Pointer {
+			if field.IsNil() {
+				continue
+			}
+			field = field.Elem()
+		}
+		nested := d.nested
+		if d.recursive != nil {
+			nested = defaultsOf(d.recursive).fields
+		}
+		applyJSONDefaults(field, nested, raw)
+	}
+}
+
+// memberFolding returns the member of members whose key is name, or else matches it regardless of case
+func memberFolding(members map[string]json.RawMessage, name string) (json.RawMessage, bool) {
+	if raw, ok := members[name]; ok {
+		return raw, true
+	}
+	for key, raw := range members {
+		if strings.EqualFold(key, name) {
+			return raw, true
+		}
+	}
+	return nil, false
+}
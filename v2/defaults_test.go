@@ -0,0 +1,91 @@
+package toolkit
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type pagingDefaults struct {
+	Limit int `json:"limit" default:"10"`
+}
+
+type searchRequest struct {
+	pagingDefaults
+	Query    string         `json:"query" default:"*"`
+	Ratio    float64        `json:"ratio" default:"0.5"`
+	Exact    bool           `json:"exact" default:"true"`
+	Timeout  time.Duration  `json:"timeout" default:"30s"`
+	MaxHits  *uint          `json:"max_hits" default:"100"`
+	Since    time.Time      `json:"since" default:"2024-01-01T00:00:00Z"`
+	Sort     sortOptions    `json:"sort"`
+	Filter   *sortOptions   `json:"filter"`
+	Next     *searchRequest `json:"next"`
+	NoTag    string
+	internal string `default:"x"`
+}
+
+type sortOptions struct {
+	Field string `json:"field" default:"created_at"`
+	Desc  bool   `json:"desc"`
+}
+
+func TestTools_ReadJSON_Defaults(t *testing.T) {
+	var testTools Tools
+
+	var omitted searchRequest
+	if err := testTools.ReadJSON(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader(`{}`)), &omitted); err != nil {
+		t.Fatal(err)
+	}
+	if omitted.Limit != 10 || omitted.Query != "*" || omitted.Ratio != 0.5 || !omitted.Exact || omitted.Timeout != 30*time.Second {
+		t.Errorf("expected the omitted fields to be defaulted, but got %+v", omitted)
+	}
+	if omitted.MaxHits == nil || *omitted.MaxHits != 100 || !omitted.Since.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the pointer to be allocated and the time defaulted, but got %v, %v", omitted.MaxHits, omitted.Since)
+	}
+	if omitted.Sort.Field != "created_at" || omitted.Filter != nil || omitted.Next != nil || omitted.internal != "" {
+		t.Errorf("expected nested structs to be defaulted, and nil pointers left nil, but got %+v", omitted)
+	}
+
+	// Fields explicitly set, even to their zero value, are not overridden, and neither are those of nested objects
+	body := `{"limit":0,"query":"","Ratio":0,"exact":false,"timeout":0,"max_hits":null,"sort":{"field":""},"filter":{"desc":true}}`
+	var explicit searchRequest
+	if err := testTools.ReadJSON(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader(body)), &explicit); err != nil {
+		t.Fatal(err)
+	}
+	if explicit.Limit != 0 || explicit.Query != "" || explicit.Ratio != 0 || explicit.Exact || explicit.Timeout != 0 || explicit.MaxHits != nil {
+		t.Errorf("expected the explicit zero values to be kept, but got %+v", explicit)
+	}
+	if explicit.Sort.Field != "" || explicit.Filter == nil || explicit.Filter.Field != "created_at" || !explicit.Filter.Desc {
+		t.Errorf("expected the nested objects to be defaulted where they leave fields out, but got %+v, %+v", explicit.Sort, explicit.Filter)
+	}
+
+	// Defaults apply to bodies decoded without a request too
+	var decoded searchRequest
+	if err := testTools.DecodeJSON(strings.NewReader(`{"query":"go","next":{"limit":5}}`), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Query != "go" || decoded.Limit != 10 || decoded.Next == nil || decoded.Next.Limit != 5 || decoded.Next.Query != "*" {
+		t.Errorf("expected the defaults of the decoded body, but got %+v", decoded)
+	}
+}
+
+func TestTools_ReadJSON_InvalidDefault(t *testing.T) {
+	type badDefault struct {
+		Count int `json:"count" default:"ten"`
+	}
+
+	var testTools Tools
+	var decoded badDefault
+	err := testTools.ReadJSON(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader(`{}`)), &decoded)
+	var invalidDefault *ErrInvalidDefault
+	if !errors.As(err, &invalidDefault) || invalidDefault.Field != "badDefault.Count" {
+		t.Fatalf("expected an *ErrInvalidDefault, but got %v", err)
+	}
+	if status := JSONErrorStatus(err); status != http.StatusInternalServerError {
+		t.Errorf("expected status 500, but got %d", status)
+	}
+}
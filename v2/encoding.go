@@ -0,0 +1,184 @@
+package toolkit
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// defaultCompressionThreshold is the size, in bytes, over which JSON responses are compressed when
+// CompressionThreshold is not set. Smaller bodies fit in a single packet anyway
+const defaultCompressionThreshold = 1400
+
+// NegotiateEncoding returns a handler that calls next with a response writer remembering the Accept-Encoding
+// header of the request, so WriteJSON, ErrorJSON and the other writers of this package can gzip responses
+// larger than CompressionThreshold for the clients that accept it.
+func (t *Tools) NegotiateEncoding(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(&encodingWriter{ResponseWriter: w, acceptsGzip: acceptsGzip(r.Header.Get("Accept-Encoding"))}, r)
+	})
+}
+
+// encodingWriter is the response writer of NegotiateEncoding
+type encodingWriter struct {
+	http.ResponseWriter
+	acceptsGzip bool
+}
+
+// Unwrap returns the response writer of the server, for http.ResponseController
+func (w *encodingWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// negotiatedWriter returns the encodingWriter writer is, or wraps, such as within a ResponseWriterWrapper
+func negotiatedWriter(writer http.ResponseWriter) (*encodingWriter, bool) {
+	for {
+		switch w := writer.(type) {
+		case *encodingWriter:
+			return w, true
+		case interface{ Unwrap() http.ResponseWriter }:
+			writer = w.Unwrap()
+		default:
+			return nil, false
+		}
+	}
+}
+
+// acceptsGzip reports whether an Accept-Encoding header accepts gzip, either by name or with *, and without a
+// quality of 0
+func acceptsGzip(acceptEncoding string) bool {
+	for _, coding := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(coding, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "gzip" && name != "x-gzip" && name != "*" {
+			continue
+		}
+		q, found := strings.CutPrefix(strings.ReplaceAll(params, " ", ""), "q=")
+		if !found {
+			return true
+		}
+		if quality, err := strconv.ParseFloat(q, 64); err != nil || quality > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// compressionThreshold returns CompressionThreshold, or 1400 bytes when it is not set
+func (t *Tools) compressionThreshold() int {
+	if t.CompressionThreshold != 0 {
+		return t.CompressionThreshold
+	}
+	return defaultCompressionThreshold
+}
+
+// negotiatedGzip reports whether a body of size bytes, to be written to writer, is subject to NegotiateEncoding,
+// because writer comes from it, the body is larger than CompressionThreshold and no Content-Encoding was set
+// already, and whether it is gzipped then, because the client accepts gzip
+func (t *Tools) negotiatedGzip(writer http.ResponseWriter, size int) (negotiated, gzipped bool) {
+	w, ok := negotiatedWriter(writer)
+	if !ok || size <= t.compressionThreshold() || writer.Header().Get("Content-Encoding") != "" {
+		return false, false
+	}
+	return true, w.acceptsGzip
+}
+
+// gzipJSON replaces body, to be written to writer, with its gzip compressed contents, and sets the headers for
+// them, when writer comes from NegotiateEncoding, the client accepts gzip, body is larger than
+// CompressionThreshold, and no Content-Encoding was set already
+func (t *Tools) gzipJSON(writer http.ResponseWriter, body *bytes.Buffer) error {
+	negotiated, gzipped := t.negotiatedGzip(writer, body.Len())
+	if !negotiated {
+		return nil
+	}
+	// The response depends on Accept-Encoding, whether it is compressed or not
+	writer.Header().Add("Vary", "Accept-Encoding")
+	if !gzipped {
+		return nil
+	}
+
+	compressed := jsonBufferPool.Get().(*bytes.Buffer)
+	defer putJSONBuffer(compressed)
+	gz := gzip.NewWriter(compressed)
+	if _, err := body.WriteTo(gz); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+
+	body.Reset()
+	if _, err := compressed.WriteTo(body); err != nil {
+		return err
+	}
+	writer.Header().Set("Content-Encoding", "gzip")
+	// The compressed bytes differ from those a strong ETag was computed from, but they mean the same
+	if etag := writer.Header().Get("ETag"); strings.HasPrefix(etag, `"`) {
+		writer.Header().Set("ETag", "W/"+etag)
+	}
+	return nil
+}
+
+// ErrInvalidBodyEncoding is matched by the error ReadJSON returns for a body that cannot be decompressed as its
+// Content-Encoding says
+var ErrInvalidBodyEncoding = errors.New("the body cannot be decompressed")
+
+// ErrUnsupportedContentEncoding is matched by the error ReadJSON returns for a body compressed with an
+// encoding other than gzip and deflate
+var ErrUnsupportedContentEncoding = errors.New("unsupported Content-Encoding")
+
+// decompressedBody returns a reader of the body of request, decompressed as its Content-Encoding header says,
+// which may be gzip or deflate
+func decompressedBody(request *http.Request) (io.Reader, error) {
+	encoding := strings.ToLower(strings.TrimSpace(request.Header.Get("Content-Encoding")))
+	switch encoding {
+	case "", "identity":
+		return request.Body, nil
+	case "gzip", "x-gzip":
+		gz, err := gzip.NewReader(request.Body)
+		if err != nil {
+			return nil, invalidBodyEncoding("gzip", err)
+		}
+		return &decompressingReader{r: gz, encoding: "gzip"}, nil
+	case "deflate":
+		zr, err := zlib.NewReader(request.Body)
+		if err != nil {
+			return nil, invalidBodyEncoding("deflate", err)
+		}
+		return &decompressingReader{r: zr, encoding: "deflate"}, nil
+	default:
+		return nil, &jsonError{message: fmt.Sprintf("unsupported Content-Encoding %q", encoding), errs: []error{ErrUnsupportedContentEncoding}}
+	}
+}
+
+// invalidBodyEncoding returns the error for a body that cannot be decompressed with encoding, because of err.
+// Errors reading the body itself, such as it being too large, are returned as they are
+func invalidBodyEncoding(encoding string, err error) error {
+	var maxBytesError *http.MaxBytesError
+	if errors.As(err, &maxBytesError) || isReadInterrupted(err) {
+		return err
+	}
+	if err == io.EOF {
+		return ErrEmptyBody
+	}
+	return &jsonError{message: fmt.Sprintf("invalid %s body: %v", encoding, err), errs: []error{ErrInvalidBodyEncoding, err}}
+}
+
+// decompressingReader reads a compressed body, and turns the errors of the decompressor into an
+// ErrInvalidBodyEncoding
+type decompressingReader struct {
+	r        io.Reader
+	encoding string
+}
+
+func (d *decompressingReader) Read(p []byte) (int, error) {
+	n, err := d.r.Read(p)
+	if err != nil && err != io.EOF {
+		err = invalidBodyEncoding(d.encoding, err)
+	}
+	return n, err
+}
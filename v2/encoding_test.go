@@ -0,0 +1,187 @@
+package toolkit
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var acceptsGzipTests = []struct {
+	name           string
+	acceptEncoding string
+	expected       bool
+}{
+	{name: "empty", acceptEncoding: "", expected: false},
+	{name: "gzip", acceptEncoding: "gzip", expected: true},
+	{name: "several", acceptEncoding: "deflate, gzip, br", expected: true},
+	{name: "upper case", acceptEncoding: "GZIP", expected: true},
+	{name: "wildcard", acceptEncoding: "*", expected: true},
+	{name: "quality", acceptEncoding: "gzip;q=0.5", expected: true},
+	{name: "refused", acceptEncoding: "gzip; q=0, br", expected: false},
+	{name: "other", acceptEncoding: "br, deflate", expected: false},
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	for _, e := range acceptsGzipTests {
+		if got := acceptsGzip(e.acceptEncoding); got != e.expected {
+			t.Errorf("%s: expected %v, but got %v", e.name, e.expected, got)
+		}
+	}
+}
+
+var negotiateEncodingTests = []struct {
+	name            string
+	acceptEncoding  string
+	items           int
+	contentEncoding string
+	compressed      bool
+	vary            bool
+}{
+	{name: "large with gzip", acceptEncoding: "gzip", items: 500, compressed: true, vary: true},
+	{name: "large without gzip", acceptEncoding: "", items: 500, compressed: false, vary: true},
+	{name: "small with gzip", acceptEncoding: "gzip", items: 2, compressed: false},
+	{name: "encoding set by caller", acceptEncoding: "gzip", items: 500, contentEncoding: "identity", compressed: false},
+}
+
+func TestTools_NegotiateEncoding(t *testing.T) {
+	var testTools Tools
+	for _, e := range negotiateEncodingTests {
+		items := make([]string, e.items)
+		for i := range items {
+			items[i] = "item number " + strconv.Itoa(i)
+		}
+
+		handler := testTools.NegotiateEncoding(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if e.contentEncoding != "" {
+				w.Header().Set("Content-Encoding", e.contentEncoding)
+			}
+			if err := testTools.WriteJSON(w, http.StatusOK, items); err != nil {
+				t.Errorf("%s: %v", e.name, err)
+			}
+		}))
+		req := httptest.NewRequest("GET", "/", nil)
+		if e.acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", e.acceptEncoding)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if (rr.Header().Get("Content-Encoding") == "gzip") != e.compressed {
+			t.Errorf("%s: expected compressed to be %v, but Content-Encoding is %q", e.name, e.compressed, rr.Header().Get("Content-Encoding"))
+		}
+		if (rr.Header().Get("Vary") == "Accept-Encoding") != e.vary {
+			t.Errorf("%s: expected Vary to be set to be %v, but got %q", e.name, e.vary, rr.Header().Get("Vary"))
+		}
+		if rr.Header().Get("Content-Length") != strconv.Itoa(rr.Body.Len()) {
+			t.Errorf("%s: Content-Length is %s, but the body is %d bytes", e.name, rr.Header().Get("Content-Length"), rr.Body.Len())
+		}
+
+		var body io.Reader = rr.Body
+		if e.compressed {
+			gz, err := gzip.NewReader(rr.Body)
+			if err != nil {
+				t.Fatalf("%s: %v", e.name, err)
+			}
+			body = gz
+		}
+		var decoded []string
+		if err := json.NewDecoder(body).Decode(&decoded); err != nil || len(decoded) != e.items || decoded[e.items-1] != items[e.items-1] {
+			t.Errorf("%s: expected the items back, but got %d items, %v", e.name, len(decoded), err)
+		}
+	}
+
+	// ErrorJSON goes through the same path
+	testTools.CompressionThreshold = 10
+	handler := testTools.NegotiateEncoding(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = testTools.ErrorJSON(w, io.ErrUnexpectedEOF)
+	}))
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	gz, err := gzip.NewReader(rr.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, _ := io.ReadAll(gz)
+	if !strings.Contains(string(decoded), "unexpected EOF") {
+		t.Errorf("expected the error message, but got %s", decoded)
+	}
+}
+
+// compressBody returns data compressed with encoding, gzip or deflate
+func compressBody(t *testing.T, encoding string, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var w io.WriteCloser = gzip.NewWriter(&buf)
+	if encoding == "deflate" {
+		w = zlib.NewWriter(&buf)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestTools_ReadJSON_CompressedBody(t *testing.T) {
+	valid := []byte(`{"foo": "bar"}`)
+	// A bomb: a few kilobytes on the wire, 10MB once decompressed
+	bomb := []byte(`{"foo": "` + strings.Repeat("a", 10<<20) + `"}`)
+	corrupt := compressBody(t, "gzip", valid)
+	corrupt[len(corrupt)-12] ^= 0xff
+
+	var compressedBodyTests = []struct {
+		name          string
+		encoding      string
+		body          []byte
+		expectedError error
+		expectedText  string
+	}{
+		{name: "gzip", encoding: "gzip", body: compressBody(t, "gzip", valid)},
+		{name: "deflate", encoding: "deflate", body: compressBody(t, "deflate", valid)},
+		{name: "identity", encoding: "identity", body: valid},
+		{name: "gzip bomb", encoding: "gzip", body: compressBody(t, "gzip", bomb), expectedError: ErrBodyTooLarge, expectedText: "body must not be larger than 1.0 MB"},
+		{name: "deflate bomb", encoding: "deflate", body: compressBody(t, "deflate", bomb), expectedError: ErrBodyTooLarge},
+		{name: "not gzip", encoding: "gzip", body: valid, expectedError: ErrInvalidBodyEncoding, expectedText: "invalid gzip body"},
+		{name: "corrupt gzip", encoding: "gzip", body: corrupt, expectedError: ErrInvalidBodyEncoding, expectedText: "invalid gzip body"},
+		{name: "empty gzip", encoding: "gzip", body: nil, expectedError: ErrEmptyBody},
+		{name: "brotli", encoding: "br", body: valid, expectedError: ErrUnsupportedContentEncoding},
+	}
+
+	var testTools Tools
+	for _, e := range compressedBodyTests {
+		if len(e.body) > 64*1024 {
+			t.Fatalf("%s: the compressed body should be small, but it is %d bytes", e.name, len(e.body))
+		}
+		req := httptest.NewRequest("POST", "/", bytes.NewReader(e.body))
+		req.Header.Set("Content-Encoding", e.encoding)
+		var decoded struct {
+			Foo string `json:"foo"`
+		}
+		err := testTools.ReadJSON(httptest.NewRecorder(), req, &decoded)
+
+		if e.expectedError == nil {
+			if err != nil || decoded.Foo != "bar" {
+				t.Errorf("%s: expected the body to be decoded, but got %v", e.name, err)
+			}
+			continue
+		}
+		if !errors.Is(err, e.expectedError) {
+			t.Errorf("%s: expected an error matching %v, but got %v", e.name, e.expectedError, err)
+		}
+		if err != nil && !strings.Contains(err.Error(), e.expectedText) {
+			t.Errorf("%s: expected the error to contain %q, but got %q", e.name, e.expectedText, err.Error())
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package toolkit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// WriteJSONCached writes data like WriteJSON, with a strong ETag computed from the JSON it is encoded to. When
+// the status is 2xx and the If-None-Match header of request, a GET or HEAD request, matches that ETag, a 304
+// Not Modified response is written instead, with no body. The ETag is always computed from the uncompressed
+// JSON, and it is sent weak, with a W/ prefix, when the response is gzipped by NegotiateEncoding, which the
+// weak comparison of If-None-Match still matches.
+func (t *Tools) WriteJSONCached(writer http.ResponseWriter, request *http.Request, status int, data any, headers ...http.Header) error {
+	if err := checkNotWritten(writer); err != nil {
+		return err
+	}
+	if status < 200 || status > 299 || status == http.StatusNoContent {
+		return t.WriteJSON(writer, status, data, headers...)
+	}
+
+	started := t.encodeStart()
+	buf, err := t.encodeJSON(data)
+	if err != nil {
+		return err
+	}
+	defer putJSONBuffer(buf)
+
+	sum := sha256.Sum256(buf.Bytes())
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	if (request.Method == http.MethodGet || request.Method == http.MethodHead) && etagMatches(request.Header.Get("If-None-Match"), etag) {
+		setHeaders(writer, headers)
+		// The 304 carries the ETag, and Vary, the 200 would have been sent with
+		negotiated, gzipped := t.negotiatedGzip(writer, buf.Len())
+		if negotiated {
+			writer.Header().Add("Vary", "Accept-Encoding")
+		}
+		if gzipped {
+			etag = "W/" + etag
+		}
+		writer.Header().Set("ETag", etag)
+		writer.WriteHeader(http.StatusNotModified)
+		t.observeResponse(http.StatusNotModified, 0, 0)
+		return nil
+	}
+
+	setHeaders(writer, headers)
+	writer.Header().Set("ETag", etag)
+	return t.writeJSONBuffer(writer, status, "application/json", buf, nil, started)
+}
+
+// etagMatches reports whether the If-None-Match header ifNoneMatch matches etag, with the weak comparison,
+// which ignores the W/ prefix
+func etagMatches(ifNoneMatch, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,124 @@
+package toolkit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var etagMatchesTests = []struct {
+	name        string
+	ifNoneMatch string
+	etag        string
+	expected    bool
+}{
+	{name: "empty", ifNoneMatch: "", etag: `"abc"`, expected: false},
+	{name: "same", ifNoneMatch: `"abc"`, etag: `"abc"`, expected: true},
+	{name: "different", ifNoneMatch: `"abd"`, etag: `"abc"`, expected: false},
+	{name: "weak", ifNoneMatch: `W/"abc"`, etag: `"abc"`, expected: true},
+	{name: "list", ifNoneMatch: `"xyz", W/"abc"`, etag: `"abc"`, expected: true},
+	{name: "wildcard", ifNoneMatch: `*`, etag: `"abc"`, expected: true},
+}
+
+func TestEtagMatches(t *testing.T) {
+	for _, e := range etagMatchesTests {
+		if got := etagMatches(e.ifNoneMatch, e.etag); got != e.expected {
+			t.Errorf("%s: expected %v, but got %v", e.name, e.expected, got)
+		}
+	}
+}
+
+func TestTools_WriteJSONCached(t *testing.T) {
+	var testTools Tools
+	payload := map[string]string{"foo": "bar"}
+
+	rr := httptest.NewRecorder()
+	if err := testTools.WriteJSONCached(rr, httptest.NewRequest("GET", "/", nil), http.StatusOK, payload); err != nil {
+		t.Fatal(err)
+	}
+	etag := rr.Header().Get("ETag")
+	if rr.Code != http.StatusOK || rr.Body.String() != `{"foo":"bar"}` || !strings.HasPrefix(etag, `"`) {
+		t.Fatalf("expected the payload with a strong ETag, but got %d %q %s", rr.Code, etag, rr.Body.String())
+	}
+
+	// The second request sends the ETag back, and gets a 304 without a body
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("If-None-Match", etag)
+	rr = httptest.NewRecorder()
+	if err := testTools.WriteJSONCached(rr, req, http.StatusOK, payload); err != nil {
+		t.Fatal(err)
+	}
+	if rr.Code != http.StatusNotModified || rr.Body.Len() != 0 || rr.Header().Get("ETag") != etag {
+		t.Errorf("expected a 304 with no body, but got %d with %d bytes", rr.Code, rr.Body.Len())
+	}
+
+	// Changed data gets a new ETag and the payload
+	rr = httptest.NewRecorder()
+	if err := testTools.WriteJSONCached(rr, req, http.StatusOK, map[string]string{"foo": "baz"}); err != nil {
+		t.Fatal(err)
+	}
+	if rr.Code != http.StatusOK || rr.Header().Get("ETag") == etag {
+		t.Errorf("expected a 200 with a new ETag, but got %d %q", rr.Code, rr.Header().Get("ETag"))
+	}
+
+	// Other methods are not answered with a 304
+	req = httptest.NewRequest("POST", "/", nil)
+	req.Header.Set("If-None-Match", etag)
+	rr = httptest.NewRecorder()
+	if err := testTools.WriteJSONCached(rr, req, http.StatusOK, payload); err != nil {
+		t.Fatal(err)
+	}
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected a 200 to a POST, but got %d", rr.Code)
+	}
+}
+
+func TestTools_WriteJSONCached_Gzip(t *testing.T) {
+	testTools := Tools{CompressionThreshold: 5}
+	payload := map[string]string{"foo": strings.Repeat("bar", 100)}
+	handler := testTools.NegotiateEncoding(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = testTools.WriteJSONCached(w, r, http.StatusOK, payload)
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	plainETag := rr.Header().Get("ETag")
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	gzipETag := rr.Header().Get("ETag")
+	if rr.Header().Get("Content-Encoding") != "gzip" || gzipETag != "W/"+plainETag {
+		t.Fatalf("expected the weak form of %s for a gzipped response, but got %s", plainETag, gzipETag)
+	}
+
+	// Either form of the ETag gets a 304, whatever the encoding
+	for _, etag := range []string{plainETag, gzipETag} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		req.Header.Set("If-None-Match", etag)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != http.StatusNotModified || rr.Body.Len() != 0 {
+			t.Errorf("%s: expected a 304 with no body, but got %d with %d bytes", etag, rr.Code, rr.Body.Len())
+		}
+		if rr.Header().Get("ETag") != gzipETag || rr.Header().Get("Vary") != "Accept-Encoding" {
+			t.Errorf("%s: expected the 304 to carry the ETag of the gzipped 200, %s, and Vary, but got %v", etag, gzipETag, rr.Header())
+		}
+	}
+
+	// The negotiated encoding is found through writers that wrap the one of NegotiateEncoding
+	wrapped := testTools.NegotiateEncoding(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = testTools.WriteJSONCached(NewResponseWriterWrapper(w), r, http.StatusOK, payload)
+	}))
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("If-None-Match", plainETag)
+	rr = httptest.NewRecorder()
+	wrapped.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotModified || rr.Header().Get("ETag") != gzipETag || rr.Header().Get("Vary") != "Accept-Encoding" {
+		t.Errorf("expected a 304 with the ETag %s and Vary through a wrapper, but got %d %v", gzipETag, rr.Code, rr.Header())
+	}
+}
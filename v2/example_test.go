@@ -0,0 +1,59 @@
+package toolkit_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+
+	"github.com/IgorCastilhos/toolkit/v2"
+)
+
+// uploadStatus maps the errors returned by UploadFiles to HTTP status codes
+func uploadStatus(err error) int {
+	switch {
+	case errors.Is(err, toolkit.ErrFileTooLarge), errors.Is(err, toolkit.ErrRequestTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, toolkit.ErrFileTypeNotPermitted):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, toolkit.ErrUploadDirUnavailable):
+		return http.StatusInternalServerError
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+func ExampleTools_UploadFiles_errors() {
+	tools := toolkit.Tools{AllowedFileTypes: []string{"image/png", "image/jpeg"}}
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		uploadDir, _ := os.MkdirTemp("", "uploads")
+		defer os.RemoveAll(uploadDir)
+
+		if _, err := tools.UploadFiles(r, uploadDir); err != nil {
+			_ = tools.ErrorJSON(w, err, uploadStatus(err))
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}
+
+	// Upload a text file, which is not an allowed type
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, _ := writer.CreateFormFile("file", "notes.txt")
+	_, _ = part.Write([]byte("some notes"))
+	_ = writer.Close()
+	request := httptest.NewRequest("POST", "/upload", body)
+	request.Header.Set("Content-Type", writer.FormDataContentType())
+
+	recorder := httptest.NewRecorder()
+	handler(recorder, request)
+	fmt.Println(recorder.Code)
+	fmt.Println(recorder.Body.String())
+	// Output:
+	// 415
+	// {"error":true,"message":"the uploaded file type is not permitted"}
+}
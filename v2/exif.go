@@ -0,0 +1,119 @@
+package toolkit
+
+import (
+	"bufio"
+	"errors"
+	"io"
+)
+
+// JPEG markers handled by exifStripper
+const (
+	jpegMarkerSOI  = 0xd8
+	jpegMarkerEOI  = 0xd9
+	jpegMarkerSOS  = 0xda
+	jpegMarkerAPP1 = 0xe1
+)
+
+// exifStripper is an io.Reader that copies a JPEG file, leaving out its APP1 segments, which hold the EXIF
+// and XMP metadata. The image data itself is copied byte for byte, so there is no loss of quality.
+type exifStripper struct {
+	r           *bufio.Reader
+	started     bool
+	passthrough bool
+	pending     []byte
+}
+
+// newEXIFStripper returns a reader yielding the JPEG file read from r without its APP1 segments
+func newEXIFStripper(r io.Reader) io.Reader {
+	return &exifStripper{r: bufio.NewReader(r)}
+}
+
+// Read copies the segments of the file to p, skipping APP1 segments. Everything from the start of scan
+// marker on is image data, and is copied as is.
+func (s *exifStripper) Read(p []byte) (int, error) {
+	for len(s.pending) == 0 && !s.passthrough {
+		if err := s.nextSegment(); err != nil {
+			return 0, err
+		}
+	}
+
+	if len(s.pending) > 0 {
+		n := copy(p, s.pending)
+		s.pending = s.pending[n:]
+		return n, nil
+	}
+	return s.r.Read(p)
+}
+
+// nextSegment reads the next marker, and queues it for output unless it is an APP1 segment
+func (s *exifStripper) nextSegment() error {
+	if !s.started {
+		s.started = true
+		header := make([]byte, 2)
+		if _, err := io.ReadFull(s.r, header); err != nil {
+			return errUnexpectedEOF(err)
+		}
+		if header[0] != 0xff || header[1] != jpegMarkerSOI {
+			return errors.New("malformed JPEG: missing start of image marker")
+		}
+		s.pending = header
+		return nil
+	}
+
+	// Markers start with 0xff, which may be repeated as padding
+	b, err := s.r.ReadByte()
+	if err != nil {
+		return errUnexpectedEOF(err)
+	}
+	if b != 0xff {
+		return errors.New("malformed JPEG: expected a marker")
+	}
+	marker := byte(0xff)
+	for marker == 0xff {
+		if marker, err = s.r.ReadByte(); err != nil {
+			return errUnexpectedEOF(err)
+		}
+	}
+
+	switch {
+	case marker == jpegMarkerSOS || marker == jpegMarkerEOI:
+		s.pending = []byte{0xff, marker}
+		s.passthrough = true
+		return nil
+	case marker == 0x01 || (marker >= 0xd0 && marker <= 0xd7):
+		// Markers without a length or payload
+		s.pending = []byte{0xff, marker}
+		return nil
+	}
+
+	segment := make([]byte, 4)
+	segment[0], segment[1] = 0xff, marker
+	if _, err := io.ReadFull(s.r, segment[2:]); err != nil {
+		return errUnexpectedEOF(err)
+	}
+	length := int(segment[2])<<8 | int(segment[3])
+	if length < 2 {
+		return errors.New("malformed JPEG: invalid segment length")
+	}
+
+	if marker == jpegMarkerAPP1 {
+		_, err := s.r.Discard(length - 2)
+		return errUnexpectedEOF(err)
+	}
+
+	segment = append(segment, make([]byte, length-2)...)
+	if _, err := io.ReadFull(s.r, segment[4:]); err != nil {
+		return errUnexpectedEOF(err)
+	}
+	s.pending = segment
+	return nil
+}
+
+// errUnexpectedEOF turns io.EOF into io.ErrUnexpectedEOF, since a JPEG file must not end in the middle of
+// its header
+func errUnexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,76 @@
+package toolkit
+
+import (
+	"bytes"
+	"image"
+	"os"
+	"testing"
+)
+
+func TestTools_UploadFiles_StripEXIF(t *testing.T) {
+	original, err := os.ReadFile("./testdata/gold.jpeg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(original, []byte("Exif\x00\x00")) {
+		t.Fatal("expected the test image to contain EXIF data")
+	}
+
+	testTools := Tools{StripEXIF: true}
+	uploadedFiles, err := testTools.UploadFiles(newUploadRequest(t, testFile{name: "gold.jpeg", content: original}), t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stripped, err := os.ReadFile(uploadedFiles[0].SavedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(stripped, []byte("Exif\x00\x00")) {
+		t.Error("expected EXIF data to be removed")
+	}
+	if uploadedFiles[0].FileSize != int64(len(stripped)) || len(stripped) >= len(original) {
+		t.Errorf("expected a smaller file, but got %d bytes from %d", len(stripped), len(original))
+	}
+
+	// The image data is copied, not re-encoded
+	before, _, err := image.Decode(bytes.NewReader(original))
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, _, err := image.Decode(bytes.NewReader(stripped))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before.Bounds() != after.Bounds() {
+		t.Fatalf("image bounds changed from %v to %v", before.Bounds(), after.Bounds())
+	}
+	for _, point := range []image.Point{{0, 0}, {100, 100}, {before.Bounds().Dx() / 2, before.Bounds().Dy() / 2}} {
+		if before.At(point.X, point.Y) != after.At(point.X, point.Y) {
+			t.Errorf("pixel at %v changed", point)
+		}
+	}
+	if !bytes.HasSuffix(original, stripped[len(stripped)-1024:]) {
+		t.Error("expected the image data to be copied unchanged")
+	}
+}
+
+func TestTools_UploadFiles_StripEXIFOtherTypes(t *testing.T) {
+	testTools := Tools{StripEXIF: true}
+
+	// Other formats are saved unchanged, even when they contain bytes that look like EXIF data
+	for _, content := range [][]byte{pngHeader, []byte("some text with Exif\x00\x00 inside")} {
+		uploadedFiles, err := testTools.UploadFiles(newUploadRequest(t, testFile{name: "file", content: content}), t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if saved, _ := os.ReadFile(uploadedFiles[0].SavedPath); !bytes.Equal(saved, content) {
+			t.Errorf("expected %q to be saved unchanged", content)
+		}
+	}
+
+	truncated := []byte("\xff\xd8\xff\xe1\x00\x20Exif")
+	if _, err := testTools.UploadFiles(newUploadRequest(t, testFile{name: "broken.jpg", content: truncated}), t.TempDir()); err == nil {
+		t.Error("expected an error for a truncated JPEG file")
+	}
+}
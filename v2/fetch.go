@@ -0,0 +1,91 @@
+package toolkit
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+)
+
+// maxFetchRedirects is the number of redirects UploadFromURL follows before giving up
+const maxFetchRedirects = 10
+
+// UploadFromURL downloads the file at rawURL to uploadDir, with the same checks and options as UploadFiles.
+// The response body is saved as it arrives, and MaxFileSize limits its size. The original file name is taken
+// from the Content-Disposition header of the response, or else from the URL path. HTTPClient is used when set,
+// and at most 10 redirects are followed. The file is renamed unless rename is false.
+func (t *Tools) UploadFromURL(ctx context.Context, rawURL, uploadDir string, rename ...bool) (*UploadedFile, error) {
+	renameFile := true
+	if len(rename) > 0 {
+		renameFile = rename[0]
+	}
+
+	request, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if request.URL.Scheme != "http" && request.URL.Scheme != "https" {
+		return nil, fmt.Errorf("cannot download from %q: only http and https URLs are supported", rawURL)
+	}
+
+	response, err := t.fetchClient().Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("cannot download from %q: the server responded with status %d", rawURL, response.StatusCode)
+	}
+
+	// Reject responses announcing a body that is too large before reading any of it
+	maxSize := t.maxUploadSize()
+	if response.ContentLength > maxSize {
+		return nil, ErrRequestTooLarge
+	}
+
+	if err := t.prepareUploadDir(uploadDir); err != nil {
+		return nil, err
+	}
+
+	return t.uploadPart(ctx, partInfo{fileName: downloadFileName(response, request.URL)}, response.Body, uploadDir, renameFile, maxSize)
+}
+
+// fetchClient returns a copy of HTTPClient, or of a default client, that follows at most maxFetchRedirects
+// redirects, unless the client has its own redirect policy
+func (t *Tools) fetchClient() *http.Client {
+	client := &http.Client{}
+	if t.HTTPClient != nil {
+		c := *t.HTTPClient
+		client = &c
+	}
+	if client.CheckRedirect == nil {
+		client.CheckRedirect = func(request *http.Request, via []*http.Request) error {
+			if len(via) >= maxFetchRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxFetchRedirects)
+			}
+			return nil
+		}
+	}
+	return client
+}
+
+// downloadFileName returns the name of the file in response, from its Content-Disposition header or its URL,
+// which is requestURL unless the request was redirected
+func downloadFileName(response *http.Response, requestURL *url.URL) string {
+	if _, params, err := mime.ParseMediaType(response.Header.Get("Content-Disposition")); err == nil && params["filename"] != "" {
+		return params["filename"]
+	}
+
+	// The request of the response is the final one, after any redirects
+	u := requestURL
+	if response.Request != nil {
+		u = response.Request.URL
+	}
+	if name, err := url.PathUnescape(path.Base(u.EscapedPath())); err == nil && name != "/" && name != "." {
+		return name
+	}
+	return "download"
+}
@@ -0,0 +1,95 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+var fetchTests = []struct {
+	name             string
+	url              string
+	status           int
+	header           http.Header
+	content          string
+	maxFileSize      int
+	allowedTypes     []string
+	expectedFileName string
+	expectedError    string
+}{
+	{name: "name from URL", url: "https://example.com/files/notes%20v2.txt?x=1", status: http.StatusOK, content: "some notes", expectedFileName: "notes v2.txt"},
+	{name: "name from header", url: "https://example.com/download?id=7", status: http.StatusOK, header: http.Header{"Content-Disposition": {`attachment; filename="report.txt"`}}, content: "a report", expectedFileName: "report.txt"},
+	{name: "no name", url: "https://example.com/", status: http.StatusOK, content: "some notes", expectedFileName: "download"},
+	{name: "not found", url: "https://example.com/missing.txt", status: http.StatusNotFound, expectedError: "status 404"},
+	{name: "not allowed", url: "https://example.com/notes.txt", status: http.StatusOK, content: "some notes", allowedTypes: []string{"image/png"}, expectedError: "not permitted"},
+	{name: "too big", url: "https://example.com/notes.txt", status: http.StatusOK, content: "some notes", maxFileSize: 4, expectedError: ErrRequestTooLarge.Error()},
+	{name: "unsupported scheme", url: "file:///etc/passwd", expectedError: "only http and https"},
+}
+
+func TestTools_UploadFromURL(t *testing.T) {
+	for _, e := range fetchTests {
+		client := NewTestClient(func(request *http.Request) *http.Response {
+			header := e.header
+			if header == nil {
+				header = make(http.Header)
+			}
+			return &http.Response{
+				StatusCode: e.status,
+				Body:       io.NopCloser(strings.NewReader(e.content)),
+				Header:     header,
+			}
+		})
+
+		uploadDir := t.TempDir()
+		testTools := Tools{HTTPClient: client, MaxFileSize: e.maxFileSize, AllowedFileTypes: e.allowedTypes}
+		uploadedFile, err := testTools.UploadFromURL(context.Background(), e.url, uploadDir, false)
+		if e.expectedError != "" {
+			if err == nil || !strings.Contains(err.Error(), e.expectedError) {
+				t.Errorf("%s: expected error containing %q, but got %v", e.name, e.expectedError, err)
+			}
+			if entries, _ := os.ReadDir(uploadDir); len(entries) != 0 {
+				t.Errorf("%s: expected no files in upload directory, but found %d", e.name, len(entries))
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: error not expected, but one received: %s", e.name, err)
+			continue
+		}
+
+		if uploadedFile.OriginalFileName != e.expectedFileName {
+			t.Errorf("%s: expected file name %q, but got %q", e.name, e.expectedFileName, uploadedFile.OriginalFileName)
+		}
+		if data, _ := os.ReadFile(uploadedFile.SavedPath); !bytes.Equal(data, []byte(e.content)) {
+			t.Errorf("%s: saved file differs from the download", e.name)
+		}
+	}
+}
+
+func TestTools_UploadFromURL_Redirects(t *testing.T) {
+	requests := 0
+	client := NewTestClient(func(request *http.Request) *http.Response {
+		requests++
+		return &http.Response{
+			StatusCode: http.StatusFound,
+			Body:       io.NopCloser(strings.NewReader("")),
+			Header:     http.Header{"Location": {"/again"}},
+		}
+	})
+
+	testTools := Tools{HTTPClient: client}
+	_, err := testTools.UploadFromURL(context.Background(), "https://example.com/loop", t.TempDir())
+	if err == nil || !strings.Contains(err.Error(), "stopped after 10 redirects") {
+		t.Errorf("expected a redirect error, but got %v", err)
+	}
+	if requests != maxFetchRedirects {
+		t.Errorf("expected %d requests, but got %d", maxFetchRedirects, requests)
+	}
+	if client.CheckRedirect != nil {
+		t.Error("expected HTTPClient to be left unchanged")
+	}
+}
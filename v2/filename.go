@@ -0,0 +1,168 @@
+package toolkit
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// normalizeFileName returns name in Unicode normalization form C, so names typed on different systems look the
+// same, with runs of whitespace, control characters, bidirectional text controls and characters reserved on
+// common file systems replaced by a hyphen. When transliterate is true, accented Latin letters are replaced by
+// the ASCII letters they are based on, and anything else but ASCII letters, digits, dots and underscores is
+// replaced too, like Slugify does. Leading and trailing hyphens and dots are removed, and a name left empty
+// becomes "file".
+func normalizeFileName(name string, transliterate bool) string {
+	name = composeText(name)
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+
+	base = strings.Trim(cleanFileNamePart(base, transliterate), "-.")
+	if base == "" {
+		base = "file"
+	}
+	ext = strings.TrimRight(cleanFileNamePart(ext, transliterate), "-.")
+	return base + ext
+}
+
+// unsafeFileNameChars matches runs of the characters replaced by normalizeFileName
+var unsafeFileNameChars = regexp.MustCompile(`[\s\p{Cc}\x{061C}\x{200E}\x{200F}\x{202A}-\x{202E}\x{2066}-\x{2069}<>:"/\\|?*]+`)
+
+// nonASCIIFileNameChars matches runs of the characters replaced by normalizeFileName when transliterating
+var nonASCIIFileNameChars = regexp.MustCompile(`[^A-Za-z\d._]+`)
+
+// cleanFileNamePart replaces the characters of s that normalizeFileName does not keep by hyphens
+func cleanFileNamePart(s string, transliterate bool) string {
+	if transliterate {
+		var b strings.Builder
+		for _, r := range s {
+			b.WriteRune(asciiLetter(r))
+		}
+		return nonASCIIFileNameChars.ReplaceAllString(b.String(), "-")
+	}
+	return unsafeFileNameChars.ReplaceAllString(s, "-")
+}
+
+// composeText composes the letters of s followed by combining marks into single characters where Unicode has
+// one, as normalization form C does. Only Latin, Greek and Cyrillic letters, and Korean Hangul, are composed,
+// which covers the names macOS decomposes.
+func composeText(s string) string {
+	if isASCII(s) {
+		return s
+	}
+
+	runes := make([]rune, 0, utf8.RuneCountInString(s))
+	for _, r := range s {
+		if n := len(runes); n > 0 {
+			if composed, ok := composeRunes(runes[n-1], r); ok {
+				runes[n-1] = composed
+				continue
+			}
+		}
+		runes = append(runes, r)
+	}
+	return string(runes)
+}
+
+// The ranges of Hangul syllables and the jamo they are made of, as described in chapter 3.12 of the Unicode
+// standard
+const (
+	hangulBase  = 0xAC00
+	jamoLBase   = 0x1100
+	jamoVBase   = 0x1161
+	jamoTBase   = 0x11A7
+	jamoLCount  = 19
+	jamoVCount  = 21
+	jamoTCount  = 28
+	hangulCount = jamoLCount * jamoVCount * jamoTCount
+)
+
+// composeRunes returns the character made of a followed by b, if there is one
+func composeRunes(a, b rune) (rune, bool) {
+	switch {
+	case a >= jamoLBase && a < jamoLBase+jamoLCount && b >= jamoVBase && b < jamoVBase+jamoVCount:
+		return hangulBase + ((a-jamoLBase)*jamoVCount+(b-jamoVBase))*jamoTCount, true
+	case a >= hangulBase && a < hangulBase+hangulCount && (a-hangulBase)%jamoTCount == 0 && b > jamoTBase && b < jamoTBase+jamoTCount:
+		return a + (b - jamoTBase), true
+	}
+
+	pairs, ok := compositions[b]
+	if !ok {
+		return 0, false
+	}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if pairs[i] == a {
+			return pairs[i+1], true
+		}
+	}
+	return 0, false
+}
+
+// asciiLetter returns the ASCII letter r is based on, such as e for é, or r itself when there is none
+func asciiLetter(r rune) rune {
+	for r >= utf8.RuneSelf {
+		base, ok := decompositions[r]
+		if !ok {
+			return r
+		}
+		r = base
+	}
+	return r
+}
+
+// isASCII reports whether s only has ASCII characters
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// compositionTable lists, for every combining mark, pairs of a letter and the character made of that letter
+// followed by the mark. It covers the Latin, Greek and Cyrillic characters with a canonical decomposition.
+var compositionTable = map[rune]string{
+	'\u0300': "AÀEÈIÌOÒUÙaàeèiìoòuùÜǛüǜNǸnǹЕЀИЍеѐиѝĒḔēḕŌṐōṑWẀwẁÂẦâầĂẰăằÊỀêềÔỒôồƠỜơờƯỪưừYỲyỳ",                                                                                                     // grave accent
+	'\u0301': "AÁEÉIÍOÓUÚYÝaáeéiíoóuúyýCĆcćLĹlĺNŃnńRŔrŕSŚsśZŹzźÜǗüǘGǴgǵÅǺåǻÆǼæǽØǾøǿ¨΅ΑΆΕΈΗΉΙΊΟΌΥΎΩΏϊΐαάεέηήιίϋΰοόυύωώϒϓГЃКЌгѓкќÇḈçḉĒḖēḗÏḮïḯKḰkḱMḾmḿÕṌõṍŌṒōṓPṔpṕŨṸũṹWẂwẃÂẤâấĂẮăắÊẾêếÔỐôốƠỚơớƯỨưứ", // acute accent
+	'\u0302': "AÂEÊIÎOÔUÛaâeêiîoôuûCĈcĉGĜgĝHĤhĥJĴjĵSŜsŝWŴwŵYŶyŷZẐzẑẠẬạậẸỆẹệỌỘọộ",                                                                                                                 // circumflex accent
+	'\u0303': "AÃNÑOÕaãnñoõIĨiĩUŨuũVṼvṽÂẪâẫĂẴăẵEẼeẽÊỄêễÔỖôỗƠỠơỡƯỮưữYỸyỹ",                                                                                                                         // tilde
+	'\u0304': "AĀaāEĒeēIĪiīOŌoōUŪuūÜǕüǖÄǞäǟȦǠȧǡÆǢæǣǪǬǫǭÖȪöȫÕȬõȭȮȰȯȱYȲyȳИӢиӣУӮуӯGḠgḡḶḸḷḹṚṜṛṝ",                                                                                                     // macron
+	'\u0306': "AĂaăEĔeĕGĞgğIĬiĭOŎoŏUŬuŭУЎИЙийуўЖӁжӂАӐаӑЕӖеӗȨḜȩḝẠẶạặ",                                                                                                                             // breve
+	'\u0307': "CĊcċEĖeėGĠgġIİZŻzżAȦaȧOȮoȯBḂbḃDḊdḋFḞfḟHḢhḣMṀmṁNṄnṅPṖpṗRṘrṙSṠsṡŚṤśṥŠṦšṧṢṨṣṩTṪtṫWẆwẇXẊxẋYẎyẏſẛ",                                                                                     // dot above
+	'\u0308': "AÄEËIÏOÖUÜaäeëiïoöuüyÿYŸΙΪΥΫιϊυϋϒϔЕЁІЇеёіїАӒаӓӘӚәӛЖӜжӝЗӞзӟИӤиӥОӦоӧӨӪөӫЭӬэӭУӰуӱЧӴчӵЫӸыӹHḦhḧÕṎõṏŪṺūṻWẄwẅXẌxẍtẗ",                                                                     // diaeresis
+	'\u0309': "AẢaảÂẨâẩĂẲăẳEẺeẻÊỂêểIỈiỉOỎoỏÔỔôổƠỞơởUỦuủƯỬưửYỶyỷ",                                                                                                                                 // hook above
+	'\u030a': "AÅaåUŮuůwẘyẙ",                                                                                                                                                                     // ring above
+	'\u030b': "OŐoőUŰuűУӲуӳ",                                                                                                                                                                     // double acute accent
+	'\u030c': "CČcčDĎdďEĚeěLĽlľNŇnňRŘrřSŠsšTŤtťZŽzžAǍaǎIǏiǐOǑoǒUǓuǔÜǙüǚGǦgǧKǨkǩƷǮʒǯjǰHȞhȟ",                                                                                                       // caron
+	'\u030f': "AȀaȁEȄeȅIȈiȉOȌoȍRȐrȑUȔuȕѴѶѵѷ",                                                                                                                                                     // double grave accent
+	'\u0311': "AȂaȃEȆeȇIȊiȋOȎoȏRȒrȓUȖuȗ",                                                                                                                                                         // inverted breve
+	'\u031b': "OƠoơUƯuư",                                                                                                                                                                         // horn
+	'\u0323': "BḄbḅDḌdḍHḤhḥKḲkḳLḶlḷMṂmṃNṆnṇRṚrṛSṢsṣTṬtṭVṾvṿWẈwẉZẒzẓAẠaạEẸeẹIỊiịOỌoọƠỢơợUỤuụƯỰưựYỴyỵ",                                                                                             // dot below
+	'\u0324': "UṲuṳ",                                                                                                                                                                             // diaeresis below
+	'\u0325': "AḀaḁ",                                                                                                                                                                             // ring below
+	'\u0326': "SȘsșTȚtț",                                                                                                                                                                         // comma below
+	'\u0327': "CÇcçGĢgģKĶkķLĻlļNŅnņRŖrŗSŞsşTŢtţEȨeȩDḐdḑHḨhḩ",                                                                                                                                     // cedilla
+	'\u0328': "AĄaąEĘeęIĮiįUŲuųOǪoǫ",                                                                                                                                                             // ogonek
+	'\u032d': "DḒdḓEḘeḙLḼlḽNṊnṋTṰtṱUṶuṷ",                                                                                                                                                         // circumflex accent below
+	'\u032e': "HḪhḫ",                                                                                                                                                                             // breve below
+	'\u0330': "EḚeḛIḬiḭUṴuṵ",                                                                                                                                                                     // tilde below
+	'\u0331': "BḆbḇDḎdḏKḴkḵLḺlḻNṈnṉRṞrṟTṮtṯZẔzẕhẖ",                                                                                                                                               // macron below
+}
+
+// compositions and decompositions are compositionTable indexed for composeRunes and asciiLetter
+var (
+	compositions   = make(map[rune][]rune, len(compositionTable))
+	decompositions = make(map[rune]rune)
+)
+
+func init() {
+	for mark, pairs := range compositionTable {
+		runes := []rune(pairs)
+		compositions[mark] = runes
+		for i := 0; i+1 < len(runes); i += 2 {
+			decompositions[runes[i+1]] = runes[i]
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package toolkit
+
+import (
+	"testing"
+)
+
+var normalizeFileNameTests = []struct {
+	name          string
+	fileName      string
+	expected      string
+	transliterate string
+}{
+	{name: "ascii", fileName: "report-2024_v2.pdf", expected: "report-2024_v2.pdf", transliterate: "report-2024_v2.pdf"},
+	{name: "nfd", fileName: "cafe\u0301.png", expected: "café.png", transliterate: "cafe.png"},
+	{name: "nfc", fileName: "café.png", expected: "café.png", transliterate: "cafe.png"},
+	{name: "several marks", fileName: "Vie\u0323\u0302t Nam.txt", expected: "Việt-Nam.txt", transliterate: "Viet-Nam.txt"},
+	{name: "cyrillic", fileName: "\u0438\u0306.txt", expected: "й.txt", transliterate: "file.txt"},
+	{name: "hangul", fileName: "\u1112\u1161\u11ab\u1100\u1173\u11af.txt", expected: "한글.txt", transliterate: "file.txt"},
+	{name: "emoji", fileName: "\U0001f4f7 holiday \U0001f334.jpg", expected: "\U0001f4f7-holiday-\U0001f334.jpg", transliterate: "holiday.jpg"},
+	{name: "rtl", fileName: "صورة תמונה.png", expected: "صورة-תמונה.png", transliterate: "file.png"},
+	{name: "rtl override", fileName: "invoice\u202egpj.exe", expected: "invoice-gpj.exe", transliterate: "invoice-gpj.exe"},
+	{name: "reserved characters", fileName: "a<b>:c?  d*.txt", expected: "a-b-c-d.txt", transliterate: "a-b-c-d.txt"},
+	{name: "control characters", fileName: "line\nbreak\t.txt", expected: "line-break.txt", transliterate: "line-break.txt"},
+	{name: "leading dot", fileName: "..notes.txt", expected: "notes.txt", transliterate: "notes.txt"},
+	{name: "nothing left", fileName: "\U0001f4f7.jpg", expected: "\U0001f4f7.jpg", transliterate: "file.jpg"},
+}
+
+func TestNormalizeFileName(t *testing.T) {
+	for _, e := range normalizeFileNameTests {
+		if got := normalizeFileName(e.fileName, false); got != e.expected {
+			t.Errorf("%s: expected %q, but got %q", e.name, e.expected, got)
+		}
+		if got := normalizeFileName(e.fileName, true); got != e.transliterate {
+			t.Errorf("%s: expected %q when transliterating, but got %q", e.name, e.transliterate, got)
+		}
+	}
+}
+
+func TestTools_UploadFiles_NormalizeFilenames(t *testing.T) {
+	fs := &MemoryFS{}
+	testTools := Tools{FS: fs, NormalizeFilenames: true}
+
+	original := "cafe\u0301 menu.txt"
+	uploadedFiles, err := testTools.UploadFiles(newUploadRequest(t, testFile{name: original, content: []byte("some notes")}), "uploads", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uploadedFiles[0].NewFileName != "café-menu.txt" || uploadedFiles[0].OriginalFileName != original {
+		t.Errorf("expected %q saved from %q, but got %q from %q", "café-menu.txt", original, uploadedFiles[0].NewFileName, uploadedFiles[0].OriginalFileName)
+	}
+	if _, err := fs.ReadFile("uploads/café-menu.txt"); err != nil {
+		t.Error(err)
+	}
+
+	// Renamed files are not affected
+	uploadedFiles, err = testTools.UploadFiles(newUploadRequest(t, testFile{name: original, content: []byte("some notes")}), "uploads")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(uploadedFiles[0].NewFileName) != 29 {
+		t.Errorf("expected a random name, but got %q", uploadedFiles[0].NewFileName)
+	}
+}
@@ -0,0 +1,214 @@
+package toolkit
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UploadFilesInto uploads the files in the request like UploadFiles, and then decodes the non-file fields of
+// the form into dst, which must be a pointer to a struct. A field of the form is decoded into the struct field
+// with the same name in its form tag, such as `form:"title"`, or else with the same name, ignoring case, and a
+// form tag of "-" skips a struct field. Fields can be strings, integers, floats, booleans, time.Time values in
+// RFC 3339 format, pointers to those, or slices of those, which receive every value of a repeated field. Struct
+// fields missing from the form are left untouched, and form fields missing from the struct are an error, unless
+// AllowUnknownFields is set.
+func (t *Tools) UploadFilesInto(r *http.Request, uploadDir string, dst any, rename ...bool) (uploadedFiles []*UploadedFile, err error) {
+	uploadedFiles, err = t.UploadFiles(r, uploadDir, rename...)
+	if err != nil {
+		return uploadedFiles, err
+	}
+
+	if err := decodeForm(r.MultipartForm.Value, dst, t.AllowUnknownFields); err != nil {
+		if t.CleanupOnError {
+			t.deleteUploadedFiles(uploadedFiles)
+			uploadedFiles = nil
+		}
+		return uploadedFiles, err
+	}
+	return uploadedFiles, nil
+}
+
+// ReadForm decodes the fields of the URL encoded or multipart form in the body of r into dst, which must be a
+// pointer to a struct, as UploadFilesInto does. Files in a multipart form are ignored. Pointer fields are
+// optional, and left nil when missing, while fields tagged as required, such as `form:"email,required"`, must be
+// present. A time.Time field is parsed with the layout of its layout tag, such as `layout:"2006-01-02"`, or
+// else as RFC 3339.
+func (t *Tools) ReadForm(r *http.Request, dst any) error {
+	var err error
+	if strings.HasPrefix(mediaType(r.Header.Get("Content-Type")), "multipart/") {
+		err = r.ParseMultipartForm(defaultFormMemory)
+	} else {
+		err = r.ParseForm()
+	}
+	if err != nil {
+		return fmt.Errorf("the form cannot be parsed: %w", err)
+	}
+	return decodeForm(r.PostForm, dst, t.AllowUnknownFields)
+}
+
+// ReadQuery decodes the query parameters of r into dst, which must be a pointer to a struct, as ReadForm does
+// with the fields of a form
+func (t *Tools) ReadQuery(r *http.Request, dst any) error {
+	return decodeForm(r.URL.Query(), dst, t.AllowUnknownFields)
+}
+
+// defaultFormMemory is how much of a multipart form ReadForm keeps in memory, the rest of its files being
+// stored in temporary files, as net/http does by default
+const defaultFormMemory = 32 << 20
+
+// formField is a struct field that form fields are decoded into
+type formField struct {
+	index    int
+	name     string
+	layout   string
+	required bool
+}
+
+// decodeForm decodes values into the struct dst points to, as described for UploadFilesInto and ReadForm
+func decodeForm(values url.Values, dst any, allowUnknownFields bool) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return errors.New("the form can only be decoded into a pointer to a struct")
+	}
+	v = v.Elem()
+
+	// Find the struct field of each form field
+	var structFields []formField
+	fields := make(map[string]int)
+	names := make(map[string]int)
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		tag, options, _ := strings.Cut(field.Tag.Get("form"), ",")
+		if tag == "-" {
+			continue
+		}
+		f := formField{index: i, name: tag, layout: field.Tag.Get("layout"), required: options == "required"}
+		if tag == "" {
+			f.name = field.Name
+			names[strings.ToLower(field.Name)] = len(structFields)
+		} else {
+			fields[tag] = len(structFields)
+		}
+		structFields = append(structFields, f)
+	}
+
+	found := make([]bool, len(structFields))
+	for key, formValues := range values {
+		i, ok := fields[key]
+		if !ok {
+			i, ok = names[strings.ToLower(key)]
+		}
+		if !ok {
+			if allowUnknownFields {
+				continue
+			}
+			return fmt.Errorf("form contains unknown field %q", key)
+		}
+
+		found[i] = true
+		f := structFields[i]
+		if err := setFormValue(v.Field(f.index), f.layout, formValues); err != nil {
+			return fmt.Errorf("form field %q is invalid: %w", key, err)
+		}
+	}
+
+	for i, f := range structFields {
+		if f.required && !found[i] {
+			return fmt.Errorf("form field %q is required", f.name)
+		}
+	}
+	return nil
+}
+
+// timeType is the type of time.Time values, which are decoded from RFC 3339 strings, unless another layout is
+// given
+var timeType = reflect.TypeOf(time.Time{})
+
+// setFormValue sets field to the values of a form field, which must be a single one unless field is a slice.
+// A pointer field is set to a new value
+func setFormValue(field reflect.Value, layout string, values []string) error {
+	if field.Kind() == reflect.Pointer {
+		value := reflect.New(field.Type().Elem())
+		if err := setFormValue(value.Elem(), layout, values); err != nil {
+			return err
+		}
+		field.Set(value)
+		return nil
+	}
+
+	if field.Kind() == reflect.Slice {
+		slice := reflect.MakeSlice(field.Type(), len(values), len(values))
+		for i, value := range values {
+			if err := setFormString(slice.Index(i), layout, value); err != nil {
+				return err
+			}
+		}
+		field.Set(slice)
+		return nil
+	}
+
+	if len(values) > 1 {
+		return fmt.Errorf("expected a single value, but got %d", len(values))
+	}
+	return setFormString(field, layout, values[0])
+}
+
+// setFormString sets field to value, converted to the type of field. Times are parsed with layout, or as
+// RFC 3339 when it is empty
+func setFormString(field reflect.Value, layout string, value string) error {
+	if field.Type() == timeType {
+		if layout == "" {
+			layout = time.RFC3339
+		}
+		t, err := time.Parse(layout, value)
+		if err != nil && layout == time.RFC3339 {
+			return fmt.Errorf("%q is not an RFC 3339 time", value)
+		}
+		if err != nil {
+			return fmt.Errorf("%q is not a time in the layout %q", value, layout)
+		}
+		field.Set(reflect.ValueOf(t))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", value)
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("%q is not an integer of %d bits", value, field.Type().Bits())
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("%q is not an unsigned integer of %d bits", value, field.Type().Bits())
+		}
+		field.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("%q is not a number", value)
+		}
+		field.SetFloat(f)
+	default:
+		return fmt.Errorf("cannot decode into a field of type %s", field.Type())
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package toolkit
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// uploadForm is the struct the form fields of the tests are decoded into
+type uploadForm struct {
+	Title     string    `form:"title"`
+	Count     int       `form:"count"`
+	Public    bool      `form:"public"`
+	Ratio     float64   `form:"ratio"`
+	Tags      []string  `form:"tag"`
+	Published time.Time `form:"published"`
+	Note      string    `form:"note"`
+	Ignored   string    `form:"-"`
+	Author    string
+}
+
+// newFormRequest returns a multipart request with a file and the form fields in fields
+func newFormRequest(t *testing.T, fields [][2]string) *http.Request {
+	t.Helper()
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for _, f := range fields {
+		_ = writer.WriteField(f[0], f[1])
+	}
+	part, err := writer.CreateFormFile("file", "notes.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = part.Write([]byte("some notes"))
+	_ = writer.Close()
+
+	request := httptest.NewRequest("POST", "/", body)
+	request.Header.Add("Content-Type", writer.FormDataContentType())
+	return request
+}
+
+var formTests = []struct {
+	name          string
+	fields        [][2]string
+	allowUnknown  bool
+	expected      uploadForm
+	expectedError string
+}{
+	{
+		name:     "all fields",
+		fields:   [][2]string{{"title", "holiday"}, {"count", "3"}, {"public", "true"}, {"ratio", "1.5"}, {"published", "2024-05-01T10:00:00Z"}, {"author", "sam"}},
+		expected: uploadForm{Title: "holiday", Count: 3, Public: true, Ratio: 1.5, Published: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC), Author: "sam"},
+	},
+	{name: "missing optional field", fields: [][2]string{{"title", "holiday"}}, expected: uploadForm{Title: "holiday"}},
+	{name: "repeated value into slice", fields: [][2]string{{"tag", "beach"}, {"tag", "sun"}}, expected: uploadForm{Tags: []string{"beach", "sun"}}},
+	{name: "bad int", fields: [][2]string{{"count", "three"}}, expectedError: `form field "count" is invalid: "three" is not an integer`},
+	{name: "bad time", fields: [][2]string{{"published", "yesterday"}}, expectedError: "is not an RFC 3339 time"},
+	{name: "repeated single value", fields: [][2]string{{"title", "one"}, {"title", "two"}}, expectedError: "expected a single value, but got 2"},
+	{name: "unknown field", fields: [][2]string{{"colour", "blue"}}, expectedError: `form contains unknown field "colour"`},
+	{name: "skipped field", fields: [][2]string{{"Ignored", "x"}}, expectedError: `form contains unknown field "Ignored"`},
+	{name: "unknown field allowed", fields: [][2]string{{"colour", "blue"}, {"title", "holiday"}}, allowUnknown: true, expected: uploadForm{Title: "holiday"}},
+}
+
+func TestTools_UploadFilesInto(t *testing.T) {
+	for _, e := range formTests {
+		testTools := Tools{FS: &MemoryFS{}, AllowUnknownFields: e.allowUnknown}
+
+		var form uploadForm
+		uploadedFiles, err := testTools.UploadFilesInto(newFormRequest(t, e.fields), "uploads", &form)
+		if e.expectedError != "" {
+			if err == nil || !strings.Contains(err.Error(), e.expectedError) {
+				t.Errorf("%s: expected error containing %q, but got %v", e.name, e.expectedError, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: error not expected, but one received: %s", e.name, err)
+			continue
+		}
+
+		if len(uploadedFiles) != 1 {
+			t.Errorf("%s: expected 1 uploaded file, but got %d", e.name, len(uploadedFiles))
+		}
+		if form.Title != e.expected.Title || form.Count != e.expected.Count || form.Public != e.expected.Public ||
+			form.Ratio != e.expected.Ratio || !form.Published.Equal(e.expected.Published) || form.Author != e.expected.Author ||
+			strings.Join(form.Tags, ",") != strings.Join(e.expected.Tags, ",") {
+			t.Errorf("%s: expected %+v, but got %+v", e.name, e.expected, form)
+		}
+	}
+
+	// Only pointers to structs can be decoded into
+	var testTools Tools
+	var notStruct string
+	if _, err := testTools.UploadFilesInto(newFormRequest(t, nil), t.TempDir(), &notStruct); err == nil {
+		t.Error("expected an error when decoding into a string")
+	}
+}
+
+// searchForm is the struct the fields of ReadForm and ReadQuery are decoded into
+type searchForm struct {
+	Query  string     `form:"q,required"`
+	Page   *int       `form:"page"`
+	Limit  uint8      `form:"limit"`
+	Exact  *bool      `form:"exact"`
+	Since  *time.Time `form:"since" layout:"2006-01-02"`
+	Sort   []string   `form:"sort"`
+	Weight float32
+}
+
+var readFormTests = []struct {
+	name          string
+	query         string
+	allowUnknown  bool
+	check         func(searchForm) bool
+	expectedError string
+}{
+	{name: "all fields", query: "q=shoes&page=2&limit=20&exact=true&since=2024-05-01&sort=price&sort=-date&weight=0.5", check: func(f searchForm) bool {
+		return f.Query == "shoes" && *f.Page == 2 && f.Limit == 20 && *f.Exact && f.Since.Equal(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)) &&
+			strings.Join(f.Sort, ",") == "price,-date" && f.Weight == 0.5
+	}},
+	{name: "missing optional pointers", query: "q=shoes", check: func(f searchForm) bool { return f.Page == nil && f.Exact == nil && f.Since == nil }},
+	{name: "missing required field", query: "page=2", expectedError: `form field "q" is required`},
+	{name: "bad int", query: "q=shoes&page=two", expectedError: `form field "page" is invalid: "two" is not an integer`},
+	{name: "out of range", query: "q=shoes&limit=300", expectedError: `form field "limit" is invalid: "300" is not an unsigned integer of 8 bits`},
+	{name: "bad layout", query: "q=shoes&since=2024-05-01T10:00:00Z", expectedError: `"2024-05-01T10:00:00Z" is not a time in the layout "2006-01-02"`},
+	{name: "repeated single value", query: "q=shoes&q=boots", expectedError: "expected a single value, but got 2"},
+	{name: "unknown field", query: "q=shoes&colour=red", expectedError: `form contains unknown field "colour"`},
+	{name: "unknown field allowed", query: "q=shoes&colour=red", allowUnknown: true, check: func(f searchForm) bool { return f.Query == "shoes" }},
+}
+
+func TestTools_ReadForm(t *testing.T) {
+	for _, e := range readFormTests {
+		testTools := Tools{AllowUnknownFields: e.allowUnknown}
+
+		// The same fields are sent in a URL encoded form, a multipart form, and the query
+		values, _ := url.ParseQuery(e.query)
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		for key, vs := range values {
+			for _, v := range vs {
+				_ = writer.WriteField(key, v)
+			}
+		}
+		_ = writer.Close()
+
+		urlEncoded := httptest.NewRequest("POST", "/?ignored=1", strings.NewReader(e.query))
+		urlEncoded.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		multipartForm := httptest.NewRequest("POST", "/?ignored=1", body)
+		multipartForm.Header.Set("Content-Type", writer.FormDataContentType())
+
+		for kind, read := range map[string]func(*searchForm) error{
+			"url encoded": func(f *searchForm) error { return testTools.ReadForm(urlEncoded, f) },
+			"multipart":   func(f *searchForm) error { return testTools.ReadForm(multipartForm, f) },
+			"query": func(f *searchForm) error {
+				return testTools.ReadQuery(httptest.NewRequest("GET", "/?"+e.query, nil), f)
+			},
+		} {
+			var form searchForm
+			err := read(&form)
+			if e.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), e.expectedError) {
+					t.Errorf("%s, %s: expected error containing %q, but got %v", e.name, kind, e.expectedError, err)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("%s, %s: error not expected, but one received: %s", e.name, kind, err)
+				continue
+			}
+			if !e.check(form) {
+				t.Errorf("%s, %s: wrong values %+v", e.name, kind, form)
+			}
+		}
+	}
+}
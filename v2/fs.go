@@ -0,0 +1,346 @@
+package toolkit
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// FileSystem is the file system uploaded files are saved to, and CreateDirIfNotExists and DownloadStaticFile
+// work on. It is the local disk unless Tools.FS is set, for instance to a MemoryFS in tests.
+type FileSystem interface {
+	// Create creates or truncates the file name, and returns a writer for its contents
+	Create(name string) (io.WriteCloser, error)
+	// Open opens the file name for reading
+	Open(name string) (fs.File, error)
+	// MkdirAll creates the directory path and any missing parents, with the mode perm
+	MkdirAll(path string, perm os.FileMode) error
+	// Stat returns information about the file or directory name
+	Stat(name string) (fs.FileInfo, error)
+	// Remove removes the file or empty directory name
+	Remove(name string) error
+}
+
+// osFS is the FileSystem of the local disk
+type osFS struct{}
+
+// Create creates the file name on the local disk
+func (osFS) Create(name string) (io.WriteCloser, error) { return os.Create(name) }
+
+// Open opens the file name on the local disk
+func (osFS) Open(name string) (fs.File, error) { return os.Open(name) }
+
+// MkdirAll creates the directory path on the local disk
+func (osFS) MkdirAll(path string, perm os.FileMode) error { return os.MkdirAll(path, perm) }
+
+// Stat returns information about the file name on the local disk
+func (osFS) Stat(name string) (fs.FileInfo, error) { return os.Stat(name) }
+
+// Remove removes the file name from the local disk
+func (osFS) Remove(name string) error { return os.Remove(name) }
+
+// CreateNew creates the file name on the local disk, failing with an error matching os.ErrExist when it exists
+func (osFS) CreateNew(name string) (io.WriteCloser, error) {
+	return os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+}
+
+// exclusiveCreator is implemented by a FileSystem that can create a file only when it does not exist yet, as
+// the local disk and MemoryFS can
+type exclusiveCreator interface {
+	CreateNew(name string) (io.WriteCloser, error)
+}
+
+// fileSystem returns FS, or the local disk when it is not set
+func (t *Tools) fileSystem() FileSystem {
+	if t.FS != nil {
+		return t.FS
+	}
+	return osFS{}
+}
+
+// onLocalDisk reports whether uploaded files are saved directly to the local disk, which some options need
+func (t *Tools) onLocalDisk() bool {
+	return t.Store == nil && t.FS == nil
+}
+
+// fsStore is a FileStore that saves files to a FileSystem
+type fsStore struct {
+	fs      FileSystem
+	dirPerm os.FileMode
+}
+
+// fsStoreMu serializes SaveNew on the file systems that cannot create a file exclusively
+var fsStoreMu sync.Mutex
+
+// Save creates the file name, and any missing parent directories, replacing an existing file. The key
+// returned is the cleaned name. A file that cannot be written completely is removed.
+func (s fsStore) Save(name string, r io.Reader) (string, int64, error) {
+	return s.save(name, r, s.fs.Create)
+}
+
+// SaveNew is like Save, but fails with an error matching os.ErrExist, without reading from r, when the file
+// name exists, which the CollisionError and CollisionAutoSuffix policies need. On a file system that cannot
+// create a file exclusively, the check and the creation are serialized within the process only
+func (s fsStore) SaveNew(name string, r io.Reader) (string, int64, error) {
+	if creator, ok := s.fs.(exclusiveCreator); ok {
+		return s.save(name, r, creator.CreateNew)
+	}
+	return s.save(name, r, func(name string) (io.WriteCloser, error) {
+		fsStoreMu.Lock()
+		defer fsStoreMu.Unlock()
+		if _, err := s.fs.Stat(name); err == nil {
+			return nil, &fs.PathError{Op: "create", Path: name, Err: fs.ErrExist}
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		return s.fs.Create(name)
+	})
+}
+
+// save creates the file name with create, and any missing parent directories, and writes r to it
+func (s fsStore) save(name string, r io.Reader, create func(name string) (io.WriteCloser, error)) (string, int64, error) {
+	name = filepath.Clean(filepath.FromSlash(name))
+	if err := s.fs.MkdirAll(filepath.Dir(name), s.dirPerm); err != nil {
+		return "", 0, err
+	}
+
+	f, err := create(name)
+	if err != nil {
+		return "", 0, err
+	}
+	size, err := io.Copy(f, r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = s.fs.Remove(name)
+		return "", 0, err
+	}
+	return name, size, nil
+}
+
+// Delete removes the file stored under key
+func (s fsStore) Delete(key string) error {
+	return s.fs.Remove(key)
+}
+
+// MemoryFS is a FileSystem that keeps files in memory, which is mostly useful in tests. The zero value is an
+// empty file system, and paths are cleaned, so "a/./b" and "a/b" are the same file.
+type MemoryFS struct {
+	mu    sync.Mutex
+	files map[string]*memoryFile
+}
+
+// memoryFile is a file or directory of a MemoryFS
+type memoryFile struct {
+	name    string
+	data    []byte
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+// init creates the map of files on first use
+func (m *MemoryFS) init() {
+	if m.files == nil {
+		m.files = map[string]*memoryFile{".": {name: ".", mode: fs.ModeDir | 0755}, "/": {name: "/", mode: fs.ModeDir | 0755}}
+	}
+}
+
+// memoryPath returns the key name is kept under
+func memoryPath(name string) string {
+	return path.Clean(filepath.ToSlash(name))
+}
+
+// Create creates or truncates the file name, whose parent directory must exist. The contents are stored when
+// the returned writer is closed.
+func (m *MemoryFS) Create(name string) (io.WriteCloser, error) {
+	return m.create(name, false)
+}
+
+// CreateNew is like Create, but fails with an error matching os.ErrExist when the file name exists
+func (m *MemoryFS) CreateNew(name string) (io.WriteCloser, error) {
+	return m.create(name, true)
+}
+
+// create does the work of Create and CreateNew, checking whether the file exists and creating it at once
+func (m *MemoryFS) create(name string, exclusive bool) (io.WriteCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.init()
+
+	name = memoryPath(name)
+	if parent, ok := m.files[path.Dir(name)]; !ok || !parent.mode.IsDir() {
+		return nil, &fs.PathError{Op: "create", Path: name, Err: fs.ErrNotExist}
+	}
+	if f, ok := m.files[name]; ok && f.mode.IsDir() {
+		return nil, &fs.PathError{Op: "create", Path: name, Err: errors.New("is a directory")}
+	} else if ok && exclusive {
+		return nil, &fs.PathError{Op: "create", Path: name, Err: fs.ErrExist}
+	}
+	m.files[name] = &memoryFile{name: path.Base(name), mode: 0666, modTime: time.Now()}
+	return &memoryWriter{fs: m, name: name}, nil
+}
+
+// Open opens the file name for reading
+func (m *MemoryFS) Open(name string) (fs.File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.init()
+
+	f, ok := m.files[memoryPath(name)]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return &memoryReader{Reader: bytes.NewReader(f.data), info: newMemoryFileInfo(f)}, nil
+}
+
+// MkdirAll creates the directory path and any missing parents
+func (m *MemoryFS) MkdirAll(dir string, perm os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.init()
+
+	dir = memoryPath(dir)
+	for p := dir; ; p = path.Dir(p) {
+		if f, ok := m.files[p]; ok {
+			if !f.mode.IsDir() {
+				return &fs.PathError{Op: "mkdir", Path: p, Err: errors.New("not a directory")}
+			}
+			break
+		}
+		if p == path.Dir(p) {
+			break
+		}
+	}
+	for p := dir; ; p = path.Dir(p) {
+		if _, ok := m.files[p]; ok {
+			break
+		}
+		m.files[p] = &memoryFile{name: path.Base(p), mode: fs.ModeDir | perm, modTime: time.Now()}
+	}
+	return nil
+}
+
+// Stat returns information about the file or directory name
+func (m *MemoryFS) Stat(name string) (fs.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.init()
+
+	f, ok := m.files[memoryPath(name)]
+	if !ok {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return newMemoryFileInfo(f), nil
+}
+
+// Remove removes the file or empty directory name
+func (m *MemoryFS) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.init()
+
+	name = memoryPath(name)
+	if _, ok := m.files[name]; !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	for p := range m.files {
+		if p != name && path.Dir(p) == name {
+			return &fs.PathError{Op: "remove", Path: name, Err: errors.New("directory not empty")}
+		}
+	}
+	delete(m.files, name)
+	return nil
+}
+
+// ReadFile returns the contents of the file name
+func (m *MemoryFS) ReadFile(name string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.init()
+
+	f, ok := m.files[memoryPath(name)]
+	if !ok || f.mode.IsDir() {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrNotExist}
+	}
+	return bytes.Clone(f.data), nil
+}
+
+// FileNames returns the sorted names of the files, not directories, directly in dir
+func (m *MemoryFS) FileNames(dir string) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.init()
+
+	dir = memoryPath(dir)
+	var names []string
+	for p, f := range m.files {
+		if p != dir && path.Dir(p) == dir && !f.mode.IsDir() {
+			names = append(names, f.name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// memoryWriter collects the contents of a file of a MemoryFS
+type memoryWriter struct {
+	fs   *MemoryFS
+	name string
+	buf  bytes.Buffer
+}
+
+// Write appends p to the contents of the file
+func (w *memoryWriter) Write(p []byte) (int, error) {
+	return w.buf.Write(p)
+}
+
+// Close stores the contents of the file, unless it was removed in the meantime
+func (w *memoryWriter) Close() error {
+	w.fs.mu.Lock()
+	defer w.fs.mu.Unlock()
+	if f, ok := w.fs.files[w.name]; ok {
+		f.data = w.buf.Bytes()
+		f.modTime = time.Now()
+	}
+	return nil
+}
+
+// memoryReader is a file of a MemoryFS opened for reading
+type memoryReader struct {
+	*bytes.Reader
+	info memoryFileInfo
+}
+
+// Stat returns information about the file
+func (r *memoryReader) Stat() (fs.FileInfo, error) { return r.info, nil }
+
+// Close does nothing
+func (r *memoryReader) Close() error { return nil }
+
+// memoryFileInfo describes a file of a MemoryFS, as it was when it was asked for
+type memoryFileInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+// newMemoryFileInfo describes f, which must be called with the lock of its MemoryFS held
+func newMemoryFileInfo(f *memoryFile) memoryFileInfo {
+	return memoryFileInfo{name: f.name, size: int64(len(f.data)), mode: f.mode, modTime: f.modTime}
+}
+
+func (i memoryFileInfo) Name() string       { return i.name }
+func (i memoryFileInfo) Size() int64        { return i.size }
+func (i memoryFileInfo) Mode() fs.FileMode  { return i.mode }
+func (i memoryFileInfo) ModTime() time.Time { return i.modTime }
+func (i memoryFileInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i memoryFileInfo) Sys() any           { return nil }
@@ -0,0 +1,44 @@
+package toolkit
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net/http"
+)
+
+// idempotencyKeyHeader is the header idempotency keys are sent in, as payment providers such as Stripe expect
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// WithIdempotencyKey sends key in the Idempotency-Key header, on every attempt of the call, so a service that
+// supports it carries out a retried call only once
+func WithIdempotencyKey(key string) RemoteOption {
+	return func(o *remoteOptions) {
+		o.setHeader(idempotencyKeyHeader, key)
+	}
+}
+
+// IdempotencyKey returns the Idempotency-Key sent with the request response answers, such as the key
+// AutoIdempotencyKey generated, so callers can persist it, or "" when none was sent
+func IdempotencyKey(response *http.Response) string {
+	if response == nil || response.Request == nil {
+		return ""
+	}
+	return response.Request.Header.Get(idempotencyKeyHeader)
+}
+
+// needsIdempotencyKey reports whether a call with method gets a key when AutoIdempotencyKey is set: POST and
+// PATCH, which are not idempotent by themselves
+func needsIdempotencyKey(method string) bool {
+	return method == http.MethodPost || method == http.MethodPatch
+}
+
+// newIdempotencyKey returns a random version 4 UUID, the format most services expect idempotency keys in
+func newIdempotencyKey() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
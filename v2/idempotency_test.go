@@ -0,0 +1,91 @@
+package toolkit
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// keyClient returns a client answering 503 to the first failures calls, and 200 after them, recording the
+// Idempotency-Key of every call in keys
+func keyClient(keys *[]string, failures int) *http.Client {
+	var mu sync.Mutex
+	return NewTestClient(func(request *http.Request) *http.Response {
+		mu.Lock()
+		defer mu.Unlock()
+		*keys = append(*keys, request.Header.Get("Idempotency-Key"))
+		status := http.StatusOK
+		if len(*keys) <= failures {
+			status = http.StatusServiceUnavailable
+		}
+		return &http.Response{StatusCode: status, Body: io.NopCloser(strings.NewReader(`{}`)), Header: make(http.Header)}
+	})
+}
+
+func TestTools_CallRemote_AutoIdempotencyKey(t *testing.T) {
+	testTools := Tools{AutoIdempotencyKey: true}
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+	var first, second []string
+	response, err := testTools.CallRemote(context.Background(), http.MethodPost, "http://example.com/charges", map[string]int{"amount": 100},
+		WithHTTPClient(keyClient(&first, 2)), WithRetry(RetryPolicy{BaseDelay: 1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if len(first) != 3 || !uuid.MatchString(first[0]) || first[1] != first[0] || first[2] != first[0] {
+		t.Errorf("expected the same key on every attempt, but got %q", first)
+	}
+	if key := IdempotencyKey(response); key != first[0] {
+		t.Errorf("expected IdempotencyKey to return %q, but got %q", first[0], key)
+	}
+
+	response, err = testTools.CallRemote(context.Background(), http.MethodPost, "http://example.com/charges", map[string]int{"amount": 100}, WithHTTPClient(keyClient(&second, 0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if !uuid.MatchString(second[0]) || second[0] == first[0] {
+		t.Errorf("expected separate calls to get different keys, but got %q and %q", first[0], second[0])
+	}
+
+	// Safe and idempotent methods get no key
+	var keys []string
+	response, err = testTools.CallRemote(context.Background(), http.MethodPut, "http://example.com/charges/1", "data", WithHTTPClient(keyClient(&keys, 0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if keys[0] != "" || IdempotencyKey(response) != "" {
+		t.Errorf("expected a PUT to get no key, but got %q", keys[0])
+	}
+}
+
+func TestTools_CallRemote_WithIdempotencyKey(t *testing.T) {
+	for _, auto := range []bool{false, true} {
+		testTools := Tools{AutoIdempotencyKey: auto}
+		var keys []string
+		_, status, err := testTools.PushJSONToRemote("http://example.com", "data", keyClient(&keys, 0))
+		if err != nil || status != http.StatusOK {
+			t.Fatalf("expected the push to succeed, but got %d, %v", status, err)
+		}
+		if (keys[0] != "") != auto {
+			t.Errorf("auto %v: expected a key only with AutoIdempotencyKey, but got %q", auto, keys[0])
+		}
+
+		keys = nil
+		response, err := testTools.CallRemote(context.Background(), http.MethodPost, "http://example.com", "data",
+			WithHTTPClient(keyClient(&keys, 1)), WithIdempotencyKey("order-42"), WithRetry(RetryPolicy{BaseDelay: 1}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		if len(keys) != 2 || keys[0] != "order-42" || keys[1] != "order-42" || IdempotencyKey(response) != "order-42" {
+			t.Errorf("auto %v: expected the key passed on every attempt, but got %q", auto, keys)
+		}
+	}
+}
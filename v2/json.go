@@ -0,0 +1,346 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ReadJSONInto reads the JSON body of request into a new value of type T, with the same limits, options and
+// error messages as ReadJSON, and returns it, as in user, err := toolkit.ReadJSONInto[CreateUserRequest](t, w, r).
+// The zero value of T is returned along with any error.
+func ReadJSONInto[T any](t *Tools, writer http.ResponseWriter, request *http.Request) (T, error) {
+	var data T
+	if err := t.ReadJSON(writer, request, &data); err != nil {
+		var zero T
+		return zero, err
+	}
+	return data, nil
+}
+
+// WriteJSONValue writes data as JSON with the status code, like WriteJSON, but only accepts values of type T,
+// so a handler cannot send something other than the type it documents by mistake
+func WriteJSONValue[T any](t *Tools, writer http.ResponseWriter, status int, data T, headers ...http.Header) error {
+	return t.WriteJSON(writer, status, data, headers...)
+}
+
+// ErrBodyTooLarge is matched by the error ReadJSON returns for a body larger than MaxJSONSize
+var ErrBodyTooLarge = errors.New("body is too large")
+
+// ErrEmptyBody is returned by ReadJSON for an empty body
+var ErrEmptyBody = errors.New("body must not be empty")
+
+// ErrMultipleJSONValues is returned by ReadJSON for a body with more than one JSON value
+var ErrMultipleJSONValues = errors.New("body must contain only one JSON value")
+
+// ErrMalformedJSON is returned by ReadJSON for a body that is not valid JSON
+type ErrMalformedJSON struct {
+	// Offset is the number of bytes read before the error, when it is known
+	Offset int64
+	// Err is the error of the decoder
+	Err error
+}
+
+func (e *ErrMalformedJSON) Error() string {
+	if e.Offset > 0 {
+		return fmt.Sprintf("body contains badly-formed JSON (at character %d)", e.Offset)
+	}
+	return "body contains badly-formed JSON"
+}
+
+func (e *ErrMalformedJSON) Unwrap() error { return e.Err }
+
+// ErrUnknownField is returned by ReadJSON for a body with a key that does not match any field, unless
+// AllowUnknownFields is set
+type ErrUnknownField struct {
+	// Field is the unknown key
+	Field string
+	// Err is the error of the decoder
+	Err error
+}
+
+func (e *ErrUnknownField) Error() string {
+	return fmt.Sprintf("body contains unknown key %q", e.Field)
+}
+
+func (e *ErrUnknownField) Unwrap() error { return e.Err }
+
+// ErrWrongType is returned by ReadJSON for a body with a value of the wrong type for the field it is decoded
+// into
+type ErrWrongType struct {
+	// Field is the path of the field, when it is known
+	Field string
+	// Offset is the number of bytes read before the value
+	Offset int64
+	// Err is the error of the decoder
+	Err error
+}
+
+func (e *ErrWrongType) Error() string {
+	if e.Field != "" {
+		return fmt.Sprintf("body contains incorrect JSON type for field %q", e.Field)
+	}
+	return fmt.Sprintf("body contains incorrect JSON type (at character %d)", e.Offset)
+}
+
+func (e *ErrWrongType) Unwrap() error { return e.Err }
+
+// ErrUnsupportedMediaType is returned by ReadJSON, when EnforceJSONContentType is set, for a request whose
+// Content-Type is not JSON, and by PushJSONToRemoteInto for such a response
+type ErrUnsupportedMediaType struct {
+	// ContentType is the Content-Type header of the request, or response
+	ContentType string
+	// expected is the type the message asks for, application/json when empty
+	expected string
+}
+
+func (e *ErrUnsupportedMediaType) Error() string {
+	expected := e.expected
+	if expected == "" {
+		expected = "application/json"
+	}
+	if e.ContentType == "" {
+		return fmt.Sprintf("Content-Type must be %s, but it is missing", expected)
+	}
+	return fmt.Sprintf("Content-Type must be %s, but got %q", expected, e.ContentType)
+}
+
+// checkJSONContentType returns an *ErrUnsupportedMediaType when the Content-Type of request is not
+// application/json or a type with a +json suffix. A request without Content-Type nor body, such as most GET
+// and DELETE requests, is accepted
+func checkJSONContentType(request *http.Request) error {
+	contentType := request.Header.Get("Content-Type")
+	if contentType == "" && request.ContentLength == 0 && (request.Method == http.MethodGet || request.Method == http.MethodDelete) {
+		return nil
+	}
+
+	if !isJSONMediaType(contentType) {
+		return &ErrUnsupportedMediaType{ContentType: contentType}
+	}
+	return nil
+}
+
+// isJSONMediaType reports whether contentType is application/json or a type with a +json suffix
+func isJSONMediaType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"))
+}
+
+// ErrJSONTooDeep is returned by ReadJSON for a body with arrays and objects nested deeper than MaxJSONDepth
+type ErrJSONTooDeep struct {
+	// Limit is MaxJSONDepth
+	Limit int
+}
+
+func (e *ErrJSONTooDeep) Error() string {
+	return fmt.Sprintf("body must not be nested more than %d levels deep", e.Limit)
+}
+
+// ErrTooManyJSONTokens is returned by ReadJSON for a body with more than MaxJSONTokens tokens
+type ErrTooManyJSONTokens struct {
+	// Limit is MaxJSONTokens
+	Limit int
+}
+
+func (e *ErrTooManyJSONTokens) Error() string {
+	return fmt.Sprintf("body must not contain more than %d JSON tokens", e.Limit)
+}
+
+// checkJSONLimits checks body against MaxJSONDepth and MaxJSONTokens, token by token, so a body that breaks
+// them is rejected without decoding it. Syntax errors are left for the decoder to report
+func (t *Tools) checkJSONLimits(body []byte) error {
+	decode := json.NewDecoder(bytes.NewReader(body))
+	depth, tokens := 0, 0
+	for {
+		token, err := decode.Token()
+		if err != nil {
+			return nil
+		}
+
+		tokens++
+		if t.MaxJSONTokens > 0 && tokens > t.MaxJSONTokens {
+			return &ErrTooManyJSONTokens{Limit: t.MaxJSONTokens}
+		}
+
+		switch token {
+		case json.Delim('['), json.Delim('{'):
+			depth++
+			if t.MaxJSONDepth > 0 && depth > t.MaxJSONDepth {
+				return &ErrJSONTooDeep{Limit: t.MaxJSONDepth}
+			}
+		case json.Delim(']'), json.Delim('}'):
+			depth--
+		}
+	}
+}
+
+// unknownFieldPrefix starts the message of the error json.Decoder returns for an unknown field, which has no
+// type of its own
+const unknownFieldPrefix = "json: unknown field "
+
+// isUnknownFieldError reports whether err is the error json.Decoder returns for an unknown field, when
+// DisallowUnknownFields is set. The decoder only tells by its message, so all the parsing of that message is
+// done here and in unknownFieldName
+func isUnknownFieldError(err error) bool {
+	return strings.HasPrefix(err.Error(), unknownFieldPrefix)
+}
+
+// unknownFieldName returns the name of the unknown field of an error for which isUnknownFieldError is true
+func unknownFieldName(err error) string {
+	name := strings.TrimPrefix(err.Error(), unknownFieldPrefix)
+	if unquoted, err := strconv.Unquote(name); err == nil {
+		return unquoted
+	}
+	return name
+}
+
+// jsonError is an error with its own message, that matches several errors, such as a sentinel error and the
+// error it was caused by
+type jsonError struct {
+	message string
+	errs    []error
+}
+
+func (e *jsonError) Error() string   { return e.message }
+func (e *jsonError) Unwrap() []error { return e.errs }
+
+// JSONErrorStatus returns the status code suggested to respond with to a request ReadJSON failed to read
+// with err: 413 Request Entity Too Large for a body that is too large, 408 Request Timeout for a body that
+// took too long to read, 415 Unsupported Media Type for a
+// Content-Type that is not JSON or a Content-Encoding that is not supported, 422 Unprocessable Entity for an
+// unknown field or a value that is not valid, 500 Internal Server Error when ReadJSON was misused, such as with
+// data that is not a pointer or a default tag that is not valid, and 400 Bad Request otherwise.
+func JSONErrorStatus(err error) int {
+	var unknownField *ErrUnknownField
+	var validationErr *ValidationError
+	var invalidUnmarshalErr *json.InvalidUnmarshalError
+	var invalidDefault *ErrInvalidDefault
+	var unsupportedMediaType *ErrUnsupportedMediaType
+	switch {
+	case errors.Is(err, ErrBodyTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrReadTimeout):
+		return http.StatusRequestTimeout
+	case errors.As(err, &unsupportedMediaType), errors.Is(err, ErrUnsupportedContentEncoding):
+		return http.StatusUnsupportedMediaType
+	case errors.As(err, &unknownField), errors.As(err, &validationErr):
+		return http.StatusUnprocessableEntity
+	case errors.As(err, &invalidUnmarshalErr), errors.As(err, &invalidDefault):
+		return http.StatusInternalServerError
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// Validator is implemented by values that ReadJSON validates once they are decoded. Validate returns an error
+// when the value is not valid, which may be a *ValidationError to tell which fields are wrong.
+type Validator interface {
+	Validate() error
+}
+
+// FieldValidator is implemented by values that ReadJSON validates once they are decoded. Valid returns a
+// description of what is wrong with each invalid field, keyed by field name, which is empty when the value is
+// valid.
+type FieldValidator interface {
+	Valid() map[string]string
+}
+
+// ValidationError is returned by ReadJSON when the decoded value is not valid, so handlers can tell it from a
+// malformed body, and respond with 422 Unprocessable Entity rather than 400 Bad Request
+type ValidationError struct {
+	// Fields describes what is wrong with each invalid field, when that is known
+	Fields map[string]string
+	// Err is the error returned by Validate, if any
+	Err error
+}
+
+// Error returns the error returned by Validate, or else lists the invalid fields
+func (e *ValidationError) Error() string {
+	if e.Err != nil {
+		return e.Err.Error()
+	}
+
+	fields := make([]string, 0, len(e.Fields))
+	for field, problem := range e.Fields {
+		fields = append(fields, fmt.Sprintf("%s: %s", field, problem))
+	}
+	sort.Strings(fields)
+	return "body is not valid: " + strings.Join(fields, ", ")
+}
+
+// Unwrap returns the error returned by Validate
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// validate validates data, when it implements Validator or FieldValidator, and returns a *ValidationError if
+// it is not valid
+func validate(data any) error {
+	switch v := data.(type) {
+	case Validator:
+		err := v.Validate()
+		if err == nil {
+			return nil
+		}
+		var validationErr *ValidationError
+		if errors.As(err, &validationErr) {
+			return err
+		}
+		return &ValidationError{Err: err}
+	case FieldValidator:
+		if fields := v.Valid(); len(fields) > 0 {
+			return &ValidationError{Fields: fields}
+		}
+	}
+	return nil
+}
+
+// GetInt64 returns the number m holds under key as an int64, whether it was decoded as a json.Number, with
+// UseNumber, or as a float64 holding a whole number
+func GetInt64(m map[string]any, key string) (int64, error) {
+	return int64Value(key, m[key])
+}
+
+// int64Value returns value, the value of key, as GetInt64 does
+func int64Value(key string, value any) (int64, error) {
+	switch v := value.(type) {
+	case json.Number:
+		return v.Int64()
+	case float64:
+		if v != math.Trunc(v) || v < math.MinInt64 || v >= math.MaxInt64 {
+			return 0, fmt.Errorf("the value of %q is not an integer: %v", key, v)
+		}
+		return int64(v), nil
+	case nil:
+		return 0, fmt.Errorf("no value for %q", key)
+	default:
+		return 0, fmt.Errorf("the value of %q is not a number: %v", key, v)
+	}
+}
+
+// GetFloat64 returns the number m holds under key as a float64, whether it was decoded as a json.Number, with
+// UseNumber, or as a float64
+func GetFloat64(m map[string]any, key string) (float64, error) {
+	return float64Value(key, m[key])
+}
+
+// float64Value returns value, the value of key, as GetFloat64 does
+func float64Value(key string, value any) (float64, error) {
+	switch v := value.(type) {
+	case json.Number:
+		return v.Float64()
+	case float64:
+		return v, nil
+	case nil:
+		return 0, fmt.Errorf("no value for %q", key)
+	default:
+		return 0, fmt.Errorf("the value of %q is not a number: %v", key, v)
+	}
+}
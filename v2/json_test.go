@@ -0,0 +1,884 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadJSONInto(t *testing.T) {
+	type payload struct {
+		Foo string `json:"foo"`
+	}
+
+	for _, e := range jsonTests {
+		testTools := Tools{MaxJSONSize: e.maxSize, AllowUnknownFields: e.allowUnknown}
+
+		request := httptest.NewRequest("POST", "/", strings.NewReader(e.json))
+		decoded, err := ReadJSONInto[payload](&testTools, httptest.NewRecorder(), request)
+		if e.errorExpected && err == nil {
+			t.Errorf("%s: error expected, but none received", e.name)
+		}
+		if !e.errorExpected && err != nil {
+			t.Errorf("%s: error not expected, but one received: %s", e.name, err.Error())
+		}
+
+		// The generic path returns the same errors as ReadJSON, and the zero value when it fails
+		var expected payload
+		expectedErr := testTools.ReadJSON(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader(e.json)), &expected)
+		if (err == nil) != (expectedErr == nil) || (err != nil && err.Error() != expectedErr.Error()) {
+			t.Errorf("%s: expected error %v, but got %v", e.name, expectedErr, err)
+		}
+		if err != nil {
+			expected = payload{}
+		}
+		if decoded != expected {
+			t.Errorf("%s: expected %+v, but got %+v", e.name, expected, decoded)
+		}
+	}
+}
+
+func TestWriteJSONValue(t *testing.T) {
+	var testTools Tools
+
+	rr := httptest.NewRecorder()
+	headers := make(http.Header)
+	headers.Add("FOO", "BAR")
+	if err := WriteJSONValue(&testTools, rr, http.StatusCreated, JSONResponse{Message: "foo"}, headers); err != nil {
+		t.Fatalf("failed to write JSON: %v", err)
+	}
+
+	var payload JSONResponse
+	if err := json.NewDecoder(rr.Body).Decode(&payload); err != nil {
+		t.Fatal(err)
+	}
+	if rr.Code != http.StatusCreated || payload.Message != "foo" || rr.Header().Get("FOO") != "BAR" {
+		t.Errorf("wrong response: status %d, payload %+v, headers %v", rr.Code, payload, rr.Header())
+	}
+}
+
+// createUserRequest rejects a missing name with a *ValidationError
+type createUserRequest struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+func (r createUserRequest) Validate() error {
+	if r.Name == "" {
+		return &ValidationError{Fields: map[string]string{"name": "is required"}}
+	}
+	if !strings.Contains(r.Email, "@") {
+		return errors.New("email is not valid")
+	}
+	return nil
+}
+
+// signupRequest reports its invalid fields with Valid
+type signupRequest struct {
+	Password string `json:"password"`
+}
+
+func (r *signupRequest) Valid() map[string]string {
+	if len(r.Password) < 8 {
+		return map[string]string{"password": "is too short"}
+	}
+	return nil
+}
+
+var validationTests = []struct {
+	name           string
+	json           string
+	data           any
+	expectedError  string
+	notValidation  bool
+	expectedFields map[string]string
+}{
+	{name: "valid", json: `{"name": "Ann", "email": "ann@example.com"}`, data: &createUserRequest{}},
+	{name: "missing field", json: `{"email": "ann@example.com"}`, data: &createUserRequest{}, expectedError: "body is not valid: name: is required", expectedFields: map[string]string{"name": "is required"}},
+	{name: "plain error", json: `{"name": "Ann", "email": "ann"}`, data: &createUserRequest{}, expectedError: "email is not valid"},
+	{name: "valid fields", json: `{"password": "correct horse"}`, data: &signupRequest{}},
+	{name: "invalid fields", json: `{"password": "short"}`, data: &signupRequest{}, expectedError: "body is not valid: password: is too short", expectedFields: map[string]string{"password": "is too short"}},
+	{name: "badly formed json is not a validation error", json: `{"name": }`, data: &createUserRequest{}, expectedError: "body contains badly-formed JSON (at character 10)", notValidation: true},
+}
+
+func TestTools_ReadJSON_Validation(t *testing.T) {
+	var testTools Tools
+	for _, e := range validationTests {
+		request := httptest.NewRequest("POST", "/", strings.NewReader(e.json))
+		err := testTools.ReadJSON(httptest.NewRecorder(), request, e.data)
+		if e.expectedError == "" {
+			if err != nil {
+				t.Errorf("%s: error not expected, but one received: %s", e.name, err)
+			}
+			continue
+		}
+		if err == nil || err.Error() != e.expectedError {
+			t.Errorf("%s: expected error %q, but got %v", e.name, e.expectedError, err)
+			continue
+		}
+
+		var validationErr *ValidationError
+		isValidationErr := errors.As(err, &validationErr)
+		if isValidationErr == e.notValidation {
+			t.Errorf("%s: wrong error type %T", e.name, err)
+			continue
+		}
+		if isValidationErr && fmt.Sprint(validationErr.Fields) != fmt.Sprint(e.expectedFields) {
+			t.Errorf("%s: expected fields %v, but got %v", e.name, e.expectedFields, validationErr.Fields)
+		}
+	}
+
+	// The generic path validates too
+	request := httptest.NewRequest("POST", "/", strings.NewReader(`{"email": "ann@example.com"}`))
+	var validationErr *ValidationError
+	if _, err := ReadJSONInto[createUserRequest](&testTools, httptest.NewRecorder(), request); !errors.As(err, &validationErr) {
+		t.Errorf("expected a *ValidationError, but got %v", err)
+	}
+}
+
+func TestTools_WriteJSON_Encoding(t *testing.T) {
+	var testTools Tools
+	payload := JSONResponse{Message: "<b>tom & jerry</b>", Data: []int{1, 2, 3}}
+
+	// The body is exactly what json.Marshal produces, with its length announced
+	rr := httptest.NewRecorder()
+	if err := testTools.WriteJSON(rr, http.StatusOK, payload); err != nil {
+		t.Fatal(err)
+	}
+	expected, _ := json.Marshal(payload)
+	if rr.Body.String() != string(expected) {
+		t.Errorf("expected body %s, but got %s", expected, rr.Body.String())
+	}
+	if rr.Header().Get("Content-Length") != fmt.Sprint(len(expected)) {
+		t.Errorf("wrong Content-Length %q for %d bytes", rr.Header().Get("Content-Length"), len(expected))
+	}
+
+	// A value that cannot be encoded writes nothing at all
+	rr = httptest.NewRecorder()
+	if err := testTools.WriteJSON(rr, http.StatusOK, map[string]any{"bad": make(chan int)}, http.Header{"Foo": {"bar"}}); err == nil {
+		t.Error("expected an error for a value that cannot be encoded")
+	}
+	if rr.Body.Len() != 0 || len(rr.Header()) != 0 || rr.Flushed {
+		t.Errorf("expected nothing to be written, but got headers %v and body %q", rr.Header(), rr.Body.String())
+	}
+}
+
+// largeJSONPayload returns a value that encodes to about 1MB of JSON
+func largeJSONPayload() []map[string]any {
+	payload := make([]map[string]any, 10000)
+	for i := range payload {
+		payload[i] = map[string]any{"id": i, "name": fmt.Sprintf("item number %d", i), "tags": []string{"some", "tags", "here"}, "price": 12.5}
+	}
+	return payload
+}
+
+// discardResponseWriter is a http.ResponseWriter that throws everything away
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (w *discardResponseWriter) Header() http.Header         { return w.header }
+func (w *discardResponseWriter) Write(p []byte) (int, error) { return len(p), nil }
+func (w *discardResponseWriter) WriteHeader(int)             {}
+
+func BenchmarkTools_WriteJSON(b *testing.B) {
+	var testTools Tools
+	payload := largeJSONPayload()
+	writer := &discardResponseWriter{header: make(http.Header)}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := testTools.WriteJSON(writer, http.StatusOK, payload); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkTools_WriteJSON_Marshal measures the former implementation of WriteJSON, which marshalled the data
+// to a new slice every time, for comparison
+func BenchmarkTools_WriteJSON_Marshal(b *testing.B) {
+	payload := largeJSONPayload()
+	writer := &discardResponseWriter{header: make(http.Header)}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		out, err := json.Marshal(payload)
+		if err != nil {
+			b.Fatal(err)
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		writer.WriteHeader(http.StatusOK)
+		_, _ = writer.Write(out)
+	}
+}
+
+func TestTools_WriteJSON_IndentJSON(t *testing.T) {
+	testTools := Tools{IndentJSON: true}
+	payload := JSONResponse{Message: "foo", Data: map[string]any{"list": []any{1.0, "two"}}}
+
+	rr := httptest.NewRecorder()
+	if err := testTools.WriteJSON(rr, http.StatusOK, payload); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(rr.Body.String(), "\n  \"message\": \"foo\"") {
+		t.Errorf("expected output indented with two spaces, but got %s", rr.Body.String())
+	}
+	if rr.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("wrong Content-Type %q", rr.Header().Get("Content-Type"))
+	}
+
+	var decoded JSONResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(decoded) != fmt.Sprint(payload) {
+		t.Errorf("expected %v, but decoded %v", payload, decoded)
+	}
+
+	// ErrorJSON is indented too
+	rr = httptest.NewRecorder()
+	if err := testTools.ErrorJSON(rr, errors.New("some error")); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(rr.Body.String(), "\n  \"error\": true") {
+		t.Errorf("expected indented error output, but got %s", rr.Body.String())
+	}
+}
+
+var bodilessStatusTests = []struct {
+	name         string
+	status       int
+	data         any
+	expectedBody string
+	expectedType string
+}{
+	{name: "no content", status: http.StatusNoContent, data: nil},
+	{name: "no content with data", status: http.StatusNoContent, data: JSONResponse{Message: "ignored"}},
+	{name: "not modified", status: http.StatusNotModified, data: map[string]string{"foo": "bar"}},
+	{name: "nil data", status: http.StatusOK, data: nil, expectedBody: "null", expectedType: "application/json"},
+	{name: "accepted", status: http.StatusAccepted, data: map[string]string{}, expectedBody: "{}", expectedType: "application/json"},
+}
+
+func TestTools_WriteJSON_BodilessStatus(t *testing.T) {
+	var testTools Tools
+	for _, e := range bodilessStatusTests {
+		rr := httptest.NewRecorder()
+		if err := testTools.WriteJSON(rr, e.status, e.data, http.Header{"Etag": {`"v1"`}}); err != nil {
+			t.Errorf("%s: error not expected, but one received: %s", e.name, err)
+			continue
+		}
+		if rr.Code != e.status || rr.Body.String() != e.expectedBody || rr.Header().Get("Content-Type") != e.expectedType {
+			t.Errorf("%s: expected status %d, body %q and type %q, but got %d, %q and %q", e.name, e.status, e.expectedBody, e.expectedType,
+				rr.Code, rr.Body.String(), rr.Header().Get("Content-Type"))
+		}
+		if rr.Header().Get("Etag") != `"v1"` {
+			t.Errorf("%s: expected the extra headers to be written", e.name)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	testTools.NoContent(rr)
+	if rr.Code != http.StatusNoContent || rr.Body.Len() != 0 || rr.Header().Get("Content-Type") != "" {
+		t.Errorf("NoContent: expected an empty 204, but got %d with %d bytes", rr.Code, rr.Body.Len())
+	}
+}
+
+// notFoundError is an error carrying its own code
+type notFoundError struct {
+	what string
+}
+
+func (e notFoundError) Error() string     { return e.what + " not found" }
+func (e notFoundError) ErrorCode() string { return e.what + "_not_found" }
+
+var errorCodeTests = []struct {
+	name         string
+	err          error
+	code         string
+	expectedCode string
+	expectedBody string
+}{
+	{name: "no code", err: errors.New("some error"), expectedBody: `{"error":true,"message":"some error"}`},
+	{name: "explicit code", err: errors.New("slow down"), code: "rate_limited", expectedCode: "rate_limited"},
+	{name: "typed error", err: notFoundError{what: "user"}, expectedCode: "user_not_found"},
+	{name: "wrapped typed error", err: fmt.Errorf("loading profile: %w", notFoundError{what: "user"}), expectedCode: "user_not_found"},
+	{name: "explicit code wins", err: notFoundError{what: "user"}, code: "gone", expectedCode: "gone"},
+}
+
+func TestTools_ErrorJSONWithCode(t *testing.T) {
+	var testTools Tools
+	for _, e := range errorCodeTests {
+		rr := httptest.NewRecorder()
+		if err := testTools.ErrorJSONWithCode(rr, e.err, e.code, http.StatusNotFound); err != nil {
+			t.Fatal(err)
+		}
+		if e.expectedBody != "" && rr.Body.String() != e.expectedBody {
+			t.Errorf("%s: expected body %s, but got %s", e.name, e.expectedBody, rr.Body.String())
+		}
+
+		var payload JSONResponse
+		if err := json.NewDecoder(rr.Body).Decode(&payload); err != nil {
+			t.Fatal(err)
+		}
+		if payload.Code != e.expectedCode || payload.Message != e.err.Error() || !payload.Error || rr.Code != http.StatusNotFound {
+			t.Errorf("%s: expected code %q, but got %+v with status %d", e.name, e.expectedCode, payload, rr.Code)
+		}
+	}
+
+	// ErrorJSON picks up the code of typed errors too
+	rr := httptest.NewRecorder()
+	_ = testTools.ErrorJSON(rr, notFoundError{what: "order"})
+	var payload JSONResponse
+	_ = json.NewDecoder(rr.Body).Decode(&payload)
+	if payload.Code != "order_not_found" {
+		t.Errorf("expected code order_not_found from ErrorJSON, but got %q", payload.Code)
+	}
+}
+
+// orgEnvelope is the envelope of the tests of WrapResponse
+type orgEnvelope struct {
+	Success bool           `json:"success"`
+	Payload any            `json:"payload"`
+	Meta    map[string]any `json:"meta"`
+}
+
+// wrapOrgEnvelope builds an orgEnvelope, except for 418, for which it falls back to the default
+func wrapOrgEnvelope(status int, data any, err error) any {
+	switch {
+	case status == http.StatusTeapot:
+		return nil
+	case data == "unencodable":
+		return orgEnvelope{Payload: make(chan int)}
+	case err != nil:
+		return orgEnvelope{Meta: map[string]any{"status": status, "error": err.Error()}}
+	}
+	return orgEnvelope{Success: true, Payload: data, Meta: map[string]any{"status": status}}
+}
+
+var envelopeTests = []struct {
+	name          string
+	status        int
+	data          any
+	err           error
+	wrap          bool
+	expected      string
+	errorExpected bool
+}{
+	{name: "default data", status: 200, data: []int{1, 2}, expected: `{"error":false,"message":"","data":[1,2]}`},
+	{name: "default error", status: 400, err: errors.New("bad"), expected: `{"error":true,"message":"bad"}`},
+	{name: "custom data", status: 200, data: []int{1, 2}, wrap: true, expected: `{"success":true,"payload":[1,2],"meta":{"status":200}}`},
+	{name: "custom error", status: 404, err: errors.New("missing"), wrap: true, expected: `{"success":false,"payload":null,"meta":{"error":"missing","status":404}}`},
+	{name: "nil falls back to default data", status: http.StatusTeapot, data: "tea", wrap: true, expected: `{"error":false,"message":"","data":"tea"}`},
+	{name: "nil falls back to default error", status: http.StatusTeapot, err: errors.New("coffee"), wrap: true, expected: `{"error":true,"message":"coffee"}`},
+	{name: "marshal error", status: 200, data: "unencodable", wrap: true, errorExpected: true},
+}
+
+func TestTools_WrapResponse(t *testing.T) {
+	for _, e := range envelopeTests {
+		var testTools Tools
+		if e.wrap {
+			testTools.WrapResponse = wrapOrgEnvelope
+		}
+
+		rr := httptest.NewRecorder()
+		var err error
+		if e.err != nil {
+			err = testTools.ErrorJSON(rr, e.err, e.status)
+		} else {
+			err = testTools.WriteEnveloped(rr, e.status, e.data)
+		}
+		if e.errorExpected {
+			if err == nil {
+				t.Errorf("%s: error expected, but none received", e.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: error not expected, but one received: %s", e.name, err)
+			continue
+		}
+		if rr.Code != e.status || rr.Body.String() != e.expected {
+			t.Errorf("%s: expected status %d and body %s, but got %d and %s", e.name, e.status, e.expected, rr.Code, rr.Body.String())
+		}
+	}
+}
+
+var jsonErrorTests = []struct {
+	name            string
+	json            string
+	maxSize         int
+	expectedMessage string
+	expectedStatus  int
+}{
+	{name: "badly formed", json: `{"foo":}`, expectedMessage: "body contains badly-formed JSON (at character 8)", expectedStatus: 400},
+	{name: "truncated", json: `{"foo": "bar"`, expectedMessage: "body contains badly-formed JSON", expectedStatus: 400},
+	{name: "wrong type", json: `{"foo": 1}`, expectedMessage: `body contains incorrect JSON type for field "foo"`, expectedStatus: 400},
+	{name: "wrong type at top level", json: `[1]`, expectedMessage: "body contains incorrect JSON type (at character 1)", expectedStatus: 400},
+	{name: "empty", json: ``, expectedMessage: "body must not be empty", expectedStatus: 400},
+	{name: "two values", json: `{"foo": "1"}{"foo": "2"}`, expectedMessage: "body must contain only one JSON value", expectedStatus: 400},
+	{name: "unknown field", json: `{"fooo": "1"}`, expectedMessage: `body contains unknown key "fooo"`, expectedStatus: 422},
+	{name: "too large", json: `{"foo": "bar"}`, maxSize: 4, expectedMessage: "body must not be larger than 4 B", expectedStatus: 413},
+}
+
+func TestJSONErrorStatus(t *testing.T) {
+	for _, e := range jsonErrorTests {
+		testTools := Tools{MaxJSONSize: e.maxSize}
+		var decoded struct {
+			Foo string `json:"foo"`
+		}
+
+		err := testTools.ReadJSON(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader(e.json)), &decoded)
+		if err == nil || err.Error() != e.expectedMessage {
+			t.Errorf("%s: expected error %q, but got %v", e.name, e.expectedMessage, err)
+			continue
+		}
+		if status := JSONErrorStatus(err); status != e.expectedStatus {
+			t.Errorf("%s: expected status %d, but got %d", e.name, e.expectedStatus, status)
+		}
+	}
+
+	if status := JSONErrorStatus(&ValidationError{Fields: map[string]string{"foo": "is required"}}); status != 422 {
+		t.Errorf("expected status 422 for a validation error, but got %d", status)
+	}
+	var testTools Tools
+	var notPointer struct{}
+	if status := JSONErrorStatus(testTools.ReadJSON(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader(`{}`)), notPointer)); status != 500 {
+		t.Errorf("expected status 500 for a misused ReadJSON, but got %d", status)
+	}
+}
+
+var unknownFieldTests = []struct {
+	name     string
+	err      error
+	expected string
+	isField  bool
+}{
+	{name: "quoted name", err: errors.New(`json: unknown field "fooo"`), expected: "fooo", isField: true},
+	{name: "escaped name", err: errors.New(`json: unknown field "a\"b"`), expected: `a"b`, isField: true},
+	{name: "unquoted name", err: errors.New(`json: unknown field fooo`), expected: "fooo", isField: true},
+	{name: "other error", err: errors.New(`json: cannot unmarshal number into Go value of type string`)},
+}
+
+func TestUnknownFieldName(t *testing.T) {
+	for _, e := range unknownFieldTests {
+		if isUnknownFieldError(e.err) != e.isField {
+			t.Errorf("%s: expected isUnknownFieldError to be %t", e.name, e.isField)
+			continue
+		}
+		if e.isField && unknownFieldName(e.err) != e.expected {
+			t.Errorf("%s: expected field %q, but got %q", e.name, e.expected, unknownFieldName(e.err))
+		}
+	}
+
+	// The error of the decoder of this version of Go is still recognised
+	decoder := json.NewDecoder(strings.NewReader(`{"foo": "1", "unexpected": 2}`))
+	decoder.DisallowUnknownFields()
+	var decoded struct {
+		Foo string `json:"foo"`
+	}
+	err := decoder.Decode(&decoded)
+	if err == nil || !isUnknownFieldError(err) || unknownFieldName(err) != "unexpected" {
+		t.Errorf("the unknown field error of the decoder is not recognised anymore: %v", err)
+	}
+}
+
+func TestTools_ReadJSON_MaxBytesError(t *testing.T) {
+	testTools := Tools{MaxJSONSize: 10}
+	var decoded map[string]any
+	err := testTools.ReadJSON(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader(`{"foo": "a longer value"}`)), &decoded)
+
+	var maxBytesErr *http.MaxBytesError
+	if !errors.Is(err, ErrBodyTooLarge) || !errors.As(err, &maxBytesErr) || maxBytesErr.Limit != 10 {
+		t.Fatalf("expected an error matching ErrBodyTooLarge and *http.MaxBytesError, but got %v", err)
+	}
+	if err.Error() != "body must not be larger than 10 B" {
+		t.Errorf("wrong message %q", err.Error())
+	}
+}
+
+func TestTools_ReadJSON_UseNumber(t *testing.T) {
+	body := `{"id": 9007199254740993, "price": 12.5, "name": "big", "nested": {"id": 9007199254740995}}`
+
+	// Without UseNumber, the id goes through a float64 and loses precision
+	var testTools Tools
+	var lossy map[string]any
+	if err := testTools.ReadJSON(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader(body)), &lossy); err != nil {
+		t.Fatal(err)
+	}
+	if id, _ := GetInt64(lossy, "id"); id == 9007199254740993 {
+		t.Error("expected the id to lose precision without UseNumber")
+	}
+
+	testTools.UseNumber = true
+	var decoded map[string]any
+	if err := testTools.ReadJSON(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader(body)), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if id, err := GetInt64(decoded, "id"); err != nil || id != 9007199254740993 {
+		t.Errorf("expected id 9007199254740993, but got %d, %v", id, err)
+	}
+	if id, err := GetInt64(decoded["nested"].(map[string]any), "id"); err != nil || id != 9007199254740995 {
+		t.Errorf("expected nested id 9007199254740995, but got %d, %v", id, err)
+	}
+	if price, err := GetFloat64(decoded, "price"); err != nil || price != 12.5 {
+		t.Errorf("expected price 12.5, but got %v, %v", price, err)
+	}
+	if _, err := GetInt64(decoded, "price"); err == nil {
+		t.Error("expected an error reading a fraction as an integer")
+	}
+	if _, err := GetInt64(decoded, "name"); err == nil {
+		t.Error("expected an error reading a string as a number")
+	}
+	if _, err := GetFloat64(decoded, "missing"); err == nil {
+		t.Error("expected an error reading a missing key")
+	}
+
+	// Round trip the map back to JSON without losing anything
+	rr := httptest.NewRecorder()
+	if err := testTools.WriteJSON(rr, http.StatusOK, decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(rr.Body.String(), `"id":9007199254740993`) {
+		t.Errorf("expected the id to survive a round trip, but got %s", rr.Body.String())
+	}
+
+	// Typed fields are not affected
+	var typed struct {
+		ID    int64   `json:"id"`
+		Price float64 `json:"price"`
+	}
+	testTools.AllowUnknownFields = true
+	if err := testTools.ReadJSON(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader(body)), &typed); err != nil || typed.ID != 9007199254740993 || typed.Price != 12.5 {
+		t.Errorf("expected typed fields to be decoded as usual, but got %+v, %v", typed, err)
+	}
+
+	// Whole float64 values are read as integers too
+	if id, err := GetInt64(map[string]any{"id": 42.0}, "id"); err != nil || id != 42 {
+		t.Errorf("expected 42 from a float64, but got %d, %v", id, err)
+	}
+}
+
+var jsonLimitTests = []struct {
+	name      string
+	json      string
+	maxDepth  int
+	maxTokens int
+	tooDeep   bool
+	tooMany   bool
+	malformed bool
+}{
+	{name: "no limits", json: `{"foo": [[[1]]]}`},
+	{name: "depth at limit", json: `{"foo": [[1]]}`, maxDepth: 3},
+	{name: "too deep", json: `{"foo": [[[1]]]}`, maxDepth: 3, tooDeep: true},
+	{name: "tokens at limit", json: `{"foo": [1, 2]}`, maxTokens: 7},
+	{name: "too many tokens", json: `{"foo": [1, 2, 3]}`, maxTokens: 7, tooMany: true},
+	{name: "malformed within limits", json: `{"foo": [1,`, maxDepth: 3, maxTokens: 10, malformed: true},
+}
+
+func TestTools_ReadJSON_Limits(t *testing.T) {
+	for _, e := range jsonLimitTests {
+		testTools := Tools{MaxJSONDepth: e.maxDepth, MaxJSONTokens: e.maxTokens}
+		var decoded map[string]any
+		err := testTools.ReadJSON(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader(e.json)), &decoded)
+
+		var tooDeep *ErrJSONTooDeep
+		var tooMany *ErrTooManyJSONTokens
+		if errors.As(err, &tooDeep) != e.tooDeep {
+			t.Errorf("%s: expected too deep to be %v, but got %v", e.name, e.tooDeep, err)
+		}
+		if errors.As(err, &tooMany) != e.tooMany {
+			t.Errorf("%s: expected too many tokens to be %v, but got %v", e.name, e.tooMany, err)
+		}
+		var malformed *ErrMalformedJSON
+		if errors.As(err, &malformed) != e.malformed {
+			t.Errorf("%s: expected malformed to be %v, but got %v", e.name, e.malformed, err)
+		}
+		if !e.tooDeep && !e.tooMany && !e.malformed && err != nil {
+			t.Errorf("%s: no error expected, but got %v", e.name, err)
+		}
+		if err != nil && JSONErrorStatus(err) != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, but got %d", e.name, JSONErrorStatus(err))
+		}
+	}
+}
+
+func TestTools_ReadJSON_DeeplyNested(t *testing.T) {
+	body := strings.Repeat("[", 10000) + strings.Repeat("]", 10000)
+	testTools := Tools{MaxJSONDepth: 32}
+
+	start := time.Now()
+	var decoded any
+	err := testTools.ReadJSON(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader(body)), &decoded)
+	elapsed := time.Since(start)
+
+	var tooDeep *ErrJSONTooDeep
+	if !errors.As(err, &tooDeep) || tooDeep.Limit != 32 {
+		t.Fatalf("expected an *ErrJSONTooDeep, but got %v", err)
+	}
+	if err.Error() != "body must not be nested more than 32 levels deep" {
+		t.Errorf("wrong message %q", err.Error())
+	}
+	if elapsed > 100*time.Millisecond {
+		t.Errorf("expected the body to be rejected quickly, but it took %s", elapsed)
+	}
+}
+
+func TestTools_ErrorJSONWithRequest(t *testing.T) {
+	type logged struct {
+		requestID string
+		status    int
+		err       error
+	}
+	var entries []logged
+	testTools := Tools{ErrorLogger: func(r *http.Request, status int, err error) {
+		entries = append(entries, logged{requestID: r.Header.Get("X-Request-ID"), status: status, err: err})
+	}}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Request-ID", "req-42")
+	unavailable := errors.New("database is down")
+	rr := httptest.NewRecorder()
+	if err := testTools.ErrorJSONWithRequest(rr, req, unavailable, http.StatusServiceUnavailable); err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].requestID != "req-42" || entries[0].status != http.StatusServiceUnavailable || entries[0].err != unavailable {
+		t.Errorf("expected the error to be logged with its request and status, but got %+v", entries)
+	}
+	if rr.Code != http.StatusServiceUnavailable || !strings.Contains(rr.Body.String(), "database is down") {
+		t.Errorf("wrong response %d %s", rr.Code, rr.Body.String())
+	}
+
+	// The status defaults to 400, as with ErrorJSON, which does not log
+	_ = testTools.ErrorJSONWithRequest(httptest.NewRecorder(), req, unavailable)
+	_ = testTools.ErrorJSON(httptest.NewRecorder(), unavailable)
+	if len(entries) != 2 || entries[1].status != http.StatusBadRequest {
+		t.Errorf("expected one more entry, with status 400, but got %+v", entries)
+	}
+
+	// A panicking logger does not stop the response
+	testTools.ErrorLogger = func(*http.Request, int, error) { panic("logger is broken") }
+	rr = httptest.NewRecorder()
+	if err := testTools.ErrorJSONWithRequest(rr, req, unavailable, http.StatusServiceUnavailable); err != nil {
+		t.Fatal(err)
+	}
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected the response to be written, but got %d", rr.Code)
+	}
+}
+
+var jsonContentTypeTests = []struct {
+	name        string
+	method      string
+	contentType string
+	body        string
+	unsupported bool
+}{
+	{name: "json", method: "POST", contentType: "application/json", body: `{"foo": "bar"}`},
+	{name: "json with charset", method: "POST", contentType: "application/json; charset=utf-8", body: `{"foo": "bar"}`},
+	{name: "hal", method: "POST", contentType: "application/hal+json", body: `{"foo": "bar"}`},
+	{name: "upper case", method: "POST", contentType: "Application/JSON", body: `{"foo": "bar"}`},
+	{name: "text", method: "POST", contentType: "text/plain", body: `{"foo": "bar"}`, unsupported: true},
+	{name: "form", method: "POST", contentType: "application/x-www-form-urlencoded", body: `foo=bar`, unsupported: true},
+	{name: "invalid", method: "POST", contentType: "application/json; charset", body: `{"foo": "bar"}`, unsupported: true},
+	{name: "missing with body", method: "POST", contentType: "", body: `{"foo": "bar"}`, unsupported: true},
+	{name: "missing on GET without body", method: "GET", contentType: "", body: ``},
+	{name: "missing on DELETE without body", method: "DELETE", contentType: "", body: ``},
+}
+
+func TestTools_ReadJSON_EnforceContentType(t *testing.T) {
+	testTools := Tools{EnforceJSONContentType: true}
+	for _, e := range jsonContentTypeTests {
+		req := httptest.NewRequest(e.method, "/", strings.NewReader(e.body))
+		if e.contentType != "" {
+			req.Header.Set("Content-Type", e.contentType)
+		}
+		var decoded struct {
+			Foo string `json:"foo"`
+		}
+		err := testTools.ReadJSON(httptest.NewRecorder(), req, &decoded)
+
+		var unsupported *ErrUnsupportedMediaType
+		if errors.As(err, &unsupported) != e.unsupported {
+			t.Errorf("%s: expected unsupported to be %v, but got %v", e.name, e.unsupported, err)
+		}
+		if e.unsupported && JSONErrorStatus(err) != http.StatusUnsupportedMediaType {
+			t.Errorf("%s: expected status 415, but got %d", e.name, JSONErrorStatus(err))
+		}
+		if !e.unsupported && e.body != "" && (err != nil || decoded.Foo != "bar") {
+			t.Errorf("%s: expected the body to be decoded, but got %v", e.name, err)
+		}
+	}
+
+	// Without the option, the Content-Type is not looked at
+	var lenient Tools
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"foo": "bar"}`))
+	req.Header.Set("Content-Type", "text/plain")
+	if err := lenient.ReadJSON(httptest.NewRecorder(), req, &map[string]any{}); err != nil {
+		t.Errorf("expected no error without EnforceJSONContentType, but got %v", err)
+	}
+}
+
+var statusHelperTests = []struct {
+	name             string
+	write            func(t *Tools, w http.ResponseWriter) error
+	expectedStatus   int
+	expectedLocation string
+	expectedBody     string
+}{
+	{name: "ok", write: func(t *Tools, w http.ResponseWriter) error { return t.OK(w, map[string]int{"id": 1}) }, expectedStatus: http.StatusOK, expectedBody: `{"error":false,"message":"","data":{"id":1}}`},
+	{name: "created", write: func(t *Tools, w http.ResponseWriter) error { return t.Created(w, "/users/1", map[string]int{"id": 1}) }, expectedStatus: http.StatusCreated, expectedLocation: "/users/1", expectedBody: `{"error":false,"message":"","data":{"id":1}}`},
+	{name: "accepted", write: func(t *Tools, w http.ResponseWriter) error { return t.Accepted(w, map[string]string{"job": "abc"}) }, expectedStatus: http.StatusAccepted, expectedBody: `{"error":false,"message":"","data":{"job":"abc"}}`},
+	{name: "no content", write: func(t *Tools, w http.ResponseWriter) error { return t.NoContent(w) }, expectedStatus: http.StatusNoContent, expectedBody: ``},
+	{name: "nil data", write: func(t *Tools, w http.ResponseWriter) error { return t.OK(w, nil) }, expectedStatus: http.StatusOK, expectedBody: `{"error":false,"message":""}`},
+}
+
+func TestTools_StatusHelpers(t *testing.T) {
+	var testTools Tools
+	for _, e := range statusHelperTests {
+		rr := httptest.NewRecorder()
+		if err := e.write(&testTools, rr); err != nil {
+			t.Errorf("%s: error not expected, but one received: %s", e.name, err)
+			continue
+		}
+		if rr.Code != e.expectedStatus || rr.Body.String() != e.expectedBody || rr.Header().Get("Location") != e.expectedLocation {
+			t.Errorf("%s: expected %d %q at %q, but got %d %q at %q", e.name, e.expectedStatus, e.expectedBody, e.expectedLocation,
+				rr.Code, rr.Body.String(), rr.Header().Get("Location"))
+		}
+	}
+
+	// Headers are passed on, and write errors returned
+	rr := httptest.NewRecorder()
+	if err := testTools.Created(rr, "/users/2", nil, http.Header{"X-Request-Id": {"42"}}); err != nil || rr.Header().Get("X-Request-Id") != "42" {
+		t.Errorf("expected the extra header to be written, but got %v", rr.Header())
+	}
+	if err := testTools.OK(httptest.NewRecorder(), make(chan int)); err == nil {
+		t.Error("expected the encoding error to be returned")
+	}
+}
+
+func TestTools_ErrorJSON_Debug(t *testing.T) {
+	err := fmt.Errorf("loading user: %w", fmt.Errorf("query failed: %w", errors.New("connection refused")))
+
+	// Without Debug, the output is the same as always
+	var testTools Tools
+	rr := httptest.NewRecorder()
+	_ = testTools.ErrorJSON(rr, err, http.StatusServiceUnavailable)
+	expected := `{"error":true,"message":"loading user: query failed: connection refused"}`
+	if rr.Body.String() != expected {
+		t.Errorf("expected %s, but got %s", expected, rr.Body.String())
+	}
+
+	testTools.Debug = true
+	rr = httptest.NewRecorder()
+	_ = testTools.ErrorJSON(rr, err, http.StatusServiceUnavailable)
+	var response struct {
+		Data struct {
+			Stack  []string `json:"stack"`
+			Causes []string `json:"causes"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Data.Stack) == 0 || !strings.Contains(response.Data.Stack[0], "TestTools_ErrorJSON_Debug") {
+		t.Errorf("expected the stack to start at the caller, but got %v", response.Data.Stack)
+	}
+	for _, frame := range response.Data.Stack {
+		if strings.Contains(frame, "toolkit/v2.(*Tools)") {
+			t.Errorf("expected the frames of the toolkit to be skipped, but got %s", frame)
+		}
+	}
+	expectedCauses := []string{"query failed: connection refused", "connection refused"}
+	if strings.Join(response.Data.Causes, "|") != strings.Join(expectedCauses, "|") {
+		t.Errorf("expected causes %v, but got %v", expectedCauses, response.Data.Causes)
+	}
+}
+
+var responseShapeTests = []struct {
+	name             string
+	alwaysEmitData   bool
+	omitEmptyMessage bool
+	expectedOK       string
+	expectedNil      string
+	expectedError    string
+}{
+	{name: "default", expectedOK: `{"error":false,"message":"","data":{"id":1}}`, expectedNil: `{"error":false,"message":""}`, expectedError: `{"error":true,"message":"not found","code":"user_not_found"}`},
+	{name: "always emit data", alwaysEmitData: true, expectedOK: `{"error":false,"message":"","data":{"id":1}}`, expectedNil: `{"error":false,"message":"","data":null}`, expectedError: `{"error":true,"message":"not found","data":null,"code":"user_not_found"}`},
+	{name: "omit empty message", omitEmptyMessage: true, expectedOK: `{"error":false,"data":{"id":1}}`, expectedNil: `{"error":false}`, expectedError: `{"error":true,"message":"not found","code":"user_not_found"}`},
+	{name: "both", alwaysEmitData: true, omitEmptyMessage: true, expectedOK: `{"error":false,"data":{"id":1}}`, expectedNil: `{"error":false,"data":null}`, expectedError: `{"error":true,"message":"not found","data":null,"code":"user_not_found"}`},
+}
+
+func TestTools_ResponseShape(t *testing.T) {
+	for _, e := range responseShapeTests {
+		testTools := Tools{AlwaysEmitData: e.alwaysEmitData, OmitEmptyMessage: e.omitEmptyMessage}
+
+		rr := httptest.NewRecorder()
+		_ = testTools.OK(rr, map[string]int{"id": 1})
+		if rr.Body.String() != e.expectedOK {
+			t.Errorf("%s: expected %s, but got %s", e.name, e.expectedOK, rr.Body.String())
+		}
+
+		rr = httptest.NewRecorder()
+		_ = testTools.WriteJSON(rr, http.StatusOK, &JSONResponse{})
+		if rr.Body.String() != e.expectedNil {
+			t.Errorf("%s: expected %s, but got %s", e.name, e.expectedNil, rr.Body.String())
+		}
+
+		rr = httptest.NewRecorder()
+		_ = testTools.ErrorJSONWithCode(rr, errors.New("not found"), "user_not_found", http.StatusNotFound)
+		if rr.Body.String() != e.expectedError {
+			t.Errorf("%s: expected %s, but got %s", e.name, e.expectedError, rr.Body.String())
+		}
+	}
+}
+
+var topLevelArrayTests = []struct {
+	name     string
+	data     any
+	reject   bool
+	forbid   bool
+	expected string
+}{
+	{name: "allowed", data: []int{1, 2}, expected: `[1,2]`},
+	{name: "wrapped", data: []int{1, 2}, forbid: true, expected: `{"items":[1,2]}`},
+	{name: "wrapped raw message", data: json.RawMessage(`[{"a":1}]`), forbid: true, expected: `{"items":[{"a":1}]}`},
+	{name: "wrapped pointer to array", data: &[2]string{"a", "<b>"}, forbid: true, expected: `{"items":["a","\u003cb\u003e"]}`},
+	{name: "rejected", data: []int{1, 2}, forbid: true, reject: true},
+	{name: "object", data: map[string]int{"a": 1}, forbid: true, reject: true, expected: `{"a":1}`},
+	{name: "bytes are a string", data: []byte("hi"), forbid: true, reject: true, expected: `"aGk="`},
+	{name: "envelope", data: JSONResponse{Data: []int{1}}, forbid: true, reject: true, expected: `{"error":false,"message":"","data":[1]}`},
+}
+
+func TestTools_WriteJSON_ForbidTopLevelArrays(t *testing.T) {
+	for _, e := range topLevelArrayTests {
+		testTools := Tools{ForbidTopLevelArrays: e.forbid, RejectTopLevelArrays: e.reject}
+		rr := httptest.NewRecorder()
+		err := testTools.WriteJSON(rr, http.StatusOK, e.data)
+
+		if e.expected == "" {
+			if !errors.Is(err, ErrTopLevelArray) || rr.Body.Len() != 0 || len(rr.Header()) != 0 {
+				t.Errorf("%s: expected ErrTopLevelArray and nothing written, but got %v, %q", e.name, err, rr.Body.String())
+			}
+			continue
+		}
+		if err != nil || rr.Body.String() != e.expected {
+			t.Errorf("%s: expected %s, but got %s, %v", e.name, e.expected, rr.Body.String(), err)
+		}
+		if rr.Header().Get("X-Content-Type-Options") != "nosniff" {
+			t.Errorf("%s: expected the nosniff header, but got %v", e.name, rr.Header())
+		}
+	}
+
+	// The wrapped array follows JSONPrefix and is indented like any value
+	testTools := Tools{ForbidTopLevelArrays: true, IndentJSON: true, JSONPrefix: ")]}',\n"}
+	rr := httptest.NewRecorder()
+	_ = testTools.WriteJSON(rr, http.StatusOK, []int{1})
+	if expected := ")]}',\n{\n  \"items\": [\n    1\n  ]\n}"; rr.Body.String() != expected {
+		t.Errorf("expected %q, but got %q", expected, rr.Body.String())
+	}
+}
@@ -0,0 +1,84 @@
+package toolkit
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// jsonAPIContentType is the media type of JSON:API documents
+const jsonAPIContentType = "application/vnd.api+json"
+
+// JSONAPIResource is a resource object of a JSON:API document
+type JSONAPIResource struct {
+	Type       string `json:"type"`
+	ID         string `json:"id"`
+	Attributes any    `json:"attributes,omitempty"`
+}
+
+// JSONAPIDocument is the top level object of a JSON:API document with data
+type JSONAPIDocument struct {
+	// Data is a JSONAPIResource, or a slice of them for a collection
+	Data any            `json:"data"`
+	Meta map[string]any `json:"meta,omitempty"`
+}
+
+// JSONAPIError is an error object of a JSON:API document
+type JSONAPIError struct {
+	ID string `json:"id,omitempty"`
+	// Status is the HTTP status code of the error, as a string. ErrorJSONAPI sets it when it is empty
+	Status string              `json:"status,omitempty"`
+	Code   string              `json:"code,omitempty"`
+	Title  string              `json:"title,omitempty"`
+	Detail string              `json:"detail,omitempty"`
+	Source *JSONAPIErrorSource `json:"source,omitempty"`
+	Meta   map[string]any      `json:"meta,omitempty"`
+}
+
+// JSONAPIErrorSource tells which part of the request a JSONAPIError is about
+type JSONAPIErrorSource struct {
+	// Pointer is a JSON pointer to the value of the request document, such as "/data/attributes/title"
+	Pointer string `json:"pointer,omitempty"`
+	// Parameter is the query parameter
+	Parameter string `json:"parameter,omitempty"`
+	// Header is the request header
+	Header string `json:"header,omitempty"`
+}
+
+// jsonAPIErrors is the top level object of a JSON:API document with errors
+type jsonAPIErrors struct {
+	Errors []JSONAPIError `json:"errors"`
+}
+
+// WriteJSONAPI writes a JSON:API document whose data is the resource of type resourceType identified by id,
+// with attributes, and the optional top level meta, with the status code
+func (t *Tools) WriteJSONAPI(writer http.ResponseWriter, status int, resourceType string, id string, attributes any, meta map[string]any) error {
+	document := JSONAPIDocument{
+		Data: JSONAPIResource{Type: resourceType, ID: id, Attributes: attributes},
+		Meta: meta,
+	}
+	return t.writeJSON(writer, status, jsonAPIContentType, document)
+}
+
+// WriteJSONAPICollection writes a JSON:API document whose data are the resources of type resourceType with
+// the attributes in items, in the same order, each identified by the ID id returns for it, and the optional top
+// level meta, with the status code. An empty or nil slice is written as an empty array
+func WriteJSONAPICollection[T any](t *Tools, writer http.ResponseWriter, status int, resourceType string, items []T, id func(T) string, meta map[string]any) error {
+	resources := make([]JSONAPIResource, 0, len(items))
+	for _, item := range items {
+		resources = append(resources, JSONAPIResource{Type: resourceType, ID: id(item), Attributes: item})
+	}
+	return t.writeJSON(writer, status, jsonAPIContentType, JSONAPIDocument{Data: resources, Meta: meta})
+}
+
+// ErrorJSONAPI writes a JSON:API document with errs, in the same order, with the status code, which is also the
+// status of the errors that do not have their own
+func (t *Tools) ErrorJSONAPI(writer http.ResponseWriter, status int, errs ...JSONAPIError) error {
+	document := jsonAPIErrors{Errors: make([]JSONAPIError, len(errs))}
+	for i, e := range errs {
+		if e.Status == "" {
+			e.Status = strconv.Itoa(status)
+		}
+		document.Errors[i] = e
+	}
+	return t.writeJSON(writer, status, jsonAPIContentType, document)
+}
@@ -0,0 +1,93 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+// article is a resource of the JSON:API tests
+type article struct {
+	ID    int    `json:"-"`
+	Title string `json:"title"`
+}
+
+func TestTools_WriteJSONAPI(t *testing.T) {
+	var testTools Tools
+
+	rr := httptest.NewRecorder()
+	err := testTools.WriteJSONAPI(rr, http.StatusOK, "articles", "1", article{Title: "Hello"}, map[string]any{"total": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rr.Header().Get("Content-Type") != "application/vnd.api+json" {
+		t.Errorf("wrong content type %s", rr.Header().Get("Content-Type"))
+	}
+	expected := `{"data":{"type":"articles","id":"1","attributes":{"title":"Hello"}},"meta":{"total":1}}`
+	if rr.Body.String() != expected {
+		t.Errorf("expected %s, but got %s", expected, rr.Body.String())
+	}
+}
+
+func TestWriteJSONAPICollection(t *testing.T) {
+	var testTools Tools
+	articles := []article{{ID: 1, Title: "First"}, {ID: 2, Title: "Second"}}
+	articleID := func(a article) string { return strconv.Itoa(a.ID) }
+
+	rr := httptest.NewRecorder()
+	if err := WriteJSONAPICollection(&testTools, rr, http.StatusOK, "articles", articles, articleID, nil); err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"data":[{"type":"articles","id":"1","attributes":{"title":"First"}},{"type":"articles","id":"2","attributes":{"title":"Second"}}]}`
+	if rr.Body.String() != expected {
+		t.Errorf("expected %s, but got %s", expected, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	if err := WriteJSONAPICollection(&testTools, rr, http.StatusOK, "articles", nil, articleID, nil); err != nil {
+		t.Fatal(err)
+	}
+	if rr.Body.String() != `{"data":[]}` {
+		t.Errorf("expected an empty collection, but got %s", rr.Body.String())
+	}
+}
+
+func TestTools_ErrorJSONAPI(t *testing.T) {
+	var testTools Tools
+
+	rr := httptest.NewRecorder()
+	err := testTools.ErrorJSONAPI(rr, http.StatusUnprocessableEntity,
+		JSONAPIError{Code: "too_short", Title: "Title is too short", Source: &JSONAPIErrorSource{Pointer: "/data/attributes/title"}},
+		JSONAPIError{Status: "409", Title: "Conflict", Detail: "The slug is taken"},
+		JSONAPIError{Title: "Missing author", Source: &JSONAPIErrorSource{Parameter: "author"}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rr.Code != http.StatusUnprocessableEntity || rr.Header().Get("Content-Type") != "application/vnd.api+json" {
+		t.Errorf("wrong response %d %s", rr.Code, rr.Header().Get("Content-Type"))
+	}
+
+	var document struct {
+		Errors []map[string]any `json:"errors"`
+		Data   any              `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &document); err != nil {
+		t.Fatal(err)
+	}
+	if len(document.Errors) != 3 || document.Data != nil {
+		t.Fatalf("expected 3 errors and no data, but got %s", rr.Body.String())
+	}
+	expectedTitles := []string{"Title is too short", "Conflict", "Missing author"}
+	expectedStatuses := []string{"422", "409", "422"}
+	for i, e := range document.Errors {
+		if e["title"] != expectedTitles[i] || e["status"] != expectedStatuses[i] {
+			t.Errorf("error %d: expected %s with status %s, but got %v", i, expectedTitles[i], expectedStatuses[i], e)
+		}
+	}
+	if pointer := document.Errors[0]["source"].(map[string]any)["pointer"]; pointer != "/data/attributes/title" {
+		t.Errorf("wrong source pointer %v", pointer)
+	}
+}
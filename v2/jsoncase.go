@@ -0,0 +1,176 @@
+package toolkit
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// jsonFieldCache holds the jsonFields of each struct type ReadJSON matched keys against, with
+// CaseSensitiveFields set, keyed by reflect.Type
+var jsonFieldCache sync.Map
+
+// jsonFields maps the name each field of a struct is decoded from, following its json tag, to its type
+type jsonFields map[string]reflect.Type
+
+var (
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// fieldsOf returns the jsonFields of the struct type typ, computing them once per type
+func fieldsOf(typ reflect.Type) jsonFields {
+	if fields, ok := jsonFieldCache.Load(typ); ok {
+		return fields.(jsonFields)
+	}
+
+	depths := make(map[string]int)
+	fields := make(jsonFields)
+	collectJSONFields(typ, 0, fields, depths)
+	cached, _ := jsonFieldCache.LoadOrStore(typ, fields)
+	return cached.(jsonFields)
+}
+
+// collectJSONFields adds the fields of the struct type typ, and of the structs it embeds, at depth, to fields.
+// As with encoding/json, a field hides the fields of the same name of the structs it embeds
+func collectJSONFields(typ reflect.Type, depth int, fields jsonFields, depths map[string]int) {
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				collectJSONFields(embedded, depth+1, fields, depths)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		if shallowest, ok := depths[name]; !ok || depth < shallowest {
+			depths[name] = depth
+			fields[name] = field.Type
+		}
+	}
+}
+
+// folds reports whether key matches the name of a field of f case-insensitively, as encoding/json would
+// decode key into it
+func (f jsonFields) folds(key string) bool {
+	for name := range f {
+		if strings.EqualFold(name, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchFieldCase returns body, the JSON value about to be decoded into a value of type typ, once the keys of
+// its objects that only match a field of a struct in a different case are dealt with: they are rejected with
+// an *ErrUnknownField, or dropped when AllowUnknownFields is set, so encoding/json does not decode them into
+// that field. Values that are not valid JSON are returned as they are, for the decoder to report
+func (t *Tools) matchFieldCase(body json.RawMessage, typ reflect.Type) (json.RawMessage, error) {
+	matched, _, err := t.matchValueCase(body, typ)
+	return matched, err
+}
+
+// matchValueCase does the work of matchFieldCase, and also reports whether body was changed
+func (t *Tools) matchValueCase(body json.RawMessage, typ reflect.Type) (json.RawMessage, bool, error) {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	// Types decoding themselves get their value as it is sent
+	if reflect.PointerTo(typ).Implements(jsonUnmarshalerType) || reflect.PointerTo(typ).Implements(textUnmarshalerType) {
+		return body, false, nil
+	}
+
+	changed := false
+	switch typ.Kind() {
+	case reflect.Struct:
+		var members map[string]json.RawMessage
+		if json.Unmarshal(body, &members) != nil || members == nil {
+			return body, false, nil
+		}
+		fields := fieldsOf(typ)
+		for key, value := range members {
+			fieldType, ok := fields[key]
+			if !ok {
+				if fields.folds(key) {
+					if !t.AllowUnknownFields {
+						return nil, false, &ErrUnknownField{Field: key}
+					}
+					delete(members, key)
+					changed = true
+				}
+				continue
+			}
+			matched, valueChanged, err := t.matchValueCase(value, fieldType)
+			if err != nil {
+				return nil, false, err
+			}
+			if valueChanged {
+				members[key] = matched
+				changed = true
+			}
+		}
+		if changed {
+			matched, err := json.Marshal(members)
+			return matched, true, err
+		}
+
+	case reflect.Map:
+		var members map[string]json.RawMessage
+		if json.Unmarshal(body, &members) != nil || members == nil {
+			return body, false, nil
+		}
+		for key, value := range members {
+			matched, valueChanged, err := t.matchValueCase(value, typ.Elem())
+			if err != nil {
+				return nil, false, err
+			}
+			if valueChanged {
+				members[key] = matched
+				changed = true
+			}
+		}
+		if changed {
+			matched, err := json.Marshal(members)
+			return matched, true, err
+		}
+
+	case reflect.Slice, reflect.Array:
+		var items []json.RawMessage
+		if json.Unmarshal(body, &items) != nil || items == nil {
+			return body, false, nil
+		}
+		for i, item := range items {
+			matched, valueChanged, err := t.matchValueCase(item, typ.Elem())
+			if err != nil {
+				return nil, false, err
+			}
+			if valueChanged {
+				items[i] = matched
+				changed = true
+			}
+		}
+		if changed {
+			matched, err := json.Marshal(items)
+			return matched, true, err
+		}
+	}
+	return body, false, nil
+}
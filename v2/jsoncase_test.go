@@ -0,0 +1,138 @@
+package toolkit
+
+import (
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// caseAudit is embedded by caseAccount, to check the fields of embedded structs are matched too
+type caseAudit struct {
+	CreatedBy string    `json:"created_by"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type caseLine struct {
+	SKU string `json:"sku"`
+	Qty int    `json:"qty"`
+}
+
+type caseAccount struct {
+	caseAudit
+	ID     int                 `json:"id"`
+	Name   string              // no tag, so its key is Name
+	Lines  []caseLine          `json:"lines"`
+	Owner  *caseLine           `json:"owner"`
+	Labels map[string]caseLine `json:"labels"`
+	Extra  map[string]any      `json:"extra"`
+	Hidden string              `json:"-"`
+}
+
+var caseSensitiveTests = []struct {
+	name         string
+	json         string
+	allowUnknown bool
+	errorField   string
+	expected     caseAccount
+}{
+	{name: "exact case", json: `{"id":1,"Name":"a","created_by":"bob"}`, expected: caseAccount{ID: 1, Name: "a", caseAudit: caseAudit{CreatedBy: "bob"}}},
+	{name: "wrong case", json: `{"ID":1}`, errorField: "ID"},
+	{name: "wrong case of untagged field", json: `{"name":"a"}`, errorField: "name"},
+	{name: "wrong case in embedded struct", json: `{"id":1,"Created_By":"bob"}`, errorField: "Created_By"},
+	{name: "wrong case in slice", json: `{"lines":[{"sku":"a","qty":1},{"SKU":"b"}]}`, errorField: "SKU"},
+	{name: "wrong case in pointer", json: `{"owner":{"Qty":2}}`, errorField: "Qty"},
+	{name: "wrong case in map value", json: `{"labels":{"x":{"sKu":"a"}}}`, errorField: "sKu"},
+	{name: "keys of maps are free", json: `{"labels":{"X":{"sku":"a"}},"extra":{"ID":1}}`, expected: caseAccount{Labels: map[string]caseLine{"X": {SKU: "a"}}, Extra: map[string]any{"ID": float64(1)}}},
+	{name: "wrong case ignored", json: `{"id":1,"ID":2,"lines":[{"SKU":"b","qty":3}]}`, allowUnknown: true, expected: caseAccount{ID: 1, Lines: []caseLine{{Qty: 3}}}},
+	{name: "wrong case of ignored field", json: `{"hidden":"x"}`, allowUnknown: true},
+	{name: "unknown field", json: `{"other":1}`, errorField: "other"},
+	{name: "unknown field allowed", json: `{"other":1}`, allowUnknown: true},
+}
+
+func TestTools_ReadJSON_CaseSensitiveFields(t *testing.T) {
+	for _, e := range caseSensitiveTests {
+		testTools := Tools{CaseSensitiveFields: true, AllowUnknownFields: e.allowUnknown}
+
+		var decoded caseAccount
+		err := testTools.ReadJSON(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader(e.json)), &decoded)
+
+		if e.errorField != "" {
+			var unknownField *ErrUnknownField
+			if !errors.As(err, &unknownField) || unknownField.Field != e.errorField {
+				t.Errorf("%s: expected an *ErrUnknownField for %q, but got %v", e.name, e.errorField, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: error not expected, but one received: %v", e.name, err)
+		}
+		if !reflect.DeepEqual(decoded, e.expected) {
+			t.Errorf("%s: expected %+v, but got %+v", e.name, e.expected, decoded)
+		}
+	}
+
+	// Without the option, encoding/json ignores the case
+	var testTools Tools
+	var decoded caseAccount
+	if err := testTools.ReadJSON(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader(`{"ID":1}`)), &decoded); err != nil || decoded.ID != 1 {
+		t.Errorf("expected the key to be matched in any case by default, but got %+v, %v", decoded, err)
+	}
+
+	// Errors in the body are still reported by the decoder
+	testTools.CaseSensitiveFields = true
+	var malformed *ErrMalformedJSON
+	if err := testTools.ReadJSON(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader(`{"id":`)), &decoded); !errors.As(err, &malformed) {
+		t.Errorf("expected an *ErrMalformedJSON, but got %v", err)
+	}
+	var wrongType *ErrWrongType
+	if err := testTools.ReadJSON(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader(`{"lines":"x"}`)), &decoded); !errors.As(err, &wrongType) {
+		t.Errorf("expected an *ErrWrongType, but got %v", err)
+	}
+}
+
+func TestTools_ReadJSON_CaseSensitiveFields_Concurrent(t *testing.T) {
+	testTools := Tools{CaseSensitiveFields: true}
+
+	// A new type, whose fields are not cached yet, is decoded from many goroutines at once
+	type fresh struct {
+		caseAudit
+		Key string `json:"key"`
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 64)
+	for i := 0; i < 64; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			body := fmt.Sprintf(`{"key":"%d","created_by":"x"}`, i)
+			if i%2 == 1 {
+				body = fmt.Sprintf(`{"KEY":"%d"}`, i)
+			}
+
+			var decoded fresh
+			err := testTools.ReadJSON(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader(body)), &decoded)
+			var unknownField *ErrUnknownField
+			switch {
+			case i%2 == 1 && !errors.As(err, &unknownField):
+				errs <- fmt.Errorf("%d: expected an *ErrUnknownField, but got %v", i, err)
+			case i%2 == 0 && (err != nil || decoded.Key != fmt.Sprint(i) || decoded.CreatedBy != "x"):
+				errs <- fmt.Errorf("%d: expected the body to be decoded, but got %+v, %v", i, decoded, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	if _, ok := jsonFieldCache.Load(reflect.TypeOf(fresh{})); !ok {
+		t.Error("expected the fields of the type to be cached")
+	}
+}
@@ -0,0 +1,294 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// TimeFormatUnix and TimeFormatUnixMilli are the values of JSONOptions.TimeFormat that write times as numbers
+// of seconds, or milliseconds, since the Unix epoch
+const (
+	TimeFormatUnix      = "unix"
+	TimeFormatUnixMilli = "unixmilli"
+)
+
+// JSONOptions change how WriteJSON, ErrorJSON and the other writers of this package encode JSON
+type JSONOptions struct {
+	// DisableHTMLEscape writes <, > and & as they are, rather than escaped as \u003c, \u003e and \u0026,
+	// which is only needed for JSON embedded in HTML. It applies to the whole output
+	DisableHTMLEscape bool
+	// TimeFormat is the layout time.Time values are written with, such as time.RFC1123, or TimeFormatUnix or
+	// TimeFormatUnixMilli to write them as numbers. When empty, times are written in RFC 3339 format, as
+	// encoding/json does. It applies to times anywhere in the data, in structs, slices, arrays, maps and
+	// pointers, except inside values that encode themselves, with a MarshalJSON or MarshalText method
+	TimeFormat string
+}
+
+// newJSONEncoder returns an encoder writing to w with IndentJSON and JSONOptions applied
+func (t *Tools) newJSONEncoder(w io.Writer) *json.Encoder {
+	encoder := json.NewEncoder(w)
+	if t.IndentJSON {
+		encoder.SetIndent("", "  ")
+	}
+	encoder.SetEscapeHTML(!t.JSONOptions.DisableHTMLEscape)
+	return encoder
+}
+
+// jsonValue returns data, or when JSONOptions.TimeFormat is set, an equivalent value with the times formatted
+func (t *Tools) jsonValue(data any) any {
+	if t.JSONOptions.TimeFormat == "" {
+		return data
+	}
+	return t.JSONOptions.formatTimes(reflect.ValueOf(data))
+}
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	anyType           = reflect.TypeOf((*any)(nil)).Elem()
+)
+
+// formatTimes returns the value to encode in place of v, with its times formatted with TimeFormat. Structs
+// become a jsonObject with the same members, in the same order, as encoding/json would write
+func (o JSONOptions) formatTimes(v reflect.Value) any {
+	if !v.IsValid() {
+		return nil
+	}
+	if v.Type() == timeType {
+		return o.formatTime(v.Interface().(time.Time))
+	}
+	if v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		return o.formatTimes(v.Elem())
+	}
+	if v.Type().Implements(jsonMarshalerType) || v.Type().Implements(textMarshalerType) {
+		return v.Interface()
+	}
+	if v.CanAddr() && (reflect.PointerTo(v.Type()).Implements(jsonMarshalerType) || reflect.PointerTo(v.Type()).Implements(textMarshalerType)) {
+		return v.Addr().Interface()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		return o.formatStruct(v)
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			// Byte slices are written in base64
+			return v.Interface()
+		}
+		fallthrough
+	case reflect.Array:
+		values := make([]any, v.Len())
+		for i := range values {
+			values[i] = o.formatTimes(v.Index(i))
+		}
+		return values
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		// Keys are kept as they are, so encoding/json writes and sorts them as usual
+		m := reflect.MakeMapWithSize(reflect.MapOf(v.Type().Key(), anyType), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			value := reflect.ValueOf(o.formatTimes(iter.Value()))
+			if !value.IsValid() {
+				value = reflect.Zero(anyType)
+			}
+			m.SetMapIndex(iter.Key(), value)
+		}
+		return m.Interface()
+	default:
+		return v.Interface()
+	}
+}
+
+// formatTime returns t formatted with TimeFormat
+func (o JSONOptions) formatTime(t time.Time) any {
+	switch o.TimeFormat {
+	case TimeFormatUnix:
+		return t.Unix()
+	case TimeFormatUnixMilli:
+		return t.UnixMilli()
+	default:
+		return t.Format(o.TimeFormat)
+	}
+}
+
+// shapeResponse returns data, or when data is a JSONResponse and AlwaysEmitData or OmitEmptyMessage is set, a
+// jsonObject with its members, shaped as those options say
+func (t *Tools) shapeResponse(data any) any {
+	if !t.AlwaysEmitData && !t.OmitEmptyMessage {
+		return data
+	}
+	var response JSONResponse
+	switch r := data.(type) {
+	case JSONResponse:
+		response = r
+	case *JSONResponse:
+		if r == nil {
+			return data
+		}
+		response = *r
+	default:
+		return data
+	}
+
+	object := jsonObject{{name: "error", value: response.Error}}
+	if response.Message != "" || !t.OmitEmptyMessage {
+		object = append(object, jsonMember{name: "message", value: response.Message})
+	}
+	if response.Data != nil || t.AlwaysEmitData {
+		object = append(object, jsonMember{name: "data", value: t.jsonValue(response.Data)})
+	}
+	if response.Code != "" {
+		object = append(object, jsonMember{name: "code", value: response.Code})
+	}
+	return object
+}
+
+// jsonMember is a member of a jsonObject
+type jsonMember struct {
+	name  string
+	value any
+	depth int
+}
+
+// jsonObject is a JSON object whose members are written in order
+type jsonObject []jsonMember
+
+// MarshalJSON writes the members of o in order. HTML is escaped, or not, by the encoder o is written with
+func (o jsonObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+
+	buf.WriteByte('{')
+	for i, member := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if err := encoder.Encode(member.name); err != nil {
+			return nil, err
+		}
+		buf.Truncate(buf.Len() - 1)
+		buf.WriteByte(':')
+		if err := encoder.Encode(member.value); err != nil {
+			return nil, err
+		}
+		buf.Truncate(buf.Len() - 1)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// formatStruct returns the members of the struct v, following the json tags of its fields, with their values
+// passed through formatTimes
+func (o JSONOptions) formatStruct(v reflect.Value) jsonObject {
+	members := o.structMembers(v, 0)
+
+	// As with encoding/json, a field hides the fields of the same name of the structs it embeds
+	shallowest := make(map[string]int)
+	for _, m := range members {
+		if depth, ok := shallowest[m.name]; !ok || m.depth < depth {
+			shallowest[m.name] = m.depth
+		}
+	}
+	object := make(jsonObject, 0, len(members))
+	for _, m := range members {
+		if m.depth == shallowest[m.name] {
+			object = append(object, m)
+			shallowest[m.name] = -1
+		}
+	}
+	return object
+}
+
+// structMembers returns the members of the struct v, and of the structs it embeds, at depth
+func (o JSONOptions) structMembers(v reflect.Value, depth int) []jsonMember {
+	var members []jsonMember
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+
+		value := v.Field(i)
+		if field.Anonymous && name == "" {
+			embedded := value
+			if embedded.Kind() == reflect.Pointer {
+				if embedded.IsNil() || embedded.Type().Elem().Kind() != reflect.Struct {
+					continue
+				}
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				members = append(members, o.structMembers(embedded, depth+1)...)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		if hasJSONOption(options, "omitempty") && emptyJSONValue(value) {
+			continue
+		}
+		if hasJSONOption(options, "string") {
+			// Quoted values are left to encoding/json, through a struct of that single field
+			quoted := reflect.New(reflect.StructOf([]reflect.StructField{{Name: "V", Type: field.Type, Tag: `json:"v,string"`}})).Elem()
+			quoted.Field(0).Set(value)
+			b, err := json.Marshal(quoted.Interface())
+			if err == nil {
+				members = append(members, jsonMember{name: name, value: json.RawMessage(b[len(`{"v":`) : len(b)-1]), depth: depth})
+				continue
+			}
+		}
+		members = append(members, jsonMember{name: name, value: o.formatTimes(value), depth: depth})
+	}
+	return members
+}
+
+// hasJSONOption reports whether the options of a json tag, such as "omitempty,string", include option
+func hasJSONOption(options, option string) bool {
+	for _, o := range strings.Split(options, ",") {
+		if o == option {
+			return true
+		}
+	}
+	return false
+}
+
+// emptyJSONValue reports whether v is empty, as encoding/json understands it for omitempty
+func emptyJSONValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Pointer:
+		return v.IsNil()
+	}
+	return false
+}
@@ -0,0 +1,138 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// jsonOptionsBase is embedded in jsonOptionsEvent
+type jsonOptionsBase struct {
+	ID      int       `json:"id"`
+	Created time.Time `json:"created"`
+	Name    string    `json:"name"`
+}
+
+// selfMarshaled encodes itself, so TimeFormat does not apply inside it
+type selfMarshaled struct {
+	At time.Time
+}
+
+func (s selfMarshaled) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]time.Time{"at": s.At})
+}
+
+// jsonOptionsEvent is the data of the JSONOptions tests
+type jsonOptionsEvent struct {
+	jsonOptionsBase
+	Name     string               `json:"name"`
+	At       time.Time            `json:"at"`
+	Ends     *time.Time           `json:"ends,omitempty"`
+	Missing  *time.Time           `json:"missing,omitempty"`
+	Times    []time.Time          `json:"times"`
+	ByKey    map[string]time.Time `json:"by_key"`
+	Count    int                  `json:"count,string"`
+	Skipped  string               `json:"-"`
+	Empty    string               `json:",omitempty"`
+	Raw      selfMarshaled        `json:"raw"`
+	Any      any                  `json:"any"`
+	internal int
+}
+
+func TestTools_JSONOptions_TimeFormat(t *testing.T) {
+	at := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	ends := at.Add(time.Hour)
+	event := jsonOptionsEvent{
+		jsonOptionsBase: jsonOptionsBase{ID: 7, Created: at, Name: "hidden"},
+		Name:            "launch",
+		At:              at,
+		Ends:            &ends,
+		Times:           []time.Time{at},
+		ByKey:           map[string]time.Time{"b": at, "a": ends},
+		Count:           3,
+		Skipped:         "x",
+		Raw:             selfMarshaled{At: at},
+		Any:             at,
+	}
+
+	testTools := Tools{JSONOptions: JSONOptions{TimeFormat: TimeFormatUnixMilli}}
+	rr := httptest.NewRecorder()
+	if err := testTools.WriteJSON(rr, http.StatusOK, event); err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"id":7,"created":1714557600000,"name":"launch","at":1714557600000,"ends":1714561200000,"times":[1714557600000],` +
+		`"by_key":{"a":1714561200000,"b":1714557600000},"count":"3","raw":{"at":"2024-05-01T10:00:00Z"},"any":1714557600000}`
+	if rr.Body.String() != expected {
+		t.Errorf("expected\n%s\nbut got\n%s", expected, rr.Body.String())
+	}
+
+	testTools.JSONOptions.TimeFormat = time.DateOnly
+	rr = httptest.NewRecorder()
+	_ = testTools.WriteJSON(rr, http.StatusOK, []any{at, &ends, nil})
+	if rr.Body.String() != `["2024-05-01","2024-05-01",null]` {
+		t.Errorf("wrong layout output %s", rr.Body.String())
+	}
+
+	testTools.JSONOptions.TimeFormat = TimeFormatUnix
+	rr = httptest.NewRecorder()
+	_ = testTools.WriteJSON(rr, http.StatusOK, at)
+	if rr.Body.String() != `1714557600` {
+		t.Errorf("wrong unix output %s", rr.Body.String())
+	}
+}
+
+func TestTools_JSONOptions_SameAsEncodingJSON(t *testing.T) {
+	// Without times, formatting them must not change anything else
+	values := []any{
+		jsonOptionsEvent{Name: "a", Count: 1, Empty: "e"},
+		map[int]string{2: "b", 1: "a"},
+		[]byte("bytes"),
+		struct {
+			A []int          `json:"a"`
+			B map[string]any `json:"b"`
+			C *int           `json:"c"`
+		}{B: map[string]any{"x": []string{"<y>"}}},
+		JSONResponse{Error: true, Message: "m", Code: "c"},
+	}
+	testTools := Tools{JSONOptions: JSONOptions{TimeFormat: time.RFC3339}}
+	for _, value := range values {
+		expected, _ := json.Marshal(value)
+		rr := httptest.NewRecorder()
+		if err := testTools.WriteJSON(rr, http.StatusOK, value); err != nil {
+			t.Fatal(err)
+		}
+		if rr.Body.String() != string(expected) {
+			t.Errorf("expected %s, but got %s", expected, rr.Body.String())
+		}
+	}
+}
+
+func TestTools_JSONOptions_DisableHTMLEscape(t *testing.T) {
+	payload := map[string]string{"url": "https://example.com/?a=1&b=<2>"}
+
+	var testTools Tools
+	rr := httptest.NewRecorder()
+	_ = testTools.WriteJSON(rr, http.StatusOK, payload)
+	if rr.Body.String() != `{"url":"https://example.com/?a=1\u0026b=\u003c2\u003e"}` {
+		t.Errorf("expected HTML to be escaped by default, but got %s", rr.Body.String())
+	}
+
+	testTools.JSONOptions.DisableHTMLEscape = true
+	rr = httptest.NewRecorder()
+	_ = testTools.WriteJSON(rr, http.StatusOK, payload)
+	if rr.Body.String() != `{"url":"https://example.com/?a=1&b=<2>"}` {
+		t.Errorf("expected HTML not to be escaped, but got %s", rr.Body.String())
+	}
+
+	// Along with TimeFormat, whose objects must not escape on their own
+	testTools.JSONOptions.TimeFormat = TimeFormatUnix
+	rr = httptest.NewRecorder()
+	_ = testTools.WriteJSON(rr, http.StatusOK, struct {
+		URL string `json:"url"`
+	}{URL: "<a>"})
+	if rr.Body.String() != `{"url":"<a>"}` {
+		t.Errorf("expected HTML not to be escaped, but got %s", rr.Body.String())
+	}
+}
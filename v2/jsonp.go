@@ -0,0 +1,46 @@
+package toolkit
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"regexp"
+)
+
+// ErrInvalidCallback is returned by WriteJSONP for a callback that is not a plain JavaScript identifier
+var ErrInvalidCallback = errors.New("the JSONP callback must be a JavaScript identifier")
+
+// jsonpCallback matches the callbacks WriteJSONP accepts: identifiers, possibly separated by dots, such as
+// jQuery123.handle, and nothing that could inject script into the response
+var jsonpCallback = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]{0,63}(\.[A-Za-z_$][A-Za-z0-9_$]{0,63}){0,3}$`)
+
+// WriteJSONP writes data as a JSONP response, /**/callback(data);, where callback is the query parameter
+// callbackParam of request, for clients that cannot make cross-origin requests otherwise. Without a callback,
+// data is written as plain JSON. A callback that is not a JavaScript identifier is never written back: a 400
+// Bad Request JSON error is written instead, and ErrInvalidCallback is returned. JSONPrefix does not apply.
+func (t *Tools) WriteJSONP(writer http.ResponseWriter, request *http.Request, status int, data any, callbackParam string) error {
+	callback := request.URL.Query().Get(callbackParam)
+	if callback == "" {
+		return t.WriteJSON(writer, status, data)
+	}
+	if !jsonpCallback.MatchString(callback) {
+		_ = t.ErrorJSON(writer, ErrInvalidCallback)
+		return ErrInvalidCallback
+	}
+
+	started := t.encodeStart()
+	buf := jsonBufferPool.Get().(*bytes.Buffer)
+	defer putJSONBuffer(buf)
+
+	// The comment keeps the callback from being the first bytes of the response, which stops them from being
+	// sniffed as another type of content, as in the Rosetta Flash attack
+	buf.WriteString("/**/" + callback + "(")
+	if err := t.newJSONEncoder(buf).Encode(t.jsonValue(data)); err != nil {
+		return err
+	}
+	buf.Truncate(buf.Len() - 1)
+	buf.WriteString(");")
+
+	writer.Header().Set("X-Content-Type-Options", "nosniff")
+	return t.writeJSONBuffer(writer, status, "application/javascript", buf, nil, started)
+}
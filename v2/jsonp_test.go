@@ -0,0 +1,118 @@
+package toolkit
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var writeJSONPTests = []struct {
+	name         string
+	callback     string
+	expectedCode int
+	expectedType string
+	expectedBody string
+	invalid      bool
+}{
+	{name: "callback", callback: "handle", expectedCode: http.StatusOK, expectedType: "application/javascript", expectedBody: `/**/handle({"foo":"bar"});`},
+	{name: "dotted callback", callback: "jQuery_123.cb$", expectedCode: http.StatusOK, expectedType: "application/javascript", expectedBody: `/**/jQuery_123.cb$({"foo":"bar"});`},
+	{name: "no callback", callback: "", expectedCode: http.StatusOK, expectedType: "application/json", expectedBody: `{"foo":"bar"}`},
+	{name: "script injection", callback: "alert(document.cookie);//", invalid: true},
+	{name: "html", callback: "<script>x</script>", invalid: true},
+	{name: "leading digit", callback: "1abc", invalid: true},
+	{name: "too deep", callback: "a.b.c.d.e", invalid: true},
+	{name: "too long", callback: strings.Repeat("a", 65), invalid: true},
+	{name: "unicode line separator", callback: "cb ", invalid: true},
+}
+
+func TestTools_WriteJSONP(t *testing.T) {
+	testTools := Tools{JSONPrefix: ")]}',\n"}
+	for _, e := range writeJSONPTests {
+		target := "/"
+		if e.callback != "" {
+			target += "?cb=" + url.QueryEscape(e.callback)
+		}
+		rr := httptest.NewRecorder()
+		err := testTools.WriteJSONP(rr, httptest.NewRequest("GET", target, nil), http.StatusOK, map[string]string{"foo": "bar"}, "cb")
+
+		if e.invalid {
+			if !errors.Is(err, ErrInvalidCallback) || rr.Code != http.StatusBadRequest || rr.Header().Get("Content-Type") != "application/json" {
+				t.Errorf("%s: expected a 400 JSON error, but got %d %s, %v", e.name, rr.Code, rr.Header().Get("Content-Type"), err)
+			}
+			if strings.Contains(rr.Body.String(), e.callback) {
+				t.Errorf("%s: the callback was reflected in %s", e.name, rr.Body.String())
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: error not expected, but one received: %s", e.name, err)
+		}
+		// The prefix only goes before plain JSON, which it would break as a script
+		expectedBody := e.expectedBody
+		if e.expectedType == "application/json" {
+			expectedBody = testTools.JSONPrefix + expectedBody
+		}
+		if rr.Code != e.expectedCode || rr.Header().Get("Content-Type") != e.expectedType || rr.Body.String() != expectedBody {
+			t.Errorf("%s: expected %d %s %q, but got %d %s %q", e.name, e.expectedCode, e.expectedType, expectedBody, rr.Code, rr.Header().Get("Content-Type"), rr.Body.String())
+		}
+	}
+}
+
+func TestTools_JSONPrefix(t *testing.T) {
+	testTools := Tools{JSONPrefix: ")]}',\n", CompressionThreshold: 10}
+	payload := []string{strings.Repeat("item", 20)}
+
+	rr := httptest.NewRecorder()
+	if err := testTools.WriteJSON(rr, http.StatusOK, payload); err != nil {
+		t.Fatal(err)
+	}
+	plain := rr.Body.String()
+	if !strings.HasPrefix(plain, ")]}',\n[\"item") || rr.Header().Get("Content-Length") != strconv.Itoa(len(plain)) {
+		t.Errorf("expected the prefixed body with its length, but got %s %q", rr.Header().Get("Content-Length"), plain)
+	}
+
+	// The ETag covers the prefix, and a cached response still gets a 304
+	handler := testTools.NegotiateEncoding(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = testTools.WriteJSONCached(w, r, http.StatusOK, payload)
+	}))
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	etag := rr.Header().Get("ETag")
+	if rr.Body.String() != plain {
+		t.Errorf("expected %q, but got %q", plain, rr.Body.String())
+	}
+	withoutPrefix := Tools{CompressionThreshold: 10}
+	rr = httptest.NewRecorder()
+	_ = withoutPrefix.WriteJSONCached(rr, httptest.NewRequest("GET", "/", nil), http.StatusOK, payload)
+	if rr.Header().Get("ETag") == etag {
+		t.Error("expected the prefix to change the ETag")
+	}
+
+	// Gzipped responses keep the prefix once decompressed
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	gz, err := gzip.NewReader(rr.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decompressed, _ := io.ReadAll(gz)
+	if string(decompressed) != plain || rr.Header().Get("ETag") != "W/"+etag {
+		t.Errorf("expected %q with a weak ETag, but got %q, %s", plain, decompressed, rr.Header().Get("ETag"))
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("If-None-Match", etag)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotModified || rr.Body.Len() != 0 {
+		t.Errorf("expected a 304, but got %d", rr.Code)
+	}
+}
@@ -0,0 +1,68 @@
+package toolkit
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PreferredLanguages returns the language tags of the Accept-Language header of r, such as "pt-BR" and "en",
+// most preferred first. Tags with a quality of 0, the * wildcard, and tags that cannot be parsed are left out.
+// Tags of the same quality keep the order of the header
+func PreferredLanguages(r *http.Request) []string {
+	type language struct {
+		tag     string
+		quality float64
+	}
+	var languages []language
+	for _, header := range r.Header.Values("Accept-Language") {
+		for _, part := range strings.Split(header, ",") {
+			tag, params, _ := strings.Cut(part, ";")
+			tag = strings.TrimSpace(tag)
+			if tag == "" || tag == "*" || strings.ContainsAny(tag, " \t") {
+				continue
+			}
+
+			quality := 1.0
+			if q, found := strings.CutPrefix(strings.TrimSpace(params), "q="); found {
+				var err error
+				if quality, err = strconv.ParseFloat(q, 64); err != nil || quality < 0 || quality > 1 {
+					continue
+				}
+			}
+			if quality > 0 {
+				languages = append(languages, language{tag: tag, quality: quality})
+			}
+		}
+	}
+
+	sort.SliceStable(languages, func(i, j int) bool { return languages[i].quality > languages[j].quality })
+	tags := make([]string, len(languages))
+	for i, l := range languages {
+		tags[i] = l.tag
+	}
+	return tags
+}
+
+// localizedError is an error sent by ErrorJSONLocalized, whose message is the translation of err
+type localizedError struct {
+	message string
+	err     error
+}
+
+func (e *localizedError) Error() string { return e.message }
+func (e *localizedError) Unwrap() error { return e.err }
+
+// ErrorJSONLocalized is like ErrorJSONWithRequest, but sends the message TranslateError returns for err and
+// the request, such as one in the first of its PreferredLanguages, rather than err.Error(). The message of err
+// is sent when TranslateError is not set or returns an empty message, and in the debug data in Debug mode.
+// The code of err, and WrapResponse, see err as usual, only its message is translated
+func (t *Tools) ErrorJSONLocalized(writer http.ResponseWriter, request *http.Request, err error, status ...int) error {
+	if t.TranslateError != nil {
+		if message := t.TranslateError(request, err); message != "" {
+			err = &localizedError{message: message, err: err}
+		}
+	}
+	return t.ErrorJSONWithRequest(writer, request, err, status...)
+}
@@ -0,0 +1,122 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var preferredLanguagesTests = []struct {
+	name           string
+	acceptLanguage string
+	expected       []string
+}{
+	{name: "none", acceptLanguage: "", expected: []string{}},
+	{name: "single", acceptLanguage: "pt-BR", expected: []string{"pt-BR"}},
+	{name: "ordered by quality", acceptLanguage: "en;q=0.5, pt-BR, pt;q=0.8", expected: []string{"pt-BR", "pt", "en"}},
+	{name: "same quality keeps order", acceptLanguage: "fr, de, en;q=0.9, es;q=0.9", expected: []string{"fr", "de", "en", "es"}},
+	{name: "refused and wildcard", acceptLanguage: "pt-BR, en;q=0, *;q=0.1", expected: []string{"pt-BR"}},
+	{name: "malformed quality", acceptLanguage: "pt-BR;q=high, en", expected: []string{"en"}},
+	{name: "spaces", acceptLanguage: " pt-BR ; q=0.7 ,en ", expected: []string{"en", "pt-BR"}},
+}
+
+func TestPreferredLanguages(t *testing.T) {
+	for _, e := range preferredLanguagesTests {
+		req := httptest.NewRequest("GET", "/", nil)
+		if e.acceptLanguage != "" {
+			req.Header.Set("Accept-Language", e.acceptLanguage)
+		}
+		if languages := PreferredLanguages(req); strings.Join(languages, "|") != strings.Join(e.expected, "|") {
+			t.Errorf("%s: expected %v, but got %v", e.name, e.expected, languages)
+		}
+	}
+}
+
+// translations are the messages of the fake translator of the tests, keyed by language and then by message
+var translations = map[string]map[string]string{
+	"pt-BR": {"user not found": "usuário não encontrado"},
+	"pt":    {"user not found": "utilizador não encontrado"},
+}
+
+func translate(r *http.Request, err error) string {
+	for _, language := range PreferredLanguages(r) {
+		if message, ok := translations[language][err.Error()]; ok {
+			return message
+		}
+	}
+	return ""
+}
+
+var localizedErrorTests = []struct {
+	name           string
+	acceptLanguage string
+	err            error
+	expected       string
+}{
+	{name: "pt-BR", acceptLanguage: "pt-BR,pt;q=0.9,en;q=0.8", err: errors.New("user not found"), expected: "usuário não encontrado"},
+	{name: "pt", acceptLanguage: "pt, pt-BR;q=0.5", err: errors.New("user not found"), expected: "utilizador não encontrado"},
+	{name: "no translation", acceptLanguage: "pt-BR", err: errors.New("disk full"), expected: "disk full"},
+	{name: "other language", acceptLanguage: "de", err: errors.New("user not found"), expected: "user not found"},
+}
+
+func TestTools_ErrorJSONLocalized(t *testing.T) {
+	for _, e := range localizedErrorTests {
+		var logged error
+		testTools := Tools{TranslateError: translate, ErrorLogger: func(r *http.Request, status int, err error) { logged = err }}
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept-Language", e.acceptLanguage)
+		rr := httptest.NewRecorder()
+		if err := testTools.ErrorJSONLocalized(rr, req, e.err, http.StatusNotFound); err != nil {
+			t.Fatal(err)
+		}
+
+		var response JSONResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		if rr.Code != http.StatusNotFound || response.Message != e.expected || response.Data != nil {
+			t.Errorf("%s: expected 404 with %q, but got %d %+v", e.name, e.expected, rr.Code, response)
+		}
+		if !errors.Is(logged, e.err) {
+			t.Errorf("%s: expected the error to be logged, but got %v", e.name, logged)
+		}
+	}
+
+	// Without a translator, the message of the error is sent
+	var testTools Tools
+	rr := httptest.NewRecorder()
+	_ = testTools.ErrorJSONLocalized(rr, httptest.NewRequest("GET", "/", nil), errors.New("user not found"))
+	if expected := `{"error":true,"message":"user not found"}`; rr.Body.String() != expected {
+		t.Errorf("expected %s, but got %s", expected, rr.Body.String())
+	}
+}
+
+func TestTools_ErrorJSONLocalized_Debug(t *testing.T) {
+	testTools := Tools{TranslateError: translate, Debug: true}
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Language", "pt-BR")
+	rr := httptest.NewRecorder()
+	_ = testTools.ErrorJSONLocalized(rr, req, notFoundError{what: "user"}, http.StatusNotFound)
+
+	var response struct {
+		Message string `json:"message"`
+		Code    string `json:"code"`
+		Data    struct {
+			Message string   `json:"message"`
+			Causes  []string `json:"causes"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Message != "usuário não encontrado" || response.Code != "user_not_found" {
+		t.Errorf("expected the translated message with the code of the error, but got %+v", response)
+	}
+	if response.Data.Message != "user not found" || len(response.Data.Causes) != 0 {
+		t.Errorf("expected the untranslated message in the debug data, but got %+v", response.Data)
+	}
+}
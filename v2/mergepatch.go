@@ -0,0 +1,96 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+)
+
+// ApplyJSONMergePatch applies patch, a JSON merge patch as RFC 7386 defines it, to the JSON document original,
+// and returns the patched document: members of the patch set to null are removed, objects are merged
+// recursively, and any other value, arrays included, replaces the one it patches. Numbers are kept as they
+// are written, so large integers keep their precision. The keys of the objects of the result are sorted
+func ApplyJSONMergePatch(original, patch []byte) ([]byte, error) {
+	target, err := decodeMergeValue(original)
+	if err != nil {
+		return nil, fmt.Errorf("original document: %w", err)
+	}
+	patchValue, err := decodeMergeValue(patch)
+	if err != nil {
+		return nil, fmt.Errorf("merge patch: %w", err)
+	}
+	return json.Marshal(mergePatch(target, patchValue))
+}
+
+// decodeMergeValue decodes the single JSON value of data, with numbers as json.Number
+func decodeMergeValue(data []byte) (any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, jsonDecodeError(err)
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, ErrMultipleJSONValues
+	}
+	return value, nil
+}
+
+// mergePatch returns target patched with patch, as the MergePatch function of RFC 7386 does
+func mergePatch(target, patch any) any {
+	patchObject, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]any)
+	if !ok {
+		targetObject = make(map[string]any, len(patchObject))
+	}
+	for name, value := range patchObject {
+		if value == nil {
+			delete(targetObject, name)
+			continue
+		}
+		targetObject[name] = mergePatch(targetObject[name], value)
+	}
+	return targetObject
+}
+
+// ReadAndApplyMergePatch reads a JSON merge patch from the body of request, with the same limits and errors as
+// ReadJSON, and applies it to original, which must be a pointer, such as to the stored version of the resource
+// a PATCH request updates. The patched document is decoded into a new value, so members the patch removes are
+// reset to their zero value, or to their default tag, and it is validated as ReadJSON does. original is left
+// as it was when any of this fails
+func (t *Tools) ReadAndApplyMergePatch(writer http.ResponseWriter, request *http.Request, original any) error {
+	target := reflect.ValueOf(original)
+	if target.Kind() != reflect.Pointer || target.IsNil() {
+		return fmt.Errorf("error applying merge patch: %w", &json.InvalidUnmarshalError{Type: reflect.TypeOf(original)})
+	}
+
+	var patch json.RawMessage
+	if err := t.ReadJSON(writer, request, &patch); err != nil {
+		return err
+	}
+	document, err := json.Marshal(original)
+	if err != nil {
+		return fmt.Errorf("error applying merge patch: %w", err)
+	}
+	patched, err := ApplyJSONMergePatch(document, patch)
+	if err != nil {
+		return err
+	}
+
+	result := reflect.New(target.Elem().Type())
+	// The patched document is not limited to MaxJSONSize, which is for the patch the client sends
+	if err := t.decodeJSON(bytes.NewReader(patched), result.Interface()); err != nil {
+		return err
+	}
+	if err := validate(result.Interface()); err != nil {
+		return err
+	}
+	target.Elem().Set(result.Elem())
+	return nil
+}
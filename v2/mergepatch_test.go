@@ -0,0 +1,124 @@
+package toolkit
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// mergePatchTests are the examples of appendix A of RFC 7386, and a few more
+var mergePatchTests = []struct {
+	name     string
+	original string
+	patch    string
+	expected string
+}{
+	{name: "replace member", original: `{"a":"b"}`, patch: `{"a":"c"}`, expected: `{"a":"c"}`},
+	{name: "add member", original: `{"a":"b"}`, patch: `{"b":"c"}`, expected: `{"a":"b","b":"c"}`},
+	{name: "delete member", original: `{"a":"b"}`, patch: `{"a":null}`, expected: `{}`},
+	{name: "delete one of two", original: `{"a":"b","b":"c"}`, patch: `{"a":null}`, expected: `{"b":"c"}`},
+	{name: "array replaces string", original: `{"a":["b"]}`, patch: `{"a":"c"}`, expected: `{"a":"c"}`},
+	{name: "string replaces array", original: `{"a":"c"}`, patch: `{"a":["b"]}`, expected: `{"a":["b"]}`},
+	{name: "nested delete", original: `{"a":{"b":"c"}}`, patch: `{"a":{"b":"d","c":null}}`, expected: `{"a":{"b":"d"}}`},
+	{name: "array of objects replaced", original: `{"a":[{"b":"c"}]}`, patch: `{"a":[1]}`, expected: `{"a":[1]}`},
+	{name: "array replaces array", original: `["a","b"]`, patch: `["c","d"]`, expected: `["c","d"]`},
+	{name: "object replaces array", original: `{"a":"b"}`, patch: `["c"]`, expected: `["c"]`},
+	{name: "null patch", original: `{"a":"foo"}`, patch: `null`, expected: `null`},
+	{name: "string patch", original: `{"a":"foo"}`, patch: `"bar"`, expected: `"bar"`},
+	{name: "null kept in added object", original: `{"e":null}`, patch: `{"a":1}`, expected: `{"a":1,"e":null}`},
+	{name: "object from array", original: `[1,2]`, patch: `{"a":"b","c":null}`, expected: `{"a":"b"}`},
+	{name: "deep nulls dropped", original: `{}`, patch: `{"a":{"bb":{"ccc":null}}}`, expected: `{"a":{"bb":{}}}`},
+	{name: "type change of nested", original: `{"a":{"b":1}}`, patch: `{"a":{"b":{"c":true}}}`, expected: `{"a":{"b":{"c":true}}}`},
+	{name: "large number", original: `{"id":9007199254740993}`, patch: `{"n":1}`, expected: `{"id":9007199254740993,"n":1}`},
+}
+
+func TestApplyJSONMergePatch(t *testing.T) {
+	for _, e := range mergePatchTests {
+		patched, err := ApplyJSONMergePatch([]byte(e.original), []byte(e.patch))
+		if err != nil || string(patched) != e.expected {
+			t.Errorf("%s: expected %s, but got %s, %v", e.name, e.expected, patched, err)
+		}
+	}
+
+	var malformed *ErrMalformedJSON
+	if _, err := ApplyJSONMergePatch([]byte(`{}`), []byte(`{"a":`)); !errors.As(err, &malformed) || !strings.HasPrefix(err.Error(), "merge patch: ") {
+		t.Errorf("expected an *ErrMalformedJSON for the patch, but got %v", err)
+	}
+	if _, err := ApplyJSONMergePatch([]byte(`{} {}`), []byte(`{}`)); !errors.Is(err, ErrMultipleJSONValues) {
+		t.Errorf("expected ErrMultipleJSONValues for the original, but got %v", err)
+	}
+}
+
+type mergeAddress struct {
+	City string `json:"city"`
+	Zip  string `json:"zip,omitempty"`
+}
+
+type mergeUser struct {
+	Name    string        `json:"name"`
+	Tags    []string      `json:"tags"`
+	Address *mergeAddress `json:"address,omitempty"`
+	Role    string        `json:"role" default:"member"`
+}
+
+func (u *mergeUser) Valid() map[string]string {
+	if u.Name == "" {
+		return map[string]string{"name": "is required"}
+	}
+	return nil
+}
+
+func TestTools_ReadAndApplyMergePatch(t *testing.T) {
+	var testTools Tools
+	newUser := func() mergeUser {
+		return mergeUser{Name: "Ana", Tags: []string{"a", "b"}, Address: &mergeAddress{City: "Porto", Zip: "4000"}, Role: "admin"}
+	}
+	patchRequest := func(patch string) *http.Request {
+		req := httptest.NewRequest("PATCH", "/users/1", strings.NewReader(patch))
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+		return req
+	}
+
+	user := newUser()
+	if err := testTools.ReadAndApplyMergePatch(httptest.NewRecorder(), patchRequest(`{"tags":["c"],"address":{"zip":null},"role":null}`), &user); err != nil {
+		t.Fatal(err)
+	}
+	if user.Name != "Ana" || strings.Join(user.Tags, ",") != "c" || user.Address == nil || *user.Address != (mergeAddress{City: "Porto"}) || user.Role != "member" {
+		t.Errorf("expected the patch to be applied, but got %+v, %+v", user, user.Address)
+	}
+
+	user = newUser()
+	if err := testTools.ReadAndApplyMergePatch(httptest.NewRecorder(), patchRequest(`{"address":null}`), &user); err != nil || user.Address != nil {
+		t.Errorf("expected the address to be removed, but got %+v, %v", user.Address, err)
+	}
+
+	// A patch that fails leaves the original as it was
+	var failureTests = []struct {
+		name   string
+		patch  string
+		status int
+	}{
+		{name: "invalid result", patch: `{"name":null}`, status: http.StatusUnprocessableEntity},
+		{name: "unknown field", patch: `{"email":"a@b.c"}`, status: http.StatusUnprocessableEntity},
+		{name: "wrong type", patch: `{"tags":"c"}`, status: http.StatusBadRequest},
+		{name: "malformed", patch: `{"name":`, status: http.StatusBadRequest},
+		{name: "empty", patch: ``, status: http.StatusBadRequest},
+	}
+	for _, e := range failureTests {
+		user := newUser()
+		err := testTools.ReadAndApplyMergePatch(httptest.NewRecorder(), patchRequest(e.patch), &user)
+		if err == nil || JSONErrorStatus(err) != e.status {
+			t.Errorf("%s: expected an error with status %d, but got %v", e.name, e.status, err)
+		}
+		if !reflect.DeepEqual(user, newUser()) {
+			t.Errorf("%s: expected the original to be left alone, but got %+v", e.name, user)
+		}
+	}
+
+	if err := testTools.ReadAndApplyMergePatch(httptest.NewRecorder(), patchRequest(`{}`), user); err == nil || JSONErrorStatus(err) != http.StatusInternalServerError {
+		t.Errorf("expected an error for an original that is not a pointer, but got %v", err)
+	}
+}
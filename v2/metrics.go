@@ -0,0 +1,117 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// The reasons passed to UploadMetrics.ObserveRejection
+const (
+	// RejectionTooLarge is a request, or the files in it, over MaxFileSize, or a file over MaxSingleFileSize
+	RejectionTooLarge = "too_large"
+	// RejectionTooSmall is a file under MinFileSize
+	RejectionTooSmall = "too_small"
+	// RejectionFileType is a file whose type or extension is not permitted
+	RejectionFileType = "file_type"
+	// RejectionTooManyFiles is a request with more files than MaxUploadCount
+	RejectionTooManyFiles = "too_many_files"
+	// RejectionQuota is a file that would take its upload directory over MaxDirSize
+	RejectionQuota = "quota"
+	// RejectionCanceled is an upload aborted because its context was cancelled
+	RejectionCanceled = "canceled"
+	// RejectionInvalid is any other failure, such as an empty file or one rejected by ScanFunc
+	RejectionInvalid = "invalid"
+)
+
+// UploadMetrics receives observations about uploads, for instance to update Prometheus counters. Its methods
+// may be called concurrently.
+type UploadMetrics interface {
+	// ObserveUpload is called for every file saved, with its new name, size and how long it took to save it
+	ObserveUpload(file string, size int64, dur time.Duration)
+	// ObserveRejection is called for every file or request rejected, with one of the Rejection reasons
+	ObserveRejection(reason string)
+}
+
+// observeRejection reports a rejection for reason to Metrics, when set
+func (t *Tools) observeRejection(reason string) {
+	if t.Metrics != nil {
+		t.Metrics.ObserveRejection(reason)
+	}
+}
+
+// encodeStart returns the time encoding a response starts, for ResponseObserver, or the zero time when
+// ResponseObserver is not set, so nothing is measured
+func (t *Tools) encodeStart() time.Time {
+	if t.ResponseObserver == nil {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// observeResponse reports a response written with status, of size bytes, to ResponseObserver, when set
+func (t *Tools) observeResponse(status, bytes int, encodeDuration time.Duration) {
+	if t.ResponseObserver != nil {
+		t.ResponseObserver(status, bytes, encodeDuration)
+	}
+}
+
+// rejectionReason returns the reason reported to UploadMetrics for an upload that failed with err
+func rejectionReason(err error) string {
+	switch {
+	case errors.Is(err, ErrQuotaExceeded):
+		return RejectionQuota
+	case errors.Is(err, ErrRequestTooLarge), errors.Is(err, ErrFileTooLarge):
+		return RejectionTooLarge
+	case errors.Is(err, ErrFileTooSmall):
+		return RejectionTooSmall
+	case errors.Is(err, ErrFileTypeNotPermitted):
+		return RejectionFileType
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return RejectionCanceled
+	default:
+		return RejectionInvalid
+	}
+}
+
+// MemoryMetrics is an UploadMetrics that keeps count of the observations in memory, which is mostly useful
+// in tests
+type MemoryMetrics struct {
+	mu         sync.Mutex
+	uploads    int
+	bytes      int64
+	rejections map[string]int
+}
+
+// ObserveUpload counts an uploaded file and its size
+func (m *MemoryMetrics) ObserveUpload(file string, size int64, dur time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.uploads++
+	m.bytes += size
+}
+
+// ObserveRejection counts a rejection for reason
+func (m *MemoryMetrics) ObserveRejection(reason string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.rejections == nil {
+		m.rejections = make(map[string]int)
+	}
+	m.rejections[reason]++
+}
+
+// Uploads returns the number of files uploaded, and their total size
+func (m *MemoryMetrics) Uploads() (int, int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.uploads, m.bytes
+}
+
+// Rejections returns the number of rejections for reason
+func (m *MemoryMetrics) Rejections(reason string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.rejections[reason]
+}
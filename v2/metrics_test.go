@@ -0,0 +1,120 @@
+package toolkit
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTools_UploadFiles_Metrics(t *testing.T) {
+	metrics := &MemoryMetrics{}
+	testTools := Tools{Metrics: metrics, AllowedFileTypes: []string{"text/plain"}, MaxSingleFileSize: 100}
+
+	// Parsed forms attempt every file, so a single request covers successes and failures
+	request := newParsedUploadRequest(t,
+		testFile{name: "one.txt", content: []byte("first notes")},
+		testFile{name: "img.png", content: pngHeader},
+		testFile{name: "two.txt", content: []byte("second notes")},
+		testFile{name: "three.txt", content: []byte("third notes")},
+	)
+	if _, err := testTools.UploadFiles(request, t.TempDir()); err == nil {
+		t.Error("error expected, but none received")
+	}
+
+	// Requests rejected as a whole are counted too
+	testTools.MaxUploadCount = 1
+	request = newUploadRequest(t, testFile{name: "one.txt", content: []byte("a")}, testFile{name: "two.txt", content: []byte("b")})
+	if _, err := testTools.UploadFiles(request, t.TempDir()); err == nil {
+		t.Error("error expected, but none received")
+	}
+	testTools.MaxUploadCount = 0
+	testTools.MaxFileSize = 10
+	request = newUploadRequest(t, testFile{name: "big.txt", content: []byte("more than ten bytes")})
+	if _, err := testTools.UploadFiles(request, t.TempDir()); err == nil {
+		t.Error("error expected, but none received")
+	}
+
+	// one.txt of the second request is uploaded before two.txt goes over the count
+	if uploads, size := metrics.Uploads(); uploads != 4 || size != 35 {
+		t.Errorf("expected 4 uploads of 35 bytes, but got %d of %d bytes", uploads, size)
+	}
+	for reason, expected := range map[string]int{RejectionFileType: 1, RejectionInvalid: 0, RejectionTooManyFiles: 1, RejectionTooLarge: 1, RejectionQuota: 0} {
+		if got := metrics.Rejections(reason); got != expected {
+			t.Errorf("expected %d rejections for %s, but got %d", expected, reason, got)
+		}
+	}
+}
+
+// observedResponse is a call of the ResponseObserver of the tests
+type observedResponse struct {
+	status         int
+	bytes          int
+	encodeDuration time.Duration
+}
+
+// slowJSON takes a while to encode
+type slowJSON struct{}
+
+func (slowJSON) MarshalJSON() ([]byte, error) {
+	time.Sleep(20 * time.Millisecond)
+	return []byte(`"slow"`), nil
+}
+
+// slowWriter takes a while to write
+type slowWriter struct {
+	*httptest.ResponseRecorder
+}
+
+func (w slowWriter) Write(b []byte) (int, error) {
+	time.Sleep(50 * time.Millisecond)
+	return w.ResponseRecorder.Write(b)
+}
+
+func TestTools_ResponseObserver(t *testing.T) {
+	var observed []observedResponse
+	testTools := Tools{ResponseObserver: func(status int, bytes int, encodeDuration time.Duration) {
+		observed = append(observed, observedResponse{status, bytes, encodeDuration})
+	}}
+
+	large := make([]streamItem, 10000)
+	for i := range large {
+		large[i] = streamItem{ID: i, Name: strings.Repeat("x", 20)}
+	}
+
+	_ = testTools.WriteJSON(httptest.NewRecorder(), http.StatusOK, map[string]int{"a": 1})
+	rr := httptest.NewRecorder()
+	_ = testTools.WriteJSON(rr, http.StatusOK, large)
+	_ = testTools.ErrorJSON(httptest.NewRecorder(), errors.New("boom"), http.StatusTeapot)
+	_ = testTools.NoContent(httptest.NewRecorder())
+	stream := httptest.NewRecorder()
+	_ = testTools.WriteJSONStream(stream, http.StatusOK, streamItems(3))
+
+	expected := []observedResponse{
+		{status: http.StatusOK, bytes: len(`{"a":1}`)},
+		{status: http.StatusOK, bytes: rr.Body.Len()},
+		{status: http.StatusTeapot, bytes: len(`{"error":true,"message":"boom"}`)},
+		{status: http.StatusNoContent, bytes: 0},
+		{status: http.StatusOK, bytes: stream.Body.Len()},
+	}
+	if len(observed) != len(expected) {
+		t.Fatalf("expected %d observations, but got %d", len(expected), len(observed))
+	}
+	for i, e := range expected {
+		if observed[i].status != e.status || observed[i].bytes != e.bytes {
+			t.Errorf("%d: expected status %d and %d bytes, but got %+v", i, e.status, e.bytes, observed[i])
+		}
+	}
+	if observed[1].bytes < 300000 || observed[1].encodeDuration <= 0 || observed[1].encodeDuration < observed[0].encodeDuration {
+		t.Errorf("expected the large payload to take longer to encode, but got %v and %v", observed[0], observed[1])
+	}
+
+	// Encoding is measured, but not writing
+	observed = nil
+	_ = testTools.WriteJSON(slowWriter{httptest.NewRecorder()}, http.StatusOK, slowJSON{})
+	if len(observed) != 1 || observed[0].encodeDuration < 20*time.Millisecond || observed[0].encodeDuration >= 50*time.Millisecond {
+		t.Errorf("expected about 20ms of encoding, without the write, but got %+v", observed)
+	}
+}
@@ -0,0 +1,83 @@
+package toolkit
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// MsgPackCodec encodes and decodes MessagePack for ReadMsgPack and WriteMsgPack, which keeps the toolkit free
+// of a MessagePack dependency. The Marshal and Unmarshal functions of github.com/vmihailenco/msgpack/v5, for
+// instance, can be wrapped in a type with these methods
+type MsgPackCodec interface {
+	// Marshal encodes v as MessagePack
+	Marshal(v any) ([]byte, error)
+	// Unmarshal decodes the MessagePack data into v
+	Unmarshal(data []byte, v any) error
+}
+
+// msgPackContentType is the media type of MessagePack bodies
+const msgPackContentType = "application/msgpack"
+
+// ErrNoMsgPackCodec is returned by ReadMsgPack and WriteMsgPack when Tools.MsgPack is not set
+var ErrNoMsgPackCodec = errors.New("no MessagePack codec is set")
+
+// ErrMalformedMsgPack is returned by ReadMsgPack for a body that cannot be decoded
+type ErrMalformedMsgPack struct {
+	// Err is the error of the codec
+	Err error
+}
+
+func (e *ErrMalformedMsgPack) Error() string {
+	return fmt.Sprintf("body contains badly-formed MessagePack: %v", e.Err)
+}
+
+func (e *ErrMalformedMsgPack) Unwrap() error { return e.Err }
+
+// ReadMsgPack reads the MessagePack body of a request into data, with the codec set in Tools.MsgPack, and with
+// the same limit, MaxJSONSize, decompression and validation as ReadJSON. When EnforceJSONContentType is set,
+// the Content-Type must be application/msgpack. The errors about the body match ErrBodyTooLarge or
+// ErrEmptyBody with errors.Is, or are an *ErrMalformedMsgPack
+func (t *Tools) ReadMsgPack(writer http.ResponseWriter, request *http.Request, data any) error {
+	if t.MsgPack == nil {
+		return ErrNoMsgPackCodec
+	}
+	if t.EnforceJSONContentType && mediaType(request.Header.Get("Content-Type")) != msgPackContentType {
+		return &ErrUnsupportedMediaType{ContentType: request.Header.Get("Content-Type")}
+	}
+	request.Body = http.MaxBytesReader(writer, request.Body, int64(t.maxJSONSize()))
+	body, err := decompressedBody(request)
+	if err != nil {
+		return err
+	}
+
+	limit := int64(t.maxJSONSize())
+	raw, err := io.ReadAll(&jsonLimitReader{r: io.LimitReader(body, limit+1), limit: limit})
+	if err != nil {
+		return jsonDecodeError(err)
+	}
+	if len(raw) == 0 {
+		return ErrEmptyBody
+	}
+	if err := t.MsgPack.Unmarshal(raw, data); err != nil {
+		return &ErrMalformedMsgPack{Err: err}
+	}
+	return validate(data)
+}
+
+// WriteMsgPack writes data encoded as MessagePack, with the codec set in Tools.MsgPack, with the status code and
+// the optional headers, as WriteJSON does with JSON
+func (t *Tools) WriteMsgPack(writer http.ResponseWriter, status int, data any, headers ...http.Header) error {
+	if t.MsgPack == nil {
+		return ErrNoMsgPackCodec
+	}
+	return t.writeEncoded(writer, status, msgPackContentType, func(w io.Writer, data any) error {
+		out, err := t.MsgPack.Marshal(data)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(out)
+		return err
+	}, data, headers)
+}
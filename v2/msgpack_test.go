@@ -0,0 +1,269 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// miniMsgPack is a MsgPackCodec for the tests, which handles maps with string keys, arrays, strings, integers,
+// floats, booleans and nil, going through JSON to map structs to those
+type miniMsgPack struct{}
+
+func (miniMsgPack) Marshal(v any) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var generic any
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	if err := decoder.Decode(&generic); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	err = packValue(&buf, generic)
+	return buf.Bytes(), err
+}
+
+func packValue(buf *bytes.Buffer, v any) error {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteByte(0xc0)
+	case bool:
+		if v {
+			buf.WriteByte(0xc3)
+		} else {
+			buf.WriteByte(0xc2)
+		}
+	case json.Number:
+		if n, err := v.Int64(); err == nil && n >= 0 && n < 128 {
+			buf.WriteByte(byte(n))
+		} else if err == nil {
+			buf.WriteByte(0xd3)
+			_ = binary.Write(buf, binary.BigEndian, n)
+		} else {
+			f, _ := v.Float64()
+			buf.WriteByte(0xcb)
+			_ = binary.Write(buf, binary.BigEndian, math.Float64bits(f))
+		}
+	case string:
+		if len(v) >= 32 {
+			buf.WriteByte(0xd9)
+			buf.WriteByte(byte(len(v)))
+		} else {
+			buf.WriteByte(0xa0 | byte(len(v)))
+		}
+		buf.WriteString(v)
+	case []any:
+		buf.WriteByte(0x90 | byte(len(v)))
+		for _, item := range v {
+			if err := packValue(buf, item); err != nil {
+				return err
+			}
+		}
+	case map[string]any:
+		// Keys are sorted, so the encoding is stable
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		buf.WriteByte(0x80 | byte(len(v)))
+		for _, key := range keys {
+			_ = packValue(buf, key)
+			if err := packValue(buf, v[key]); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("cannot pack %T", v)
+	}
+	return nil
+}
+
+func (miniMsgPack) Unmarshal(data []byte, v any) error {
+	r := bytes.NewReader(data)
+	generic, err := unpackValue(r)
+	if err != nil {
+		return err
+	}
+	if r.Len() > 0 {
+		return errors.New("trailing data")
+	}
+	b, err := json.Marshal(generic)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func unpackValue(r *bytes.Reader) (any, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return nil, errors.New("unexpected end of data")
+	}
+	readString := func(n int) (any, error) {
+		s := make([]byte, n)
+		if _, err := r.Read(s); err != nil && n > 0 {
+			return nil, errors.New("unexpected end of data")
+		}
+		return string(s), nil
+	}
+	switch {
+	case b < 0x80:
+		return int64(b), nil
+	case b&0xf0 == 0x80:
+		m := make(map[string]any)
+		for i := 0; i < int(b&0x0f); i++ {
+			key, err := unpackValue(r)
+			if err != nil {
+				return nil, err
+			}
+			k, ok := key.(string)
+			if !ok {
+				return nil, errors.New("map keys must be strings")
+			}
+			if m[k], err = unpackValue(r); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	case b&0xf0 == 0x90:
+		a := make([]any, int(b&0x0f))
+		for i := range a {
+			if a[i], err = unpackValue(r); err != nil {
+				return nil, err
+			}
+		}
+		return a, nil
+	case b&0xe0 == 0xa0:
+		return readString(int(b & 0x1f))
+	case b == 0xd9:
+		n, err := r.ReadByte()
+		if err != nil {
+			return nil, errors.New("unexpected end of data")
+		}
+		return readString(int(n))
+	case b == 0xc0:
+		return nil, nil
+	case b == 0xc2, b == 0xc3:
+		return b == 0xc3, nil
+	case b == 0xd3:
+		var n int64
+		err := binary.Read(r, binary.BigEndian, &n)
+		return n, err
+	case b == 0xcb:
+		var bits uint64
+		err := binary.Read(r, binary.BigEndian, &bits)
+		return math.Float64frombits(bits), err
+	default:
+		return nil, fmt.Errorf("unsupported type byte 0x%x", b)
+	}
+}
+
+// msgPackFixture is {"compact":true,"schema":0}, as encoded on msgpack.org
+var msgPackFixture = []byte{0x82, 0xa7, 'c', 'o', 'm', 'p', 'a', 'c', 't', 0xc3, 0xa6, 's', 'c', 'h', 'e', 'm', 'a', 0x00}
+
+// msgPackExample is the struct of msgPackFixture
+type msgPackExample struct {
+	Compact bool `json:"compact"`
+	Schema  int  `json:"schema"`
+}
+
+func TestTools_WriteMsgPack(t *testing.T) {
+	testTools := Tools{MsgPack: miniMsgPack{}}
+
+	rr := httptest.NewRecorder()
+	if err := testTools.WriteMsgPack(rr, http.StatusOK, msgPackExample{Compact: true}); err != nil {
+		t.Fatal(err)
+	}
+	if rr.Header().Get("Content-Type") != "application/msgpack" || !bytes.Equal(rr.Body.Bytes(), msgPackFixture) {
+		t.Errorf("expected the fixture % x, but got % x", msgPackFixture, rr.Body.Bytes())
+	}
+
+	var noCodec Tools
+	if err := noCodec.WriteMsgPack(httptest.NewRecorder(), http.StatusOK, msgPackExample{}); !errors.Is(err, ErrNoMsgPackCodec) {
+		t.Errorf("expected ErrNoMsgPackCodec, but got %v", err)
+	}
+}
+
+var readMsgPackTests = []struct {
+	name          string
+	body          []byte
+	contentType   string
+	maxSize       int
+	enforce       bool
+	expectedError error
+	malformed     bool
+}{
+	{name: "fixture", body: msgPackFixture, contentType: "application/msgpack"},
+	{name: "empty", body: nil, expectedError: ErrEmptyBody},
+	{name: "truncated", body: msgPackFixture[:10], malformed: true},
+	{name: "too large", body: msgPackFixture, maxSize: 8, expectedError: ErrBodyTooLarge},
+	{name: "wrong content type", body: msgPackFixture, contentType: "application/json", enforce: true},
+}
+
+func TestTools_ReadMsgPack(t *testing.T) {
+	for _, e := range readMsgPackTests {
+		testTools := Tools{MsgPack: miniMsgPack{}, MaxJSONSize: e.maxSize, EnforceJSONContentType: e.enforce}
+		req := httptest.NewRequest("POST", "/", bytes.NewReader(e.body))
+		req.Header.Set("Content-Type", e.contentType)
+
+		var decoded msgPackExample
+		err := testTools.ReadMsgPack(httptest.NewRecorder(), req, &decoded)
+
+		var malformed *ErrMalformedMsgPack
+		var unsupported *ErrUnsupportedMediaType
+		switch {
+		case e.expectedError != nil:
+			if !errors.Is(err, e.expectedError) {
+				t.Errorf("%s: expected an error matching %v, but got %v", e.name, e.expectedError, err)
+			}
+		case e.malformed:
+			if !errors.As(err, &malformed) || !strings.Contains(err.Error(), "badly-formed MessagePack") {
+				t.Errorf("%s: expected an *ErrMalformedMsgPack, but got %v", e.name, err)
+			}
+		case e.enforce:
+			if !errors.As(err, &unsupported) {
+				t.Errorf("%s: expected an *ErrUnsupportedMediaType, but got %v", e.name, err)
+			}
+		default:
+			if err != nil || decoded != (msgPackExample{Compact: true}) {
+				t.Errorf("%s: expected the fixture to be decoded, but got %+v, %v", e.name, decoded, err)
+			}
+		}
+	}
+}
+
+func TestTools_MsgPack_RoundTrip(t *testing.T) {
+	type order struct {
+		ID    int64    `json:"id"`
+		Items []string `json:"items"`
+		Total float64  `json:"total"`
+		Note  *string  `json:"note"`
+	}
+	testTools := Tools{MsgPack: miniMsgPack{}}
+	sent := order{ID: -42, Items: []string{"apple", strings.Repeat("b", 40)}, Total: 12.5}
+
+	rr := httptest.NewRecorder()
+	if err := testTools.WriteMsgPack(rr, http.StatusOK, sent); err != nil {
+		t.Fatal(err)
+	}
+	var received order
+	req := httptest.NewRequest("POST", "/", rr.Body)
+	if err := testTools.ReadMsgPack(httptest.NewRecorder(), req, &received); err != nil {
+		t.Fatal(err)
+	}
+	if received.ID != sent.ID || strings.Join(received.Items, ",") != strings.Join(sent.Items, ",") || received.Total != sent.Total || received.Note != nil {
+		t.Errorf("expected %+v, but got %+v", sent, received)
+	}
+}
@@ -0,0 +1,112 @@
+package toolkit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"slices"
+)
+
+// ReadNDJSON reads the body of request as newline delimited JSON, also known as JSON lines, and calls handle
+// with each value, without ever holding more than a line in memory. MaxJSONSize, or 1MB, limits the size of
+// each line rather than of the body, which is why writer is not used, where ReadJSON needs it to limit the
+// body. Blank lines, such as a trailing newline, are skipped. Reading stops at the first line that is not a
+// single valid JSON value, or for which handle returns an error, and the error returned tells the number of
+// that line. As with ReadJSON, a body compressed with gzip or deflate is decompressed, reading stops once the
+// context of the request is done, and, when EnforceJSONContentType is set, a request whose Content-Type is not
+// application/x-ndjson, application/jsonl or JSON is rejected with an *ErrUnsupportedMediaType.
+func (t *Tools) ReadNDJSON(writer http.ResponseWriter, request *http.Request, handle func(json.RawMessage) error) error {
+	return t.readNDJSON(request, func(line []byte) error {
+		var value json.RawMessage
+		if err := t.decodeJSON(bytes.NewReader(line), &value); err != nil {
+			return err
+		}
+		return handle(value)
+	})
+}
+
+// ReadNDJSONInto reads the body of request as newline delimited JSON, like ReadNDJSON, decoding every line
+// into a value of type T with the same options and errors as ReadJSON, validation included, and calls handle
+// with it. The body is read as ReadNDJSON reads it
+func ReadNDJSONInto[T any](t *Tools, writer http.ResponseWriter, request *http.Request, handle func(T) error) error {
+	return t.readNDJSON(request, func(line []byte) error {
+		var value T
+		if err := t.decodeJSON(bytes.NewReader(line), &value); err != nil {
+			return err
+		}
+		if err := validate(&value); err != nil {
+			return err
+		}
+		return handle(value)
+	})
+}
+
+// readNDJSON calls handle with every line of the body of request that is not blank, and stops at the first
+// error, prefixed with the number of its line
+func (t *Tools) readNDJSON(request *http.Request, handle func(line []byte) error) error {
+	if t.EnforceJSONContentType {
+		if err := checkNDJSONContentType(request); err != nil {
+			return err
+		}
+	}
+	body, err := requestBody(request)
+	if err != nil {
+		return err
+	}
+
+	maxSize := t.maxJSONSize()
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, min(maxSize, 64*1024)), maxSize+1)
+
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		if err := request.Context().Err(); err != nil {
+			return err
+		}
+
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if len(line) > maxSize {
+			return ndjsonLineTooLarge(lineNumber, maxSize)
+		}
+		if err := handle(line); err != nil {
+			return fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+	}
+
+	// The line that could not be scanned is the one after the last one read
+	err = scanner.Err()
+	switch {
+	case errors.Is(err, bufio.ErrTooLong):
+		return ndjsonLineTooLarge(lineNumber+1, maxSize)
+	case isReadInterrupted(err):
+		return readInterrupted(err)
+	}
+	return err
+}
+
+// ndjsonMediaTypes are the types of newline delimited JSON, which has no registered type
+var ndjsonMediaTypes = []string{"application/x-ndjson", "application/ndjson", "application/jsonl", "application/x-jsonlines"}
+
+// checkNDJSONContentType returns an *ErrUnsupportedMediaType when the Content-Type of request is not one of
+// ndjsonMediaTypes or JSON, which some clients send NDJSON as
+func checkNDJSONContentType(request *http.Request) error {
+	contentType := request.Header.Get("Content-Type")
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err == nil && slices.Contains(ndjsonMediaTypes, mediaType) || isJSONMediaType(contentType) {
+		return nil
+	}
+	return &ErrUnsupportedMediaType{ContentType: contentType, expected: "application/x-ndjson"}
+}
+
+// ndjsonLineTooLarge returns the error for the line lineNumber being over maxSize bytes
+func ndjsonLineTooLarge(lineNumber, maxSize int) error {
+	return &jsonError{message: fmt.Sprintf("line %d: line must not be larger than %s", lineNumber, HumanizeBytes(int64(maxSize))), errs: []error{ErrBodyTooLarge}}
+}
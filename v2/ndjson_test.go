@@ -0,0 +1,137 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// ndjsonLines returns n lines of NDJSON, each with its own index
+func ndjsonLines(n int) []string {
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = fmt.Sprintf(`{"id": %d, "name": "item %d"}`, i, i)
+	}
+	return lines
+}
+
+var ndjsonTests = []struct {
+	name          string
+	body          string
+	maxSize       int
+	failOn        int
+	expectedCount int
+	expectedError string
+	matches       error
+}{
+	{name: "10k lines", body: strings.Join(ndjsonLines(10000), "\n"), expectedCount: 10000},
+	{name: "trailing newline", body: strings.Join(ndjsonLines(3), "\n") + "\n", expectedCount: 3},
+	{name: "blank lines and CRLF", body: "\r\n" + strings.Join(ndjsonLines(3), "\r\n\r\n") + "\r\n", expectedCount: 3},
+	{name: "empty body", body: "", expectedCount: 0},
+	{name: "malformed middle line", body: strings.Join(ndjsonLines(2), "\n") + "\n{\"id\": \n" + strings.Join(ndjsonLines(2), "\n"), expectedCount: 2, expectedError: "line 3: body contains badly-formed JSON"},
+	{name: "two values on a line", body: `{"id": 1} {"id": 2}`, expectedError: "line 1: body must contain only one JSON value"},
+	{name: "oversized line", body: `{"id": 1}` + "\n" + `{"id": 2, "name": "` + strings.Repeat("x", 100) + `"}` + "\n" + `{"id": 3}`, maxSize: 50, expectedCount: 1, expectedError: "line 2: line must not be larger than 50 B", matches: ErrBodyTooLarge},
+	{name: "oversized last line", body: `{"id": 1}` + "\n" + `{"id": 2, "name": "` + strings.Repeat("x", 100) + `"}`, maxSize: 50, expectedCount: 1, expectedError: "line 2: line must not be larger than 50 B", matches: ErrBodyTooLarge},
+	{name: "handler error", body: strings.Join(ndjsonLines(10), "\n"), failOn: 5, expectedCount: 4, expectedError: "line 5: item 4 refused", matches: errRefused},
+}
+
+// errRefused is returned by the handler of the tests of ReadNDJSON
+var errRefused = errors.New("refused")
+
+func TestTools_ReadNDJSON(t *testing.T) {
+	for _, e := range ndjsonTests {
+		testTools := Tools{MaxJSONSize: e.maxSize}
+
+		count := 0
+		err := testTools.ReadNDJSON(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader(e.body)), func(value json.RawMessage) error {
+			var item struct {
+				ID int `json:"id"`
+			}
+			if err := json.Unmarshal(value, &item); err != nil {
+				return err
+			}
+			if e.failOn > 0 && count+1 == e.failOn {
+				return fmt.Errorf("item %d %w", item.ID, errRefused)
+			}
+			count++
+			return nil
+		})
+
+		if e.expectedError == "" && err != nil {
+			t.Errorf("%s: error not expected, but one received: %s", e.name, err)
+		}
+		if e.expectedError != "" && (err == nil || err.Error() != e.expectedError) {
+			t.Errorf("%s: expected error %q, but got %v", e.name, e.expectedError, err)
+		}
+		if e.matches != nil && !errors.Is(err, e.matches) {
+			t.Errorf("%s: expected an error matching %v, but got %v", e.name, e.matches, err)
+		}
+		if count != e.expectedCount {
+			t.Errorf("%s: expected %d values to be handled, but got %d", e.name, e.expectedCount, count)
+		}
+	}
+}
+
+func TestReadNDJSONInto(t *testing.T) {
+	var testTools Tools
+	body := `{"name": "Ann", "email": "ann@example.com"}` + "\n" + `{"email": "bob@example.com"}` + "\n"
+
+	var names []string
+	err := ReadNDJSONInto(&testTools, httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader(body)), func(r createUserRequest) error {
+		names = append(names, r.Name)
+		return nil
+	})
+
+	// The second line fails validation
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) || !strings.HasPrefix(err.Error(), "line 2: ") {
+		t.Errorf("expected a validation error on line 2, but got %v", err)
+	}
+	if len(names) != 1 || names[0] != "Ann" {
+		t.Errorf("expected only the first line to be handled, but got %v", names)
+	}
+
+	// Unknown fields are rejected like in ReadJSON
+	err = ReadNDJSONInto(&testTools, httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader(`{"nickname": "A"}`)), func(r createUserRequest) error {
+		return nil
+	})
+	var unknownField *ErrUnknownField
+	if !errors.As(err, &unknownField) || unknownField.Field != "nickname" {
+		t.Errorf("expected an unknown field error, but got %v", err)
+	}
+}
+
+func TestTools_ReadNDJSON_Body(t *testing.T) {
+	// A gzipped body is decompressed, and only its lines are limited to MaxJSONSize
+	testTools := Tools{MaxJSONSize: 100}
+	body := strings.Join(ndjsonLines(1000), "\n")
+	request := httptest.NewRequest("POST", "/", bytes.NewReader(compressBody(t, "gzip", []byte(body))))
+	request.Header.Set("Content-Encoding", "gzip")
+	count := 0
+	if err := testTools.ReadNDJSON(httptest.NewRecorder(), request, func(json.RawMessage) error { count++; return nil }); err != nil || count != 1000 {
+		t.Errorf("expected 1000 values from a gzipped body, but got %d, %v", count, err)
+	}
+
+	// A body that cannot be decompressed
+	request = httptest.NewRequest("POST", "/", strings.NewReader(body))
+	request.Header.Set("Content-Encoding", "gzip")
+	if err := testTools.ReadNDJSON(httptest.NewRecorder(), request, func(json.RawMessage) error { return nil }); !errors.Is(err, ErrInvalidBodyEncoding) {
+		t.Errorf("expected an error matching ErrInvalidBodyEncoding, but got %v", err)
+	}
+
+	// The Content-Type is checked with EnforceJSONContentType
+	testTools.EnforceJSONContentType = true
+	for contentType, accepted := range map[string]bool{"application/x-ndjson": true, "application/jsonl; charset=utf-8": true, "application/json": true, "text/plain": false, "": false} {
+		request = httptest.NewRequest("POST", "/", strings.NewReader(`{"id": 1}`))
+		request.Header.Set("Content-Type", contentType)
+		err := testTools.ReadNDJSON(httptest.NewRecorder(), request, func(json.RawMessage) error { return nil })
+		var unsupported *ErrUnsupportedMediaType
+		if accepted && err != nil || !accepted && (!errors.As(err, &unsupported) || !strings.Contains(err.Error(), "application/x-ndjson")) {
+			t.Errorf("%q: expected accepted to be %v, but got %v", contentType, accepted, err)
+		}
+	}
+}
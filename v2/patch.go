@@ -0,0 +1,63 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// FieldSet is the set of the keys present in a JSON object, including those set to null. Each key maps to the
+// FieldSet of its value when that is an object itself, or nil otherwise
+type FieldSet map[string]FieldSet
+
+// Has reports whether the key path was present, where path is a top level key, such as "address", or a key of
+// the object of a top level key, separated by a dot, such as "address.city"
+func (f FieldSet) Has(path string) bool {
+	key, nested, found := strings.Cut(path, ".")
+	fields, ok := f[key]
+	if !found || !ok {
+		return ok
+	}
+	_, ok = fields[nested]
+	return ok
+}
+
+// ReadJSONPatch reads the JSON object in the body of request into dst, like ReadJSON, and also returns the keys
+// present in it, so a PATCH handler can tell a field that was left out from one set to null, which both leave
+// a pointer field nil
+func (t *Tools) ReadJSONPatch(writer http.ResponseWriter, request *http.Request, dst any) (FieldSet, error) {
+	body, err := t.jsonBody(writer, request)
+	if err != nil {
+		return nil, err
+	}
+	limit := int64(t.maxJSONSize())
+	raw, err := io.ReadAll(&jsonLimitReader{r: io.LimitReader(body, limit+1), limit: limit})
+	if err != nil {
+		return nil, jsonDecodeError(err)
+	}
+
+	if err := t.DecodeJSON(bytes.NewReader(raw), dst); err != nil {
+		return nil, err
+	}
+
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &members); err != nil || members == nil {
+		return nil, errors.New("body must be a JSON object")
+	}
+	fields := make(FieldSet, len(members))
+	for key, value := range members {
+		var nested map[string]json.RawMessage
+		if json.Unmarshal(value, &nested) != nil || nested == nil {
+			fields[key] = nil
+			continue
+		}
+		fields[key] = make(FieldSet, len(nested))
+		for nestedKey := range nested {
+			fields[key][nestedKey] = nil
+		}
+	}
+	return fields, nil
+}
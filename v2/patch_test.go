@@ -0,0 +1,82 @@
+package toolkit
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// userPatch is the body of the PATCH tests
+type userPatch struct {
+	Name    *string `json:"name"`
+	Email   *string `json:"email"`
+	Age     *int    `json:"age"`
+	Address *struct {
+		City *string `json:"city"`
+		Zip  *string `json:"zip"`
+	} `json:"address"`
+}
+
+var readJSONPatchTests = []struct {
+	name          string
+	json          string
+	present       []string
+	absent        []string
+	errorExpected bool
+}{
+	{name: "set", json: `{"name": "Ann", "age": 30}`, present: []string{"name", "age"}, absent: []string{"email", "address", "address.city"}},
+	{name: "null", json: `{"email": null}`, present: []string{"email"}, absent: []string{"name", "age"}},
+	{name: "empty", json: `{}`, absent: []string{"name", "email", "age", "address"}},
+	{name: "nested", json: `{"address": {"city": null}}`, present: []string{"address", "address.city"}, absent: []string{"address.zip", "name.city"}},
+	{name: "nested null", json: `{"address": null}`, present: []string{"address"}, absent: []string{"address.city"}},
+	{name: "not an object", json: `null`, errorExpected: true},
+	{name: "unknown field", json: `{"colour": "red"}`, errorExpected: true},
+	{name: "malformed", json: `{"name": `, errorExpected: true},
+}
+
+func TestTools_ReadJSONPatch(t *testing.T) {
+	var testTools Tools
+	for _, e := range readJSONPatchTests {
+		var patch userPatch
+		fields, err := testTools.ReadJSONPatch(httptest.NewRecorder(), httptest.NewRequest("PATCH", "/", strings.NewReader(e.json)), &patch)
+		if e.errorExpected {
+			if err == nil {
+				t.Errorf("%s: error expected, but none received", e.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: error not expected, but one received: %s", e.name, err)
+			continue
+		}
+		for _, path := range e.present {
+			if !fields.Has(path) {
+				t.Errorf("%s: expected %s to be present", e.name, path)
+			}
+		}
+		for _, path := range e.absent {
+			if fields.Has(path) {
+				t.Errorf("%s: expected %s to be absent", e.name, path)
+			}
+		}
+	}
+
+	// Omitted and null leave the same struct, and only the field set tells them apart
+	var omitted, null userPatch
+	omittedFields, _ := testTools.ReadJSONPatch(httptest.NewRecorder(), httptest.NewRequest("PATCH", "/", strings.NewReader(`{"name": "Ann"}`)), &omitted)
+	nullFields, _ := testTools.ReadJSONPatch(httptest.NewRecorder(), httptest.NewRequest("PATCH", "/", strings.NewReader(`{"name": "Ann", "email": null}`)), &null)
+	if omitted.Email != nil || null.Email != nil || *null.Name != "Ann" {
+		t.Errorf("expected both emails to be nil, but got %v and %v", omitted.Email, null.Email)
+	}
+	if omittedFields.Has("email") || !nullFields.Has("email") {
+		t.Error("expected the field sets to tell an omitted email from a null one")
+	}
+
+	// The limits of ReadJSON apply
+	testTools.MaxJSONSize = 8
+	_, err := testTools.ReadJSONPatch(httptest.NewRecorder(), httptest.NewRequest("PATCH", "/", strings.NewReader(`{"name": "a long name"}`)), &userPatch{})
+	if !errors.Is(err, ErrBodyTooLarge) {
+		t.Errorf("expected ErrBodyTooLarge, but got %v", err)
+	}
+}
@@ -0,0 +1,101 @@
+package toolkit
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Payload is a JSON object decoded into a map, such as the body of a webhook, whose values are read by path
+// with its getters rather than with type assertions. A path is a key, or keys and array indexes separated by
+// dots, such as "data.object.id" or "items.0.sku". The getters report false, rather than panic, when there
+// is no value at the path or it has another type.
+type Payload map[string]any
+
+// ReadJSONMap reads the JSON object in the body of request into a Payload, with the same limits, options and
+// errors as ReadJSON. Numbers are json.Number when UseNumber is set, which the getters accept
+func (t *Tools) ReadJSONMap(writer http.ResponseWriter, request *http.Request) (Payload, error) {
+	var payload map[string]any
+	if err := t.ReadJSON(writer, request, &payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// Get returns the value at path, whatever its type
+func (p Payload) Get(path string) (any, bool) {
+	var value any = map[string]any(p)
+	for _, key := range strings.Split(path, ".") {
+		switch v := value.(type) {
+		case map[string]any:
+			next, ok := v[key]
+			if !ok {
+				return nil, false
+			}
+			value = next
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			value = v[i]
+		default:
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// GetString returns the string at path
+func (p Payload) GetString(path string) (string, bool) {
+	value, _ := p.Get(path)
+	s, ok := value.(string)
+	return s, ok
+}
+
+// GetInt64 returns the number at path as an int64, whether it is a json.Number or a float64 holding a whole
+// number, as GetInt64 does
+func (p Payload) GetInt64(path string) (int64, bool) {
+	value, _ := p.Get(path)
+	n, err := int64Value(path, value)
+	return n, err == nil
+}
+
+// GetFloat64 returns the number at path as a float64, whether it is a json.Number or a float64
+func (p Payload) GetFloat64(path string) (float64, bool) {
+	value, _ := p.Get(path)
+	f, err := float64Value(path, value)
+	return f, err == nil
+}
+
+// GetBool returns the boolean at path
+func (p Payload) GetBool(path string) (bool, bool) {
+	value, _ := p.Get(path)
+	b, ok := value.(bool)
+	return b, ok
+}
+
+// GetTime returns the time the string at path holds, parsed with layout, such as time.RFC3339
+func (p Payload) GetTime(path, layout string) (time.Time, bool) {
+	s, ok := p.GetString(path)
+	if !ok {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(layout, s)
+	return t, err == nil
+}
+
+// GetSlice returns the array at path
+func (p Payload) GetSlice(path string) ([]any, bool) {
+	value, _ := p.Get(path)
+	s, ok := value.([]any)
+	return s, ok
+}
+
+// GetPayload returns the object at path, as a Payload to read its own values from
+func (p Payload) GetPayload(path string) (Payload, bool) {
+	value, _ := p.Get(path)
+	m, ok := value.(map[string]any)
+	return m, ok
+}
@@ -0,0 +1,102 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const webhookBody = `{
+	"type": "invoice.paid",
+	"livemode": false,
+	"created": 1700000000,
+	"data": {
+		"object": {
+			"id": "in_123",
+			"amount": 9007199254740993,
+			"ratio": 0.5,
+			"paid_at": "2024-01-02T03:04:05Z",
+			"lines": [{"sku": "a", "qty": 2}, {"sku": "b", "qty": 1.5}],
+			"note": null
+		}
+	}
+}`
+
+var payloadTests = []struct {
+	name      string
+	path      string
+	useNumber bool
+	getter    string
+	expected  any
+	ok        bool
+}{
+	{name: "top level string", path: "type", getter: "string", expected: "invoice.paid", ok: true},
+	{name: "nested string", path: "data.object.id", getter: "string", expected: "in_123", ok: true},
+	{name: "string in array", path: "data.object.lines.1.sku", getter: "string", expected: "b", ok: true},
+	{name: "index out of range", path: "data.object.lines.2.sku", getter: "string", expected: "", ok: false},
+	{name: "index not a number", path: "data.object.lines.first.sku", getter: "string", expected: "", ok: false},
+	{name: "missing key", path: "data.missing.id", getter: "string", expected: "", ok: false},
+	{name: "through a string", path: "type.id", getter: "string", expected: "", ok: false},
+	{name: "null", path: "data.object.note", getter: "string", expected: "", ok: false},
+	{name: "number as string", path: "created", getter: "string", expected: "", ok: false},
+	{name: "bool", path: "livemode", getter: "bool", expected: false, ok: true},
+	{name: "string as bool", path: "type", getter: "bool", expected: false, ok: false},
+	{name: "int from float64", path: "created", getter: "int64", expected: int64(1700000000), ok: true},
+	{name: "int from json.Number", path: "data.object.amount", useNumber: true, getter: "int64", expected: int64(9007199254740993), ok: true},
+	{name: "int in array", path: "data.object.lines.0.qty", getter: "int64", expected: int64(2), ok: true},
+	{name: "fraction as int", path: "data.object.lines.1.qty", getter: "int64", expected: int64(0), ok: false},
+	{name: "fraction as int from json.Number", path: "data.object.lines.1.qty", useNumber: true, getter: "int64", expected: int64(0), ok: false},
+	{name: "string as int", path: "type", getter: "int64", expected: int64(0), ok: false},
+	{name: "float", path: "data.object.ratio", useNumber: true, getter: "float64", expected: 0.5, ok: true},
+	{name: "time", path: "data.object.paid_at", getter: "time", expected: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), ok: true},
+	{name: "time in another layout", path: "data.object.id", getter: "time", expected: time.Time{}, ok: false},
+	{name: "slice", path: "data.object.lines", getter: "slice", expected: 2, ok: true},
+	{name: "object as slice", path: "data.object", getter: "slice", expected: 0, ok: false},
+}
+
+func TestTools_ReadJSONMap(t *testing.T) {
+	for _, e := range payloadTests {
+		testTools := Tools{UseNumber: e.useNumber}
+		payload, err := testTools.ReadJSONMap(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader(webhookBody)))
+		if err != nil {
+			t.Fatalf("%s: %v", e.name, err)
+		}
+
+		var value any
+		var ok bool
+		switch e.getter {
+		case "string":
+			value, ok = payload.GetString(e.path)
+		case "bool":
+			value, ok = payload.GetBool(e.path)
+		case "int64":
+			value, ok = payload.GetInt64(e.path)
+		case "float64":
+			value, ok = payload.GetFloat64(e.path)
+		case "time":
+			var parsed time.Time
+			parsed, ok = payload.GetTime(e.path, time.RFC3339)
+			value = parsed
+		case "slice":
+			var items []any
+			items, ok = payload.GetSlice(e.path)
+			value = len(items)
+		}
+
+		if ok != e.ok || value != e.expected {
+			t.Errorf("%s: expected %v, %t, but got %v, %t", e.name, e.expected, e.ok, value, ok)
+		}
+	}
+
+	object, ok := Payload{"data": map[string]any{"object": map[string]any{"id": json.Number("7")}}}.GetPayload("data.object")
+	if id, idOK := object.GetInt64("id"); !ok || !idOK || id != 7 {
+		t.Errorf("expected the nested payload to be returned, but got %v, %t", object, ok)
+	}
+
+	var testTools Tools
+	if _, err := testTools.ReadJSONMap(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader(`[1]`))); err == nil {
+		t.Error("expected an error for a body that is not an object")
+	}
+}
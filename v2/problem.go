@@ -0,0 +1,85 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// Problem is the body of an RFC 7807 application/problem+json response, describing what went wrong in a way
+// clients can act on
+type Problem struct {
+	// Type is a URI identifying the kind of problem. When empty, it is understood as "about:blank"
+	Type string `json:"type,omitempty"`
+	// Title is a short summary of the kind of problem, which does not change from one occurrence to the next
+	Title string `json:"title,omitempty"`
+	// Status is the HTTP status code of the response
+	Status int `json:"status,omitempty"`
+	// Detail explains this occurrence of the problem
+	Detail string `json:"detail,omitempty"`
+	// Instance is a URI identifying this occurrence of the problem
+	Instance string `json:"instance,omitempty"`
+	// Extensions are additional members, written alongside the standard ones. Extensions named like a
+	// standard member are ignored
+	Extensions map[string]any `json:"-"`
+}
+
+// MarshalJSON encodes p with its Extensions flattened into the same object as the standard members
+func (p Problem) MarshalJSON() ([]byte, error) {
+	// problem has the fields of Problem, without its methods, so it is encoded the usual way
+	type problem Problem
+	standard, err := json.Marshal(problem(p))
+	if err != nil || len(p.Extensions) == 0 {
+		return standard, err
+	}
+
+	members := make(map[string]any, len(p.Extensions)+5)
+	for name, value := range p.Extensions {
+		members[name] = value
+	}
+	var standardMembers map[string]json.RawMessage
+	if err := json.Unmarshal(standard, &standardMembers); err != nil {
+		return nil, err
+	}
+	for name, value := range standardMembers {
+		members[name] = value
+	}
+	return json.Marshal(members)
+}
+
+// WriteProblem writes p as an application/problem+json response, with the status code p.Status, which is set
+// to 500 Internal Server Error when it is zero
+func (t *Tools) WriteProblem(writer http.ResponseWriter, p Problem, headers ...http.Header) error {
+	if p.Status == 0 {
+		p.Status = http.StatusInternalServerError
+	}
+	return t.writeJSON(writer, p.Status, "application/problem+json", p, headers...)
+}
+
+// NewProblem returns the Problem describing err, with the optional status code, or else 400 Bad Request, or
+// 422 Unprocessable Entity for a *ValidationError, whose invalid fields are listed in an "errors" extension.
+// The code of an error implementing ErrorCoder is set in a "code" extension.
+func NewProblem(err error, status ...int) Problem {
+	p := Problem{Status: http.StatusBadRequest, Detail: err.Error()}
+
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		p.Status = http.StatusUnprocessableEntity
+		if len(validationErr.Fields) > 0 {
+			p.Extensions = map[string]any{"errors": validationErr.Fields}
+		}
+	}
+	var coder ErrorCoder
+	if errors.As(err, &coder) {
+		if p.Extensions == nil {
+			p.Extensions = make(map[string]any)
+		}
+		p.Extensions["code"] = coder.ErrorCode()
+	}
+
+	if len(status) > 0 {
+		p.Status = status[0]
+	}
+	p.Title = http.StatusText(p.Status)
+	return p
+}
@@ -0,0 +1,78 @@
+package toolkit
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+var problemTests = []struct {
+	name           string
+	problem        Problem
+	expectedStatus int
+	expectedBody   string
+}{
+	{name: "minimal", problem: Problem{Status: http.StatusNotFound}, expectedStatus: 404, expectedBody: `{"status":404}`},
+	{name: "default status", problem: Problem{}, expectedStatus: 500, expectedBody: `{"status":500}`},
+	{
+		name:           "all members",
+		problem:        Problem{Type: "https://example.com/probs/out-of-credit", Title: "You do not have enough credit.", Status: 403, Detail: "Your balance is 30, but that costs 50.", Instance: "/account/12345/msgs/abc"},
+		expectedStatus: 403,
+		expectedBody:   `{"type":"https://example.com/probs/out-of-credit","title":"You do not have enough credit.","status":403,"detail":"Your balance is 30, but that costs 50.","instance":"/account/12345/msgs/abc"}`,
+	},
+	{
+		name:           "extensions",
+		problem:        Problem{Title: "Out of credit", Status: 403, Extensions: map[string]any{"balance": 30, "accounts": []string{"/account/12345"}, "status": "ignored"}},
+		expectedStatus: 403,
+		expectedBody:   `{"accounts":["/account/12345"],"balance":30,"status":403,"title":"Out of credit"}`,
+	},
+}
+
+func TestTools_WriteProblem(t *testing.T) {
+	var testTools Tools
+	for _, e := range problemTests {
+		rr := httptest.NewRecorder()
+		if err := testTools.WriteProblem(rr, e.problem); err != nil {
+			t.Errorf("%s: error not expected, but one received: %s", e.name, err)
+			continue
+		}
+		if rr.Code != e.expectedStatus || rr.Body.String() != e.expectedBody {
+			t.Errorf("%s: expected status %d and body %s, but got %d and %s", e.name, e.expectedStatus, e.expectedBody, rr.Code, rr.Body.String())
+		}
+		if rr.Header().Get("Content-Type") != "application/problem+json" {
+			t.Errorf("%s: wrong Content-Type %q", e.name, rr.Header().Get("Content-Type"))
+		}
+	}
+}
+
+var newProblemTests = []struct {
+	name     string
+	err      error
+	status   []int
+	expected string
+}{
+	{name: "plain error", err: errors.New("bad things"), expected: `{"title":"Bad Request","status":400,"detail":"bad things"}`},
+	{name: "plain error with status", err: errors.New("bad things"), status: []int{409}, expected: `{"title":"Conflict","status":409,"detail":"bad things"}`},
+	{
+		name:     "validation error",
+		err:      &ValidationError{Fields: map[string]string{"name": "is required"}},
+		expected: `{"detail":"body is not valid: name: is required","errors":{"name":"is required"},"status":422,"title":"Unprocessable Entity"}`,
+	},
+	{name: "validation error without fields", err: &ValidationError{Err: errors.New("too late")}, expected: `{"title":"Unprocessable Entity","status":422,"detail":"too late"}`},
+	{name: "error with code", err: fmt.Errorf("lookup: %w", notFoundError{what: "user"}), status: []int{404}, expected: `{"code":"user_not_found","detail":"lookup: user not found","status":404,"title":"Not Found"}`},
+}
+
+func TestNewProblem(t *testing.T) {
+	var testTools Tools
+	for _, e := range newProblemTests {
+		rr := httptest.NewRecorder()
+		if err := testTools.WriteProblem(rr, NewProblem(e.err, e.status...)); err != nil {
+			t.Fatal(err)
+		}
+		if rr.Body.String() != e.expected {
+			t.Errorf("%s: expected %s, but got %s", e.name, e.expected, rr.Body.String())
+		}
+	}
+}
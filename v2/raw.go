@@ -0,0 +1,42 @@
+package toolkit
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+)
+
+// SaveRawBody saves the body of r, such as a PUT request sending the bytes of a file rather than a multipart
+// form, to uploadDir, with the same checks and options as UploadFiles. The file is named suggestedName, or
+// else after the filename parameter of the Content-Disposition header of r. Its type is detected from its
+// contents, falling back to the Content-Type header of r when the contents only reveal that they are binary
+// data. A body larger than MaxFileSize is rejected with ErrRequestTooLarge. The file is renamed unless rename
+// is false.
+func (t *Tools) SaveRawBody(r *http.Request, uploadDir, suggestedName string, rename ...bool) (*UploadedFile, error) {
+	renameFile := true
+	if len(rename) > 0 {
+		renameFile = rename[0]
+	}
+
+	fileName := suggestedName
+	if fileName == "" {
+		if _, params, err := mime.ParseMediaType(r.Header.Get("Content-Disposition")); err == nil {
+			fileName = params["filename"]
+		}
+	}
+	if fileName == "" {
+		return nil, errors.New("no file name was given for the request body")
+	}
+
+	maxSize := t.maxUploadSize()
+	if r.ContentLength > maxSize {
+		t.observeRejection(RejectionTooLarge)
+		return nil, ErrRequestTooLarge
+	}
+
+	if err := t.prepareUploadDir(uploadDir); err != nil {
+		return nil, err
+	}
+
+	return t.uploadPart(r.Context(), partInfo{fileName: fileName, declaredType: r.Header.Get("Content-Type"), checksum: t.checksumHeader(r.Header), request: r}, r.Body, uploadDir, renameFile, maxSize)
+}
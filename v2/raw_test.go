@@ -0,0 +1,89 @@
+package toolkit
+
+import (
+	"bytes"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+var rawBodyTests = []struct {
+	name          string
+	suggestedName string
+	disposition   string
+	contentType   string
+	body          []byte
+	maxFileSize   int
+	unknownLength bool
+	allowedTypes  []string
+	expectedName  string
+	expectedType  string
+	expectedError error
+}{
+	{name: "png", suggestedName: "img.png", contentType: "image/png", expectedName: "img.png", expectedType: "image/png"},
+	{name: "content disposition", disposition: `attachment; filename="photo.png"`, expectedName: "photo.png", expectedType: "image/png"},
+	{name: "suggested name wins", suggestedName: "img.png", disposition: `attachment; filename="photo.png"`, expectedName: "img.png", expectedType: "image/png"},
+	{name: "sniffed type wins", suggestedName: "img.png", contentType: "image/jpeg", allowedTypes: []string{"image/jpeg"}, expectedError: ErrFileTypeNotPermitted},
+	{name: "content type fallback", suggestedName: "data.bin", contentType: "application/x-custom; v=1", body: []byte{0, 1, 2, 3}, allowedTypes: []string{"application/x-custom"}, expectedName: "data.bin", expectedType: "application/x-custom"},
+	{name: "too big", suggestedName: "img.png", maxFileSize: 1000, expectedError: ErrRequestTooLarge},
+	{name: "too big without length", suggestedName: "img.png", maxFileSize: 1000, unknownLength: true, expectedError: ErrRequestTooLarge},
+}
+
+func TestTools_SaveRawBody(t *testing.T) {
+	img, err := os.ReadFile("./testdata/img.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, e := range rawBodyTests {
+		fs := &MemoryFS{}
+		testTools := Tools{FS: fs, MaxFileSize: e.maxFileSize, AllowedFileTypes: e.allowedTypes}
+
+		body := e.body
+		if body == nil {
+			body = img
+		}
+		request := httptest.NewRequest("PUT", "/upload", bytes.NewReader(body))
+		if e.unknownLength {
+			request.ContentLength = -1
+		}
+		if e.contentType != "" {
+			request.Header.Set("Content-Type", e.contentType)
+		}
+		if e.disposition != "" {
+			request.Header.Set("Content-Disposition", e.disposition)
+		}
+
+		uploadedFile, err := testTools.SaveRawBody(request, "uploads", e.suggestedName, false)
+		if e.expectedError != nil {
+			if !errors.Is(err, e.expectedError) {
+				t.Errorf("%s: expected error %v, but got %v", e.name, e.expectedError, err)
+			}
+			if names := fs.FileNames("uploads"); len(names) != 0 {
+				t.Errorf("%s: expected no files in upload directory, but found %v", e.name, names)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: error not expected, but one received: %s", e.name, err)
+			continue
+		}
+
+		if uploadedFile.NewFileName != e.expectedName || uploadedFile.ContentType != e.expectedType || uploadedFile.FileSize != int64(len(body)) {
+			t.Errorf("%s: expected %s of type %s and size %d, but got %s of type %s and size %d", e.name, e.expectedName, e.expectedType, len(body),
+				uploadedFile.NewFileName, uploadedFile.ContentType, uploadedFile.FileSize)
+		}
+		if saved, err := fs.ReadFile("uploads/" + e.expectedName); err != nil || !bytes.Equal(saved, body) {
+			t.Errorf("%s: saved file does not match the request body: %v", e.name, err)
+		}
+	}
+
+	// The body must be given a name
+	var testTools Tools
+	request := httptest.NewRequest("PUT", "/upload", strings.NewReader("hello"))
+	if _, err := testTools.SaveRawBody(request, t.TempDir(), ""); err == nil {
+		t.Error("expected an error without a file name")
+	}
+}
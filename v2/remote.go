@@ -0,0 +1,451 @@
+package toolkit
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ErrInvalidMethod is returned by CallRemote for a method that is not a valid HTTP token, such as "GET /"
+var ErrInvalidMethod = errors.New("invalid HTTP method")
+
+// RemoteOption changes how CallRemote, and the other functions calling remote services, make a call
+type RemoteOption func(*remoteOptions)
+
+// remoteOptions are the settings of a call, as the RemoteOptions passed to it set them
+type remoteOptions struct {
+	client      *http.Client
+	msgPack     bool
+	header      http.Header
+	retry       *RetryPolicy
+	tokenSource TokenSource
+	gzip        bool
+	query       url.Values
+	// accept is the Accept header of the functions expecting a type of response, which WithHeader can replace
+	accept string
+	// sensitive are the headers of the options redacted from dumps, along with SensitiveHeaders
+	sensitive []string
+}
+
+// WithHTTPClient makes the call with client, rather than a client NewRemoteClient returns, which times out
+// after RemoteTimeout
+func WithHTTPClient(client *http.Client) RemoteOption {
+	return func(o *remoteOptions) {
+		o.client = client
+	}
+}
+
+// WithHeader adds the headers of header to the request, replacing those CallRemote sets, such as Content-Type.
+// Headers of several WithHeader options are all sent
+func WithHeader(header http.Header) RemoteOption {
+	return func(o *remoteOptions) {
+		if o.header == nil {
+			o.header = make(http.Header)
+		}
+		for key, values := range header {
+			for _, value := range values {
+				o.header.Add(key, value)
+			}
+		}
+	}
+}
+
+// WithGzipBody compresses the body with gzip, as CompressRequestBody does, for this call
+func WithGzipBody() RemoteOption {
+	return func(o *remoteOptions) {
+		o.gzip = true
+	}
+}
+
+// WithQuery adds the parameters of query to the query string of the URI, keeping those it has already. The
+// parameters of several WithQuery options are all sent
+func WithQuery(query url.Values) RemoteOption {
+	return func(o *remoteOptions) {
+		if o.query == nil {
+			o.query = make(url.Values)
+		}
+		for key, values := range query {
+			o.query[key] = append(o.query[key], values...)
+		}
+	}
+}
+
+// WithMsgPack sends the body encoded as MessagePack, with the codec set in Tools.MsgPack, rather than as JSON
+func WithMsgPack() RemoteOption {
+	return func(o *remoteOptions) {
+		o.msgPack = true
+	}
+}
+
+// CallRemote calls uri with method, sending body encoded as JSON, unless the WithMsgPack option is passed,
+// along with its Content-Type and the headers of the WithHeader options. When body is nil, the request has no
+// body, as for a GET or most DELETE requests. The caller must close the body of the response returned. Once
+// ctx is done, the call is given up with an error matching the error of ctx, such as context.DeadlineExceeded,
+// with errors.Is. A method that is not a valid token is rejected with ErrInvalidMethod, before anything is
+// sent. Calls are retried as the WithRetry option, or Tools.RemoteRetry, says, with the body sent again in
+// full; the response, or error, of the last attempt is returned
+func (t *Tools) CallRemote(ctx context.Context, method, uri string, body any, opts ...RemoteOption) (*http.Response, error) {
+	var options remoteOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if !validMethod(method) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidMethod, method)
+	}
+
+	if len(options.query) > 0 {
+		var err error
+		if uri, err = mergeQuery(uri, options.query); err != nil {
+			return nil, err
+		}
+	}
+	encoded, err := t.encodeRemoteBody(body, options)
+	if err != nil {
+		return nil, err
+	}
+	// The key is generated once for the call, so every attempt of it sends the same
+	if t.AutoIdempotencyKey && needsIdempotencyKey(method) && options.header.Get(idempotencyKeyHeader) == "" {
+		key, err := newIdempotencyKey()
+		if err != nil {
+			return nil, err
+		}
+		options.setHeader(idempotencyKeyHeader, key)
+	}
+	policy := options.retry
+	if policy == nil {
+		policy = t.RemoteRetry
+	}
+
+	for attempt := 1; ; attempt++ {
+		response, err := t.callRemoteOnce(ctx, method, uri, encoded, options)
+		if attempt >= policy.maxAttempts() || ctx.Err() != nil || !policy.retry(response, err) {
+			if err != nil {
+				// The transport may report a canceled call in its own way
+				if ctxErr := ctx.Err(); ctxErr != nil {
+					return nil, fmt.Errorf("calling %s: %w", redactURL(uri), ctxErr)
+				}
+				return nil, err
+			}
+			return response, nil
+		}
+		if response != nil {
+			discardResponse(response)
+		}
+		if err := sleepContext(ctx, policy.backoff(attempt)); err != nil {
+			return nil, fmt.Errorf("calling %s: %w", redactURL(uri), err)
+		}
+	}
+}
+
+// callRemoteOnce makes a single call of CallRemote, with a request built anew, as the body of a request is
+// consumed when it is sent
+func (t *Tools) callRemoteOnce(ctx context.Context, method, uri string, body remoteBody, options remoteOptions) (*http.Response, error) {
+	// The token is got first, so nothing is sent when it cannot be
+	var token string
+	if options.tokenSource != nil {
+		var err error
+		if token, err = options.tokenSource(ctx); err != nil {
+			return nil, fmt.Errorf("getting a token to call %s: %w", redactURL(uri), err)
+		}
+	}
+
+	var reader io.Reader
+	if body.payload != nil {
+		reader = bytes.NewReader(body.payload)
+	}
+	request, err := http.NewRequestWithContext(ctx, method, uri, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body.contentType != "" {
+		request.Header.Set("Content-Type", body.contentType)
+	}
+	if options.accept != "" {
+		request.Header.Set("Accept", options.accept)
+	}
+	if body.contentEncoding != "" {
+		request.Header.Set("Content-Encoding", body.contentEncoding)
+	}
+	for key, values := range options.header {
+		request.Header[key] = values
+	}
+	if options.tokenSource != nil {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	client := options.client
+	if client == nil {
+		client = t.remoteClient()
+	}
+	t.debugRemote(request, nil, options.sensitive)
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	// IdempotencyKey reads the key from the request of the response, which a transport may leave out
+	if response.Request == nil {
+		response.Request = request
+	}
+	t.debugRemote(request, response, options.sensitive)
+	return response, nil
+}
+
+// remoteBody is the body of the requests of a call, as CallRemote sends it on every attempt
+type remoteBody struct {
+	payload         []byte
+	contentType     string
+	contentEncoding string
+}
+
+// encodeRemoteBody returns body encoded as CallRemote sends it, with no payload when body is nil. The encoded
+// body is gzip compressed when CompressRequestBody is set, or the WithGzipBody option is passed, and it is
+// larger than CompressionThreshold
+func (t *Tools) encodeRemoteBody(body any, options remoteOptions) (remoteBody, error) {
+	if body == nil {
+		return remoteBody{}, nil
+	}
+	var encoded remoteBody
+	var err error
+	if options.msgPack {
+		if t.MsgPack == nil {
+			return remoteBody{}, ErrNoMsgPackCodec
+		}
+		encoded.contentType = msgPackContentType
+		encoded.payload, err = t.MsgPack.Marshal(body)
+	} else {
+		encoded.contentType = "application/json"
+		encoded.payload, err = json.Marshal(body)
+	}
+	if err != nil {
+		return remoteBody{}, err
+	}
+
+	// A body the caller set a Content-Encoding for is sent as it is
+	if (t.CompressRequestBody || options.gzip) && len(encoded.payload) > t.compressionThreshold() && options.header.Get("Content-Encoding") == "" {
+		var compressed bytes.Buffer
+		gz := gzip.NewWriter(&compressed)
+		if _, err := gz.Write(encoded.payload); err != nil {
+			return remoteBody{}, err
+		}
+		if err := gz.Close(); err != nil {
+			return remoteBody{}, err
+		}
+		encoded.payload, encoded.contentEncoding = compressed.Bytes(), "gzip"
+	}
+	return encoded, nil
+}
+
+// redacted replaces the values of sensitive headers in dumps
+const redacted = "[REDACTED]"
+
+// defaultSensitiveHeaders are the headers whose values RedactHeaders always hides, as they carry credentials
+var defaultSensitiveHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key"}
+
+// RedactHeaders returns a copy of header with the values of the headers that carry credentials, such as
+// Authorization and Cookie, and of those named in SensitiveHeaders, replaced by [REDACTED], so it can be logged
+func (t *Tools) RedactHeaders(header http.Header) http.Header {
+	return t.redactHeaders(header, nil)
+}
+
+// redactHeaders does the work of RedactHeaders, redacting the headers named in sensitive too
+func (t *Tools) redactHeaders(header http.Header, sensitive []string) http.Header {
+	clean := header.Clone()
+	for _, names := range [][]string{defaultSensitiveHeaders, t.SensitiveHeaders, sensitive} {
+		for _, name := range names {
+			if values := clean.Values(name); len(values) > 0 {
+				clean[http.CanonicalHeaderKey(name)] = []string{redacted}
+			}
+		}
+	}
+	return clean
+}
+
+// debugRemote passes RemoteDebug, when it is set, a dump of request, before it is sent, or of response, without
+// their bodies and with their headers redacted by RedactHeaders, and those named in sensitive
+func (t *Tools) debugRemote(request *http.Request, response *http.Response, sensitive []string) {
+	if t.RemoteDebug == nil {
+		return
+	}
+	var dump strings.Builder
+	header := request.Header
+	if response != nil {
+		proto, status := response.Proto, response.Status
+		if proto == "" {
+			proto = "HTTP/1.1"
+		}
+		if status == "" {
+			status = fmt.Sprintf("%d %s", response.StatusCode, http.StatusText(response.StatusCode))
+		}
+		fmt.Fprintf(&dump, "%s %s\r\n", proto, status)
+		header = response.Header
+	} else {
+		// The query is left out, as it may carry credentials too
+		fmt.Fprintf(&dump, "%s %s://%s%s\r\n", request.Method, request.URL.Scheme, request.URL.Host, request.URL.EscapedPath())
+	}
+	_ = t.redactHeaders(header, sensitive).Write(&dump)
+	t.RemoteDebug(dump.String())
+}
+
+// validMethod reports whether method is a token, as RFC 9110 requires of HTTP methods
+func validMethod(method string) bool {
+	if method == "" {
+		return false
+	}
+	for _, c := range method {
+		if c > '~' || c <= ' ' || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, c) {
+			return false
+		}
+	}
+	return true
+}
+
+// PushJSONToRemote arbitrary data to some URL as JSON, and returns the response, status code, and error, if any...
+// The final parameter, client, is optional. If none is specified, we use a client from NewRemoteClient, which
+// times out after RemoteTimeout, or 30s.
+func (t *Tools) PushJSONToRemote(uri string, data any, client ...*http.Client) (*http.Response, int, error) {
+	return t.PushJSONToRemoteWithContext(context.Background(), uri, data, client...)
+}
+
+// PushJSONToRemoteWithContext is like PushJSONToRemote, but gives up on the call once ctx is done, such as when
+// its deadline passes, with an error matching the error of ctx, as context.DeadlineExceeded, with errors.Is
+func (t *Tools) PushJSONToRemoteWithContext(ctx context.Context, uri string, data any, client ...*http.Client) (*http.Response, int, error) {
+	var opts []RemoteOption
+	if len(client) > 0 {
+		opts = append(opts, WithHTTPClient(client[0]))
+	}
+	// Nil data has always been sent as null
+	if data == nil {
+		data = json.RawMessage("null")
+	}
+	response, err := t.CallRemote(ctx, http.MethodPost, uri, data, opts...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer response.Body.Close()
+	// send response back
+	return response, response.StatusCode, nil
+}
+
+// remoteErrorSnippet is the most of the body of a response a RemoteError quotes
+const remoteErrorSnippet = 512
+
+// RemoteError is returned by PushJSONToRemoteInto for a response whose status code is not 2xx
+type RemoteError struct {
+	// StatusCode is the status code of the response
+	StatusCode int
+	// Body is the start of the body of the response, truncated to 512 bytes
+	Body string
+
+	body  []byte
+	tools *Tools
+}
+
+func (e *RemoteError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("remote service responded with %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("remote service responded with %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Body)
+}
+
+// Decode decodes the body of the response into out, for services that describe their errors in JSON, with the
+// same errors as ReadJSON. The body is limited to MaxRemoteResponseSize, as a successful response is
+func (e *RemoteError) Decode(out any) error {
+	return e.tools.decodeJSON(bytes.NewReader(e.body), out)
+}
+
+// PushJSONToRemoteInto sends data to uri as JSON, as PushJSONToRemoteWithContext does, with the Accept:
+// application/json header, and decodes the JSON response into out, returning its status code. The response is
+// limited to MaxRemoteResponseSize, and must have a JSON Content-Type, or an *ErrUnsupportedMediaType is
+// returned; it is decoded with the same settings and errors as ReadJSON, such as an *ErrMalformedJSON. A
+// response without a body, such as a 204 No Content, leaves out unchanged. For a status code that is not 2xx, nothing is decoded into out, and a *RemoteError is
+// returned, whose Decode method decodes the body, such as the error document of the service, when wanted
+func (t *Tools) PushJSONToRemoteInto(ctx context.Context, uri string, data any, out any, client ...*http.Client) (int, error) {
+	var opts []RemoteOption
+	if len(client) > 0 {
+		opts = append(opts, WithHTTPClient(client[0]))
+	}
+	if data == nil {
+		data = json.RawMessage("null")
+	}
+	opts = append(opts, acceptJSON)
+	response, err := t.CallRemote(ctx, http.MethodPost, uri, data, opts...)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	return response.StatusCode, t.decodeRemoteResponse(response, out)
+}
+
+// GetJSONFromRemote gets uri, with the Accept: application/json header, and decodes the JSON response into out,
+// returning its status code, as PushJSONToRemoteInto does: the response is limited to MaxRemoteResponseSize,
+// must have a JSON Content-Type, and a response without a body, such as a 204 No Content, leaves out unchanged.
+// For a status code that is not 2xx, a *RemoteError is returned. The options are those of CallRemote, such as
+// WithQuery to add parameters to the query string
+func (t *Tools) GetJSONFromRemote(ctx context.Context, uri string, out any, opts ...RemoteOption) (int, error) {
+	response, err := t.CallRemote(ctx, http.MethodGet, uri, nil, append(opts[:len(opts):len(opts)], acceptJSON)...)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	return response.StatusCode, t.decodeRemoteResponse(response, out)
+}
+
+// acceptJSON makes a call send Accept: application/json, unless a WithHeader option sets Accept
+func acceptJSON(o *remoteOptions) {
+	o.accept = "application/json"
+}
+
+// mergeQuery returns uri with the parameters of query added to its query string
+func mergeQuery(uri string, query url.Values) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+	merged := u.Query()
+	for key, values := range query {
+		merged[key] = append(merged[key], values...)
+	}
+	u.RawQuery = merged.Encode()
+	return u.String(), nil
+}
+
+// decodeRemoteResponse decodes the JSON body of response into out, as PushJSONToRemoteInto does
+func (t *Tools) decodeRemoteResponse(response *http.Response, out any) error {
+	limit := int64(t.maxRemoteResponseSize())
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		// The body of an error is only read up to the limit, as it is not decoded unless the caller asks to
+		body, _ := io.ReadAll(io.LimitReader(response.Body, limit))
+		snippet := body
+		if len(snippet) > remoteErrorSnippet {
+			snippet = snippet[:remoteErrorSnippet]
+		}
+		return &RemoteError{StatusCode: response.StatusCode, Body: strings.ToValidUTF8(string(snippet), ""), body: body, tools: t}
+	}
+
+	body, err := io.ReadAll(&jsonLimitReader{r: io.LimitReader(response.Body, limit+1), limit: limit})
+	if err != nil {
+		return jsonDecodeError(err)
+	}
+	if len(body) == 0 {
+		return nil
+	}
+	if contentType := response.Header.Get("Content-Type"); !isJSONMediaType(contentType) {
+		return &ErrUnsupportedMediaType{ContentType: contentType}
+	}
+	return t.decodeJSON(bytes.NewReader(body), out)
+}
+
+// maxRemoteResponseSize returns MaxRemoteResponseSize, or the size ReadJSON is limited to when it is not set
+func (t *Tools) maxRemoteResponseSize() int {
+	if t.MaxRemoteResponseSize != 0 {
+		return t.MaxRemoteResponseSize
+	}
+	return t.maxJSONSize()
+}
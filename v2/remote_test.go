@@ -0,0 +1,424 @@
+package toolkit
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// slowClient returns a client whose calls take delay, unless their context is done first
+func slowClient(delay time.Duration) *http.Client {
+	return NewTestClient(func(request *http.Request) *http.Response {
+		select {
+		case <-time.After(delay):
+			return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewBufferString("ok")), Header: make(http.Header)}
+		case <-request.Context().Done():
+			// A nil response fails the call, as a transport giving up would
+			return nil
+		}
+	})
+}
+
+func TestTools_PushJSONToRemoteWithContext(t *testing.T) {
+	var testTools Tools
+
+	_, status, err := testTools.PushJSONToRemoteWithContext(context.Background(), "http://example.com/some/path", map[string]string{"bar": "bar"}, slowClient(time.Millisecond))
+	if err != nil || status != http.StatusOK {
+		t.Errorf("expected the call to succeed, but got %d, %v", status, err)
+	}
+
+	// A deadline passing during the call
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	_, _, err = testTools.PushJSONToRemoteWithContext(ctx, "http://example.com/some/path", "data", slowClient(time.Second))
+	if !errors.Is(err, context.DeadlineExceeded) || time.Since(started) > 500*time.Millisecond {
+		t.Errorf("expected the call to stop with context.DeadlineExceeded, but got %v after %v", err, time.Since(started))
+	}
+
+	// A context canceled before the call
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if _, _, err = testTools.PushJSONToRemoteWithContext(ctx, "http://example.com/some/path", "data", slowClient(time.Second)); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected an error matching context.Canceled, but got %v", err)
+	}
+
+	// Marshalling and transport errors do not match the errors of the context
+	var unsupported *json.UnsupportedTypeError
+	if _, _, err = testTools.PushJSONToRemoteWithContext(context.Background(), "http://example.com", make(chan int)); !errors.As(err, &unsupported) || errors.Is(err, context.Canceled) {
+		t.Errorf("expected a marshalling error, but got %v", err)
+	}
+	var urlErr *url.Error
+	if _, _, err = testTools.PushJSONToRemoteWithContext(context.Background(), "unknown://example.com", "data"); !errors.As(err, &urlErr) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected a transport error, but got %v", err)
+	}
+}
+
+// capturedRequest is a request a captureClient received, with its body read
+type capturedRequest struct {
+	*http.Request
+	body []byte
+}
+
+// captureClient returns a client that keeps the requests it receives in requests, and responds to them with
+// the status code and body
+func captureClient(requests *[]capturedRequest, status int, body string) *http.Client {
+	return NewTestClient(func(request *http.Request) *http.Response {
+		captured := capturedRequest{Request: request}
+		if request.Body != nil {
+			captured.body, _ = io.ReadAll(request.Body)
+		}
+		*requests = append(*requests, captured)
+		return &http.Response{StatusCode: status, Body: io.NopCloser(strings.NewReader(body)), Header: http.Header{"Content-Type": {"application/json"}}}
+	})
+}
+
+var callRemoteTests = []struct {
+	name                string
+	method              string
+	body                any
+	msgPack             bool
+	expectedBody        string
+	expectedContentType string
+	expectedError       error
+}{
+	{name: "PUT", method: http.MethodPut, body: map[string]int{"a": 1}, expectedBody: `{"a":1}`, expectedContentType: "application/json"},
+	{name: "PATCH", method: http.MethodPatch, body: json.RawMessage(`{"b":null}`), expectedBody: `{"b":null}`, expectedContentType: "application/json"},
+	{name: "DELETE", method: http.MethodDelete, body: nil},
+	{name: "custom method", method: "PURGE", body: nil},
+	{name: "MessagePack", method: http.MethodPost, body: msgPackExample{Compact: true}, msgPack: true, expectedBody: string(msgPackFixture), expectedContentType: "application/msgpack"},
+	{name: "invalid method", method: "GET /", body: nil, expectedError: ErrInvalidMethod},
+	{name: "empty method", method: "", body: nil, expectedError: ErrInvalidMethod},
+	{name: "non ASCII method", method: "PÜT", body: nil, expectedError: ErrInvalidMethod},
+}
+
+func TestTools_CallRemote(t *testing.T) {
+	testTools := Tools{MsgPack: miniMsgPack{}}
+
+	for _, e := range callRemoteTests {
+		var requests []capturedRequest
+		opts := []RemoteOption{WithHTTPClient(captureClient(&requests, http.StatusOK, `{}`))}
+		if e.msgPack {
+			opts = append(opts, WithMsgPack())
+		}
+
+		response, err := testTools.CallRemote(context.Background(), e.method, "http://example.com/items/1", e.body, opts...)
+		if e.expectedError != nil {
+			if !errors.Is(err, e.expectedError) || len(requests) != 0 {
+				t.Errorf("%s: expected an error matching %v before any request, but got %v", e.name, e.expectedError, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", e.name, err)
+			continue
+		}
+		response.Body.Close()
+
+		if len(requests) != 1 {
+			t.Fatalf("%s: expected 1 request, but got %d", e.name, len(requests))
+		}
+		request := requests[0]
+		if request.Method != e.method || string(request.body) != e.expectedBody || request.Header.Get("Content-Type") != e.expectedContentType {
+			t.Errorf("%s: expected %s with %q as %q, but got %s with %q as %q", e.name, e.method, e.expectedBody, e.expectedContentType, request.Method, request.body, request.Header.Get("Content-Type"))
+		}
+		if e.body == nil && request.ContentLength != 0 {
+			t.Errorf("%s: expected no body, but got a Content-Length of %d", e.name, request.ContentLength)
+		}
+	}
+
+	var noCodec Tools
+	if _, err := noCodec.CallRemote(context.Background(), http.MethodPost, "http://example.com", "data", WithMsgPack()); !errors.Is(err, ErrNoMsgPackCodec) {
+		t.Errorf("expected ErrNoMsgPackCodec, but got %v", err)
+	}
+}
+
+func TestTools_PushJSONToRemote_NilData(t *testing.T) {
+	var testTools Tools
+	var requests []capturedRequest
+	_, status, err := testTools.PushJSONToRemote("http://example.com", nil, captureClient(&requests, http.StatusCreated, ""))
+	if err != nil || status != http.StatusCreated || len(requests) != 1 || string(requests[0].body) != "null" || requests[0].Method != http.MethodPost {
+		t.Errorf("expected nil data to be posted as null, but got %d, %v, %+v", status, err, requests)
+	}
+}
+
+func TestTools_CallRemote_Headers(t *testing.T) {
+	var dumps []string
+	testTools := Tools{SensitiveHeaders: []string{"x-tenant-token"}, RemoteDebug: func(dump string) { dumps = append(dumps, dump) }}
+
+	var requests []capturedRequest
+	header := http.Header{"Authorization": {"Bearer secret-token"}, "X-Tenant-Token": {"tenant-secret"}, "X-Request-Id": {"42"}}
+	response, err := testTools.CallRemote(context.Background(), http.MethodPost, "http://example.com/items?key=query-secret", map[string]int{"a": 1},
+		WithHTTPClient(captureClient(&requests, http.StatusOK, `{}`)),
+		WithHeader(header),
+		WithHeader(http.Header{"x-request-id": {"43"}, "Content-Type": {"application/vnd.api+json"}}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+
+	received := requests[0].Header
+	if received.Get("Authorization") != "Bearer secret-token" || received.Get("X-Tenant-Token") != "tenant-secret" {
+		t.Errorf("expected the headers to arrive, but got %v", received)
+	}
+	if strings.Join(received.Values("X-Request-Id"), ",") != "42,43" || received.Get("Content-Type") != "application/vnd.api+json" {
+		t.Errorf("expected the headers of every option, and Content-Type to be overridden, but got %v", received)
+	}
+
+	if len(dumps) != 2 || !strings.HasPrefix(dumps[0], "POST http://example.com/items\r\n") || !strings.HasPrefix(dumps[1], "HTTP/1.1 200 OK\r\n") {
+		t.Fatalf("expected a dump of the request and of the response, but got %q", dumps)
+	}
+	for _, secret := range []string{"secret-token", "tenant-secret", "query-secret"} {
+		if strings.Contains(dumps[0], secret) {
+			t.Errorf("expected %q to be redacted, but got %q", secret, dumps[0])
+		}
+	}
+	if !strings.Contains(dumps[0], "X-Request-Id: 42") || !strings.Contains(dumps[0], "Authorization: [REDACTED]") {
+		t.Errorf("expected the other headers to be dumped, but got %q", dumps[0])
+	}
+	if header.Get("Authorization") != "Bearer secret-token" {
+		t.Error("expected the headers passed to be left unchanged")
+	}
+}
+
+func TestTools_RedactHeaders(t *testing.T) {
+	testTools := Tools{SensitiveHeaders: []string{"X-Secret"}}
+	header := http.Header{"Cookie": {"a=1", "b=2"}, "X-Secret": {"s"}, "Accept": {"*/*"}}
+	clean := testTools.RedactHeaders(header)
+	if clean.Get("Accept") != "*/*" || strings.Join(clean.Values("Cookie"), ",") != redacted || clean.Get("X-Secret") != redacted {
+		t.Errorf("expected the sensitive headers to be redacted, but got %v", clean)
+	}
+	if header.Get("Cookie") != "a=1" {
+		t.Error("expected the header to be left unchanged")
+	}
+}
+
+// jsonClient returns a client whose calls are answered with status, body and contentType
+func jsonClient(status int, contentType, body string) *http.Client {
+	return NewTestClient(func(request *http.Request) *http.Response {
+		return &http.Response{StatusCode: status, Body: io.NopCloser(strings.NewReader(body)), Header: http.Header{"Content-Type": {contentType}}}
+	})
+}
+
+type remoteItem struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+var pushJSONToRemoteIntoTests = []struct {
+	name        string
+	status      int
+	contentType string
+	body        string
+	maxSize     int
+	want        remoteItem
+	wantErr     func(err error) bool
+}{
+	{name: "ok", status: http.StatusOK, contentType: "application/json", body: `{"id":1,"name":"one"}`, want: remoteItem{ID: 1, Name: "one"}},
+	{name: "json suffix", status: http.StatusCreated, contentType: "application/problem+json; charset=utf-8", body: `{"id":2}`, want: remoteItem{ID: 2}},
+	{name: "no content", status: http.StatusNoContent, want: remoteItem{ID: 9}},
+	{name: "not json", status: http.StatusOK, contentType: "text/html", body: `<html></html>`, want: remoteItem{ID: 9}, wantErr: func(err error) bool {
+		var e *ErrUnsupportedMediaType
+		return errors.As(err, &e) && e.ContentType == "text/html"
+	}},
+	{name: "malformed", status: http.StatusOK, contentType: "application/json", body: `{"id":`, wantErr: func(err error) bool {
+		var e *ErrMalformedJSON
+		return errors.As(err, &e)
+	}},
+	{name: "wrong type", status: http.StatusOK, contentType: "application/json", body: `{"id":"one"}`, wantErr: func(err error) bool {
+		var e *ErrWrongType
+		return errors.As(err, &e)
+	}},
+	{name: "too large", status: http.StatusOK, contentType: "application/json", body: `{"name":"` + strings.Repeat("a", 64) + `"}`, maxSize: 32, want: remoteItem{ID: 9}, wantErr: func(err error) bool {
+		return errors.Is(err, ErrBodyTooLarge)
+	}},
+	{name: "not found", status: http.StatusNotFound, contentType: "application/json", body: `{"error":"no such item"}`, want: remoteItem{ID: 9}, wantErr: func(err error) bool {
+		var e *RemoteError
+		return errors.As(err, &e) && e.StatusCode == http.StatusNotFound && e.Body == `{"error":"no such item"}`
+	}},
+}
+
+func TestTools_PushJSONToRemoteInto(t *testing.T) {
+	for _, e := range pushJSONToRemoteIntoTests {
+		testTools := Tools{MaxRemoteResponseSize: e.maxSize}
+		out := remoteItem{ID: 9}
+		status, err := testTools.PushJSONToRemoteInto(context.Background(), "http://example.com/items", remoteItem{Name: "new"}, &out, jsonClient(e.status, e.contentType, e.body))
+		if status != e.status {
+			t.Errorf("%s: expected status %d, but got %d", e.name, e.status, status)
+		}
+		if e.wantErr == nil && err != nil {
+			t.Errorf("%s: expected no error, but got %v", e.name, err)
+		}
+		if e.wantErr != nil && !e.wantErr(err) {
+			t.Errorf("%s: unexpected error %v", e.name, err)
+		}
+		if e.want != (remoteItem{}) && out != e.want {
+			t.Errorf("%s: expected %+v, but got %+v", e.name, e.want, out)
+		}
+	}
+}
+
+func TestRemoteError(t *testing.T) {
+	var testTools Tools
+	body := `{"error":"` + strings.Repeat("x", 1000) + `"}`
+	var out remoteItem
+	_, err := testTools.PushJSONToRemoteInto(context.Background(), "http://example.com/items", nil, &out, jsonClient(http.StatusBadGateway, "application/json", body))
+
+	var remoteErr *RemoteError
+	if !errors.As(err, &remoteErr) {
+		t.Fatalf("expected a *RemoteError, but got %v", err)
+	}
+	if len(remoteErr.Body) != 512 || !strings.Contains(err.Error(), "502 Bad Gateway") {
+		t.Errorf("expected the body to be truncated, but got %q", err.Error())
+	}
+
+	// The whole body can still be decoded, as the caller wants
+	var apiError struct {
+		Error string `json:"error"`
+	}
+	if err := remoteErr.Decode(&apiError); err != nil || len(apiError.Error) != 1000 {
+		t.Errorf("expected the body to be decoded, but got %v", err)
+	}
+	if out != (remoteItem{}) {
+		t.Errorf("expected out to be left unchanged, but got %+v", out)
+	}
+}
+
+// gunzip returns the decompressed body, failing t when it is not gzip
+func gunzip(t *testing.T, body []byte) []byte {
+	t.Helper()
+	gz, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decompressed, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return decompressed
+}
+
+func TestTools_CallRemote_GzipBody(t *testing.T) {
+	document := map[string]string{"text": strings.Repeat("ingest me ", 500)}
+	original, _ := json.Marshal(document)
+
+	testTools := Tools{CompressRequestBody: true}
+	var requests []capturedRequest
+	response, err := testTools.CallRemote(context.Background(), http.MethodPost, "http://example.com", document, WithHTTPClient(captureClient(&requests, http.StatusOK, `{}`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	request := requests[0]
+	if request.Header.Get("Content-Encoding") != "gzip" || request.Header.Get("Content-Type") != "application/json" || len(request.body) >= len(original) {
+		t.Fatalf("expected a compressed body, but got %d bytes with %v", len(request.body), request.Header)
+	}
+	if request.ContentLength != int64(len(request.body)) {
+		t.Errorf("expected Content-Length to be %d, but got %d", len(request.body), request.ContentLength)
+	}
+	if decompressed := gunzip(t, request.body); !bytes.Equal(decompressed, original) {
+		t.Errorf("expected the original payload, but got %q", decompressed)
+	}
+
+	// A body under CompressionThreshold is sent as it is
+	requests = nil
+	response, err = testTools.CallRemote(context.Background(), http.MethodPost, "http://example.com", map[string]string{"text": "small"}, WithHTTPClient(captureClient(&requests, http.StatusOK, `{}`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if requests[0].Header.Get("Content-Encoding") != "" || string(requests[0].body) != `{"text":"small"}` {
+		t.Errorf("expected an uncompressed body, but got %q", requests[0].body)
+	}
+}
+
+func TestTools_CallRemote_GzipBodyRetried(t *testing.T) {
+	var testTools Tools
+	document := strings.Repeat("x", 4096)
+	original, _ := json.Marshal(document)
+
+	var attempts int32
+	var bodies []string
+	response, err := testTools.CallRemote(context.Background(), http.MethodPut, "http://example.com", document,
+		WithHTTPClient(flakyClient(&attempts, &bodies, http.StatusBadGateway, http.StatusBadGateway)), WithGzipBody(), WithRetry(RetryPolicy{BaseDelay: 1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if attempts != 3 {
+		t.Fatalf("expected 3 attempts, but got %d", attempts)
+	}
+	for i, body := range bodies {
+		if decompressed := gunzip(t, []byte(body)); !bytes.Equal(decompressed, original) {
+			t.Errorf("expected attempt %d to send the whole compressed payload, but got %d bytes", i+1, len(decompressed))
+		}
+	}
+}
+
+var getJSONFromRemoteTests = []struct {
+	name      string
+	uri       string
+	opts      []RemoteOption
+	wantQuery url.Values
+}{
+	{name: "no query", uri: "http://example.com/items", wantQuery: url.Values{}},
+	{name: "query", uri: "http://example.com/items", opts: []RemoteOption{WithQuery(url.Values{"q": {"a b&c"}})}, wantQuery: url.Values{"q": {"a b&c"}}},
+	{name: "merged", uri: "http://example.com/items?page=2&q=x", opts: []RemoteOption{WithQuery(url.Values{"q": {"y"}, "sort": {"name"}}), WithQuery(url.Values{"sort": {"id"}})},
+		wantQuery: url.Values{"page": {"2"}, "q": {"x", "y"}, "sort": {"name", "id"}}},
+}
+
+func TestTools_GetJSONFromRemote(t *testing.T) {
+	var testTools Tools
+	for _, e := range getJSONFromRemoteTests {
+		var requests []capturedRequest
+		var out remoteItem
+		status, err := testTools.GetJSONFromRemote(context.Background(), e.uri, &out, append(e.opts, WithHTTPClient(captureClient(&requests, http.StatusOK, `{"id":1,"name":"one"}`)))...)
+		if err != nil || status != http.StatusOK {
+			t.Errorf("%s: expected a 200, but got %d, %v", e.name, status, err)
+			continue
+		}
+		if out != (remoteItem{ID: 1, Name: "one"}) {
+			t.Errorf("%s: expected the response to be decoded, but got %+v", e.name, out)
+		}
+		request := requests[0]
+		if request.Method != http.MethodGet || request.Header.Get("Accept") != "application/json" || len(request.body) != 0 {
+			t.Errorf("%s: expected a GET accepting JSON, without a body, but got %s %v", e.name, request.Method, request.Header)
+		}
+		if got := request.URL.Query(); !reflect.DeepEqual(got, e.wantQuery) {
+			t.Errorf("%s: expected the query %v, but got %v", e.name, e.wantQuery, got)
+		}
+	}
+}
+
+func TestTools_GetJSONFromRemote_Responses(t *testing.T) {
+	var testTools Tools
+
+	// A 204 leaves out untouched
+	out := remoteItem{ID: 9}
+	status, err := testTools.GetJSONFromRemote(context.Background(), "http://example.com", &out, WithHTTPClient(jsonClient(http.StatusNoContent, "", "")))
+	if err != nil || status != http.StatusNoContent || out != (remoteItem{ID: 9}) {
+		t.Errorf("expected a 204 to leave out untouched, but got %d, %+v, %v", status, out, err)
+	}
+
+	var malformed *ErrMalformedJSON
+	if _, err = testTools.GetJSONFromRemote(context.Background(), "http://example.com", &out, WithHTTPClient(jsonClient(http.StatusOK, "application/json", `{"id":1,`))); !errors.As(err, &malformed) {
+		t.Errorf("expected an *ErrMalformedJSON, but got %v", err)
+	}
+
+	// The Accept header can be replaced
+	var requests []capturedRequest
+	_, _ = testTools.GetJSONFromRemote(context.Background(), "http://example.com", &out, WithHTTPClient(captureClient(&requests, http.StatusOK, `{}`)), WithHeader(http.Header{"Accept": {"application/hal+json"}}))
+	if got := requests[0].Header.Values("Accept"); len(got) != 1 || got[0] != "application/hal+json" {
+		t.Errorf("expected the Accept header to be replaced, but got %v", got)
+	}
+}
@@ -0,0 +1,171 @@
+package toolkit
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// EncoderFunc encodes data into w, for WriteResponse
+type EncoderFunc func(w io.Writer, data any) error
+
+// registeredEncoder is an encoder added with RegisterEncoder
+type registeredEncoder struct {
+	mediaType string
+	encode    EncoderFunc
+}
+
+// ErrNotAcceptable is returned by WriteResponse when none of the media types it can write is acceptable to
+// the client
+var ErrNotAcceptable = errors.New("none of the media types the response can be written in is acceptable")
+
+// RegisterEncoder makes WriteResponse able to write responses of mediaType, such as "text/csv", encoded by fn.
+// Registering application/json or application/xml replaces the encoder WriteResponse uses for them by default.
+// Encoders must be registered before the Tools are used to write responses.
+func (t *Tools) RegisterEncoder(mediaType string, fn EncoderFunc) {
+	mediaType = strings.ToLower(mediaType)
+	for i, e := range t.encoders {
+		if e.mediaType == mediaType {
+			t.encoders[i].encode = fn
+			return
+		}
+	}
+	t.encoders = append(t.encoders, registeredEncoder{mediaType: mediaType, encode: fn})
+}
+
+// WriteResponse writes data with the status code and the optional headers, in the media type the Accept header
+// of request prefers, among application/json, application/xml and those added with RegisterEncoder. JSON is
+// written when there is no Accept header, when several media types are preferred alike, and when none is
+// acceptable, unless the client refuses JSON too, with a quality of 0 for application/json, application/* or
+// */*. A 406 Not Acceptable JSON error is written then, and ErrNotAcceptable is returned.
+func (t *Tools) WriteResponse(writer http.ResponseWriter, request *http.Request, status int, data any, headers ...http.Header) error {
+	writer.Header().Add("Vary", "Accept")
+
+	mediaTypes := t.responseMediaTypes()
+	chosen := "application/json"
+	if accept := request.Header.Values("Accept"); len(accept) > 0 {
+		ranges := parseAccept(strings.Join(accept, ","))
+		best := 0.0
+		for _, mediaType := range mediaTypes {
+			if q := acceptQuality(ranges, mediaType); q > best {
+				chosen, best = mediaType, q
+			}
+		}
+		if best == 0 && !acceptsFallback(ranges) {
+			_ = t.ErrorJSON(writer, ErrNotAcceptable, http.StatusNotAcceptable)
+			return ErrNotAcceptable
+		}
+	}
+
+	for _, e := range t.encoders {
+		if e.mediaType == chosen {
+			return t.writeEncoded(writer, status, chosen, e.encode, data, headers)
+		}
+	}
+	if chosen == "application/xml" {
+		return t.WriteXML(writer, status, data, headers...)
+	}
+	return t.WriteJSON(writer, status, data, headers...)
+}
+
+// responseMediaTypes returns the media types WriteResponse can write, JSON first
+func (t *Tools) responseMediaTypes() []string {
+	mediaTypes := []string{"application/json", "application/xml"}
+	for _, e := range t.encoders {
+		if e.mediaType != "application/json" && e.mediaType != "application/xml" {
+			mediaTypes = append(mediaTypes, e.mediaType)
+		}
+	}
+	return mediaTypes
+}
+
+// writeEncoded writes data encoded by encode, as a response of mediaType
+func (t *Tools) writeEncoded(writer http.ResponseWriter, status int, mediaType string, encode EncoderFunc, data any, headers []http.Header) error {
+	if err := checkNotWritten(writer); err != nil {
+		return err
+	}
+	if status == http.StatusNoContent || status == http.StatusNotModified {
+		setHeaders(writer, headers)
+		writer.WriteHeader(status)
+		t.observeResponse(status, 0, 0)
+		return nil
+	}
+
+	started := t.encodeStart()
+	buf := jsonBufferPool.Get().(*bytes.Buffer)
+	defer putJSONBuffer(buf)
+	if err := encode(buf, data); err != nil {
+		return err
+	}
+	return t.writeJSONBuffer(writer, status, mediaType, buf, headers, started)
+}
+
+// acceptRange is a media range of an Accept header, such as text/*, with its quality
+type acceptRange struct {
+	mediaType string
+	quality   float64
+}
+
+// parseAccept returns the media ranges of the Accept header accept. Ranges that cannot be parsed are skipped
+func parseAccept(accept string) []acceptRange {
+	var ranges []acceptRange
+	for _, part := range strings.Split(accept, ",") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		mediaType, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil || quality < 0 || quality > 1 {
+				continue
+			}
+		}
+		ranges = append(ranges, acceptRange{mediaType: mediaType, quality: quality})
+	}
+	return ranges
+}
+
+// acceptQuality returns the quality ranges give to mediaType, which is that of the most specific range
+// matching it, or 0 when none does
+func acceptQuality(ranges []acceptRange, mediaType string) float64 {
+	quality, specificity := 0.0, 0
+	for _, r := range ranges {
+		if s := rangeSpecificity(r.mediaType, mediaType); s > specificity {
+			quality, specificity = r.quality, s
+		}
+	}
+	return quality
+}
+
+// rangeSpecificity returns 3 when the media range matches mediaType exactly, 2 for a type/* range, 1 for
+// */*, and 0 when it does not match
+func rangeSpecificity(mediaRange, mediaType string) int {
+	switch {
+	case mediaRange == mediaType:
+		return 3
+	case mediaRange == "*/*":
+		return 1
+	case strings.HasSuffix(mediaRange, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(mediaRange, "*")):
+		return 2
+	default:
+		return 0
+	}
+}
+
+// acceptsFallback reports whether ranges leave JSON to be written when none of them matches a media type
+// WriteResponse can write, which is unless JSON is explicitly given a quality of 0
+func acceptsFallback(ranges []acceptRange) bool {
+	for _, r := range ranges {
+		if r.quality == 0 && rangeSpecificity(r.mediaType, "application/json") > 0 {
+			return false
+		}
+	}
+	return true
+}
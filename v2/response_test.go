@@ -0,0 +1,96 @@
+package toolkit
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var writeResponseTests = []struct {
+	name         string
+	accept       string
+	expectedType string
+	expectedBody string
+	notAccepted  bool
+}{
+	{name: "missing header", accept: "", expectedType: "application/json", expectedBody: `{"Foo":"bar"}`},
+	{name: "json", accept: "application/json", expectedType: "application/json", expectedBody: `{"Foo":"bar"}`},
+	{name: "xml", accept: "application/xml", expectedType: "application/xml", expectedBody: `<payload><Foo>bar</Foo></payload>`},
+	{name: "wildcard", accept: "*/*", expectedType: "application/json", expectedBody: `{"Foo":"bar"}`},
+	{name: "type wildcard", accept: "text/*", expectedType: "text/csv", expectedBody: "bar\n"},
+	{name: "q-value ordering", accept: "application/json;q=0.5, application/xml;q=0.8, text/csv;q=0.1", expectedType: "application/xml", expectedBody: `<payload><Foo>bar</Foo></payload>`},
+	{name: "most specific range", accept: "application/*;q=0.9, application/json;q=0.1", expectedType: "application/xml", expectedBody: `<payload><Foo>bar</Foo></payload>`},
+	{name: "registered", accept: "text/csv", expectedType: "text/csv", expectedBody: "bar\n"},
+	{name: "unknown falls back to json", accept: "image/png", expectedType: "application/json", expectedBody: `{"Foo":"bar"}`},
+	{name: "fallback refused", accept: "image/png, */*;q=0", notAccepted: true},
+	{name: "json refused", accept: "application/json;q=0", notAccepted: true},
+}
+
+func TestTools_WriteResponse(t *testing.T) {
+	type payload struct {
+		Foo string
+	}
+
+	var testTools Tools
+	testTools.RegisterEncoder("text/csv", func(w io.Writer, data any) error {
+		p, ok := data.(payload)
+		if !ok {
+			return fmt.Errorf("cannot encode %T as CSV", data)
+		}
+		writer := csv.NewWriter(w)
+		if err := writer.Write([]string{p.Foo}); err != nil {
+			return err
+		}
+		writer.Flush()
+		return writer.Error()
+	})
+
+	for _, e := range writeResponseTests {
+		req := httptest.NewRequest("GET", "/", nil)
+		if e.accept != "" {
+			req.Header.Set("Accept", e.accept)
+		}
+		rr := httptest.NewRecorder()
+		err := testTools.WriteResponse(rr, req, http.StatusOK, payload{Foo: "bar"})
+
+		if e.notAccepted {
+			if !errors.Is(err, ErrNotAcceptable) || rr.Code != http.StatusNotAcceptable || rr.Header().Get("Content-Type") != "application/json" {
+				t.Errorf("%s: expected a 406 JSON error, but got %d %s, %v", e.name, rr.Code, rr.Body.String(), err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: error not expected, but one received: %s", e.name, err.Error())
+		}
+		if rr.Header().Get("Content-Type") != e.expectedType {
+			t.Errorf("%s: expected %s, but got %s", e.name, e.expectedType, rr.Header().Get("Content-Type"))
+		}
+		if !strings.HasSuffix(rr.Body.String(), e.expectedBody) {
+			t.Errorf("%s: expected %s, but got %s", e.name, e.expectedBody, rr.Body.String())
+		}
+		if rr.Header().Get("Vary") != "Accept" {
+			t.Errorf("%s: expected Vary: Accept, but got %q", e.name, rr.Header().Get("Vary"))
+		}
+	}
+}
+
+func TestTools_RegisterEncoder_Replace(t *testing.T) {
+	var testTools Tools
+	testTools.RegisterEncoder("application/json", func(w io.Writer, data any) error {
+		_, err := io.WriteString(w, "custom")
+		return err
+	})
+
+	rr := httptest.NewRecorder()
+	if err := testTools.WriteResponse(rr, httptest.NewRequest("GET", "/", nil), http.StatusOK, "ignored"); err != nil {
+		t.Fatal(err)
+	}
+	if rr.Body.String() != "custom" || rr.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("expected the registered JSON encoder to be used, but got %s", rr.Body.String())
+	}
+}
@@ -0,0 +1,119 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// RetryPolicy tells CallRemote, and the other functions calling remote services, how to retry a call that
+// failed in a way that may not last, such as a reset connection or a 503 Service Unavailable. Calls are
+// retried after a random delay of up to BaseDelay, doubled on every attempt and capped at MaxDelay, which is
+// the "full jitter" backoff that keeps many clients from retrying all at once
+type RetryPolicy struct {
+	// MaxAttempts is the most calls made, including the first one, which is 3 when it is not set
+	MaxAttempts int
+	// BaseDelay is the most the first retry waits, which is 100ms when it is not set
+	BaseDelay time.Duration
+	// MaxDelay is the most any retry waits, which is 10s when it is not set
+	MaxDelay time.Duration
+	// RetryOn reports whether a call that got the status code status, or failed with err, is retried. It is
+	// DefaultRetryOn when not set
+	RetryOn func(status int, err error) bool
+}
+
+// DefaultRetryOn reports whether a call is retried by a RetryPolicy without RetryOn: a call that failed with a
+// network error, such as a reset connection or a timeout, or that got the status code 429 Too Many Requests,
+// 502 Bad Gateway, 503 Service Unavailable or 504 Gateway Timeout
+func DefaultRetryOn(status int, err error) bool {
+	if err != nil {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return false
+		}
+		// Every error of http.Client is a *url.Error, which is a net.Error itself, even for a bad URL
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		var netErr net.Error
+		return errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+	}
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// WithRetry retries the call as policy says, rather than as Tools.RemoteRetry does
+func WithRetry(policy RetryPolicy) RemoteOption {
+	return func(o *remoteOptions) {
+		o.retry = &policy
+	}
+}
+
+// maxAttempts returns MaxAttempts, or 3 when it is not set. A nil policy makes a single attempt
+func (p *RetryPolicy) maxAttempts() int {
+	switch {
+	case p == nil:
+		return 1
+	case p.MaxAttempts > 0:
+		return p.MaxAttempts
+	default:
+		return 3
+	}
+}
+
+// retry reports whether a call that got response, or failed with err, is retried
+func (p *RetryPolicy) retry(response *http.Response, err error) bool {
+	retryOn := p.RetryOn
+	if retryOn == nil {
+		retryOn = DefaultRetryOn
+	}
+	status := 0
+	if response != nil {
+		status = response.StatusCode
+	}
+	return retryOn(status, err)
+}
+
+// backoff returns how long to wait before the retry following the attempt-th call: a random delay of up to
+// BaseDelay doubled attempt-1 times, capped at MaxDelay
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	base, most := p.BaseDelay, p.MaxDelay
+	if base <= 0 {
+		base = 100 * time.Millisecond
+	}
+	if most <= 0 {
+		most = 10 * time.Second
+	}
+	ceiling := most
+	if shift := attempt - 1; shift < 62 && base<<shift > 0 && base<<shift < most {
+		ceiling = base << shift
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+// sleepContext waits for d, or until ctx is done, returning the error of ctx then
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// discardResponse reads what is left of the body of a response that is not returned, so its connection can be
+// reused, and closes it
+func discardResponse(response *http.Response) {
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 64*1024))
+	_ = response.Body.Close()
+}
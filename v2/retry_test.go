@@ -0,0 +1,149 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// transportFunc is a transport that can fail, where RoundTripFunc always returns a response
+type transportFunc func(request *http.Request) (*http.Response, error)
+
+func (f transportFunc) RoundTrip(request *http.Request) (*http.Response, error) {
+	return f(request)
+}
+
+// flakyClient returns a client whose calls fail with the results of failures, in turn, and succeed after them,
+// counting the calls in attempts and recording the bodies they sent
+func flakyClient(attempts *int32, bodies *[]string, failures ...any) *http.Client {
+	return &http.Client{Transport: transportFunc(func(request *http.Request) (*http.Response, error) {
+		n := atomic.AddInt32(attempts, 1)
+		if request.Body != nil {
+			body, _ := io.ReadAll(request.Body)
+			*bodies = append(*bodies, string(body))
+		}
+		status := http.StatusOK
+		if int(n) <= len(failures) {
+			switch failure := failures[n-1].(type) {
+			case error:
+				return nil, failure
+			case int:
+				status = failure
+			}
+		}
+		return &http.Response{StatusCode: status, Body: io.NopCloser(strings.NewReader(`{}`)), Header: make(http.Header)}, nil
+	})}
+}
+
+var retryTests = []struct {
+	name         string
+	policy       RetryPolicy
+	failures     []any
+	wantStatus   int
+	wantErr      bool
+	wantAttempts int32
+}{
+	{name: "no failures", failures: nil, wantStatus: http.StatusOK, wantAttempts: 1},
+	{name: "bad gateway", failures: []any{http.StatusBadGateway, http.StatusServiceUnavailable}, wantStatus: http.StatusOK, wantAttempts: 3},
+	{name: "too many requests", failures: []any{http.StatusTooManyRequests}, wantStatus: http.StatusOK, wantAttempts: 2},
+	{name: "connection reset", failures: []any{&net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}}, wantStatus: http.StatusOK, wantAttempts: 2},
+	{name: "unexpected eof", failures: []any{io.ErrUnexpectedEOF}, wantStatus: http.StatusOK, wantAttempts: 2},
+	{name: "out of attempts", failures: []any{504, 504, 504, 504}, wantStatus: http.StatusGatewayTimeout, wantAttempts: 3},
+	{name: "out of attempts with error", failures: []any{io.EOF, io.EOF}, policy: RetryPolicy{MaxAttempts: 2}, wantErr: true, wantAttempts: 2},
+	{name: "not retried", failures: []any{http.StatusInternalServerError}, wantStatus: http.StatusInternalServerError, wantAttempts: 1},
+	{name: "not retried error", failures: []any{errors.New("certificate is not trusted")}, wantErr: true, wantAttempts: 1},
+	{name: "custom retry on", failures: []any{http.StatusInternalServerError, http.StatusInternalServerError}, policy: RetryPolicy{MaxAttempts: 5, RetryOn: func(status int, err error) bool {
+		return status == http.StatusInternalServerError
+	}}, wantStatus: http.StatusOK, wantAttempts: 3},
+}
+
+func TestTools_CallRemote_Retry(t *testing.T) {
+	var testTools Tools
+	for _, e := range retryTests {
+		var attempts int32
+		var bodies []string
+		policy := e.policy
+		policy.BaseDelay = time.Millisecond
+		response, err := testTools.CallRemote(context.Background(), http.MethodPut, "http://example.com/items/1", map[string]string{"name": "one"},
+			WithHTTPClient(flakyClient(&attempts, &bodies, e.failures...)), WithRetry(policy))
+
+		if e.wantErr && err == nil {
+			t.Errorf("%s: expected an error, but got none", e.name)
+		}
+		if !e.wantErr {
+			if err != nil {
+				t.Errorf("%s: expected no error, but got %v", e.name, err)
+				continue
+			}
+			response.Body.Close()
+			if response.StatusCode != e.wantStatus {
+				t.Errorf("%s: expected status %d, but got %d", e.name, e.wantStatus, response.StatusCode)
+			}
+		}
+		if attempts != e.wantAttempts {
+			t.Errorf("%s: expected %d attempts, but got %d", e.name, e.wantAttempts, attempts)
+		}
+		for _, body := range bodies {
+			if body != `{"name":"one"}` {
+				t.Errorf("%s: expected the body to be sent in full on every attempt, but got %q", e.name, body)
+			}
+		}
+	}
+}
+
+func TestTools_CallRemote_RetryDefault(t *testing.T) {
+	var attempts int32
+	var bodies []string
+	testTools := Tools{RemoteRetry: &RetryPolicy{BaseDelay: time.Millisecond}}
+	_, status, err := testTools.PushJSONToRemote("http://example.com", "data", flakyClient(&attempts, &bodies, http.StatusServiceUnavailable))
+	if err != nil || status != http.StatusOK || attempts != 2 {
+		t.Errorf("expected RemoteRetry to retry the push, but got %d after %d attempts, %v", status, attempts, err)
+	}
+
+	// Without a policy, calls are not retried
+	attempts = 0
+	testTools.RemoteRetry = nil
+	if _, status, _ = testTools.PushJSONToRemote("http://example.com", "data", flakyClient(&attempts, &bodies, http.StatusServiceUnavailable)); status != http.StatusServiceUnavailable || attempts != 1 {
+		t.Errorf("expected a single attempt, but got %d after %d attempts", status, attempts)
+	}
+}
+
+func TestTools_CallRemote_RetryCanceled(t *testing.T) {
+	var testTools Tools
+	var attempts int32
+	var bodies []string
+
+	// The backoff is given up once the context is done, rather than waiting for the next attempt
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	_, err := testTools.CallRemote(ctx, http.MethodGet, "http://example.com", nil,
+		WithHTTPClient(flakyClient(&attempts, &bodies, 503, 503, 503)), WithRetry(RetryPolicy{BaseDelay: time.Hour, MaxDelay: time.Hour}))
+	if !errors.Is(err, context.DeadlineExceeded) || time.Since(started) > 500*time.Millisecond {
+		t.Errorf("expected the backoff to stop with context.DeadlineExceeded, but got %v after %v", err, time.Since(started))
+	}
+	if attempts != 1 {
+		t.Errorf("expected a single attempt, but got %d", attempts)
+	}
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond}
+	for attempt, ceiling := range []time.Duration{10, 20, 40, 50, 50} {
+		for i := 0; i < 100; i++ {
+			if delay := policy.backoff(attempt + 1); delay < 0 || delay > ceiling*time.Millisecond {
+				t.Errorf("expected the delay after attempt %d to be at most %v, but got %v", attempt+1, ceiling*time.Millisecond, delay)
+			}
+		}
+	}
+	if delay := policy.backoff(100); delay < 0 || delay > 50*time.Millisecond {
+		t.Errorf("expected the delay to be capped, but got %v", delay)
+	}
+}
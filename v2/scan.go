@@ -0,0 +1,56 @@
+package toolkit
+
+import (
+	"errors"
+	"io"
+)
+
+// errScanAborted is passed to a ScanFunc's reader when the file stops being saved before it was read in full
+var errScanAborted = errors.New("the upload was aborted before the file was scanned")
+
+// scanningReader streams the contents read through it to a ScanFunc running in the background. When the
+// contents are exhausted, it waits for the scanner, and returns its error in place of io.EOF, so a rejected
+// file is never completely saved.
+type scanningReader struct {
+	r    io.Reader
+	pw   *io.PipeWriter
+	done chan error
+	err  error
+}
+
+// newScanningReader starts scan on everything read from r through the returned reader
+func newScanningReader(name string, r io.Reader, scan func(name string, r io.Reader) error) *scanningReader {
+	pr, pw := io.Pipe()
+	s := &scanningReader{r: io.TeeReader(r, pw), pw: pw, done: make(chan error, 1)}
+
+	go func() {
+		err := scan(name, pr)
+
+		// Keep reading whatever the scanner left, so writes never block
+		_, _ = io.Copy(io.Discard, pr)
+		s.done <- err
+	}()
+	return s
+}
+
+// Read reads from the underlying reader, and reports the result of the scan at the end of it
+func (s *scanningReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	if err == io.EOF {
+		if scanErr := s.finish(nil); scanErr != nil {
+			return n, scanErr
+		}
+	}
+	return n, err
+}
+
+// finish tells the scanner that the contents ended, or were aborted with err, and returns its result. It can be
+// called more than once.
+func (s *scanningReader) finish(err error) error {
+	if s.done != nil {
+		_ = s.pw.CloseWithError(err)
+		s.err = <-s.done
+		s.done = nil
+	}
+	return s.err
+}
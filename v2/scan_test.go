@@ -0,0 +1,65 @@
+package toolkit
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+// errInfected is returned by fakeScanner for files containing the EICAR-like signature
+var errInfected = errors.New("infected")
+
+// fakeScanner rejects files containing a magic byte sequence, which may be split across reads
+func fakeScanner(name string, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if bytes.Contains(data, []byte("X5O!P%@AP")) {
+		return errInfected
+	}
+	return nil
+}
+
+func TestTools_UploadFiles_ScanFunc(t *testing.T) {
+	uploadDir := t.TempDir()
+	testTools := Tools{ScanFunc: fakeScanner}
+
+	// The signature sits beyond the sniffed bytes, so the scanner must see the whole file
+	infected := append(bytes.Repeat([]byte("a"), 100*1024), []byte("X5O!P%@AP")...)
+
+	request := newUploadRequest(t,
+		testFile{name: "clean.txt", content: []byte("nothing to see here")},
+		testFile{name: "infected.txt", content: infected},
+	)
+	uploadedFiles, err := testTools.UploadFiles(request, uploadDir, false)
+	if !errors.Is(err, errInfected) || !strings.Contains(err.Error(), `"infected.txt"`) {
+		t.Errorf("expected an infected error naming the file, but got %v", err)
+	}
+	if len(uploadedFiles) != 1 || uploadedFiles[0].NewFileName != "clean.txt" {
+		t.Errorf("expected only clean.txt to be uploaded, but got %v", uploadedFiles)
+	}
+
+	entries, _ := os.ReadDir(uploadDir)
+	if len(entries) != 1 || entries[0].Name() != "clean.txt" {
+		t.Errorf("expected only clean.txt in the upload directory, but found %v", entries)
+	}
+
+	// A scanner that stops reading early must not stall the upload
+	testTools.ScanFunc = func(name string, r io.Reader) error { return nil }
+	request = newUploadRequest(t, testFile{name: "big.txt", content: infected})
+	if _, err := testTools.UploadFiles(request, uploadDir, false); err != nil {
+		t.Error(err)
+	}
+
+	// Neither does a file going over the size limit
+	testTools.ScanFunc = fakeScanner
+	testTools.MaxSingleFileSize = 1024
+	request = newUploadRequest(t, testFile{name: "huge.txt", content: infected})
+	if _, err := testTools.UploadFiles(request, uploadDir, false); err == nil || errors.Is(err, errInfected) {
+		t.Errorf("expected a size error, but got %v", err)
+	}
+}
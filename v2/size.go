@@ -0,0 +1,53 @@
+package toolkit
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// byteUnits are the units of HumanizeBytes, each 1024 times the one before
+var byteUnits = []string{"B", "KB", "MB", "GB", "TB", "PB", "EB"}
+
+// HumanizeBytes returns the size n, in bytes, in the largest unit it makes at least one of, such as "1023 B",
+// "1.5 MB" or "512 KB", with one decimal under 10 of the unit. Units are powers of 1024
+func HumanizeBytes(n int64) string {
+	if n < 1024 && n > -1024 {
+		return strconv.FormatInt(n, 10) + " B"
+	}
+
+	value, unit := float64(n), 0
+	for (value >= 1024 || value <= -1024) && unit < len(byteUnits)-1 {
+		value /= 1024
+		unit++
+	}
+	// A size just under the next unit is rounded up to it, rather than written as 1024 of this one
+	if (value >= 1023.5 || value <= -1023.5) && unit < len(byteUnits)-1 {
+		value /= 1024
+		unit++
+	}
+	if value < 9.95 && value > -9.95 {
+		return fmt.Sprintf("%.1f %s", value, byteUnits[unit])
+	}
+	return fmt.Sprintf("%.0f %s", value, byteUnits[unit])
+}
+
+// ErrBodyLimitExceeded is returned by ReadJSON, and the other readers of a body, for a body larger than their
+// limit. It matches ErrBodyTooLarge with errors.Is, and its message tells the limit in a unit people read
+type ErrBodyLimitExceeded struct {
+	// Limit is the limit, in bytes
+	Limit int64
+	// Err is the error of the read, an *http.MaxBytesError
+	Err error
+}
+
+func (e *ErrBodyLimitExceeded) Error() string {
+	return "body must not be larger than " + HumanizeBytes(e.Limit)
+}
+
+func (e *ErrBodyLimitExceeded) Unwrap() []error { return []error{ErrBodyTooLarge, e.Err} }
+
+// bodyTooLarge returns the error of the readers of a body for err, which went over its limit
+func bodyTooLarge(err *http.MaxBytesError) error {
+	return &ErrBodyLimitExceeded{Limit: err.Limit, Err: err}
+}
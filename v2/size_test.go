@@ -0,0 +1,54 @@
+package toolkit
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var humanizeBytesTests = []struct {
+	bytes    int64
+	expected string
+}{
+	{bytes: 0, expected: "0 B"},
+	{bytes: 1023, expected: "1023 B"},
+	{bytes: 1024, expected: "1.0 KB"},
+	{bytes: 1536, expected: "1.5 KB"},
+	{bytes: 512 << 10, expected: "512 KB"},
+	{bytes: 1<<20 - 1, expected: "1.0 MB"},
+	{bytes: 1 << 20, expected: "1.0 MB"},
+	{bytes: 3 << 19, expected: "1.5 MB"},
+	{bytes: 10 << 20, expected: "10 MB"},
+	{bytes: 1 << 30, expected: "1.0 GB"},
+	{bytes: 1<<63 - 1, expected: "8.0 EB"},
+	{bytes: -2048, expected: "-2.0 KB"},
+}
+
+func TestHumanizeBytes(t *testing.T) {
+	for _, e := range humanizeBytesTests {
+		if got := HumanizeBytes(e.bytes); got != e.expected {
+			t.Errorf("%d: expected %q, but got %q", e.bytes, e.expected, got)
+		}
+	}
+}
+
+func TestTools_ReadJSON_BodyLimitExceeded(t *testing.T) {
+	var testTools Tools
+	var decoded map[string]string
+	body := `{"a":"` + strings.Repeat("x", 1<<20) + `"}`
+	err := testTools.ReadJSON(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader(body)), &decoded)
+
+	var limitErr *ErrBodyLimitExceeded
+	if !errors.As(err, &limitErr) || limitErr.Limit != 1<<20 {
+		t.Fatalf("expected an *ErrBodyLimitExceeded with the raw limit, but got %v", err)
+	}
+	if err.Error() != "body must not be larger than 1.0 MB" {
+		t.Errorf("expected the limit in MB, but got %q", err.Error())
+	}
+	var maxBytesErr *http.MaxBytesError
+	if !errors.Is(err, ErrBodyTooLarge) || !errors.As(err, &maxBytesErr) || JSONErrorStatus(err) != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected the error to match ErrBodyTooLarge and *http.MaxBytesError, but got %v", err)
+	}
+}
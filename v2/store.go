@@ -0,0 +1,200 @@
+package toolkit
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// FileStore is the interface implemented by anything that can hold uploaded files, such as the local disk or an
+// object storage bucket. Save must not leave a partially written file behind when it returns an error.
+type FileStore interface {
+	// Save writes everything read from r under name, and returns the key the file can be found by later
+	Save(name string, r io.Reader) (key string, size int64, err error)
+	// Delete removes the file stored under key
+	Delete(key string) error
+}
+
+// ExclusiveFileStore is implemented by a FileStore that can refuse to replace an existing file, which is needed
+// for the CollisionError and CollisionAutoSuffix policies. SaveNew must fail with an error matching os.ErrExist,
+// without reading from r, when a file already exists under name.
+type ExclusiveFileStore interface {
+	FileStore
+	SaveNew(name string, r io.Reader) (key string, size int64, err error)
+}
+
+// DiskStore is a FileStore that saves files on the local disk, under Root
+type DiskStore struct {
+	Root string
+	// DirPerm is the mode of created directories, 0755 when zero
+	DirPerm os.FileMode
+	// FilePerm is the mode of created files, 0666 when zero. Both modes are subject to the umask
+	FilePerm os.FileMode
+}
+
+// dirPerm returns the mode for created directories
+func (d DiskStore) dirPerm() os.FileMode {
+	if d.DirPerm == 0 {
+		return 0755
+	}
+	return d.DirPerm
+}
+
+// filePerm returns the mode for created files
+func (d DiskStore) filePerm() os.FileMode {
+	if d.FilePerm == 0 {
+		return 0666
+	}
+	return d.FilePerm
+}
+
+// Save creates the file name under Root, and any missing parent directories, replacing an existing file.
+// The key returned is the absolute path of the file. The contents are written to a temporary file in the same
+// directory first, and renamed to name only once everything was copied, so a failed or interrupted copy
+// never leaves a truncated file under name.
+func (d DiskStore) Save(name string, r io.Reader) (string, int64, error) {
+	path, err := filepath.Abs(filepath.Join(d.Root, filepath.FromSlash(name)))
+	if err != nil {
+		return "", 0, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), d.dirPerm()); err != nil {
+		return "", 0, err
+	}
+
+	size, err := writeAtomically(path, r, d.filePerm())
+	if err != nil {
+		return "", 0, err
+	}
+	return path, size, nil
+}
+
+// SaveNew is like Save, but fails with os.ErrExist if the file already exists. The name is reserved by an
+// empty file while the contents are being copied, which is removed again if the copy fails.
+func (d DiskStore) SaveNew(name string, r io.Reader) (string, int64, error) {
+	path, err := filepath.Abs(filepath.Join(d.Root, filepath.FromSlash(name)))
+	if err != nil {
+		return "", 0, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), d.dirPerm()); err != nil {
+		return "", 0, err
+	}
+
+	placeholder, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, d.filePerm())
+	if err != nil {
+		return "", 0, err
+	}
+	if err := placeholder.Close(); err != nil {
+		_ = os.Remove(path)
+		return "", 0, err
+	}
+
+	size, err := writeAtomically(path, r, d.filePerm())
+	if err != nil {
+		_ = os.Remove(path)
+		return "", 0, err
+	}
+	return path, size, nil
+}
+
+// writeAtomically copies r to a temporary file next to path, created with mode perm, and renames it to path once
+// the copy succeeded. The temporary file is removed on any error.
+func writeAtomically(path string, r io.Reader, perm os.FileMode) (int64, error) {
+	suffix := make([]byte, 12)
+	if _, err := rand.Read(suffix); err != nil {
+		return 0, err
+	}
+	tmpPath := filepath.Join(filepath.Dir(path), ".tmp-"+hex.EncodeToString(suffix))
+
+	tmpFile, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, perm)
+	if err != nil {
+		return 0, err
+	}
+
+	size, err := io.Copy(tmpFile, r)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return 0, err
+	}
+	return size, nil
+}
+
+// Delete removes the file at the path key
+func (d DiskStore) Delete(key string) error {
+	return os.Remove(key)
+}
+
+// MemoryStore is a FileStore that keeps files in memory, which is mostly useful in tests
+type MemoryStore struct {
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+// Save reads r into memory, and keeps it under name, replacing an existing file
+func (m *MemoryStore) Save(name string, r io.Reader) (string, int64, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.files == nil {
+		m.files = make(map[string][]byte)
+	}
+	m.files[name] = data
+	return name, int64(len(data)), nil
+}
+
+// SaveNew is like Save, but fails with os.ErrExist if a file is already stored under name. The name is reserved
+// while r is being read, so concurrent calls cannot both succeed.
+func (m *MemoryStore) SaveNew(name string, r io.Reader) (string, int64, error) {
+	m.mu.Lock()
+	if _, ok := m.files[name]; ok {
+		m.mu.Unlock()
+		return "", 0, os.ErrExist
+	}
+	if m.files == nil {
+		m.files = make(map[string][]byte)
+	}
+	m.files[name] = nil
+	m.mu.Unlock()
+
+	data, err := io.ReadAll(r)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err != nil {
+		delete(m.files, name)
+		return "", 0, err
+	}
+	m.files[name] = data
+	return name, int64(len(data)), nil
+}
+
+// Delete forgets the file stored under key
+func (m *MemoryStore) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.files[key]; !ok {
+		return os.ErrNotExist
+	}
+	delete(m.files, key)
+	return nil
+}
+
+// Get returns the contents of the file stored under key, and whether it exists
+func (m *MemoryStore) Get(key string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.files[key]
+	return data, ok
+}
@@ -0,0 +1,213 @@
+package toolkit
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// failingReader returns n bytes of data, and then fails
+type failingReader struct {
+	n int
+}
+
+func (f *failingReader) Read(p []byte) (int, error) {
+	if f.n <= 0 {
+		return 0, errors.New("connection reset")
+	}
+	if len(p) > f.n {
+		p = p[:f.n]
+	}
+	for i := range p {
+		p[i] = 'x'
+	}
+	f.n -= len(p)
+	return len(p), nil
+}
+
+func TestDiskStore(t *testing.T) {
+	store := DiskStore{Root: t.TempDir()}
+
+	key, size, err := store.Save("nested/dir/file.txt", bytes.NewBufferString("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != 5 {
+		t.Errorf("wrong size; expected 5 but got %d", size)
+	}
+	if key != filepath.Join(store.Root, "nested", "dir", "file.txt") {
+		t.Errorf("wrong key returned: %s", key)
+	}
+	if data, _ := os.ReadFile(key); string(data) != "hello" {
+		t.Errorf("wrong file contents: %q", data)
+	}
+
+	if err := store.Delete(key); err != nil {
+		t.Error(err)
+	}
+	if _, err := os.Stat(key); !os.IsNotExist(err) {
+		t.Error("expected file to be deleted")
+	}
+
+	// A failed copy must not leave a partial or temporary file behind, nor replace an existing file
+	if err := os.WriteFile(filepath.Join(store.Root, "existing.txt"), []byte("keep me"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"partial.txt", "existing.txt"} {
+		_, _, err = store.Save(name, &failingReader{n: 100 * 1024})
+		if err == nil {
+			t.Errorf("%s: expected an error from a failing reader", name)
+		}
+	}
+	_, _, err = store.SaveNew("partial.txt", &failingReader{n: 100 * 1024})
+	if err == nil {
+		t.Error("expected an error from a failing reader")
+	}
+
+	entries, _ := os.ReadDir(store.Root)
+	if len(entries) != 2 || entries[0].Name() != "existing.txt" || entries[1].Name() != "nested" {
+		t.Errorf("expected only existing.txt and nested to remain, but found %v", entries)
+	}
+	if data, _ := os.ReadFile(filepath.Join(store.Root, "existing.txt")); string(data) != "keep me" {
+		t.Errorf("expected existing file to be untouched, but found %q", data)
+	}
+}
+
+func TestTools_UploadFiles_FailedCopy(t *testing.T) {
+	uploadDir := t.TempDir()
+
+	// The request body breaks off in the middle of the file
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("file", "broken.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = part.Write(bytes.Repeat([]byte("x"), 1024))
+
+	request := httptest.NewRequest("POST", "/", io.MultiReader(body, &failingReader{n: 64 * 1024}))
+	request.Header.Add("Content-Type", writer.FormDataContentType())
+
+	var testTools Tools
+	if _, err := testTools.UploadFiles(request, uploadDir, false); err == nil {
+		t.Error("expected an error from a broken request body")
+	}
+
+	entries, _ := os.ReadDir(uploadDir)
+	if len(entries) != 0 {
+		t.Errorf("expected no stray files, but found %v", entries)
+	}
+}
+
+func TestTools_UploadFiles_Store(t *testing.T) {
+	store := &MemoryStore{}
+	testTools := Tools{Store: store}
+
+	request := newUploadRequest(t, testFile{name: "notes.txt", content: []byte("some notes")})
+	uploadedFiles, err := testTools.UploadFiles(request, "users/42", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if uploadedFiles[0].StoreKey != "users/42/notes.txt" {
+		t.Errorf("wrong store key: %s", uploadedFiles[0].StoreKey)
+	}
+	if uploadedFiles[0].SavedPath != "users/42/notes.txt" || uploadedFiles[0].UploadDir != "users/42" {
+		t.Errorf("wrong saved path %s or upload directory %s", uploadedFiles[0].SavedPath, uploadedFiles[0].UploadDir)
+	}
+	data, ok := store.Get(uploadedFiles[0].StoreKey)
+	if !ok || string(data) != "some notes" {
+		t.Errorf("expected file in memory store, but got %q", data)
+	}
+	if _, err := os.Stat("users"); !os.IsNotExist(err) {
+		t.Error("expected nothing to be written to disk")
+	}
+
+	// Files going over the size limit are removed from the store
+	testTools.MaxFileSize = 4
+	request = newUploadRequest(t, testFile{name: "big.txt", content: []byte("too much data")})
+	if _, err := testTools.UploadFiles(request, "users/42", false); err == nil {
+		t.Error("expected an error for a file over the size limit")
+	}
+	if _, ok := store.Get("users/42/big.txt"); ok {
+		t.Error("expected file over the size limit to be deleted from the store")
+	}
+
+	if err := store.Delete("users/42/missing.txt"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected os.ErrNotExist, but got %v", err)
+	}
+}
+
+func TestTools_UploadFiles_CollisionPolicyStore(t *testing.T) {
+	store := &MemoryStore{}
+	testTools := Tools{Store: store, CollisionPolicy: CollisionAutoSuffix}
+
+	for i := 0; i < 2; i++ {
+		request := newUploadRequest(t, testFile{name: "notes.txt", content: []byte("some notes")})
+		if _, err := testTools.UploadFiles(request, "docs", false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok := store.Get("docs/notes-1.txt"); !ok {
+		t.Error("expected second upload to be saved as docs/notes-1.txt")
+	}
+
+	// A store without SaveNew cannot honor the policy
+	testTools.Store = onlySaveStore{store}
+	request := newUploadRequest(t, testFile{name: "notes.txt", content: []byte("some notes")})
+	if _, err := testTools.UploadFiles(request, "docs", false); err == nil {
+		t.Error("expected an error from a store that does not implement ExclusiveFileStore")
+	}
+}
+
+// plainFS hides every method of a FileSystem that is not part of the FileSystem interface, such as CreateNew
+type plainFS struct {
+	FileSystem
+}
+
+func TestTools_UploadFiles_CollisionPolicyFS(t *testing.T) {
+	for _, plain := range []bool{false, true} {
+		memoryFS := &MemoryFS{}
+		testTools := Tools{FS: memoryFS, CollisionPolicy: CollisionAutoSuffix}
+		if plain {
+			testTools.FS = plainFS{memoryFS}
+		}
+
+		var wg sync.WaitGroup
+		for i := 0; i < 5; i++ {
+			request := newUploadRequest(t, testFile{name: "notes.txt", content: []byte("some notes")})
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := testTools.UploadFiles(request, "docs", false); err != nil {
+					t.Errorf("plain %t: %v", plain, err)
+				}
+			}()
+		}
+		wg.Wait()
+		if names := memoryFS.FileNames("docs"); len(names) != 5 || names[0] != "notes-1.txt" || names[4] != "notes.txt" {
+			t.Errorf("plain %t: expected 5 distinct files, but found %v", plain, names)
+		}
+
+		testTools.CollisionPolicy = CollisionError
+		request := newUploadRequest(t, testFile{name: "notes.txt", content: []byte("other notes")})
+		if _, err := testTools.UploadFiles(request, "docs", false); err == nil || !strings.Contains(err.Error(), "already exists") {
+			t.Errorf("plain %t: expected an error for an existing file, but got %v", plain, err)
+		}
+		if data, _ := memoryFS.ReadFile("docs/notes.txt"); string(data) != "some notes" {
+			t.Errorf("plain %t: expected the existing file to be left as it was, but found %q", plain, data)
+		}
+	}
+}
+
+// onlySaveStore hides every method of a FileStore that is not part of the FileStore interface
+type onlySaveStore struct {
+	FileStore
+}
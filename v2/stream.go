@@ -0,0 +1,104 @@
+package toolkit
+
+import (
+	"bytes"
+	"net/http"
+	"time"
+)
+
+// StreamErrorTrailer is the trailer WriteJSONStream sets to the message of the error that stopped it, when an
+// item cannot be encoded after the response has started
+const StreamErrorTrailer = "X-Stream-Error"
+
+// streamFlushSize is how many bytes of items WriteJSONStream collects before writing and flushing them
+const streamFlushSize = 32 * 1024
+
+// WriteJSONStream writes the items items yields as a JSON array, with the status code, encoding them one at a
+// time, so they never all have to be in memory. The items are written, and flushed when writer is an
+// http.Flusher, every 32KB or so. The array is closed whenever items returns, even early. As the headers are
+// sent before the first item is encoded, an item that cannot be encoded stops the stream with the array closed
+// after the items before it, and the message of the error in the StreamErrorTrailer trailer, which clients
+// must check to tell a truncated array from a complete one. The error is returned too. With
+// ForbidTopLevelArrays set, the array is wrapped as {"items":[...]}, or ErrTopLevelArray is returned before
+// anything is written when RejectTopLevelArrays is set.
+func (t *Tools) WriteJSONStream(writer http.ResponseWriter, status int, items func(yield func(any) bool)) error {
+	if err := checkNotWritten(writer); err != nil {
+		return err
+	}
+	if t.ForbidTopLevelArrays && t.RejectTopLevelArrays {
+		return ErrTopLevelArray
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	writer.Header().Set("X-Content-Type-Options", "nosniff")
+	writer.Header().Set("Trailer", StreamErrorTrailer)
+	writer.WriteHeader(status)
+
+	batch := jsonBufferPool.Get().(*bytes.Buffer)
+	defer putJSONBuffer(batch)
+	item := jsonBufferPool.Get().(*bytes.Buffer)
+	defer putJSONBuffer(item)
+	encoder := t.newJSONEncoder(item)
+
+	// written and encodeDuration are reported to ResponseObserver once the stream ends
+	var written int64
+	var encodeDuration time.Duration
+	flush := func() error {
+		n, err := batch.WriteTo(writer)
+		written += n
+		if err != nil {
+			return err
+		}
+		if flusher, ok := writer.(http.Flusher); ok {
+			flusher.Flush()
+		}
+		return nil
+	}
+
+	batch.WriteString(t.JSONPrefix)
+	if t.ForbidTopLevelArrays {
+		batch.WriteString(`{"items":`)
+	}
+	batch.WriteByte('[')
+	first := true
+	var streamErr error
+	items(func(value any) bool {
+		// A producer may go on yielding after being told to stop
+		if streamErr != nil {
+			return false
+		}
+		item.Reset()
+		started := t.encodeStart()
+		err := encoder.Encode(t.jsonValue(value))
+		if !started.IsZero() {
+			encodeDuration += time.Since(started)
+		}
+		if err != nil {
+			streamErr = err
+			writer.Header().Set(StreamErrorTrailer, err.Error())
+			return false
+		}
+		if !first {
+			batch.WriteByte(',')
+		}
+		first = false
+		batch.Write(item.Bytes()[:item.Len()-1])
+
+		if batch.Len() >= streamFlushSize {
+			if err := flush(); err != nil {
+				streamErr = err
+				return false
+			}
+		}
+		return true
+	})
+
+	batch.WriteByte(']')
+	if t.ForbidTopLevelArrays {
+		batch.WriteByte('}')
+	}
+	if err := flush(); err != nil && streamErr == nil {
+		streamErr = err
+	}
+	t.observeResponse(status, int(written), encodeDuration)
+	return streamErr
+}
@@ -0,0 +1,127 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// streamItem is an item of the streaming tests
+type streamItem struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// streamItems yields n items
+func streamItems(n int) func(yield func(any) bool) {
+	return func(yield func(any) bool) {
+		for i := 0; i < n; i++ {
+			if !yield(streamItem{ID: i, Name: "item"}) {
+				return
+			}
+		}
+	}
+}
+
+// flushRecorder is a ResponseRecorder counting flushes
+type flushRecorder struct {
+	*httptest.ResponseRecorder
+	flushes int
+}
+
+func (f *flushRecorder) Flush() { f.flushes++ }
+
+func TestTools_WriteJSONStream(t *testing.T) {
+	var testTools Tools
+
+	rr := &flushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	if err := testTools.WriteJSONStream(rr, http.StatusOK, streamItems(100000)); err != nil {
+		t.Fatal(err)
+	}
+	var decoded []streamItem
+	if err := json.Unmarshal(rr.Body.Bytes(), &decoded); err != nil {
+		t.Fatalf("the stream is not valid JSON: %v", err)
+	}
+	if len(decoded) != 100000 || decoded[99999].ID != 99999 {
+		t.Errorf("expected 100000 items, but got %d", len(decoded))
+	}
+	if rr.flushes < 10 {
+		t.Errorf("expected the stream to be flushed as it goes, but it was flushed %d times", rr.flushes)
+	}
+	if rr.Result().Trailer.Get(StreamErrorTrailer) != "" {
+		t.Errorf("expected no error trailer, but got %q", rr.Result().Trailer.Get(StreamErrorTrailer))
+	}
+
+	// Nothing, and a producer stopping early, still give valid arrays
+	for _, n := range []int{0, 1} {
+		rr := httptest.NewRecorder()
+		_ = testTools.WriteJSONStream(rr, http.StatusOK, streamItems(n))
+		if err := json.Unmarshal(rr.Body.Bytes(), &decoded); err != nil || len(decoded) != n {
+			t.Errorf("expected %d items, but got %s", n, rr.Body.String())
+		}
+	}
+}
+
+func TestTools_WriteJSONStream_Error(t *testing.T) {
+	var testTools Tools
+	rr := httptest.NewRecorder()
+	err := testTools.WriteJSONStream(rr, http.StatusOK, func(yield func(any) bool) {
+		yield(streamItem{ID: 1})
+		if yield(make(chan int)) {
+			t.Error("expected the producer to be told to stop")
+		}
+		yield(streamItem{ID: 3})
+	})
+	if err == nil {
+		t.Fatal("expected the encoding error to be returned")
+	}
+
+	// The array is closed after the items before the error, which the trailer tells
+	if rr.Body.String() != `[{"id":1,"name":""}]` {
+		t.Errorf("expected the array to be cut off, but got %s", rr.Body.String())
+	}
+	if rr.Result().Trailer.Get(StreamErrorTrailer) == "" {
+		t.Error("expected the error in the trailer")
+	}
+}
+
+func TestTools_WriteJSONStream_Allocations(t *testing.T) {
+	var testTools Tools
+	w := &countingResponseWriter{header: make(http.Header)}
+	items := streamItems(100000)
+
+	allocs := testing.AllocsPerRun(1, func() {
+		_ = testTools.WriteJSONStream(w, http.StatusOK, items)
+	})
+	if allocs/100000 > 5 {
+		t.Errorf("expected a few allocations per item, but got %.1f", allocs/100000)
+	}
+	if w.largest > 2*streamFlushSize {
+		t.Errorf("expected the stream to be written in batches, but one write was %d bytes", w.largest)
+	}
+}
+
+func TestTools_WriteJSONStream_ForbidTopLevelArrays(t *testing.T) {
+	testTools := Tools{ForbidTopLevelArrays: true}
+	rr := httptest.NewRecorder()
+	if err := testTools.WriteJSONStream(rr, http.StatusOK, streamItems(3)); err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct {
+		Items []streamItem `json:"items"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &decoded); err != nil || len(decoded.Items) != 3 {
+		t.Errorf("expected the items to be wrapped, but got %s", rr.Body.String())
+	}
+	if rr.Header().Get("X-Content-Type-Options") != "nosniff" {
+		t.Errorf("expected the nosniff header, but got %v", rr.Header())
+	}
+
+	testTools.RejectTopLevelArrays = true
+	rr = httptest.NewRecorder()
+	if err := testTools.WriteJSONStream(rr, http.StatusOK, streamItems(3)); !errors.Is(err, ErrTopLevelArray) || rr.Body.Len() != 0 {
+		t.Errorf("expected ErrTopLevelArray and nothing written, but got %v, %s", err, rr.Body.String())
+	}
+}
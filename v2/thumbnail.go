@@ -0,0 +1,144 @@
+package toolkit
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ThumbnailOptions configures the thumbnails generated for uploaded PNG and JPEG images
+type ThumbnailOptions struct {
+	// Width and Height are the box the thumbnail fits in, keeping the aspect ratio of the image. Zero means no
+	// limit in that direction. Images that already fit are not enlarged
+	Width  int
+	Height int
+	// Dir is the directory thumbnails are saved in. When empty, they are saved next to the uploaded file
+	Dir string
+	// Format is "jpeg" or "png". When empty, the format of the uploaded image is kept
+	Format string
+}
+
+// thumbnailer decodes the image written to it in the background, so the image can be decoded while the
+// uploaded file is being saved
+type thumbnailer struct {
+	pw     *io.PipeWriter
+	done   chan struct{}
+	img    image.Image
+	format string
+	err    error
+}
+
+// newThumbnailer starts decoding the image written to the returned thumbnailer
+func newThumbnailer() *thumbnailer {
+	pr, pw := io.Pipe()
+	th := &thumbnailer{pw: pw, done: make(chan struct{})}
+
+	go func() {
+		defer close(th.done)
+		th.img, th.format, th.err = image.Decode(pr)
+
+		// Keep reading whatever follows the image, so writes never block
+		_, _ = io.Copy(io.Discard, pr)
+	}()
+	return th
+}
+
+// Write passes p on to the image decoder
+func (th *thumbnailer) Write(p []byte) (int, error) {
+	return th.pw.Write(p)
+}
+
+// finish tells the decoder that the whole file was written, or that writing failed with err, and returns
+// the decoded image and its format
+func (th *thumbnailer) finish(err error) (image.Image, string, error) {
+	_ = th.pw.CloseWithError(err)
+	<-th.done
+	return th.img, th.format, th.err
+}
+
+// saveThumbnail resizes img to fit in the Thumbnail box, and saves it to store, recording its name on
+// uploadedFile. The thumbnail is named after the uploaded file, with a "_thumb" suffix.
+func (t *Tools) saveThumbnail(store FileStore, uploadDir string, uploadedFile *UploadedFile, img image.Image, format string) error {
+	if t.Thumbnail.Format != "" {
+		format = t.Thumbnail.Format
+	}
+
+	var buf bytes.Buffer
+	var ext string
+	thumbnail := resizeToFit(img, t.Thumbnail.Width, t.Thumbnail.Height)
+	switch format {
+	case "jpeg":
+		ext = ".jpg"
+		if err := jpeg.Encode(&buf, thumbnail, &jpeg.Options{Quality: 85}); err != nil {
+			return err
+		}
+	case "png":
+		ext = ".png"
+		if err := png.Encode(&buf, thumbnail); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported thumbnail format %q", format)
+	}
+
+	dir := t.Thumbnail.Dir
+	if dir == "" {
+		dir = uploadDir
+	}
+	name := strings.TrimSuffix(uploadedFile.NewFileName, filepath.Ext(uploadedFile.NewFileName)) + "_thumb" + ext
+	key, _, err := store.Save(path.Join(filepath.ToSlash(dir), name), &buf)
+	if err != nil {
+		return err
+	}
+	uploadedFile.ThumbnailName = name
+	uploadedFile.thumbnailKey = key
+	return nil
+}
+
+// resizeToFit scales src down to fit within maxWidth by maxHeight, keeping its aspect ratio. Each pixel of the
+// result is the average of the pixels of src it covers. A zero maximum does not constrain that direction.
+func resizeToFit(src image.Image, maxWidth, maxHeight int) image.Image {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	scale := 1.0
+	if maxWidth > 0 && width > maxWidth {
+		scale = float64(maxWidth) / float64(width)
+	}
+	if maxHeight > 0 && float64(height)*scale > float64(maxHeight) {
+		scale = float64(maxHeight) / float64(height)
+	}
+	if scale == 1 {
+		return src
+	}
+
+	dstWidth := max(1, int(float64(width)*scale))
+	dstHeight := max(1, int(float64(height)*scale))
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+
+	for y := 0; y < dstHeight; y++ {
+		y0 := bounds.Min.Y + y*height/dstHeight
+		y1 := max(y0+1, bounds.Min.Y+(y+1)*height/dstHeight)
+		for x := 0; x < dstWidth; x++ {
+			x0 := bounds.Min.X + x*width/dstWidth
+			x1 := max(x0+1, bounds.Min.X+(x+1)*width/dstWidth)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, b, a, n = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca), n+1
+				}
+			}
+			dst.Set(x, y, color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(b / n), A: uint16(a / n)})
+		}
+	}
+	return dst
+}
@@ -0,0 +1,103 @@
+package toolkit
+
+import (
+	"image"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var thumbnailTests = []struct {
+	name           string
+	file           string
+	options        ThumbnailOptions
+	expectedName   string
+	expectedFormat string
+	maxWidth       int
+	maxHeight      int
+}{
+	{name: "png in box", file: "./testdata/img.png", options: ThumbnailOptions{Width: 100, Height: 100}, expectedName: "img_thumb.png", expectedFormat: "png", maxWidth: 100, maxHeight: 100},
+	{name: "jpeg width only", file: "./testdata/gold.jpeg", options: ThumbnailOptions{Width: 64}, expectedName: "gold_thumb.jpg", expectedFormat: "jpeg", maxWidth: 64},
+	{name: "png to jpeg in thumbnail dir", file: "./testdata/img.png", options: ThumbnailOptions{Height: 50, Dir: "thumbs", Format: "jpeg"}, expectedName: "img_thumb.jpg", expectedFormat: "jpeg", maxHeight: 50},
+	{name: "not enlarged", file: "./testdata/img.png", options: ThumbnailOptions{Width: 4000, Height: 4000}, expectedName: "img_thumb.png", expectedFormat: "png", maxWidth: 640, maxHeight: 426},
+}
+
+func TestTools_UploadFiles_Thumbnail(t *testing.T) {
+	for _, e := range thumbnailTests {
+		content, err := os.ReadFile(e.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		uploadDir := t.TempDir()
+		options := e.options
+		if options.Dir != "" {
+			options.Dir = filepath.Join(uploadDir, options.Dir)
+		}
+		testTools := Tools{Thumbnail: &options}
+
+		uploadedFiles, err := testTools.UploadFiles(newUploadRequest(t, testFile{name: filepath.Base(e.file), content: content}), uploadDir, false)
+		if err != nil {
+			t.Errorf("%s: %s", e.name, err)
+			continue
+		}
+		if uploadedFiles[0].ThumbnailName != e.expectedName {
+			t.Errorf("%s: wrong thumbnail name %s", e.name, uploadedFiles[0].ThumbnailName)
+		}
+
+		dir := uploadDir
+		if options.Dir != "" {
+			dir = options.Dir
+		}
+		f, err := os.Open(filepath.Join(dir, uploadedFiles[0].ThumbnailName))
+		if err != nil {
+			t.Errorf("%s: expected thumbnail to exist: %s", e.name, err)
+			continue
+		}
+		config, format, err := image.DecodeConfig(f)
+		_ = f.Close()
+		if err != nil {
+			t.Errorf("%s: %s", e.name, err)
+			continue
+		}
+
+		if format != e.expectedFormat {
+			t.Errorf("%s: wrong thumbnail format %s", e.name, format)
+		}
+		if (e.maxWidth > 0 && config.Width > e.maxWidth) || (e.maxHeight > 0 && config.Height > e.maxHeight) {
+			t.Errorf("%s: thumbnail of %dx%d does not fit in %dx%d", e.name, config.Width, config.Height, e.maxWidth, e.maxHeight)
+		}
+		if config.Width == 0 || config.Height == 0 {
+			t.Errorf("%s: empty thumbnail", e.name)
+		}
+	}
+}
+
+func TestTools_UploadFiles_ThumbnailSkipped(t *testing.T) {
+	uploadDir := t.TempDir()
+	testTools := Tools{Thumbnail: &ThumbnailOptions{Width: 100, Height: 100}}
+
+	// GIF images and other files have no thumbnail
+	for _, content := range [][]byte{[]byte("GIF89a\x01\x00\x01\x00"), []byte("some text")} {
+		uploadedFiles, err := testTools.UploadFiles(newUploadRequest(t, testFile{name: "file", content: content}), uploadDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if uploadedFiles[0].ThumbnailName != "" {
+			t.Errorf("expected no thumbnail, but got %s", uploadedFiles[0].ThumbnailName)
+		}
+	}
+
+	entries, _ := os.ReadDir(uploadDir)
+	if len(entries) != 2 {
+		t.Errorf("expected only the 2 uploaded files, but found %v", entries)
+	}
+}
+
+func TestResizeToFit(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 400, 100))
+	bounds := resizeToFit(src, 100, 100).Bounds()
+	if bounds.Dx() != 100 || bounds.Dy() != 25 {
+		t.Errorf("expected 100x25, but got %dx%d", bounds.Dx(), bounds.Dy())
+	}
+}
@@ -0,0 +1,43 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"time"
+)
+
+// ErrReadTimeout is matched by the error ReadJSON returns when the deadline of the context of the request, or
+// the timeout of ReadJSONWithTimeout, passes before the body is read, as when a client sends it very slowly
+var ErrReadTimeout = errors.New("timed out reading the body")
+
+// isReadInterrupted reports whether err is the error of a read stopped by the context of the request, or by
+// the read deadline ReadJSONWithTimeout sets on the connection
+func isReadInterrupted(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, os.ErrDeadlineExceeded)
+}
+
+// readInterrupted returns the error ReadJSON returns for a read stopped with err, for which isReadInterrupted
+// is true
+func readInterrupted(err error) error {
+	if errors.Is(err, context.Canceled) {
+		return &jsonError{message: "reading the body was canceled", errs: []error{err}}
+	}
+	return &jsonError{message: ErrReadTimeout.Error(), errs: []error{ErrReadTimeout, err}}
+}
+
+// ReadJSONWithTimeout is like ReadJSON, but gives up reading the body once timeout has passed, with an error
+// matching ErrReadTimeout. When the server supports it, the read deadline of the connection is set too, so a
+// read waiting for the next bytes of the body is stopped rather than only the next one. That deadline replaces
+// the one of the ReadTimeout of the server, and is left in place once the body is read, for the rest of the
+// request
+func (t *Tools) ReadJSONWithTimeout(writer http.ResponseWriter, request *http.Request, data any, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(request.Context(), timeout)
+	defer cancel()
+
+	controller := http.NewResponseController(writer)
+	// The deadline is not cleared afterwards, which would leave the connection without any
+	_ = controller.SetReadDeadline(time.Now().Add(timeout))
+	return t.ReadJSON(writer, request.WithContext(ctx), data)
+}
@@ -0,0 +1,110 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// trickleReader returns one byte of its body at a time, every interval, as a slow client sends it
+type trickleReader struct {
+	body     string
+	interval time.Duration
+}
+
+func (r *trickleReader) Read(p []byte) (int, error) {
+	if r.body == "" {
+		return 0, io.EOF
+	}
+	time.Sleep(r.interval)
+	p[0] = r.body[0]
+	r.body = r.body[1:]
+	return 1, nil
+}
+
+func slowRequest(ctx context.Context) *http.Request {
+	body := &trickleReader{body: `{"foo":"` + strings.Repeat("x", 1000) + `"}`, interval: 10 * time.Millisecond}
+	return httptest.NewRequest("POST", "/", body).WithContext(ctx)
+}
+
+func TestTools_ReadJSON_ContextCanceled(t *testing.T) {
+	var testTools Tools
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	var decoded map[string]string
+	started := time.Now()
+	err := testTools.ReadJSON(httptest.NewRecorder(), slowRequest(ctx), &decoded)
+	if elapsed := time.Since(started); elapsed > 500*time.Millisecond {
+		t.Errorf("expected the read to stop once the context was canceled, but it took %v", elapsed)
+	}
+	if !errors.Is(err, context.Canceled) || errors.Is(err, ErrReadTimeout) {
+		t.Errorf("expected an error matching context.Canceled, but got %v", err)
+	}
+
+	// A context canceled before the body is read, with a compressed body too
+	req := httptest.NewRequest("POST", "/", bytes.NewReader(compressBody(t, "gzip", []byte(`{"foo":"bar"}`))))
+	req.Header.Set("Content-Encoding", "gzip")
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if err := testTools.ReadJSON(httptest.NewRecorder(), req.WithContext(ctx), &decoded); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected an error matching context.Canceled for the compressed body, but got %v", err)
+	}
+}
+
+func TestTools_ReadJSONWithTimeout(t *testing.T) {
+	var testTools Tools
+
+	var decoded map[string]string
+	started := time.Now()
+	err := testTools.ReadJSONWithTimeout(httptest.NewRecorder(), slowRequest(context.Background()), &decoded, 50*time.Millisecond)
+	if elapsed := time.Since(started); elapsed > 500*time.Millisecond {
+		t.Errorf("expected the read to stop after the timeout, but it took %v", elapsed)
+	}
+	if !errors.Is(err, ErrReadTimeout) || !errors.Is(err, context.DeadlineExceeded) || JSONErrorStatus(err) != http.StatusRequestTimeout {
+		t.Errorf("expected an error matching ErrReadTimeout, with status 408, but got %v", err)
+	}
+
+	// A body read in time is decoded as usual
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"foo":"bar"}`))
+	if err := testTools.ReadJSONWithTimeout(httptest.NewRecorder(), req, &decoded, time.Second); err != nil || decoded["foo"] != "bar" {
+		t.Errorf("expected the body to be decoded, but got %v, %v", decoded, err)
+	}
+}
+
+func TestTools_ReadJSONWithTimeout_StalledClient(t *testing.T) {
+	var testTools Tools
+	result := make(chan error, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var decoded map[string]string
+		err := testTools.ReadJSONWithTimeout(w, r, &decoded, 100*time.Millisecond)
+		result <- err
+		_ = testTools.ErrorJSON(w, err, JSONErrorStatus(err))
+	}))
+	defer server.Close()
+
+	// The client sends the start of the body, then nothing, so the handler waits in a read of the connection
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	fmt.Fprintf(conn, "POST / HTTP/1.1\r\nHost: test\r\nContent-Type: application/json\r\nContent-Length: 100\r\n\r\n{\"foo\":")
+
+	select {
+	case err := <-result:
+		if !errors.Is(err, ErrReadTimeout) {
+			t.Errorf("expected an error matching ErrReadTimeout, but got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the handler to stop reading the stalled body")
+	}
+}
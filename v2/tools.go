@@ -2,27 +2,334 @@ package toolkit
 
 import (
 	"bytes"
+	"context"
+	"crypto/md5"
 	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hash"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
 	"io"
+	"io/fs"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"reflect"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 const randomStringSource = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_+"
 
+// CollisionPolicy decides what happens when an uploaded file is saved under the name of an existing file
+type CollisionPolicy int
+
+const (
+	// CollisionOverwrite replaces the existing file
+	CollisionOverwrite CollisionPolicy = iota
+	// CollisionError rejects the uploaded file
+	CollisionError
+	// CollisionAutoSuffix saves the uploaded file under a free name, such as report-1.pdf for report.pdf
+	CollisionAutoSuffix
+)
+
+// maxCollisionSuffix is the highest suffix tried by CollisionAutoSuffix before giving up
+const maxCollisionSuffix = 1000
+
+// ErrRequestTooLarge is returned by UploadFiles when the request body goes over the limit set by MaxFileSize
+var ErrRequestTooLarge = errors.New("the request is too large")
+
+// ErrQuotaExceeded is returned when saving an uploaded file would take its upload directory over MaxDirSize
+var ErrQuotaExceeded = errors.New("the upload directory quota is exceeded")
+
+// ErrNoFileUploaded is returned by UploadOneFile when the request has no files
+var ErrNoFileUploaded = errors.New("no file was uploaded")
+
+// ErrFileTooLarge is matched by the error returned when an uploaded file is over MaxSingleFileSize
+var ErrFileTooLarge = errors.New("the uploaded file is too big")
+
+// ErrFileTooSmall is matched by the error returned when an uploaded file is under MinFileSize
+var ErrFileTooSmall = errors.New("the uploaded file is too small")
+
+// ErrFileTypeNotPermitted is matched by the error returned when the type or extension of an uploaded file is
+// not permitted, or when its extension does not match its type with VerifyExtensionMatchesContent
+var ErrFileTypeNotPermitted = errors.New("the uploaded file type is not permitted")
+
+// ErrChecksumMismatch is matched by the error returned when an uploaded file does not match the checksum sent
+// in the VerifyChecksumHeader header
+var ErrChecksumMismatch = errors.New("the uploaded file does not match its checksum")
+
+// ErrUploadDirUnavailable is matched by the error returned when the upload directory cannot be created
+var ErrUploadDirUnavailable = errors.New("the upload directory is unavailable")
+
+// UploadError is the error returned when an uploaded file is rejected. It matches one of the sentinel errors,
+// such as ErrFileTypeNotPermitted, with errors.Is, and tells which file was rejected
+type UploadError struct {
+	// Err is the sentinel error matched, such as ErrFileTooLarge
+	Err error
+	// FileName is the name of the file, as sent by the client
+	FileName string
+	// FileType is the type detected from the file contents, when it was known
+	FileType string
+	// Limit is the size limit, in bytes, the file went over, or under for ErrFileTooSmall
+	Limit int64
+	// message is the description of the error
+	message string
+}
+
+// Error returns the description of the error
+func (e *UploadError) Error() string {
+	if e.message == "" {
+		return e.Err.Error()
+	}
+	return e.message
+}
+
+// Unwrap returns the sentinel error matched by e
+func (e *UploadError) Unwrap() error {
+	return e.Err
+}
+
+// newUploadError returns an *UploadError for err, described by format and args
+func newUploadError(err error, fileName, fileType, format string, args ...any) error {
+	return &UploadError{Err: err, FileName: fileName, FileType: fileType, message: fmt.Sprintf(format, args...)}
+}
+
+// maxMultipartOverhead is how far the size of a request body may go over MaxFileSize, to allow for the
+// multipart headers and non-file form fields sent along with the files
+const maxMultipartOverhead = 1 << 20
+
 // Tools is the type used to instantiate this module. Any variable of this type will have access to all the methods with the receiver *Tools
 type Tools struct {
+	// MaxFileSize limits the total size of the files uploaded in a request, 1GB when zero. The request body is
+	// cut off once it goes over MaxFileSize, plus 1MB for the multipart headers and form fields, so nothing
+	// larger is ever read, whether or not the client announced its size. This does not apply to a request
+	// parsed by r.ParseMultipartForm before UploadFiles, which has read the whole body already
 	MaxFileSize int
-	// AllowedFileTypes are the ONLY types of files that will be allowed to upload
-	AllowedFileTypes   []string
-	MaxJSONSize        int
-	AllowUnknownFields bool
+	// MaxSingleFileSize limits the size of each uploaded file, independently of MaxFileSize. Zero means no limit
+	MaxSingleFileSize int64
+	// MinFileSize rejects uploaded files smaller than this many bytes, with ErrFileTooSmall, once they are
+	// saved. Zero means no minimum, and 1 rejects empty files even with AllowEmptyFiles
+	MinFileSize int64
+	// MaxUploadCount is the maximum number of files accepted in a single request. Zero means no limit
+	MaxUploadCount int
+	// AllowedFileTypes are the ONLY types of files that will be allowed to upload. Wildcards such as
+	// "image/*" and "*/*" are supported
+	AllowedFileTypes []string
+	// AllowedFileExtensions are the ONLY file name extensions allowed to upload, with or without the leading dot.
+	// When both this and AllowedFileTypes are set, a file must satisfy both. Files without an extension are rejected
+	AllowedFileExtensions []string
+	// DeniedFileTypes are types of files that are never allowed to upload, even if AllowedFileTypes lists them.
+	// Wildcards are supported as in AllowedFileTypes
+	DeniedFileTypes []string
+	// DeniedFileExtensions are file name extensions that are never allowed to upload, even if
+	// AllowedFileExtensions lists them
+	DeniedFileExtensions []string
+	MaxJSONSize          int
+	AllowUnknownFields   bool
+	// EnforceJSONContentType makes ReadJSON reject, with an *ErrUnsupportedMediaType, a request whose
+	// Content-Type is not application/json or a +json type, such as application/hal+json
+	EnforceJSONContentType bool
+	// CaseSensitiveFields makes ReadJSON match the keys of a body to the fields of a struct in the exact case
+	// of their names, where encoding/json ignores the case, so {"ID":1} is not decoded into a field tagged
+	// json:"id". Such a key is rejected with an *ErrUnknownField, or ignored when AllowUnknownFields is set
+	CaseSensitiveFields bool
+	// MaxJSONDepth is the deepest ReadJSON accepts arrays and objects to be nested, when it is not 0. A body
+	// nested deeper is rejected with an *ErrJSONTooDeep before it is decoded
+	MaxJSONDepth int
+	// MaxJSONTokens is the most tokens, such as delimiters, keys and values, ReadJSON accepts in a body, when
+	// it is not 0. A body with more is rejected with an *ErrTooManyJSONTokens before it is decoded
+	MaxJSONTokens int
+	// IndentJSON makes WriteJSON and ErrorJSON indent their output with two spaces, which is easier to read
+	// during development
+	IndentJSON bool
+	// CompressionThreshold is the size, in bytes, over which WriteJSON and ErrorJSON gzip their output, when
+	// the handler is wrapped in NegotiateEncoding and the client accepts gzip, and over which the bodies sent to
+	// remote services are, with CompressRequestBody. It is 1400 bytes when not set
+	CompressionThreshold int
+	// JSONPrefix is written before the JSON of every response, such as )]}',\n to stop a page of another site
+	// from reading an array response through a script tag. Clients must strip it before parsing the JSON
+	JSONPrefix string
+	// ForbidTopLevelArrays makes WriteJSON, and the other writers of JSON, never send an array as the top level
+	// value, which old browsers let a page of another site read through a script tag. An array is wrapped in an
+	// object, as {"items":[...]}, or rejected with ErrTopLevelArray when RejectTopLevelArrays is set. The
+	// JSONResponse of ErrorJSON and WriteEnveloped, or the envelope of WrapResponse, is an object already, so
+	// the data in it is left as it is
+	ForbidTopLevelArrays bool
+	// RejectTopLevelArrays makes ForbidTopLevelArrays reject arrays, with ErrTopLevelArray, rather than wrap them
+	RejectTopLevelArrays bool
+	// ResponseObserver, when set, is called by WriteJSON, ErrorJSON and the other writers of this package once
+	// a response is written, with its status code, the size of its body as sent, and how long encoding the
+	// body took, which does not include writing it
+	ResponseObserver func(status int, bytes int, encodeDuration time.Duration)
+	// JSONOptions change how JSON is encoded, such as the format of times
+	JSONOptions JSONOptions
+	// AlwaysEmitData makes the data key of a JSONResponse written even when Data is nil, as null
+	AlwaysEmitData bool
+	// OmitEmptyMessage leaves the message key out of a JSONResponse whose Message is empty
+	OmitEmptyMessage bool
+	// Debug makes ErrorJSON send the stack of its caller and the errors wrapped by the error it sends in the
+	// Data of the response, which helps during development, but must never be set in production
+	Debug bool
+	// ErrorLogger, when set, is called by ErrorJSONWithRequest with every error it sends, so they can be logged
+	// along with the request they answer, such as its ID
+	ErrorLogger func(r *http.Request, status int, err error)
+	// TranslateError, when set, returns the message ErrorJSONLocalized sends for an error, such as one in the
+	// language the request prefers, which PreferredLanguages tells. An empty message sends err.Error()
+	TranslateError func(r *http.Request, err error) string
+	// UseNumber makes ReadJSON decode numbers into interface values, such as those of a map[string]any, as
+	// json.Number rather than float64, so large integers keep their precision. Numbers decoded into typed
+	// fields, such as an int64, are not affected. GetInt64 and GetFloat64 read them back
+	UseNumber bool
+	// WrapResponse, when set, builds the body ErrorJSON and WriteEnveloped send, in place of a JSONResponse,
+	// from the status code and either the data or the error to send. When it returns nil, a JSONResponse is
+	// sent
+	WrapResponse func(status int, data any, err error) any
+	// HashUploads is the algorithm used to compute the checksum of uploaded files: "sha256", "md5" or "sha1".
+	// When empty, no checksum is computed
+	HashUploads string
+	// VerifyChecksumHeader names a header, such as X-Content-SHA256 or Content-MD5, carrying the checksum of
+	// an uploaded file. When a file is sent with it, either in its part of a multipart form or in the request,
+	// the file is rejected with ErrChecksumMismatch unless its checksum matches. The algorithm is md5 when the
+	// header name mentions it, and sha256 otherwise, unless the value has a "sha256:" or "md5:" prefix. The
+	// digest can be hex or base64 encoded. A checksum in the request header is only meant for a single file
+	VerifyChecksumHeader string
+	// VerifyExtensionMatchesContent rejects uploaded files whose extension is not one expected for their
+	// detected type, such as an executable named photo.jpg. Files without an extension are accepted
+	VerifyExtensionMatchesContent bool
+	// ContentTypeExtensions adds to the extensions expected for a detected type, like "image/jpeg" or "text/*",
+	// when VerifyExtensionMatchesContent is set. Extensions include the dot, as in ".jfif"
+	ContentTypeExtensions map[string][]string
+	// CollisionPolicy decides what happens when an uploaded file has the same name as an existing one. The
+	// default is to overwrite it. Other policies need a Store that implements ExclusiveFileStore
+	CollisionPolicy CollisionPolicy
+	// RenameFunc, when set, names uploaded files instead of the random or original name. It receives the
+	// original file name, stripped of any directory components
+	RenameFunc func(original string) string
+	// RandomNameLength is the number of random characters in the name of renamed uploaded files, between 8
+	// and 64. Zero means 25
+	RandomNameLength int
+	// RandomNamePrefix is put before the random characters in the name of renamed uploaded files, such as
+	// "img_". It cannot contain path separators
+	RandomNamePrefix string
+	// NormalizeFilenames cleans up the original name of files uploaded without renaming them: it is put in
+	// Unicode normalization form C, so a name sent decomposed by macOS is saved like the same name typed
+	// elsewhere, and whitespace, control characters and characters reserved by common file systems are
+	// replaced by hyphens. OriginalFileName keeps the name as it was sent
+	NormalizeFilenames bool
+	// TransliterateFilenames additionally replaces accented letters by the ASCII letters they are based on, and
+	// any other character but ASCII letters, digits, dots and underscores by hyphens, when NormalizeFilenames
+	// is set
+	TransliterateFilenames bool
+	// AllowSubdirectories lets RenameFunc return names containing forward slashes, saving files in
+	// subdirectories of the upload directory, which are created as needed
+	AllowSubdirectories bool
+	// AllowEmptyFiles accepts uploaded files of zero bytes, which are rejected by default
+	AllowEmptyFiles bool
+	// CompressUploads saves text files, and other types that compress well, gzip compressed, under their name
+	// with .gz appended. Images and other types that are compressed already are saved as they are
+	CompressUploads bool
+	// MaxZipEntries is the maximum number of entries in an archive passed to UploadAndExtractZip, 1000 when zero
+	MaxZipEntries int
+	// MaxImageWidth and MaxImageHeight limit the dimensions of uploaded PNG, JPEG and GIF images. Zero means
+	// no limit
+	MaxImageWidth  int
+	MaxImageHeight int
+	// StripEXIF removes the EXIF and XMP metadata (APP1 segments) from uploaded JPEG images, without
+	// re-encoding them. Other files are saved unchanged
+	StripEXIF bool
+	// ScanFunc, when set, is given the full contents of every uploaded file while it is being saved, for virus
+	// scanning and the like. When it returns an error, the file is not saved
+	ScanFunc func(name string, r io.Reader) error
+	// Thumbnail, when set, generates a thumbnail for every uploaded PNG and JPEG image
+	Thumbnail *ThumbnailOptions
+	// UploadConcurrency is the number of files saved at the same time, when the request was parsed by
+	// r.ParseMultipartForm before the upload. Streamed requests are always saved one file at a time
+	UploadConcurrency int
+	// CleanupOnError removes the files already saved by UploadFiles when a later file in the same request fails
+	CleanupOnError bool
+	// MaxDirSize is the maximum total size, in bytes, of the files in an upload directory, including its
+	// subdirectories. Files that would take it over are rejected with ErrQuotaExceeded. Zero means no limit
+	MaxDirSize int64
+	// DirPerm is the mode of directories created for uploads, 0755 by default
+	DirPerm os.FileMode
+	// FilePerm is the mode of uploaded files saved to the local disk, 0666 by default. Both are subject to the umask
+	FilePerm os.FileMode
+	// DedupeByHash names uploaded files after their checksum, computed with HashUploads or sha256, and keeps only
+	// one copy of identical files. The rename option and RenameFunc are ignored, and only the local disk is
+	// supported. Files are still written to a temporary file first, since their checksum is only known at the end
+	DedupeByHash bool
+	// ChunkedUploadDir is the directory the .partial directory, holding the chunks of unfinished chunked
+	// uploads, is created in. When empty, the temporary directory of the system is used
+	ChunkedUploadDir string
+	// Metrics, when set, is told about every uploaded file, and every rejected one
+	Metrics UploadMetrics
+	// AuditFunc, when set, is called once for every uploaded file, once it is saved or rejected, with who sent
+	// it and what happened to it. It is called synchronously, from the goroutine saving the file, so it should
+	// return quickly, for instance by queuing the event, and must be safe for concurrent use when
+	// UploadConcurrency is more than 1
+	AuditFunc func(e UploadEvent)
+	// HTTPClient is the client UploadFromURL downloads files with. When nil, a default client is used
+	HTTPClient *http.Client
+	// RemoteDebug, when set, is called by CallRemote, and the other functions calling remote services, with a
+	// dump of every request before it is sent and of every response, without their bodies, and with the values
+	// of the headers carrying credentials redacted, as RedactHeaders does
+	RemoteDebug func(dump string)
+	// SensitiveHeaders are headers, other than Authorization, Proxy-Authorization, Cookie, Set-Cookie and
+	// X-Api-Key, whose values are redacted from the dumps of RemoteDebug, such as X-Tenant-Token
+	SensitiveHeaders []string
+	// MaxRemoteResponseSize limits the size of the responses PushJSONToRemoteInto decodes, which is MaxJSONSize,
+	// or 1MB, when it is not set
+	MaxRemoteResponseSize int
+	// RemoteRetry, when set, is how calls to remote services are retried, unless the WithRetry option is passed.
+	// Calls are not retried by default
+	RemoteRetry *RetryPolicy
+	// RemoteTimeout limits how long a call to a remote service may take, when no client is passed for it, as
+	// with PushJSONToRemote. It is 30s when not set, where calls used to have no time limit, and a negative
+	// RemoteTimeout removes the limit
+	RemoteTimeout time.Duration
+	// CompressRequestBody makes the calls to remote services send their bodies compressed with gzip, with the
+	// Content-Encoding: gzip header, when they are larger than CompressionThreshold. The service must accept it
+	CompressRequestBody bool
+	// AutoIdempotencyKey makes POST and PATCH calls to remote services send a random Idempotency-Key, the same
+	// on every attempt of a call, unless the WithIdempotencyKey option is passed. IdempotencyKey returns the key
+	// sent, from the response
+	AutoIdempotencyKey bool
+	// FS is the file system uploaded files are saved to, and CreateDirIfNotExists and DownloadStaticFile work
+	// on, when Store is not set. It is the local disk by default. DedupeByHash and MaxDirSize only support the
+	// local disk, and files are written to FS directly, rather than through a temporary file. CollisionError and
+	// CollisionAutoSuffix create files with the CreateNew method of FS, as MemoryFS has, when it has one, and
+	// otherwise check that a file does not exist before creating it, which is only safe within the process
+	FS FileSystem
+	// Store is where uploaded files are saved. When nil, they are written to the upload directory on the local disk
+	Store FileStore
+
+	// YAML is the codec ReadYAML and WriteYAML encode and decode YAML with, which they need to be set
+	YAML YAMLCodec
+	// AllowMultipleYAMLDocs makes ReadYAML accept a body with several documents, and decode the first one,
+	// rather than rejecting it
+	AllowMultipleYAMLDocs bool
+	// MsgPack is the codec ReadMsgPack and WriteMsgPack encode and decode MessagePack with, which they need to
+	// be set
+	MsgPack MsgPackCodec
+
+	// encoders are the encoders added with RegisterEncoder, in the order they were
+	encoders []registeredEncoder
 }
 
 // RandomString Returns a string of random characters of length n, using randomStringSource as the source for the string
@@ -41,8 +348,30 @@ type UploadedFile struct {
 	NewFileName      string
 	OriginalFileName string
 	FileSize         int64
+	// StoredSize is the number of bytes saved, which is less than FileSize when the file was compressed
+	StoredSize int64
+	// ContentType is the type detected from the first 512 bytes of the file
+	ContentType string
+	// ThumbnailName is the name of the thumbnail generated for an image, when Tools.Thumbnail is set
+	ThumbnailName string
+	// Duplicate is true when Tools.DedupeByHash found a file with the same contents in the upload directory,
+	// in which case nothing was written, and NewFileName is the name of the existing file
+	Duplicate bool
+	// thumbnailKey is the key the thumbnail was saved under, so it can be removed along with the file
+	thumbnailKey string
+	// Checksum is the hex encoded hash of the file contents, computed with the algorithm set in Tools.HashUploads
+	Checksum string
+	// StoreKey is the key the file was saved under by the FileStore, which is its path on the local disk by default
+	StoreKey string
+	// SavedPath is where the file was written: its absolute path on the local disk, or its name in the Store
+	SavedPath string
+	// UploadDir is the upload directory the file was saved in
+	UploadDir string
 }
 
+// UploadOneFile uploads the files in the request like UploadFiles, and returns the first one. All the files are
+// saved, so use MaxUploadCount to reject requests with more than one. ErrNoFileUploaded is returned when the
+// request has no files.
 func (t *Tools) UploadOneFile(request *http.Request, uploadDir string, rename ...bool) (*UploadedFile, error) {
 	renameFile := true
 	if len(rename) > 0 {
@@ -52,125 +381,909 @@ func (t *Tools) UploadOneFile(request *http.Request, uploadDir string, rename ..
 	if err != nil {
 		return nil, err
 	}
+	if len(files) == 0 {
+		return nil, ErrNoFileUploaded
+	}
 
 	return files[0], nil
 }
 
-// UploadFiles handles the process of uploading files to the server
+// UploadFiles handles the process of uploading files to the server. It honors the request context,
+// so an upload is aborted if the client goes away.
 func (t *Tools) UploadFiles(r *http.Request, uploadDir string, rename ...bool) ([]*UploadedFile, error) {
+	return t.UploadFilesWithContext(r.Context(), r, uploadDir, rename...)
+}
+
+// UploadFilesWithContext is like UploadFiles, but stops as soon as ctx is cancelled, both while the request
+// body is being read and while files are copied to uploadDir. A partially written file is removed, and
+// ctx.Err() is returned.
+//
+// The multipart body is processed as a stream: each file part is written to disk as it arrives, rather than
+// being buffered in memory or temporary files first. Non-file form fields are collected and made available
+// through r.FormValue, r.PostForm and r.MultipartForm.Value once the upload completes.
+//
+// When a file is rejected, the files saved before it are kept, and returned along with the error, unless
+// CleanupOnError is set.
+//
+// When the request was parsed already, by r.ParseMultipartForm for instance, its files have been buffered, and
+// are saved from there instead, by up to UploadConcurrency workers. All of them are then attempted, and the
+// files saved are returned along with the errors of those that failed.
+//
+// MaxFileSize is a hard limit on the total number of bytes saved from a single request, and an upload going
+// over it fails. Before uploads were streamed, it was the memory threshold passed to ParseMultipartForm, and
+// larger files spilled over to temporary files on disk instead.
+//
+// A request whose Content-Length is more than MaxFileSize, plus 1MB for the multipart headers and form
+// fields, is rejected with ErrRequestTooLarge before any of its body is read, and the body of chunked
+// requests is cut off at the same size. ErrRequestTooLarge is also returned, in place of the former "the
+// uploaded file is too big" error, when the files themselves add up to more than MaxFileSize.
+func (t *Tools) UploadFilesWithContext(ctx context.Context, r *http.Request, uploadDir string, rename ...bool) (uploadedFiles []*UploadedFile, err error) {
 	renameFile := true
 	if len(rename) > 0 {
 		renameFile = rename[0]
 	}
 
-	var uploadedFiles []*UploadedFile
+	// Remove the files saved so far if the upload fails, so the upload directory is left as it was
+	defer func() {
+		if err != nil && t.CleanupOnError {
+			t.deleteUploadedFiles(uploadedFiles)
+			uploadedFiles = nil
+		}
+	}()
 
-	// Set a default MaxFileSize of 1GB if not provided
-	if t.MaxFileSize == 0 {
-		t.MaxFileSize = 1024 * 1024 * 1024
+	maxFileSize := t.maxUploadSize()
+
+	// Reject requests announcing a body that is too large before reading any of it, and cut off those that
+	// don't announce their size, such as chunked requests, once they go over the same limit
+	maxBodySize := maxFileSize + maxMultipartOverhead
+	if r.ContentLength > maxBodySize {
+		t.observeRejection(RejectionTooLarge)
+		return nil, ErrRequestTooLarge
 	}
+	r.Body = http.MaxBytesReader(nil, r.Body, maxBodySize)
+	defer func() {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			err = ErrRequestTooLarge
+		}
+	}()
 
-	err := t.CreateDirIfNotExists(uploadDir)
-	if err != nil {
+	if err := t.prepareUploadDir(uploadDir); err != nil {
 		return nil, err
 	}
 
-	// Parse the multipart form data with a specified max file size
-	err = r.ParseMultipartForm(int64(t.MaxFileSize))
+	// The body of a request that was parsed already has been consumed, but its files are buffered and can be
+	// saved concurrently
+	if r.MultipartForm != nil {
+		return t.uploadParsedFiles(ctx, r, uploadDir, renameFile, maxFileSize)
+	}
+
+	// Read the multipart form data part by part instead of parsing it all up front, aborting if ctx is cancelled
+	r.Body = &contextReadCloser{contextReader: contextReader{ctx: ctx, r: r.Body}, c: r.Body}
+	reader, err := r.MultipartReader()
 	if err != nil {
-		return nil, errors.New("the uploaded file is too big")
-	}
-
-	// Loop through each file header in the multipart form data
-	for _, fHeaders := range r.MultipartForm.File {
-		for _, hdr := range fHeaders {
-			uploadedFiles, err = func(uploadedFiles []*UploadedFile) ([]*UploadedFile, error) {
-				var uploadSingleFile UploadedFile
-
-				// Open the uploaded file for reading
-				infile, err := hdr.Open()
-				if err != nil {
-					return nil, err
-				}
-				defer infile.Close()
-
-				// Read the first 512 bytes of the file to determine its type
-				buff := make([]byte, 512)
-				_, err = infile.Read(buff)
-				if err != nil {
-					return nil, err
-				}
-
-				// Check if the file type is allowed based on the provided AllowedFileTypes
-				allowed := false
-				fileType := http.DetectContentType(buff)
-
-				if len(t.AllowedFileTypes) > 0 {
-					for _, typeOfFile := range t.AllowedFileTypes {
-						if strings.EqualFold(fileType, typeOfFile) {
-							allowed = true
-						}
-					}
-				} else {
-					allowed = true
-				}
-				if !allowed {
-					return nil, errors.New("the uploaded file type is not permitted")
-				}
-
-				// Seek back to the beginning of the file
-				_, err = infile.Seek(0, 0)
-				if err != nil {
-					return nil, err
-				}
-
-				// Generate a new file name and determine the full path for saving
-				if renameFile {
-					uploadSingleFile.NewFileName = fmt.Sprintf("%s%s", t.RandomString(25), filepath.Ext(hdr.Filename))
-				} else {
-					uploadSingleFile.NewFileName = hdr.Filename
-				}
-				uploadSingleFile.OriginalFileName = hdr.Filename
-
-				// Create the new file in the specified upload directory
-				var outfile *os.File
-				defer outfile.Close()
-
-				if outfile, err = os.Create(filepath.Join(uploadDir, uploadSingleFile.NewFileName)); err != nil {
-					return nil, err
-				} else {
-					// Copy the file content to the newly created file and record the file size
-					fileSize, err := io.Copy(outfile, infile)
-					if err != nil {
-						return nil, err
-					}
-					uploadSingleFile.FileSize = fileSize
-				}
-
-				// Append the information of the uploaded file to the list of uploaded files
-				uploadedFiles = append(uploadedFiles, &uploadSingleFile)
-				return uploadedFiles, nil
-			}(uploadedFiles)
+		return nil, err
+	}
+
+	// MaxFileSize limits the total number of bytes saved from a single request
+	remaining := maxFileSize
+	values := make(url.Values)
+	valuesSize := int64(0)
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return uploadedFiles, err
+		}
+
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return uploadedFiles, err
+		}
+
+		// Collect non-file form fields, so they are not lost when the body is consumed
+		if part.FileName() == "" {
+			value, err := io.ReadAll(io.LimitReader(part, maxFormValuesSize-valuesSize+1))
 			if err != nil {
 				return uploadedFiles, err
 			}
+			valuesSize += int64(len(value))
+			if valuesSize > maxFormValuesSize {
+				return uploadedFiles, errors.New("the form values are too big")
+			}
+			values.Add(part.FormName(), string(value))
+			continue
 		}
+
+		file := partInfo{fileName: part.FileName(), fieldName: part.FormName(), checksum: t.checksumHeader(http.Header(part.Header), r.Header), request: r}
+		if t.MaxUploadCount > 0 && len(uploadedFiles) >= t.MaxUploadCount {
+			err := fmt.Errorf("too many files: limit is %d", t.MaxUploadCount)
+			t.observeRejection(RejectionTooManyFiles)
+			t.audit(file, nil, err)
+			return uploadedFiles, err
+		}
+
+		uploadSingleFile, err := t.uploadPart(ctx, file, part, uploadDir, renameFile, remaining)
+		if err != nil {
+			return uploadedFiles, err
+		}
+		remaining -= uploadSingleFile.FileSize
+
+		// Append the information of the uploaded file to the list of uploaded files
+		uploadedFiles = append(uploadedFiles, uploadSingleFile)
+	}
+
+	// Expose the form fields the same way ParseMultipartForm would have
+	r.MultipartForm = &multipart.Form{Value: values, File: make(map[string][]*multipart.FileHeader)}
+	if r.PostForm == nil {
+		r.PostForm = make(url.Values)
+	}
+	if r.Form == nil {
+		r.Form = r.URL.Query()
 	}
+	for key, value := range values {
+		r.PostForm[key] = append(r.PostForm[key], value...)
+		r.Form[key] = append(r.Form[key], value...)
+	}
+
 	return uploadedFiles, nil
 }
 
-// CreateDirIfNotExists creates a directory, and add all necessary parents, if it does not exist
+// uploadParsedFiles saves the files of the multipart form of r, parsed by r.ParseMultipartForm, to uploadDir,
+// using up to UploadConcurrency workers. The files are returned in the order of their form field names, and
+// then of the form, along with the errors of those that failed, joined in the same order.
+func (t *Tools) uploadParsedFiles(ctx context.Context, r *http.Request, uploadDir string, renameFile bool, maxFileSize int64) ([]*UploadedFile, error) {
+	form := r.MultipartForm
+
+	// Form fields are kept in a map, so the order of the files is only preserved within a field
+	fields := make([]string, 0, len(form.File))
+	for field := range form.File {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	var headers []*multipart.FileHeader
+	var files []partInfo
+	total := int64(0)
+	for _, field := range fields {
+		for _, header := range form.File[field] {
+			headers = append(headers, header)
+			files = append(files, partInfo{fileName: header.Filename, fieldName: field, checksum: t.checksumHeader(http.Header(header.Header), r.Header), request: r})
+			total += header.Size
+		}
+	}
+
+	// The sizes of buffered files are known, so the limits are checked before anything is saved
+	var err error
+	switch {
+	case t.MaxUploadCount > 0 && len(headers) > t.MaxUploadCount:
+		t.observeRejection(RejectionTooManyFiles)
+		err = fmt.Errorf("too many files: limit is %d", t.MaxUploadCount)
+	case total > maxFileSize:
+		t.observeRejection(RejectionTooLarge)
+		err = ErrRequestTooLarge
+	}
+	if err != nil {
+		for _, file := range files {
+			t.audit(file, nil, err)
+		}
+		return nil, err
+	}
+
+	workers := t.UploadConcurrency
+	if workers < 1 {
+		workers = 1
+	}
+	workers = min(workers, len(headers))
+
+	uploaded := make([]*UploadedFile, len(headers))
+	errs := make([]error, len(headers))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				uploaded[i], errs[i] = t.uploadFileHeader(ctx, files[i], headers[i], uploadDir, renameFile, maxFileSize)
+			}
+		}()
+	}
+	for i := range headers {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	var uploadedFiles []*UploadedFile
+	for _, f := range uploaded {
+		if f != nil {
+			uploadedFiles = append(uploadedFiles, f)
+		}
+	}
+	return uploadedFiles, errors.Join(errs...)
+}
+
+// uploadFileHeader saves file, buffered by r.ParseMultipartForm in header, to uploadDir
+func (t *Tools) uploadFileHeader(ctx context.Context, file partInfo, header *multipart.FileHeader, uploadDir string, renameFile bool, maxSize int64) (*UploadedFile, error) {
+	if err := ctx.Err(); err != nil {
+		t.audit(file, nil, err)
+		return nil, err
+	}
+	f, err := header.Open()
+	if err != nil {
+		t.audit(file, nil, err)
+		return nil, err
+	}
+	defer f.Close()
+
+	return t.uploadPart(ctx, file, f, uploadDir, renameFile, maxSize)
+}
+
+// maxFormValuesSize is the maximum number of bytes accepted for the non-file fields of a multipart form
+const maxFormValuesSize = 10 << 20
+
+// partInfo describes a file being uploaded, as the client sent it
+type partInfo struct {
+	// fileName is the original name of the file
+	fileName string
+	// declaredType is the type the client claims the file has, which is only used when its contents don't
+	// reveal a more specific one, or empty
+	declaredType string
+	// checksum is the value of the VerifyChecksumHeader header sent with the file, or empty
+	checksum string
+	// fieldName is the name of the form field the file was sent in, if any
+	fieldName string
+	// request is the request the file was sent with, if any
+	request *http.Request
+}
+
+// uploadPart saves a single file of a multipart form, described by file and read from part, to uploadDir,
+// refusing to write more than maxSize bytes. The outcome is reported to Metrics and AuditFunc, when set
+func (t *Tools) uploadPart(ctx context.Context, file partInfo, part io.Reader, uploadDir string, renameFile bool, maxSize int64) (*UploadedFile, error) {
+	if t.Metrics == nil && t.AuditFunc == nil {
+		return t.savePart(ctx, file, part, uploadDir, renameFile, maxSize)
+	}
+
+	start := time.Now()
+	uploadedFile, err := t.savePart(ctx, file, part, uploadDir, renameFile, maxSize)
+	t.audit(file, uploadedFile, err)
+	if err != nil {
+		t.observeRejection(rejectionReason(err))
+		return nil, err
+	}
+	if t.Metrics != nil {
+		t.Metrics.ObserveUpload(uploadedFile.NewFileName, uploadedFile.FileSize, time.Since(start))
+	}
+	return uploadedFile, nil
+}
+
+// savePart does the work of uploadPart
+func (t *Tools) savePart(ctx context.Context, file partInfo, part io.Reader, uploadDir string, renameFile bool, maxSize int64) (*UploadedFile, error) {
+	var uploadSingleFile UploadedFile
+	fileName := file.fileName
+
+	// Check the file extension against DeniedFileExtensions, which wins over AllowedFileExtensions
+	if extensionMatches(fileName, t.DeniedFileExtensions) {
+		return nil, newUploadError(ErrFileTypeNotPermitted, fileName, "", "the uploaded file extension %s is not permitted", filepath.Ext(fileName))
+	}
+
+	// Check if the file extension is allowed based on the provided AllowedFileExtensions
+	if len(t.AllowedFileExtensions) > 0 && !extensionMatches(fileName, t.AllowedFileExtensions) {
+		return nil, newUploadError(ErrFileTypeNotPermitted, fileName, "", "the uploaded file extension is not permitted")
+	}
+
+	// Read the first 512 bytes of the file to determine its type. Smaller files are sniffed from the bytes
+	// they have, and empty files are rejected unless AllowEmptyFiles is set
+	buff := make([]byte, 512)
+	n, err := io.ReadFull(part, buff)
+	switch {
+	case err == io.EOF && !t.AllowEmptyFiles:
+		return nil, fmt.Errorf("the uploaded file %q is empty", fileName)
+	case err != nil && err != io.EOF && err != io.ErrUnexpectedEOF:
+		return nil, err
+	}
+	buff = buff[:n]
+
+	// Check the file type against DeniedFileTypes, which wins over AllowedFileTypes
+	fileType := http.DetectContentType(buff)
+	if fileType == "application/octet-stream" && file.declaredType != "" {
+		fileType = mediaType(file.declaredType)
+	}
+	for _, typeOfFile := range t.DeniedFileTypes {
+		if fileTypeMatches(fileType, typeOfFile) {
+			return nil, newUploadError(ErrFileTypeNotPermitted, fileName, fileType, "the uploaded file type %s is not permitted", fileType)
+		}
+	}
+
+	// Check if the file type is allowed based on the provided AllowedFileTypes
+	allowed := false
+
+	if len(t.AllowedFileTypes) > 0 {
+		for _, typeOfFile := range t.AllowedFileTypes {
+			if fileTypeMatches(fileType, typeOfFile) {
+				allowed = true
+			}
+		}
+	} else {
+		allowed = true
+	}
+	if !allowed {
+		return nil, newUploadError(ErrFileTypeNotPermitted, fileName, fileType, "the uploaded file type is not permitted")
+	}
+
+	// Check that the extension of the file is one expected for its detected type, so it cannot mislead
+	// whoever uses the file later
+	if t.VerifyExtensionMatchesContent {
+		if err := t.verifyExtension(fileName, fileType); err != nil {
+			return nil, err
+		}
+	}
+
+	// Generate a new file name and determine the full path for saving. The original name is sanitized, so
+	// that it cannot be used to write outside of the upload directory
+	safeFileName, err := sanitizeFileName(fileName)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case t.DedupeByHash:
+		// The file is renamed after its checksum once it has been saved
+		if !t.onLocalDisk() {
+			return nil, errors.New("DedupeByHash is only supported when saving to the local disk")
+		}
+		uploadSingleFile.NewFileName = ".dedupe-" + t.RandomString(25)
+	case t.RenameFunc != nil:
+		uploadSingleFile.NewFileName = t.RenameFunc(safeFileName)
+		if err := validateNewFileName(uploadSingleFile.NewFileName, t.AllowSubdirectories); err != nil {
+			return nil, err
+		}
+	case renameFile:
+		uploadSingleFile.NewFileName, err = t.randomFileName(safeFileName)
+		if err != nil {
+			return nil, err
+		}
+	case t.NormalizeFilenames:
+		uploadSingleFile.NewFileName = normalizeFileName(safeFileName, t.TransliterateFilenames)
+	default:
+		uploadSingleFile.NewFileName = safeFileName
+	}
+	uploadSingleFile.OriginalFileName = fileName
+
+	// Save the file in the specified upload directory of the store, which is the local disk by default
+	store := t.fileStore()
+
+	// Copy the sniffed bytes and the rest of the part to the store and record the file size,
+	// removing the saved file if it goes over the size limit
+	limit := maxSize
+	if t.MaxSingleFileSize > 0 && t.MaxSingleFileSize < limit {
+		limit = t.MaxSingleFileSize
+	}
+
+	// Keep the upload directory within MaxDirSize. This is best effort: files being saved at the same time,
+	// by other requests, are not accounted for, so the quota may be exceeded by them
+	var dirUsage int64
+	quotaLimited := false
+	if t.MaxDirSize > 0 {
+		if !t.onLocalDisk() {
+			return nil, errors.New("MaxDirSize is only supported when saving to the local disk")
+		}
+		dirUsage, err = t.DirSize(uploadDir)
+		if err != nil {
+			return nil, err
+		}
+		if quota := max(t.MaxDirSize-dirUsage, 0); quota < limit {
+			limit = quota
+			quotaLimited = true
+		}
+	}
+	content := io.MultiReader(bytes.NewReader(buff), part)
+
+	// Check the dimensions of images from their header, before the rest of the file is copied
+	if (t.MaxImageWidth > 0 || t.MaxImageHeight > 0) && strings.HasPrefix(fileType, "image/") {
+		content, err = t.checkImageDimensions(uploadSingleFile.OriginalFileName, content)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Hash the file as it was sent, to compare it with the checksum sent along with it
+	var verifier *checksumVerifier
+	if file.checksum != "" {
+		verifier, err = newChecksumVerifier(t.VerifyChecksumHeader, file.checksum)
+		if err != nil {
+			return nil, err
+		}
+		content = io.TeeReader(content, verifier.hash)
+	}
+
+	// Remove metadata from JPEG images, before anything else sees the file contents
+	if t.StripEXIF && fileType == "image/jpeg" {
+		content = newEXIFStripper(content)
+	}
+
+	// Hash the file while it is being saved, rather than reading it again afterwards
+	var hasher hash.Hash
+	if t.HashUploads != "" || t.DedupeByHash {
+		hasher, err = newHash(t.hashAlgorithm())
+		if err != nil {
+			return nil, err
+		}
+		content = io.TeeReader(content, hasher)
+	}
+
+	// Decode images while they are being saved, to generate their thumbnail
+	var thumbnails *thumbnailer
+	if t.Thumbnail != nil && (fileType == "image/png" || fileType == "image/jpeg") {
+		thumbnails = newThumbnailer()
+		content = io.TeeReader(content, thumbnails)
+	}
+
+	// Scan the contents while they are being saved. A rejected file fails to save, so it never lands in the store
+	var scanner *scanningReader
+	if t.ScanFunc != nil {
+		scanner = newScanningReader(uploadSingleFile.OriginalFileName, content, t.ScanFunc)
+		content = scanner
+	}
+
+	// Compress text files as they are saved, under the name of the file with .gz appended
+	var source io.Reader = &contextReader{ctx: ctx, r: io.LimitReader(content, limit+1)}
+	var compressor *gzipReader
+	if t.CompressUploads && compressible(fileType) {
+		compressor = newGzipReader(source)
+		source = compressor
+		uploadSingleFile.NewFileName += ".gz"
+	}
+
+	key, fileSize, err := t.saveToStore(store, uploadDir, &uploadSingleFile, source)
+	storedSize := fileSize
+	if compressor != nil {
+		fileSize = compressor.finish()
+	}
+	if scanner != nil {
+		if scanErr := scanner.finish(errScanAborted); scanErr != nil && !errors.Is(scanErr, errScanAborted) {
+			if err == nil {
+				_ = store.Delete(key)
+			}
+			err = fmt.Errorf("the uploaded file %q was rejected by the scanner: %w", uploadSingleFile.OriginalFileName, scanErr)
+		}
+	}
+	var img image.Image
+	var imgFormat string
+	var decodeErr error
+	if thumbnails != nil {
+		img, imgFormat, decodeErr = thumbnails.finish(err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if fileSize > limit {
+		_ = store.Delete(key)
+		if quotaLimited {
+			return nil, fmt.Errorf("%w: %d of %d bytes are used", ErrQuotaExceeded, dirUsage, t.MaxDirSize)
+		}
+		if limit < maxSize {
+			return nil, &UploadError{Err: ErrFileTooLarge, FileName: fileName, FileType: fileType, Limit: limit,
+				message: fmt.Sprintf("the uploaded file %q is too big (limit is %s)", uploadSingleFile.OriginalFileName, HumanizeBytes(limit))}
+		}
+		return nil, ErrRequestTooLarge
+	}
+	if fileSize < t.MinFileSize {
+		_ = store.Delete(key)
+		return nil, &UploadError{Err: ErrFileTooSmall, FileName: fileName, FileType: fileType, Limit: t.MinFileSize,
+			message: fmt.Sprintf("the uploaded file %q is too small (minimum is %s)", uploadSingleFile.OriginalFileName, HumanizeBytes(t.MinFileSize))}
+	}
+	if verifier != nil {
+		if err := verifier.verify(); err != nil {
+			_ = store.Delete(key)
+			return nil, newUploadError(ErrChecksumMismatch, fileName, fileType, "the uploaded file %q does not match its checksum: %s", uploadSingleFile.OriginalFileName, err)
+		}
+	}
+	uploadSingleFile.FileSize = fileSize
+	uploadSingleFile.StoredSize = storedSize
+	uploadSingleFile.ContentType = fileType
+	if hasher != nil {
+		uploadSingleFile.Checksum = hex.EncodeToString(hasher.Sum(nil))
+	}
+
+	// Move the file to its content addressed name, or drop it if the same contents were uploaded before
+	if t.DedupeByHash {
+		ext := filepath.Ext(safeFileName)
+		if compressor != nil {
+			ext += ".gz"
+		}
+		key, err = t.storeByChecksum(uploadDir, &uploadSingleFile, key, ext)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	uploadSingleFile.StoreKey = key
+	uploadSingleFile.UploadDir = uploadDir
+	uploadSingleFile.SavedPath = path.Join(filepath.ToSlash(uploadDir), uploadSingleFile.NewFileName)
+	if t.Store == nil {
+		uploadSingleFile.SavedPath = key
+	}
+
+	// Generate the thumbnail of images, removing the saved file if that fails
+	if thumbnails != nil {
+		if decodeErr == nil {
+			err = t.saveThumbnail(store, uploadDir, &uploadSingleFile, img, imgFormat)
+		} else {
+			err = fmt.Errorf("could not decode image %q: %w", uploadSingleFile.OriginalFileName, decodeErr)
+		}
+		if err != nil {
+			if !uploadSingleFile.Duplicate {
+				_ = store.Delete(key)
+			}
+			return nil, err
+		}
+	}
+
+	return &uploadSingleFile, nil
+}
+
+// fileTypeMatches reports whether fileType matches pattern, which is either a full type like "image/png",
+// or a wildcard like "image/*" or "*/*". The comparison is case-insensitive, and ignores parameters such as
+// the charset in "text/plain; charset=utf-8"
+func fileTypeMatches(fileType, pattern string) bool {
+	fileType, pattern = mediaType(fileType), mediaType(pattern)
+	if fileType == pattern || pattern == "*/*" {
+		return true
+	}
+
+	major, sub, ok := strings.Cut(pattern, "/")
+	if !ok || sub != "*" {
+		return false
+	}
+	fileMajor, _, _ := strings.Cut(fileType, "/")
+	return major == fileMajor
+}
+
+// defaultContentTypeExtensions are the extensions expected for types detected by http.DetectContentType that
+// the mime package may not know about, depending on the system
+var defaultContentTypeExtensions = map[string][]string{
+	"text/plain":      {".txt", ".text", ".log", ".csv", ".md"},
+	"application/zip": {".zip"},
+}
+
+// verifyExtension fails if the extension of fileName is not one of those expected for fileType, according to
+// the mime package, defaultContentTypeExtensions and ContentTypeExtensions. Files without an extension pass.
+func (t *Tools) verifyExtension(fileName, fileType string) error {
+	ext := strings.ToLower(filepath.Ext(fileName))
+	if ext == "" {
+		return nil
+	}
+
+	detected := mediaType(fileType)
+	expected, _ := mime.ExtensionsByType(detected)
+	expected = append(expected, defaultContentTypeExtensions[detected]...)
+	for pattern, extensions := range t.ContentTypeExtensions {
+		if fileTypeMatches(detected, pattern) {
+			expected = append(expected, extensions...)
+		}
+	}
+	for _, e := range expected {
+		if strings.EqualFold(ext, e) {
+			return nil
+		}
+	}
+	return newUploadError(ErrFileTypeNotPermitted, fileName, fileType, "the uploaded file %q has the extension %s, which does not match its detected type %s", fileName, ext, detected)
+}
+
+// mediaType returns the lower case media type of a MIME type, without its parameters
+func mediaType(mimeType string) string {
+	if mediaType, _, err := mime.ParseMediaType(mimeType); err == nil {
+		return mediaType
+	}
+	mimeType, _, _ = strings.Cut(mimeType, ";")
+	return strings.ToLower(strings.TrimSpace(mimeType))
+}
+
+// checkImageDimensions decodes the image header at the start of content, and fails if the image is wider than
+// MaxImageWidth or taller than MaxImageHeight. It returns a reader yielding all of content again. Images in a
+// format without a registered decoder are not checked.
+func (t *Tools) checkImageDimensions(fileName string, content io.Reader) (io.Reader, error) {
+	var header bytes.Buffer
+	config, _, err := image.DecodeConfig(io.TeeReader(content, &header))
+	content = io.MultiReader(&header, content)
+	if errors.Is(err, image.ErrFormat) {
+		return content, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not decode image %q: %w", fileName, err)
+	}
+
+	if t.MaxImageWidth > 0 && config.Width > t.MaxImageWidth {
+		return nil, fmt.Errorf("the uploaded image %q is %dx%d, wider than the allowed %d pixels",
+			fileName, config.Width, config.Height, t.MaxImageWidth)
+	}
+	if t.MaxImageHeight > 0 && config.Height > t.MaxImageHeight {
+		return nil, fmt.Errorf("the uploaded image %q is %dx%d, taller than the allowed %d pixels",
+			fileName, config.Width, config.Height, t.MaxImageHeight)
+	}
+	return content, nil
+}
+
+// maxUploadSize returns MaxFileSize, or a default of 1GB if not provided. The default is not stored in t,
+// which may be shared between handlers
+func (t *Tools) maxUploadSize() int64 {
+	if t.MaxFileSize == 0 {
+		return 1024 * 1024 * 1024
+	}
+	return int64(t.MaxFileSize)
+}
+
+// prepareUploadDir creates uploadDir, when files are saved to the local disk
+func (t *Tools) prepareUploadDir(uploadDir string) error {
+	if t.Store != nil {
+		return nil
+	}
+	if err := t.CreateDirIfNotExists(uploadDir); err != nil {
+		return fmt.Errorf("%w: %w", ErrUploadDirUnavailable, err)
+	}
+	return nil
+}
+
+// hashAlgorithm returns the algorithm used to hash uploaded files, which is sha256 unless HashUploads is set
+func (t *Tools) hashAlgorithm() string {
+	if t.HashUploads != "" {
+		return t.HashUploads
+	}
+	return "sha256"
+}
+
+// storeByChecksum renames the file saved at key, in uploadDir on the local disk, after its checksum and ext.
+// When a file of that name already exists, it has the same contents, so the new copy is removed and the upload
+// is marked as a duplicate. It returns the path of the file.
+func (t *Tools) storeByChecksum(uploadDir string, uploadedFile *UploadedFile, key, ext string) (string, error) {
+	name := uploadedFile.Checksum + strings.ToLower(ext)
+	finalPath, err := filepath.Abs(filepath.Join(uploadDir, name))
+	if err != nil {
+		_ = os.Remove(key)
+		return "", err
+	}
+
+	if _, err := os.Lstat(finalPath); err == nil {
+		_ = os.Remove(key)
+		uploadedFile.Duplicate = true
+	} else if err := os.Rename(key, finalPath); err != nil {
+		_ = os.Remove(key)
+		return "", err
+	}
+	uploadedFile.NewFileName = name
+	return finalPath, nil
+}
+
+// fileStore returns the FileStore uploaded files are saved to, which is the local disk unless Store or FS is set
+func (t *Tools) fileStore() FileStore {
+	if t.Store != nil {
+		return t.Store
+	}
+	if t.FS != nil {
+		return fsStore{fs: t.FS, dirPerm: t.dirPerm()}
+	}
+	return DiskStore{DirPerm: t.DirPerm, FilePerm: t.FilePerm}
+}
+
+// deleteUploadedFiles removes files that were saved by an upload from the store, ignoring errors
+func (t *Tools) deleteUploadedFiles(files []*UploadedFile) {
+	store := t.fileStore()
+	for _, f := range files {
+		// A duplicate points to a file saved by an earlier upload, which must be kept
+		if f.Duplicate {
+			continue
+		}
+		_ = store.Delete(f.StoreKey)
+		if f.thumbnailKey != "" {
+			_ = store.Delete(f.thumbnailKey)
+		}
+	}
+}
+
+// saveToStore saves r to store as uploadedFile.NewFileName in uploadDir, applying the CollisionPolicy. With
+// CollisionAutoSuffix, NewFileName is updated to the name the file was actually saved as.
+func (t *Tools) saveToStore(store FileStore, uploadDir string, uploadedFile *UploadedFile, r io.Reader) (string, int64, error) {
+	dir := filepath.ToSlash(uploadDir)
+	if t.CollisionPolicy == CollisionOverwrite {
+		return store.Save(path.Join(dir, uploadedFile.NewFileName), r)
+	}
+
+	exclusive, ok := store.(ExclusiveFileStore)
+	if !ok {
+		return "", 0, errors.New("the file store does not support collision policies")
+	}
+
+	// Try the original name first, and then name-1.ext, name-2.ext and so on. Creating the file exclusively
+	// makes this safe against concurrent uploads of the same name
+	fileName := uploadedFile.NewFileName
+	ext := filepath.Ext(fileName)
+	stem := strings.TrimSuffix(fileName, ext)
+	for i := 0; i <= maxCollisionSuffix; i++ {
+		candidate := fileName
+		if i > 0 {
+			candidate = fmt.Sprintf("%s-%d%s", stem, i, ext)
+		}
+
+		key, size, err := exclusive.SaveNew(path.Join(dir, candidate), r)
+		if errors.Is(err, os.ErrExist) {
+			if t.CollisionPolicy == CollisionError {
+				return "", 0, fmt.Errorf("a file named %q already exists", fileName)
+			}
+			continue
+		}
+		if err != nil {
+			return "", 0, err
+		}
+		uploadedFile.NewFileName = candidate
+		return key, size, nil
+	}
+	return "", 0, fmt.Errorf("could not find a free name for %q", fileName)
+}
+
+// The bounds of RandomNameLength, and the length used when it is zero
+const (
+	defaultRandomNameLength = 25
+	minRandomNameLength     = 8
+	maxRandomNameLength     = 64
+)
+
+// randomFileName returns a random name for the file fileName, made of RandomNamePrefix, RandomNameLength
+// random characters and the extension of fileName in lower case
+func (t *Tools) randomFileName(fileName string) (string, error) {
+	length := t.RandomNameLength
+	if length == 0 {
+		length = defaultRandomNameLength
+	}
+	if length < minRandomNameLength || length > maxRandomNameLength {
+		return "", fmt.Errorf("RandomNameLength must be between %d and %d, not %d", minRandomNameLength, maxRandomNameLength, length)
+	}
+	if strings.ContainsAny(t.RandomNamePrefix, "/\\\x00") {
+		return "", fmt.Errorf("invalid RandomNamePrefix %q: it cannot contain path separators", t.RandomNamePrefix)
+	}
+	return t.RandomNamePrefix + t.RandomString(length) + strings.ToLower(filepath.Ext(fileName)), nil
+}
+
+// sanitizeFileName strips any directory components from a client supplied file name, treating both forward and
+// backward slashes as separators, and rejects names that are empty, "." or "..", or contain NUL bytes
+func sanitizeFileName(name string) (string, error) {
+	if strings.ContainsRune(name, 0) {
+		return "", errors.New("the uploaded file name is not valid")
+	}
+
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || name == ".." || name == "/" || name == "" {
+		return "", errors.New("the uploaded file name is not valid")
+	}
+	return name, nil
+}
+
+// validateNewFileName checks a name returned by a RenameFunc. Path separators are only accepted when
+// allowSubdirectories is true, and then only forward slashes in a relative path that stays inside the upload
+// directory
+func validateNewFileName(name string, allowSubdirectories bool) error {
+	if name == "" || strings.ContainsAny(name, "\\\x00") {
+		return fmt.Errorf("invalid file name %q returned by RenameFunc", name)
+	}
+	if strings.Contains(name, "/") && !allowSubdirectories {
+		return fmt.Errorf("file name %q returned by RenameFunc contains a path separator", name)
+	}
+	for _, segment := range strings.Split(name, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return fmt.Errorf("invalid file name %q returned by RenameFunc", name)
+		}
+	}
+	return nil
+}
+
+// extensionMatches reports whether the extension of fileName is one of extensions, ignoring case and leading dots
+func extensionMatches(fileName string, extensions []string) bool {
+	ext := strings.TrimPrefix(filepath.Ext(fileName), ".")
+	if ext == "" {
+		return false
+	}
+	for _, allowed := range extensions {
+		if strings.EqualFold(ext, strings.TrimPrefix(allowed, ".")) {
+			return true
+		}
+	}
+	return false
+}
+
+// newHash returns a new hash.Hash for the algorithm name, which is one of "sha256", "md5" or "sha1"
+func newHash(name string) (hash.Hash, error) {
+	switch strings.ToLower(name) {
+	case "sha256":
+		return sha256.New(), nil
+	case "md5":
+		return md5.New(), nil
+	case "sha1":
+		return sha1.New(), nil
+	default:
+		return nil, fmt.Errorf("unsupported hash algorithm %q", name)
+	}
+}
+
+// contextReader is an io.Reader that fails with the context's error once the context is done
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+// Read checks the context before every read from the underlying reader
+func (cr *contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
+
+// contextReadCloser is a contextReader that keeps the Close method of the reader it wraps
+type contextReadCloser struct {
+	contextReader
+	c io.Closer
+}
+
+// Close closes the underlying reader
+func (crc *contextReadCloser) Close() error {
+	return crc.c.Close()
+}
+
+// CreateDirIfNotExists creates a directory, and add all necessary parents, if it does not exist. New directories
+// get the mode set in DirPerm, or 0755 by default
 func (t *Tools) CreateDirIfNotExists(path string) error {
-	const mode = 0755
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		err := os.MkdirAll(path, mode)
+	fileSystem := t.fileSystem()
+	info, err := fileSystem.Stat(path)
+	if os.IsNotExist(err) {
+		err := fileSystem.MkdirAll(path, t.dirPerm())
 		if err != nil {
 			return err
 		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", path)
 	}
 	return nil
 }
 
+// dirPerm returns the mode of created directories, set in DirPerm, or 0755 by default
+func (t *Tools) dirPerm() os.FileMode {
+	if t.DirPerm != 0 {
+		return t.DirPerm
+	}
+	return 0755
+}
+
+// DirSize returns the total size of the regular files in the directory path, including its subdirectories
+func (t *Tools) DirSize(path string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		// Files may be removed while the directory is walked, such as the temporary files of other uploads
+		info, err := d.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	return size, err
+}
+
 // Slugify is a simple mean of creating a slug from a string
 func (t *Tools) Slugify(s string) (string, error) {
 	if s == "" {
@@ -188,9 +1301,31 @@ func (t *Tools) Slugify(s string) (string, error) {
 // in the browser windows by setting content disposition. It also allows specification of the
 // display name.
 func (t *Tools) DownloadStaticFile(writer http.ResponseWriter, request *http.Request, pathName, displayName string) {
-	writer.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", displayName))
+	writer.Header().Set("Content-Disposition", attachmentDisposition(displayName))
+
+	if t.FS == nil {
+		http.ServeFile(writer, request, pathName)
+		return
+	}
 
-	http.ServeFile(writer, request, pathName)
+	// Serve the file from FS, which needs it to be seekable to answer range requests
+	info, err := t.FS.Stat(pathName)
+	if err != nil || info.IsDir() {
+		http.NotFound(writer, request)
+		return
+	}
+	f, err := t.FS.Open(pathName)
+	if err != nil {
+		http.NotFound(writer, request)
+		return
+	}
+	defer f.Close()
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		http.Error(writer, "the file cannot be served", http.StatusInternalServerError)
+		return
+	}
+	http.ServeContent(writer, request, info.Name(), info.ModTime(), content)
 }
 
 // JSONResponse is the type used for sending JSON around
@@ -198,88 +1333,342 @@ type JSONResponse struct {
 	Error   bool        `json:"error"`
 	Message string      `json:"message"`
 	Data    interface{} `json:"data,omitempty"`
+	// Code is a stable, machine readable code for an error, such as "user_not_found"
+	Code string `json:"code,omitempty"`
+}
+
+// ErrorCoder is implemented by errors that carry the code ErrorJSON sends in JSONResponse.Code
+type ErrorCoder interface {
+	ErrorCode() string
 }
 
-// ReadJSON tries to read the body of a request and converts from json into a go data variable
+// ReadJSON tries to read the body of a request and converts from json into a go data variable. A body compressed
+// with gzip or deflate, as its Content-Encoding says, is decompressed, and limited to MaxJSONSize once
+// decompressed. Fields of a struct with a default tag, as in `default:"10"` or `default:"30s"` for a
+// time.Duration, are set to it when the body leaves them out and they are still zero, before validation; a
+// pointer field is allocated for it. When data implements Validator or FieldValidator, it is validated once
+// decoded, and a *ValidationError is returned if it is not valid. Reading stops once the context of the request
+// is canceled, or its deadline passes, with an error matching ErrReadTimeout for the latter, rather than waiting
+// for a body sent very slowly. The errors about the body match ErrBodyTooLarge, ErrEmptyBody,
+// ErrMultipleJSONValues, ErrInvalidBodyEncoding or ErrUnsupportedContentEncoding with errors.Is, or are an
+// *ErrMalformedJSON, *ErrUnknownField, *ErrWrongType, *ErrJSONTooDeep, *ErrTooManyJSONTokens or
+// *ErrUnsupportedMediaType, and JSONErrorStatus tells which status code to respond with
 func (t *Tools) ReadJSON(writer http.ResponseWriter, request *http.Request, data interface{}) error {
-	maxBytes := 1024 * 1024 // 1MB
-	if t.MaxJSONSize != 0 {
-		maxBytes = t.MaxJSONSize
+	body, err := t.jsonBody(writer, request)
+	if err != nil {
+		return err
 	}
-	request.Body = http.MaxBytesReader(writer, request.Body, int64(maxBytes))
+	return t.DecodeJSON(body, data)
+}
 
-	decode := json.NewDecoder(request.Body)
+// jsonBody checks the Content-Type of request, when EnforceJSONContentType is set, and returns its body,
+// limited to MaxJSONSize and decompressed. The decompressed body still has to be limited, as DecodeJSON does
+func (t *Tools) jsonBody(writer http.ResponseWriter, request *http.Request) (io.Reader, error) {
+	if t.EnforceJSONContentType {
+		if err := checkJSONContentType(request); err != nil {
+			return nil, err
+		}
+	}
+	request.Body = http.MaxBytesReader(writer, request.Body, int64(t.maxJSONSize()))
+	return requestBody(request)
+}
 
-	if !t.AllowUnknownFields {
-		decode.DisallowUnknownFields()
+// requestBody returns the body of request decompressed, as its Content-Encoding says, and read only until the
+// context of request is done
+func requestBody(request *http.Request) (io.Reader, error) {
+	// The context of the request is checked between reads, so a body sent very slowly does not hold the
+	// handler once the request is canceled or its deadline passes
+	if request.Context().Done() != nil {
+		request.Body = &contextReadCloser{contextReader: contextReader{ctx: request.Context(), r: request.Body}, c: request.Body}
 	}
+	return decompressedBody(request)
+}
 
-	err := decode.Decode(data)
-	if err != nil {
-		var syntaxError *json.SyntaxError
-		var unmarshalTypeError *json.UnmarshalTypeError
-		var invalidUnmarshalError *json.InvalidUnmarshalError
+// DecodeJSON reads a single JSON value from r into data, with the same limits, validation and errors as
+// ReadJSON, for bodies that do not come from an HTTP request, such as queued messages or files
+func (t *Tools) DecodeJSON(r io.Reader, data any) error {
+	limit := int64(t.maxJSONSize())
+	if err := t.decodeJSON(&jsonLimitReader{r: io.LimitReader(r, limit+1), limit: limit}, data); err != nil {
+		return err
+	}
+	return validate(data)
+}
 
-		switch {
-		case errors.As(err, &syntaxError):
-			return fmt.Errorf("body contains badly-formed JSON (at character %d)", syntaxError.Offset)
+// jsonLimitReader reads from r, which is limited to one byte more than limit, and fails with an
+// *http.MaxBytesError, as the body of ReadJSON does, once more than limit bytes are read
+type jsonLimitReader struct {
+	r     io.Reader
+	limit int64
+	read  int64
+}
 
-		case errors.Is(err, io.ErrUnexpectedEOF):
-			return errors.New("body contains badly-formed JSON")
+func (l *jsonLimitReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	if l.read > l.limit {
+		return n - int(l.read-l.limit), &http.MaxBytesError{Limit: l.limit}
+	}
+	return n, err
+}
 
-		case errors.As(err, &unmarshalTypeError):
-			if unmarshalTypeError.Field != "" {
-				return fmt.Errorf("body contains incorrect JSON type for field %q", unmarshalTypeError.Field)
-			}
-			return fmt.Errorf("body contains incorrect JSON type (at character %d)", unmarshalTypeError.Offset)
+// maxJSONSize returns MaxJSONSize, or 1MB when it is not set
+func (t *Tools) maxJSONSize() int {
+	if t.MaxJSONSize != 0 {
+		return t.MaxJSONSize
+	}
+	return 1024 * 1024
+}
 
-		case errors.Is(err, io.EOF):
-			return errors.New("body must not be empty")
+// decodeJSON decodes the single JSON value read from r into data, as ReadJSON does
+func (t *Tools) decodeJSON(r io.Reader, data any) error {
+	defaults, err := structDefaults(data)
+	if err != nil {
+		return err
+	}
 
-		case strings.HasPrefix(err.Error(), "json: unknown field"):
-			fieldName := strings.TrimPrefix(err.Error(), "json: unknown field")
-			return fmt.Errorf("body contains unknown key %s", fieldName)
+	// The limits on the structure of the value, and the case of its keys, are checked before decoding it, and
+	// defaults are applied to the fields it leaves out once it is decoded, which needs it in memory
+	var body []byte
+	if t.MaxJSONDepth > 0 || t.MaxJSONTokens > 0 || t.CaseSensitiveFields || len(defaults) > 0 {
+		if body, err = io.ReadAll(r); err != nil {
+			return jsonDecodeError(err)
+		}
+		if t.MaxJSONDepth > 0 || t.MaxJSONTokens > 0 {
+			if err := t.checkJSONLimits(body); err != nil {
+				return err
+			}
+		}
+		if typ := reflect.TypeOf(data); t.CaseSensitiveFields && typ != nil {
+			if body, err = t.matchFieldCase(body, typ); err != nil {
+				return err
+			}
+		}
+		r = bytes.NewReader(body)
+	}
 
-		case err.Error() == "http: request body too large":
-			return fmt.Errorf("body must not be larger than %d", maxBytes)
+	decode := json.NewDecoder(r)
 
-		case errors.As(err, &invalidUnmarshalError):
-			return fmt.Errorf("error unmarshalling JSON: %s", err.Error())
+	if !t.AllowUnknownFields {
+		decode.DisallowUnknownFields()
+	}
+	if t.UseNumber {
+		decode.UseNumber()
+	}
 
-		default:
-			return err
-		}
+	if err := decode.Decode(data); err != nil {
+		return jsonDecodeError(err)
 	}
 
 	err = decode.Decode(&struct{}{})
 	if err != io.EOF {
-		return errors.New("body must contain only one JSON value")
+		return ErrMultipleJSONValues
+	}
+
+	if len(defaults) > 0 {
+		v := reflect.ValueOf(data)
+		for v.Kind() == reflect.Pointer && !v.IsNil() {
+			v = v.Elem()
+		}
+		if v.Kind() == reflect.Struct {
+			applyJSONDefaults(v, defaults, body)
+		}
 	}
 	return nil
 }
 
-// WriteJSON takes a response status code and arbitrary data and writes json to the client
+// jsonDecodeError returns the error ReadJSON returns for the error err of the decoder
+func jsonDecodeError(err error) error {
+	var syntaxError *json.SyntaxError
+	var unmarshalTypeError *json.UnmarshalTypeError
+	var invalidUnmarshalError *json.InvalidUnmarshalError
+	var maxBytesError *http.MaxBytesError
+
+	switch {
+	case errors.As(err, &syntaxError):
+		return &ErrMalformedJSON{Offset: syntaxError.Offset, Err: err}
+
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return &ErrMalformedJSON{Err: err}
+
+	case errors.As(err, &unmarshalTypeError):
+		return &ErrWrongType{Field: unmarshalTypeError.Field, Offset: unmarshalTypeError.Offset, Err: err}
+
+	case errors.Is(err, io.EOF):
+		return ErrEmptyBody
+
+	case errors.As(err, &maxBytesError):
+		return bodyTooLarge(maxBytesError)
+
+	case isReadInterrupted(err):
+		return readInterrupted(err)
+
+	case isUnknownFieldError(err):
+		return &ErrUnknownField{Field: unknownFieldName(err), Err: err}
+
+	case errors.As(err, &invalidUnmarshalError):
+		return fmt.Errorf("error unmarshalling JSON: %w", err)
+
+	default:
+		return err
+	}
+}
+
+// WriteJSON takes a response status code and arbitrary data and writes json to the client. The data is
+// encoded into a pooled buffer before anything is written, so an encoding error is returned without writing
+// headers, and the Content-Length header can be set. Nil data is written as null, except with the status
+// codes 204 No Content and 304 Not Modified, which cannot have a body, and for which only the headers are
+// written, without Content-Type, whatever data is. Responses with a body are sent with the
+// X-Content-Type-Options: nosniff header
 func (t *Tools) WriteJSON(writer http.ResponseWriter, status int, data interface{}, headers ...http.Header) error {
-	out, err := json.Marshal(data)
+	return t.writeJSON(writer, status, "application/json", data, headers...)
+}
+
+// writeJSON does the work of WriteJSON, sending the body with the type contentType
+func (t *Tools) writeJSON(writer http.ResponseWriter, status int, contentType string, data any, headers ...http.Header) error {
+	if err := checkNotWritten(writer); err != nil {
+		return err
+	}
+	if status == http.StatusNoContent || status == http.StatusNotModified {
+		setHeaders(writer, headers)
+		writer.WriteHeader(status)
+		t.observeResponse(status, 0, 0)
+		return nil
+	}
+
+	started := t.encodeStart()
+	buf, err := t.encodeJSON(data)
 	if err != nil {
 		return err
 	}
-	if len(headers) > 0 {
-		for key, value := range headers[0] {
-			writer.Header()[key] = value
+	defer putJSONBuffer(buf)
+
+	return t.writeJSONBuffer(writer, status, contentType, buf, headers, started)
+}
+
+// encodeJSON encodes data, after JSONPrefix, into a buffer of jsonBufferPool, which the caller must put back
+// with putJSONBuffer
+func (t *Tools) encodeJSON(data any) (*bytes.Buffer, error) {
+	buf := jsonBufferPool.Get().(*bytes.Buffer)
+	buf.WriteString(t.JSONPrefix)
+	encoder := t.newJSONEncoder(buf)
+	value := t.jsonValue(t.shapeResponse(data))
+	if err := encoder.Encode(value); err != nil {
+		putJSONBuffer(buf)
+		return nil, err
+	}
+
+	// Whether data is an array is told by its JSON, as a json.Marshaler can encode anything
+	if t.ForbidTopLevelArrays && buf.Bytes()[len(t.JSONPrefix)] == '[' {
+		if t.RejectTopLevelArrays {
+			putJSONBuffer(buf)
+			return nil, ErrTopLevelArray
 		}
+		buf.Truncate(len(t.JSONPrefix))
+		if err := encoder.Encode(topLevelItems{Items: value}); err != nil {
+			putJSONBuffer(buf)
+			return nil, err
+		}
+	}
+	// Encode ends the value with a newline, which json.Marshal, used before, did not
+	buf.Truncate(buf.Len() - 1)
+	return buf, nil
+}
+
+// ErrTopLevelArray is returned by WriteJSON, when ForbidTopLevelArrays and RejectTopLevelArrays are set, for
+// data that is encoded as an array
+var ErrTopLevelArray = errors.New("top level JSON arrays are not allowed")
+
+// topLevelItems wraps the array WriteJSON sends when ForbidTopLevelArrays is set
+type topLevelItems struct {
+	Items any `json:"items"`
+}
+
+// writeJSONBuffer writes the response with the JSON encoded in buf as its body, along with the
+// X-Content-Type-Options: nosniff header, so browsers never read it as another type. started is when encoding
+// buf started, as encodeStart returned it
+func (t *Tools) writeJSONBuffer(writer http.ResponseWriter, status int, contentType string, buf *bytes.Buffer, headers []http.Header, started time.Time) error {
+	if err := checkNotWritten(writer); err != nil {
+		return err
+	}
+	var encodeDuration time.Duration
+	if !started.IsZero() {
+		encodeDuration = time.Since(started)
+	}
+	setHeaders(writer, headers)
+	if err := t.gzipJSON(writer, buf); err != nil {
+		return err
 	}
-	writer.Header().Set("Content-Type", "application/json")
+	writer.Header().Set("Content-Type", contentType)
+	writer.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	writer.Header().Set("X-Content-Type-Options", "nosniff")
 	writer.WriteHeader(status)
-	_, err = writer.Write(out)
+	n, err := buf.WriteTo(writer)
+	t.observeResponse(status, int(n), encodeDuration)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-// ErrorJSON takes an error, and optionally a status code, and generates and sends a JSON error message
+// setHeaders sets the first of headers, if any, on the response of writer
+func setHeaders(writer http.ResponseWriter, headers []http.Header) {
+	if len(headers) > 0 {
+		for key, value := range headers[0] {
+			writer.Header()[key] = value
+		}
+	}
+}
+
+// NoContent writes a 204 No Content response, with the optional headers and no body
+func (t *Tools) NoContent(writer http.ResponseWriter, headers ...http.Header) error {
+	return t.WriteJSON(writer, http.StatusNoContent, nil, headers...)
+}
+
+// maxPooledJSONBuffer is the capacity over which a buffer used by WriteJSON is dropped rather than pooled, so
+// an occasional huge response doesn't keep its memory alive
+const maxPooledJSONBuffer = 4 << 20
+
+// jsonBufferPool holds the buffers WriteJSON encodes data into
+var jsonBufferPool = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+// putJSONBuffer returns buf to jsonBufferPool, unless it grew too big
+func putJSONBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledJSONBuffer {
+		return
+	}
+	buf.Reset()
+	jsonBufferPool.Put(buf)
+}
+
+// ErrorJSON takes an error, and optionally a status code, and generates and sends a JSON error message. When
+// err, or an error it wraps, implements ErrorCoder, its code is sent too
 func (t *Tools) ErrorJSON(writer http.ResponseWriter, err error, status ...int) error {
+	return t.ErrorJSONWithCode(writer, err, "", status...)
+}
+
+// ErrorJSONWithRequest is like ErrorJSON, but first passes the request, the status code and err to
+// ErrorLogger, when it is set. The response is written even if ErrorLogger panics
+func (t *Tools) ErrorJSONWithRequest(writer http.ResponseWriter, request *http.Request, err error, status ...int) error {
+	statusCode := http.StatusBadRequest
+	if len(status) > 0 {
+		statusCode = status[0]
+	}
+	t.logError(request, statusCode, err)
+	return t.ErrorJSON(writer, err, statusCode)
+}
+
+// logError calls ErrorLogger, if it is set, and recovers from any panic in it
+func (t *Tools) logError(request *http.Request, status int, err error) {
+	if t.ErrorLogger == nil {
+		return
+	}
+	defer func() { _ = recover() }()
+	t.ErrorLogger(request, status, err)
+}
+
+// ErrorJSONWithCode is like ErrorJSON, but sends code as the machine readable code of the error. When code is
+// empty, the code of err is sent, if it implements ErrorCoder
+func (t *Tools) ErrorJSONWithCode(writer http.ResponseWriter, err error, code string, status ...int) error {
 	statusCode := http.StatusBadRequest
 
 	if len(status) > 0 {
@@ -288,35 +1677,49 @@ func (t *Tools) ErrorJSON(writer http.ResponseWriter, err error, status ...int)
 	var payload JSONResponse
 	payload.Error = true
 	payload.Message = err.Error()
+	payload.Code = code
 
-	return t.WriteJSON(writer, statusCode, payload)
-}
-
-// PushJSONToRemote arbitrary data to some URL as JSON, and returns the response, status code, and error, if any...
-// The final parameter, client, is optional. If none is  specified, we use the standard http.Client.
-func (t *Tools) PushJSONToRemote(uri string, data any, client ...*http.Client) (*http.Response, int, error) {
-	// create json
-	jsonData, err := json.Marshal(data)
-	if err != nil {
-		return nil, 0, err
+	var coder ErrorCoder
+	if payload.Code == "" && errors.As(err, &coder) {
+		payload.Code = coder.ErrorCode()
 	}
-	// check for custom http client
-	httpClient := &http.Client{}
-	if len(client) > 0 {
-		httpClient = client[0]
+	if t.Debug {
+		payload.Data = newDebugInfo(err)
 	}
-	// build the request and set the header
-	request, err := http.NewRequest("POST", uri, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return nil, 0, err
+
+	if t.WrapResponse != nil {
+		if body := t.WrapResponse(statusCode, nil, err); body != nil {
+			return t.WriteJSON(writer, statusCode, body)
+		}
 	}
-	request.Header.Set("Content-Type", "application/json")
-	// call the remote uri
-	response, err := httpClient.Do(request)
-	if err != nil {
-		return nil, 0, err
+	return t.WriteJSON(writer, statusCode, payload)
+}
+
+// WriteEnveloped writes data as JSON with the status code, wrapped in the envelope built by WrapResponse, or
+// else in the Data field of a JSONResponse
+func (t *Tools) WriteEnveloped(writer http.ResponseWriter, status int, data any, headers ...http.Header) error {
+	if t.WrapResponse != nil {
+		if body := t.WrapResponse(status, data, nil); body != nil {
+			return t.WriteJSON(writer, status, body, headers...)
+		}
 	}
-	defer response.Body.Close()
-	// send response back
-	return response, response.StatusCode, nil
+	return t.WriteJSON(writer, status, JSONResponse{Data: data}, headers...)
+}
+
+// OK writes data in a 200 OK response, enveloped as WriteEnveloped does, with the optional headers
+func (t *Tools) OK(writer http.ResponseWriter, data any, headers ...http.Header) error {
+	return t.WriteEnveloped(writer, http.StatusOK, data, headers...)
+}
+
+// Created writes data in a 201 Created response, enveloped as WriteEnveloped does, with the optional headers
+// and a Location header set to location, the URL of the resource created
+func (t *Tools) Created(writer http.ResponseWriter, location string, data any, headers ...http.Header) error {
+	writer.Header().Set("Location", location)
+	return t.WriteEnveloped(writer, http.StatusCreated, data, headers...)
+}
+
+// Accepted writes data in a 202 Accepted response, enveloped as WriteEnveloped does, with the optional headers,
+// for a request that will be processed later
+func (t *Tools) Accepted(writer http.ResponseWriter, data any, headers ...http.Header) error {
+	return t.WriteEnveloped(writer, http.StatusAccepted, data, headers...)
 }
@@ -2,6 +2,8 @@ package toolkit
 
 import (
 	"bytes"
+	"context"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -12,6 +14,11 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
+	"strings"
 	"sync"
 	"testing"
 )
@@ -105,26 +112,32 @@ func TestTools_UploadFiles(t *testing.T) {
 		request := httptest.NewRequest("POST", "/", pipeReader)
 		request.Header.Add("Content-Type", writer.FormDataContentType())
 
-		var testTools Tools
-		testTools.AllowedFileTypes = e.allowedTypes
+		memoryFS := &MemoryFS{}
+		testTools := Tools{FS: memoryFS, AllowedFileTypes: e.allowedTypes}
 
-		uploadedFiles, err := testTools.UploadFiles(request, "./testdata/uploads", e.renameFile)
+		uploadedFiles, err := testTools.UploadFiles(request, "uploads", e.renameFile)
 		if err != nil && !e.errorExpected {
 			t.Error(err)
 		}
 		if !e.errorExpected {
-			if _, err := os.Stat(fmt.Sprintf("./testdata/uploads/%s", uploadedFiles[0].NewFileName)); os.IsNotExist(err) {
+			if _, err := memoryFS.Stat(uploadedFiles[0].SavedPath); os.IsNotExist(err) {
 				t.Errorf("%s: expected file to exist: %s", e.name, err.Error())
 			}
-
-			// Clean up
-			_ = os.Remove(fmt.Sprintf("./testdata/uploads/%s", uploadedFiles[0].NewFileName))
+			if uploadedFiles[0].ContentType != "image/png" {
+				t.Errorf("%s: wrong content type; expected image/png but got %s", e.name, uploadedFiles[0].ContentType)
+			}
 		}
 
 		if !e.errorExpected && err != nil {
 			t.Errorf("%s: error expected but none received", e.name)
 		}
+
+		// A rejected upload stops reading the body early; drain the rest like net/http would, so the writer can finish
+		go func() {
+			_, _ = io.Copy(io.Discard, pipeReader)
+		}()
 		wg.Wait()
+		_ = pipeReader.Close()
 	}
 }
 
@@ -163,18 +176,46 @@ func TestTools_UploadOneFile(t *testing.T) {
 
 	var testTools Tools
 
-	uploadedFiles, err := testTools.UploadOneFile(request, "./testdata/uploads", true)
+	uploadDir := t.TempDir()
+	uploadedFiles, err := testTools.UploadOneFile(request, uploadDir, true)
 	if err != nil {
 		t.Error(err)
 	}
 
-	if _, err := os.Stat(fmt.Sprintf("./testdata/uploads/%s", uploadedFiles.NewFileName)); os.IsNotExist(err) {
+	if _, err := os.Stat(uploadedFiles.SavedPath); os.IsNotExist(err) {
 		t.Errorf("expected file to exist: %s", err.Error())
 	}
 
-	// Clean up
-	_ = os.Remove(fmt.Sprintf("./testdata/uploads/%s", uploadedFiles.NewFileName))
+	if !filepath.IsAbs(uploadedFiles.SavedPath) || filepath.Dir(uploadedFiles.SavedPath) != uploadDir {
+		t.Errorf("expected an absolute path in %s, but got %s", uploadDir, uploadedFiles.SavedPath)
+	}
+	if uploadedFiles.UploadDir != uploadDir {
+		t.Errorf("wrong upload directory %s", uploadedFiles.UploadDir)
+	}
+
+	if uploadedFiles.ContentType != "image/png" {
+		t.Errorf("wrong content type; expected image/png but got %s", uploadedFiles.ContentType)
+	}
+
+}
+
+func TestTools_UploadOneFile_NoFile(t *testing.T) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	_ = writer.WriteField("title", "holiday")
+	_ = writer.Close()
 
+	request := httptest.NewRequest("POST", "/", body)
+	request.Header.Add("Content-Type", writer.FormDataContentType())
+
+	var testTools Tools
+	uploadedFile, err := testTools.UploadOneFile(request, t.TempDir())
+	if !errors.Is(err, ErrNoFileUploaded) {
+		t.Errorf("expected ErrNoFileUploaded, but got %v", err)
+	}
+	if uploadedFile != nil {
+		t.Error("expected no uploaded file")
+	}
 }
 
 func TestTools_CreateDirIfNotExists(t *testing.T) {
@@ -250,18 +291,20 @@ var jsonTests = []struct {
 	errorExpected bool
 	maxSize       int
 	allowUnknown  bool
+	expectedError error
+	expectedType  error
 }{
 	{name: "good json", json: `{"foo": "bar"}`, errorExpected: false, maxSize: 1024, allowUnknown: false},
-	{name: "badly formatted json", json: `{"foo":}`, errorExpected: true, maxSize: 1024, allowUnknown: false},
-	{name: "incorrect type", json: `{"foo": 1}`, errorExpected: true, maxSize: 1024, allowUnknown: false},
-	{name: "two json files", json: `{"foo": "1"}{"alpha":"beta"}`, errorExpected: true, maxSize: 1024, allowUnknown: false},
-	{name: "empty body", json: ``, errorExpected: true, maxSize: 1024, allowUnknown: false},
-	{name: "syntax error in json", json: `{"foo": 1"`, errorExpected: true, maxSize: 1024, allowUnknown: false},
-	{name: "unknown field in json", json: `{"fooo": "1"}`, errorExpected: true, maxSize: 1024, allowUnknown: false},
+	{name: "badly formatted json", json: `{"foo":}`, errorExpected: true, maxSize: 1024, allowUnknown: false, expectedType: &ErrMalformedJSON{}},
+	{name: "incorrect type", json: `{"foo": 1}`, errorExpected: true, maxSize: 1024, allowUnknown: false, expectedType: &ErrWrongType{}},
+	{name: "two json files", json: `{"foo": "1"}{"alpha":"beta"}`, errorExpected: true, maxSize: 1024, allowUnknown: false, expectedError: ErrMultipleJSONValues},
+	{name: "empty body", json: ``, errorExpected: true, maxSize: 1024, allowUnknown: false, expectedError: ErrEmptyBody},
+	{name: "syntax error in json", json: `{"foo": 1"`, errorExpected: true, maxSize: 1024, allowUnknown: false, expectedType: &ErrMalformedJSON{}},
+	{name: "unknown field in json", json: `{"fooo": "1"}`, errorExpected: true, maxSize: 1024, allowUnknown: false, expectedType: &ErrUnknownField{}},
 	{name: "allow unknown fields in json", json: `{"fooo": "1"}`, errorExpected: false, maxSize: 1024, allowUnknown: true},
-	{name: "missing field name", json: `{rose: "1"}`, errorExpected: true, maxSize: 1024, allowUnknown: true},
-	{name: "file too large", json: `{"foo":"bar"}`, errorExpected: true, maxSize: 4, allowUnknown: true},
-	{name: "not JSON", json: `hello error`, errorExpected: true, maxSize: 1024, allowUnknown: true},
+	{name: "missing field name", json: `{rose: "1"}`, errorExpected: true, maxSize: 1024, allowUnknown: true, expectedType: &ErrMalformedJSON{}},
+	{name: "file too large", json: `{"foo":"bar"}`, errorExpected: true, maxSize: 4, allowUnknown: true, expectedError: ErrBodyTooLarge},
+	{name: "not JSON", json: `hello error`, errorExpected: true, maxSize: 1024, allowUnknown: true, expectedType: &ErrMalformedJSON{}},
 }
 
 func TestTools_ReadJSON(t *testing.T) {
@@ -292,10 +335,57 @@ func TestTools_ReadJSON(t *testing.T) {
 			t.Errorf("%s: error not expected, but one received: %s", e.name, err.Error())
 		}
 
+		// Errors match their sentinel with errors.Is, or their type with errors.As
+		if e.expectedError != nil && !errors.Is(err, e.expectedError) {
+			t.Errorf("%s: expected an error matching %v, but got %v", e.name, e.expectedError, err)
+		}
+		if e.expectedType != nil && !errors.As(err, reflect.New(reflect.TypeOf(e.expectedType)).Interface()) {
+			t.Errorf("%s: expected an error of type %T, but got %T: %v", e.name, e.expectedType, err, err)
+		}
+
 		req.Body.Close()
 	}
 }
 
+func TestTools_DecodeJSON(t *testing.T) {
+	for _, e := range jsonTests {
+		testTool := Tools{MaxJSONSize: e.maxSize, AllowUnknownFields: e.allowUnknown}
+
+		var decodeJSON struct {
+			Foo string `json:"foo"`
+		}
+		err := testTool.DecodeJSON(bytes.NewReader([]byte(e.json)), &decodeJSON)
+
+		if e.errorExpected && err == nil {
+			t.Errorf("%s: error expected, but none received", e.name)
+		}
+		if !e.errorExpected && err != nil {
+			t.Errorf("%s: error not expected, but one received: %s", e.name, err.Error())
+		}
+		if e.expectedError != nil && !errors.Is(err, e.expectedError) {
+			t.Errorf("%s: expected an error matching %v, but got %v", e.name, e.expectedError, err)
+		}
+		if e.expectedType != nil && !errors.As(err, reflect.New(reflect.TypeOf(e.expectedType)).Interface()) {
+			t.Errorf("%s: expected an error of type %T, but got %T: %v", e.name, e.expectedType, err, err)
+		}
+		if !e.errorExpected && decodeJSON.Foo == "" && !e.allowUnknown {
+			t.Errorf("%s: expected the value to be decoded", e.name)
+		}
+	}
+
+	// A body over the limit is rejected with the same message as ReadJSON, without reading it all
+	testTool := Tools{MaxJSONSize: 10}
+	body := strings.NewReader(`{"foo": "` + strings.Repeat("a", 1000) + `"}`)
+	var decoded map[string]any
+	err := testTool.DecodeJSON(body, &decoded)
+	if err == nil || err.Error() != "body must not be larger than 10 B" {
+		t.Errorf("expected the body to be too large, but got %v", err)
+	}
+	if body.Len() < 900 {
+		t.Errorf("expected reading to stop at the limit, but %d bytes were left", body.Len())
+	}
+}
+
 func TestTools_WriteJSON(t *testing.T) {
 	var testTools Tools
 
@@ -339,3 +429,1244 @@ func TestTools_ErrorJSON(t *testing.T) {
 		t.Errorf("wrong status code returned; expected 503, but got %d", rr.Code)
 	}
 }
+
+// cancelAfterReader cancels a context once n bytes have been read through it, simulating a client that
+// goes away in the middle of an upload
+type cancelAfterReader struct {
+	r        io.Reader
+	n        int
+	cancel   context.CancelFunc
+	onCancel func()
+}
+
+func (c *cancelAfterReader) Read(p []byte) (int, error) {
+	if len(p) > 4096 {
+		p = p[:4096]
+	}
+	n, err := c.r.Read(p)
+	c.n -= n
+	if c.n <= 0 && c.cancel != nil {
+		if c.onCancel != nil {
+			c.onCancel()
+		}
+		c.cancel()
+		c.cancel = nil
+	}
+	return n, err
+}
+
+func TestTools_UploadFilesWithContext(t *testing.T) {
+	uploadDir := t.TempDir()
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("file", "big.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = part.Write(bytes.Repeat([]byte("toolkit "), 64*1024))
+	_ = writer.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Record how much of the file had been written when the client went away
+	partialSize := int64(0)
+	onCancel := func() {
+		entries, _ := os.ReadDir(uploadDir)
+		for _, entry := range entries {
+			if info, err := entry.Info(); err == nil {
+				partialSize += info.Size()
+			}
+		}
+	}
+
+	request := httptest.NewRequest("POST", "/", &cancelAfterReader{r: body, n: 64 * 1024, cancel: cancel, onCancel: onCancel})
+	request.Header.Add("Content-Type", writer.FormDataContentType())
+
+	var testTools Tools
+	_, err = testTools.UploadFilesWithContext(ctx, request, uploadDir, false)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, but got %v", err)
+	}
+
+	if partialSize == 0 {
+		t.Error("expected a partially written file when the context was cancelled")
+	}
+
+	entries, err := os.ReadDir(uploadDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected no files in upload directory, but found %d", len(entries))
+	}
+}
+
+func TestTools_UploadFiles_FormValues(t *testing.T) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	_ = writer.WriteField("title", "holiday")
+	part, err := writer.CreateFormFile("file", "notes.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = part.Write([]byte("some notes"))
+	_ = writer.WriteField("tag", "beach")
+	_ = writer.WriteField("tag", "sun")
+	_ = writer.Close()
+
+	request := httptest.NewRequest("POST", "/?page=2", body)
+	request.Header.Add("Content-Type", writer.FormDataContentType())
+
+	var testTools Tools
+	uploadedFiles, err := testTools.UploadFiles(request, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(uploadedFiles) != 1 {
+		t.Errorf("expected 1 uploaded file, but got %d", len(uploadedFiles))
+	}
+
+	if request.PostForm.Get("title") != "holiday" {
+		t.Errorf("wrong title in PostForm: %q", request.PostForm.Get("title"))
+	}
+	if tags := request.MultipartForm.Value["tag"]; len(tags) != 2 || tags[0] != "beach" || tags[1] != "sun" {
+		t.Errorf("wrong tags in MultipartForm.Value: %v", tags)
+	}
+	if request.FormValue("title") != "holiday" || request.FormValue("page") != "2" {
+		t.Error("expected FormValue to return both form and query values")
+	}
+}
+
+// syntheticUpload streams a multipart body with a single file of the given size through a pipe
+func syntheticUpload(size int) *http.Request {
+	pipeReader, pipeWriter := io.Pipe()
+	writer := multipart.NewWriter(pipeWriter)
+
+	go func() {
+		part, err := writer.CreateFormFile("file", "large.bin")
+		if err != nil {
+			_ = pipeWriter.CloseWithError(err)
+			return
+		}
+		chunk := bytes.Repeat([]byte{0x7f}, 64*1024)
+		for written := 0; written < size; written += len(chunk) {
+			if _, err := part.Write(chunk); err != nil {
+				_ = pipeWriter.CloseWithError(err)
+				return
+			}
+		}
+		_ = writer.Close()
+		_ = pipeWriter.Close()
+	}()
+
+	request := httptest.NewRequest("POST", "/", pipeReader)
+	request.Header.Add("Content-Type", writer.FormDataContentType())
+	return request
+}
+
+// allocatedBytes reports how many bytes were allocated on the heap while running fn
+func allocatedBytes(fn func()) uint64 {
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	fn()
+	runtime.ReadMemStats(&after)
+	return after.TotalAlloc - before.TotalAlloc
+}
+
+func TestTools_UploadFiles_Streaming(t *testing.T) {
+	const size = 32 * 1024 * 1024
+
+	// Parsing the whole form up front holds the file in memory
+	parsed := allocatedBytes(func() {
+		request := syntheticUpload(size)
+		if err := request.ParseMultipartForm(size * 2); err != nil {
+			t.Error(err)
+		}
+	})
+
+	var testTools Tools
+	streamed := allocatedBytes(func() {
+		uploadedFiles, err := testTools.UploadFiles(syntheticUpload(size), t.TempDir())
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if uploadedFiles[0].FileSize != size {
+			t.Errorf("wrong file size; expected %d but got %d", size, uploadedFiles[0].FileSize)
+		}
+	})
+
+	if parsed < size {
+		t.Errorf("expected ParseMultipartForm to allocate at least %d bytes, but it allocated %d", size, parsed)
+	}
+	if streamed > size/8 {
+		t.Errorf("expected streaming upload to allocate far less than %d bytes, but it allocated %d", size, streamed)
+	}
+}
+
+// testFile is a file part sent by newUploadRequest
+type testFile struct {
+	name    string
+	content []byte
+}
+
+// newUploadRequest builds a multipart request with one "file" part for each of files
+func newUploadRequest(t *testing.T, files ...testFile) *http.Request {
+	t.Helper()
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for _, f := range files {
+		part, err := writer.CreateFormFile("file", f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := part.Write(f.content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	request := httptest.NewRequest("POST", "/", body)
+	request.Header.Add("Content-Type", writer.FormDataContentType())
+	return request
+}
+
+func TestTools_UploadFiles_MaxSingleFileSize(t *testing.T) {
+	uploadDir := t.TempDir()
+	testTools := Tools{MaxSingleFileSize: 16}
+
+	request := newUploadRequest(t,
+		testFile{name: "one.txt", content: []byte("small file")},
+		testFile{name: "two.txt", content: []byte("another small")},
+		testFile{name: "huge.txt", content: bytes.Repeat([]byte("x"), 17)},
+		testFile{name: "four.txt", content: []byte("never read")},
+	)
+
+	uploadedFiles, err := testTools.UploadFiles(request, uploadDir, false)
+	if err == nil || !strings.Contains(err.Error(), `"huge.txt" is too big (limit is 16 B)`) {
+		t.Errorf("expected an error naming huge.txt, but got %v", err)
+	}
+	var uploadErr *UploadError
+	if !errors.As(err, &uploadErr) || uploadErr.Limit != 16 {
+		t.Errorf("expected an *UploadError with the limit, but got %v", err)
+	}
+
+	// Files saved before the oversize one are kept and returned
+	if len(uploadedFiles) != 2 {
+		t.Fatalf("expected 2 uploaded files, but got %d", len(uploadedFiles))
+	}
+	for _, name := range []string{"one.txt", "two.txt"} {
+		if _, err := os.Stat(filepath.Join(uploadDir, name)); err != nil {
+			t.Errorf("expected %s to be kept: %s", name, err)
+		}
+	}
+	for _, name := range []string{"huge.txt", "four.txt"} {
+		if _, err := os.Stat(filepath.Join(uploadDir, name)); !os.IsNotExist(err) {
+			t.Errorf("expected %s not to exist", name)
+		}
+	}
+}
+
+func TestTools_UploadFiles_MaxUploadCount(t *testing.T) {
+	uploadDir := "uploads"
+	memoryFS := &MemoryFS{}
+	testTools := Tools{FS: memoryFS, MaxUploadCount: 2}
+
+	var files []testFile
+	for i := 1; i <= 5; i++ {
+		files = append(files, testFile{name: fmt.Sprintf("%d.txt", i), content: []byte("some text")})
+	}
+
+	uploadedFiles, err := testTools.UploadFiles(newUploadRequest(t, files...), uploadDir, false)
+	if err == nil || err.Error() != "too many files: limit is 2" {
+		t.Errorf("expected too many files error, but got %v", err)
+	}
+	if len(uploadedFiles) != 2 {
+		t.Errorf("expected 2 uploaded files, but got %d", len(uploadedFiles))
+	}
+
+	if names := memoryFS.FileNames(uploadDir); len(names) != 2 {
+		t.Errorf("expected 2 files in upload directory, but found %v", names)
+	}
+}
+
+var hashTests = []struct {
+	name          string
+	algorithm     string
+	errorExpected bool
+}{
+	{name: "sha256", algorithm: "sha256", errorExpected: false},
+	{name: "md5", algorithm: "md5", errorExpected: false},
+	{name: "sha1", algorithm: "SHA1", errorExpected: false},
+	{name: "unsupported", algorithm: "crc32", errorExpected: true},
+}
+
+func TestTools_UploadFiles_HashUploads(t *testing.T) {
+	for _, e := range hashTests {
+		uploadDir := t.TempDir()
+		testTools := Tools{HashUploads: e.algorithm}
+
+		request := newUploadRequest(t, testFile{name: "notes.txt", content: []byte("some notes to hash")})
+		uploadedFiles, err := testTools.UploadFiles(request, uploadDir, false)
+		if e.errorExpected {
+			if err == nil {
+				t.Errorf("%s: error expected, but none received", e.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", e.name, err)
+			continue
+		}
+
+		// Hash the saved file again and compare
+		data, err := os.ReadFile(filepath.Join(uploadDir, "notes.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		hasher, _ := newHash(e.algorithm)
+		hasher.Write(data)
+		if expected := hex.EncodeToString(hasher.Sum(nil)); uploadedFiles[0].Checksum != expected {
+			t.Errorf("%s: wrong checksum; expected %s but got %s", e.name, expected, uploadedFiles[0].Checksum)
+		}
+	}
+
+	// No checksum unless asked for
+	var testTools Tools
+	request := newUploadRequest(t, testFile{name: "notes.txt", content: []byte("some notes")})
+	uploadedFiles, err := testTools.UploadFiles(request, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uploadedFiles[0].Checksum != "" {
+		t.Error("expected no checksum when HashUploads is empty")
+	}
+}
+
+var fileTypePatternTests = []struct {
+	name          string
+	allowedTypes  []string
+	file          testFile
+	errorExpected bool
+}{
+	{name: "image wildcard allows png", allowedTypes: []string{"image/*"}, file: testFile{name: "img.png", content: pngHeader}, errorExpected: false},
+	{name: "image wildcard rejects text", allowedTypes: []string{"image/*"}, file: testFile{name: "notes.txt", content: []byte("some notes")}, errorExpected: true},
+	{name: "any type", allowedTypes: []string{"*/*"}, file: testFile{name: "notes.txt", content: []byte("some notes")}, errorExpected: false},
+	{name: "wildcard is case-insensitive", allowedTypes: []string{"IMAGE/*"}, file: testFile{name: "img.png", content: pngHeader}, errorExpected: false},
+	{name: "exact match", allowedTypes: []string{"image/jpeg", "image/png"}, file: testFile{name: "img.png", content: pngHeader}, errorExpected: false},
+	{name: "exact match is case-insensitive", allowedTypes: []string{"Image/PNG"}, file: testFile{name: "img.png", content: pngHeader}, errorExpected: false},
+	{name: "no partial match", allowedTypes: []string{"image/p*"}, file: testFile{name: "img.png", content: pngHeader}, errorExpected: true},
+	{name: "utf-8 text", allowedTypes: []string{"text/plain"}, file: testFile{name: "notes.txt", content: []byte("some notes, déjà vu")}, errorExpected: false},
+	{name: "utf-8 text with parameters", allowedTypes: []string{"Text/Plain; charset=iso-8859-1"}, file: testFile{name: "notes.txt", content: []byte("some notes, déjà vu")}, errorExpected: false},
+	{name: "text wildcard", allowedTypes: []string{"text/*"}, file: testFile{name: "notes.txt", content: []byte("some notes, déjà vu")}, errorExpected: false},
+	{name: "text is not html", allowedTypes: []string{"text/html"}, file: testFile{name: "notes.txt", content: []byte("some notes, déjà vu")}, errorExpected: true},
+}
+
+// pngHeader is enough of a PNG file for its type to be detected
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func TestTools_UploadFiles_FileTypePatterns(t *testing.T) {
+	for _, e := range fileTypePatternTests {
+		testTools := Tools{FS: &MemoryFS{}, AllowedFileTypes: e.allowedTypes}
+
+		_, err := testTools.UploadFiles(newUploadRequest(t, e.file), "uploads")
+		if e.errorExpected && err == nil {
+			t.Errorf("%s: error expected, but none received", e.name)
+		}
+		if !e.errorExpected && err != nil {
+			t.Errorf("%s: error not expected, but one received: %s", e.name, err)
+		}
+	}
+}
+
+var extensionTests = []struct {
+	name              string
+	allowedExtensions []string
+	allowedTypes      []string
+	file              testFile
+	expectedError     string
+}{
+	{name: "upper case extension", allowedExtensions: []string{".svg"}, file: testFile{name: "logo.SVG", content: []byte("<svg></svg>")}},
+	{name: "allowed without dot", allowedExtensions: []string{"svg"}, file: testFile{name: "logo.svg", content: []byte("<svg></svg>")}},
+	{name: "allowed list upper case", allowedExtensions: []string{".SVG"}, file: testFile{name: "logo.svg", content: []byte("<svg></svg>")}},
+	{name: "no extension", allowedExtensions: []string{".svg"}, file: testFile{name: "logo", content: []byte("<svg></svg>")}, expectedError: "the uploaded file extension is not permitted"},
+	{name: "wrong extension", allowedExtensions: []string{".svg"}, file: testFile{name: "logo.exe", content: []byte("<svg></svg>")}, expectedError: "the uploaded file extension is not permitted"},
+	{name: "extension and type", allowedExtensions: []string{".csv"}, allowedTypes: []string{"text/plain; charset=utf-8"}, file: testFile{name: "data.csv", content: []byte("a,b\n1,2\n")}},
+	{name: "extension ok but type not", allowedExtensions: []string{".csv"}, allowedTypes: []string{"image/png"}, file: testFile{name: "data.csv", content: []byte("a,b\n1,2\n")}, expectedError: "the uploaded file type is not permitted"},
+}
+
+func TestTools_UploadFiles_AllowedFileExtensions(t *testing.T) {
+	for _, e := range extensionTests {
+		testTools := Tools{FS: &MemoryFS{}, AllowedFileExtensions: e.allowedExtensions, AllowedFileTypes: e.allowedTypes}
+
+		_, err := testTools.UploadFiles(newUploadRequest(t, e.file), "uploads")
+		if e.expectedError == "" && err != nil {
+			t.Errorf("%s: error not expected, but one received: %s", e.name, err)
+		}
+		if e.expectedError != "" && (err == nil || err.Error() != e.expectedError) {
+			t.Errorf("%s: expected error %q, but got %v", e.name, e.expectedError, err)
+		}
+	}
+}
+
+var denyTests = []struct {
+	name          string
+	tools         Tools
+	file          testFile
+	expectedError string
+}{
+	{name: "denied extension", tools: Tools{DeniedFileExtensions: []string{"exe", ".zip"}}, file: testFile{name: "setup.EXE", content: []byte("some text")}, expectedError: "the uploaded file extension .EXE is not permitted"},
+	{name: "denied type", tools: Tools{DeniedFileTypes: []string{"application/zip"}}, file: testFile{name: "a.bin", content: []byte("PK\x03\x04archive")}, expectedError: "the uploaded file type application/zip is not permitted"},
+	{name: "denied type wildcard", tools: Tools{DeniedFileTypes: []string{"image/*"}}, file: testFile{name: "img.png", content: pngHeader}, expectedError: "the uploaded file type image/png is not permitted"},
+	{name: "not denied", tools: Tools{DeniedFileTypes: []string{"application/zip"}, DeniedFileExtensions: []string{".exe"}}, file: testFile{name: "img.png", content: pngHeader}},
+	{name: "deny type wins over allow", tools: Tools{AllowedFileTypes: []string{"*/*"}, DeniedFileTypes: []string{"image/png"}}, file: testFile{name: "img.png", content: pngHeader}, expectedError: "the uploaded file type image/png is not permitted"},
+	{name: "deny extension wins over allow", tools: Tools{AllowedFileExtensions: []string{".png"}, DeniedFileExtensions: []string{".png"}}, file: testFile{name: "img.png", content: pngHeader}, expectedError: "the uploaded file extension .png is not permitted"},
+	{name: "allowed by both lists", tools: Tools{AllowedFileTypes: []string{"image/*"}, DeniedFileTypes: []string{"image/gif"}, AllowedFileExtensions: []string{".png"}, DeniedFileExtensions: []string{".gif"}}, file: testFile{name: "img.png", content: pngHeader}},
+}
+
+func TestTools_UploadFiles_Denied(t *testing.T) {
+	for _, e := range denyTests {
+		e.tools.FS = &MemoryFS{}
+		_, err := e.tools.UploadFiles(newUploadRequest(t, e.file), "uploads")
+		if e.expectedError == "" && err != nil {
+			t.Errorf("%s: error not expected, but one received: %s", e.name, err)
+		}
+		if e.expectedError != "" && (err == nil || err.Error() != e.expectedError) {
+			t.Errorf("%s: expected error %q, but got %v", e.name, e.expectedError, err)
+		}
+	}
+}
+
+var fileNameTests = []struct {
+	name          string
+	fileName      string
+	expected      string
+	errorExpected bool
+}{
+	{name: "plain name", fileName: "report.pdf", expected: "report.pdf"},
+	{name: "unix traversal", fileName: "../../etc/cron.d/evil", expected: "evil"},
+	{name: "windows traversal", fileName: `..\..\x.exe`, expected: "x.exe"},
+	{name: "absolute path", fileName: "/etc/passwd", expected: "passwd"},
+	{name: "mixed separators", fileName: `a/b\..\c.txt`, expected: "c.txt"},
+	{name: "dot dot", fileName: "..", errorExpected: true},
+	{name: "dot", fileName: ".", errorExpected: true},
+	{name: "trailing separator", fileName: `..\`, errorExpected: true},
+	{name: "nul byte", fileName: "evil\x00.png", errorExpected: true},
+}
+
+func TestSanitizeFileName(t *testing.T) {
+	for _, e := range fileNameTests {
+		name, err := sanitizeFileName(e.fileName)
+		if e.errorExpected && err == nil {
+			t.Errorf("%s: error expected, but none received", e.name)
+		}
+		if !e.errorExpected && (err != nil || name != e.expected) {
+			t.Errorf("%s: expected %q, but got %q (%v)", e.name, e.expected, name, err)
+		}
+	}
+}
+
+func TestTools_UploadFiles_PathTraversal(t *testing.T) {
+	root := t.TempDir()
+	uploadDir := filepath.Join(root, "uploads")
+
+	var testTools Tools
+	for _, fileName := range []string{"../../evil.txt", `..\..\evil.txt`} {
+		request := newUploadRequest(t, testFile{name: fileName, content: []byte("some text")})
+		uploadedFiles, err := testTools.UploadFiles(request, uploadDir, false)
+		if err != nil {
+			t.Errorf("%s: %s", fileName, err)
+			continue
+		}
+		if uploadedFiles[0].NewFileName != "evil.txt" {
+			t.Errorf("%s: wrong file name %q", fileName, uploadedFiles[0].NewFileName)
+		}
+		if _, err := os.Stat(filepath.Join(uploadDir, "evil.txt")); err != nil {
+			t.Errorf("%s: expected file inside the upload directory: %s", fileName, err)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(root, "evil.txt")); !os.IsNotExist(err) {
+		t.Error("expected no file outside of the upload directory")
+	}
+
+	request := newUploadRequest(t, testFile{name: "..", content: []byte("some text")})
+	if _, err := testTools.UploadFiles(request, uploadDir, false); err == nil {
+		t.Error("expected an error for an invalid file name")
+	}
+}
+
+var collisionTests = []struct {
+	name          string
+	policy        CollisionPolicy
+	expectedFiles []string
+	errorExpected bool
+}{
+	{name: "overwrite", policy: CollisionOverwrite, expectedFiles: []string{"report.pdf"}},
+	{name: "error", policy: CollisionError, expectedFiles: []string{"report.pdf"}, errorExpected: true},
+	{name: "auto suffix", policy: CollisionAutoSuffix, expectedFiles: []string{"report-1.pdf", "report.pdf"}},
+}
+
+func TestTools_UploadFiles_CollisionPolicy(t *testing.T) {
+	for _, e := range collisionTests {
+		uploadDir := t.TempDir()
+		testTools := Tools{CollisionPolicy: e.policy}
+
+		_, err := testTools.UploadFiles(newUploadRequest(t, testFile{name: "report.pdf", content: []byte("first")}), uploadDir, false)
+		if err != nil {
+			t.Fatalf("%s: %s", e.name, err)
+		}
+
+		uploadedFiles, err := testTools.UploadFiles(newUploadRequest(t, testFile{name: "report.pdf", content: []byte("second")}), uploadDir, false)
+		if e.errorExpected && err == nil {
+			t.Errorf("%s: error expected, but none received", e.name)
+		}
+		if !e.errorExpected && err != nil {
+			t.Errorf("%s: error not expected, but one received: %s", e.name, err)
+		}
+		if !e.errorExpected && uploadedFiles[0].NewFileName != e.expectedFiles[0] {
+			t.Errorf("%s: wrong new file name %s", e.name, uploadedFiles[0].NewFileName)
+		}
+
+		var names []string
+		entries, _ := os.ReadDir(uploadDir)
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		if strings.Join(names, ",") != strings.Join(e.expectedFiles, ",") {
+			t.Errorf("%s: expected files %v, but found %v", e.name, e.expectedFiles, names)
+		}
+
+		// Only the overwrite policy replaces the first file
+		data, _ := os.ReadFile(filepath.Join(uploadDir, "report.pdf"))
+		if expected := map[bool]string{true: "second", false: "first"}[e.policy == CollisionOverwrite]; string(data) != expected {
+			t.Errorf("%s: expected report.pdf to contain %q, but found %q", e.name, expected, data)
+		}
+	}
+}
+
+func TestTools_UploadFiles_CollisionAutoSuffixConcurrent(t *testing.T) {
+	uploadDir := t.TempDir()
+	testTools := Tools{CollisionPolicy: CollisionAutoSuffix}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		request := newUploadRequest(t, testFile{name: "report.pdf", content: []byte("some report")})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := testTools.UploadFiles(request, uploadDir, false); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	entries, _ := os.ReadDir(uploadDir)
+	if len(entries) != 10 {
+		t.Errorf("expected 10 distinct files, but found %d", len(entries))
+	}
+}
+
+func TestTools_UploadFiles_CleanupOnError(t *testing.T) {
+	for _, cleanup := range []bool{false, true} {
+		uploadDir := t.TempDir()
+		testTools := Tools{AllowedFileTypes: []string{"image/png"}, CleanupOnError: cleanup}
+
+		request := newUploadRequest(t,
+			testFile{name: "one.png", content: pngHeader},
+			testFile{name: "two.txt", content: []byte("not an image")},
+			testFile{name: "three.png", content: pngHeader},
+		)
+		uploadedFiles, err := testTools.UploadFiles(request, uploadDir, false)
+		if err == nil {
+			t.Errorf("cleanup %t: error expected, but none received", cleanup)
+		}
+
+		entries, _ := os.ReadDir(uploadDir)
+		expected := map[bool]int{false: 1, true: 0}[cleanup]
+		if len(uploadedFiles) != expected {
+			t.Errorf("cleanup %t: expected %d uploaded files returned, but got %d", cleanup, expected, len(uploadedFiles))
+		}
+		if len(entries) != expected {
+			t.Errorf("cleanup %t: expected %d files in upload directory, but found %d", cleanup, expected, len(entries))
+		}
+	}
+}
+
+func TestTools_UploadFiles_UnwritableDir(t *testing.T) {
+	root := t.TempDir()
+
+	// A regular file where a directory is expected makes the upload directory impossible to create
+	blocker := filepath.Join(root, "blocker")
+	if err := os.WriteFile(blocker, []byte("not a directory"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A directory with the name of the uploaded file makes the file impossible to save
+	uploadDir := filepath.Join(root, "uploads")
+	if err := os.MkdirAll(filepath.Join(uploadDir, "notes.txt"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	var testTools Tools
+	for _, dir := range []string{filepath.Join(blocker, "uploads"), uploadDir} {
+		request := newUploadRequest(t, testFile{name: "notes.txt", content: []byte("some notes")})
+		uploadedFiles, err := testTools.UploadFiles(request, dir, false)
+		if err == nil {
+			t.Errorf("%s: error expected, but none received", dir)
+		}
+		if len(uploadedFiles) != 0 {
+			t.Errorf("%s: expected no uploaded files, but got %d", dir, len(uploadedFiles))
+		}
+	}
+
+	// Nothing but the blocking directory is left behind
+	entries, _ := os.ReadDir(uploadDir)
+	if len(entries) != 1 {
+		t.Errorf("expected no stray files, but found %v", entries)
+	}
+}
+
+var smallFileTests = []struct {
+	name          string
+	content       []byte
+	allowEmpty    bool
+	minSize       int64
+	expectedType  string
+	errorExpected string
+}{
+	{name: "ten bytes", content: []byte("0123456789"), expectedType: "text/plain; charset=utf-8"},
+	{name: "empty rejected", content: []byte{}, errorExpected: "is empty"},
+	{name: "empty allowed", content: []byte{}, allowEmpty: true, expectedType: "text/plain; charset=utf-8"},
+	{name: "empty under minimum", content: []byte{}, minSize: 1, errorExpected: "is empty"},
+	{name: "empty allowed under minimum", content: []byte{}, allowEmpty: true, minSize: 1, errorExpected: `the uploaded file "small.txt" is too small (minimum is 1 B)`},
+	{name: "under minimum", content: []byte("0123456789"), minSize: 11, errorExpected: `the uploaded file "small.txt" is too small (minimum is 11 B)`},
+	{name: "at minimum", content: []byte("0123456789"), minSize: 10, expectedType: "text/plain; charset=utf-8"},
+}
+
+func TestTools_UploadFiles_SmallFiles(t *testing.T) {
+	for _, e := range smallFileTests {
+		uploadDir := t.TempDir()
+		testTools := Tools{AllowEmptyFiles: e.allowEmpty, MinFileSize: e.minSize}
+
+		uploadedFiles, err := testTools.UploadFiles(newUploadRequest(t, testFile{name: "small.txt", content: e.content}), uploadDir, false)
+		if e.errorExpected != "" {
+			if err == nil || !strings.Contains(err.Error(), e.errorExpected) {
+				t.Errorf("%s: expected error containing %q, but got %v", e.name, e.errorExpected, err)
+			}
+			if entries, _ := os.ReadDir(uploadDir); len(entries) != 0 {
+				t.Errorf("%s: expected no files in upload directory, but found %d", e.name, len(entries))
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: error not expected, but one received: %s", e.name, err)
+			continue
+		}
+
+		if uploadedFiles[0].FileSize != int64(len(e.content)) {
+			t.Errorf("%s: wrong file size %d", e.name, uploadedFiles[0].FileSize)
+		}
+		if uploadedFiles[0].ContentType != e.expectedType {
+			t.Errorf("%s: wrong content type %s", e.name, uploadedFiles[0].ContentType)
+		}
+		if data, _ := os.ReadFile(filepath.Join(uploadDir, "small.txt")); !bytes.Equal(data, e.content) {
+			t.Errorf("%s: wrong file contents %q", e.name, data)
+		}
+	}
+}
+
+var renameFuncTests = []struct {
+	name                string
+	renameFunc          func(string) string
+	allowSubdirectories bool
+	expected            string
+	errorExpected       bool
+}{
+	{name: "flat name", renameFunc: func(s string) string { return "avatar-" + s }, expected: "avatar-notes.txt"},
+	{name: "nested name", renameFunc: func(s string) string { return "42/2024-01-01-" + s }, allowSubdirectories: true, expected: "42/2024-01-01-notes.txt"},
+	{name: "nested without option", renameFunc: func(s string) string { return "42/" + s }, errorExpected: true},
+	{name: "traversal", renameFunc: func(s string) string { return "../" + s }, allowSubdirectories: true, errorExpected: true},
+	{name: "absolute", renameFunc: func(s string) string { return "/tmp/" + s }, allowSubdirectories: true, errorExpected: true},
+	{name: "backslash", renameFunc: func(s string) string { return `42\` + s }, allowSubdirectories: true, errorExpected: true},
+	{name: "empty", renameFunc: func(s string) string { return "" }, errorExpected: true},
+}
+
+func TestTools_UploadFiles_RenameFunc(t *testing.T) {
+	for _, e := range renameFuncTests {
+		uploadDir := t.TempDir()
+		testTools := Tools{RenameFunc: e.renameFunc, AllowSubdirectories: e.allowSubdirectories}
+
+		// RenameFunc wins over both the random and the original name
+		for _, rename := range []bool{true, false} {
+			request := newUploadRequest(t, testFile{name: "notes.txt", content: []byte("some notes")})
+			uploadedFiles, err := testTools.UploadFiles(request, uploadDir, rename)
+			if e.errorExpected {
+				if err == nil {
+					t.Errorf("%s: error expected, but none received", e.name)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("%s: error not expected, but one received: %s", e.name, err)
+				continue
+			}
+
+			if uploadedFiles[0].NewFileName != e.expected {
+				t.Errorf("%s: expected name %s, but got %s", e.name, e.expected, uploadedFiles[0].NewFileName)
+			}
+			if _, err := os.Stat(filepath.Join(uploadDir, filepath.FromSlash(e.expected))); err != nil {
+				t.Errorf("%s: expected file to exist: %s", e.name, err)
+			}
+		}
+	}
+}
+
+var randomNameTests = []struct {
+	name          string
+	length        int
+	prefix        string
+	fileName      string
+	expected      string
+	errorExpected bool
+}{
+	{name: "default", fileName: "notes.txt", expected: `^[a-zA-Z0-9_+]{25}\.txt$`},
+	{name: "prefix and length", length: 8, prefix: "img_", fileName: "photo.png", expected: `^img_[a-zA-Z0-9_+]{8}\.png$`},
+	{name: "longest", length: 64, fileName: "notes.txt", expected: `^[a-zA-Z0-9_+]{64}\.txt$`},
+	{name: "extension lower-cased", length: 12, prefix: "doc-", fileName: "REPORT.TXT", expected: `^doc-[a-zA-Z0-9_+]{12}\.txt$`},
+	{name: "no extension", prefix: "f", fileName: "notes", expected: `^f[a-zA-Z0-9_+]{25}$`},
+	{name: "too short", length: 7, fileName: "notes.txt", errorExpected: true},
+	{name: "too long", length: 65, fileName: "notes.txt", errorExpected: true},
+	{name: "prefix with slash", prefix: "../", fileName: "notes.txt", errorExpected: true},
+	{name: "prefix with backslash", prefix: "a\\", fileName: "notes.txt", errorExpected: true},
+}
+
+func TestTools_UploadFiles_RandomName(t *testing.T) {
+	for _, e := range randomNameTests {
+		fs := &MemoryFS{}
+		testTools := Tools{FS: fs, RandomNameLength: e.length, RandomNamePrefix: e.prefix}
+
+		uploadedFiles, err := testTools.UploadFiles(newUploadRequest(t, testFile{name: e.fileName, content: []byte("some notes")}), "uploads")
+		if e.errorExpected {
+			if err == nil {
+				t.Errorf("%s: error expected, but none received", e.name)
+			}
+			if names := fs.FileNames("uploads"); len(names) != 0 {
+				t.Errorf("%s: expected no files in upload directory, but found %v", e.name, names)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: error not expected, but one received: %s", e.name, err)
+			continue
+		}
+
+		if !regexp.MustCompile(e.expected).MatchString(uploadedFiles[0].NewFileName) {
+			t.Errorf("%s: expected a name matching %s, but got %s", e.name, e.expected, uploadedFiles[0].NewFileName)
+		}
+		if names := fs.FileNames("uploads"); len(names) != 1 || names[0] != uploadedFiles[0].NewFileName {
+			t.Errorf("%s: expected %s to be saved, but found %v", e.name, uploadedFiles[0].NewFileName, names)
+		}
+	}
+}
+
+func TestTools_UploadFiles_Permissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not supported on windows")
+	}
+
+	uploadDir := filepath.Join(t.TempDir(), "uploads")
+	testTools := Tools{DirPerm: 0750, FilePerm: 0640, RenameFunc: func(s string) string { return "nested/" + s }, AllowSubdirectories: true}
+
+	request := newUploadRequest(t, testFile{name: "notes.txt", content: []byte("some notes")})
+	uploadedFiles, err := testTools.UploadFiles(request, uploadDir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(uploadedFiles[0].SavedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("wrong file mode; expected 0640 but got %o", info.Mode().Perm())
+	}
+
+	for _, dir := range []string{uploadDir, filepath.Join(uploadDir, "nested")} {
+		info, err := os.Stat(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0750 {
+			t.Errorf("%s: wrong directory mode; expected 0750 but got %o", dir, info.Mode().Perm())
+		}
+	}
+}
+
+var imageDimensionTests = []struct {
+	name          string
+	maxWidth      int
+	maxHeight     int
+	file          string
+	content       []byte
+	expectedError string
+}{
+	{name: "within limits", maxWidth: 4096, maxHeight: 4096, file: "./testdata/img.png"},
+	{name: "too wide", maxWidth: 600, file: "./testdata/img.png", expectedError: "is 640x426, wider than the allowed 600 pixels"},
+	{name: "too tall", maxHeight: 400, file: "./testdata/img.png", expectedError: "is 640x426, taller than the allowed 400 pixels"},
+	{name: "jpeg too wide", maxWidth: 100, file: "./testdata/gold.jpeg", expectedError: "wider than the allowed 100 pixels"},
+	{name: "truncated header", maxWidth: 100, content: pngHeader, expectedError: "could not decode image"},
+	{name: "not an image", maxWidth: 100, content: []byte("some text")},
+}
+
+func TestTools_UploadFiles_ImageDimensions(t *testing.T) {
+	for _, e := range imageDimensionTests {
+		content := e.content
+		if e.file != "" {
+			var err error
+			if content, err = os.ReadFile(e.file); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		uploadDir := t.TempDir()
+		testTools := Tools{MaxImageWidth: e.maxWidth, MaxImageHeight: e.maxHeight}
+		uploadedFiles, err := testTools.UploadFiles(newUploadRequest(t, testFile{name: "upload", content: content}), uploadDir)
+		if e.expectedError != "" {
+			if err == nil || !strings.Contains(err.Error(), e.expectedError) {
+				t.Errorf("%s: expected error containing %q, but got %v", e.name, e.expectedError, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: error not expected, but one received: %s", e.name, err)
+			continue
+		}
+
+		// The header read to check the dimensions is still saved
+		if data, _ := os.ReadFile(uploadedFiles[0].SavedPath); !bytes.Equal(data, content) {
+			t.Errorf("%s: saved file differs from the upload", e.name)
+		}
+	}
+}
+
+func TestTools_UploadFiles_DedupeByHash(t *testing.T) {
+	uploadDir := t.TempDir()
+	testTools := Tools{DedupeByHash: true, CleanupOnError: true}
+
+	var names []string
+	for i, duplicate := range []bool{false, true} {
+		request := newUploadRequest(t, testFile{name: fmt.Sprintf("notes-%d.TXT", i), content: []byte("the same notes")})
+		uploadedFiles, err := testTools.UploadFiles(request, uploadDir, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if uploadedFiles[0].Duplicate != duplicate {
+			t.Errorf("upload %d: expected Duplicate to be %t", i, duplicate)
+		}
+		if expected := uploadedFiles[0].Checksum + ".txt"; uploadedFiles[0].NewFileName != expected {
+			t.Errorf("upload %d: expected file name %s, but got %s", i, expected, uploadedFiles[0].NewFileName)
+		}
+		names = append(names, uploadedFiles[0].NewFileName)
+	}
+	if names[0] != names[1] {
+		t.Errorf("expected identical uploads to share a name, but got %s and %s", names[0], names[1])
+	}
+
+	// A failed request must not remove the copy saved by the first one
+	testTools.AllowedFileTypes = []string{"text/plain"}
+	request := newUploadRequest(t,
+		testFile{name: "again.txt", content: []byte("the same notes")},
+		testFile{name: "image.png", content: pngHeader},
+	)
+	if _, err := testTools.UploadFiles(request, uploadDir); err == nil {
+		t.Error("error expected, but none received")
+	}
+
+	entries, _ := os.ReadDir(uploadDir)
+	if len(entries) != 1 || entries[0].Name() != names[0] {
+		t.Errorf("expected only %s in upload directory, but found %d entries", names[0], len(entries))
+	}
+
+	// Other stores are not supported
+	testTools = Tools{DedupeByHash: true, Store: &MemoryStore{}}
+	if _, err := testTools.UploadFiles(newUploadRequest(t, testFile{name: "notes.txt", content: []byte("notes")}), uploadDir); err == nil {
+		t.Error("expected an error when DedupeByHash is used with a Store")
+	}
+}
+
+// countingReader counts the bytes read from r
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func TestTools_UploadFiles_RequestTooLarge(t *testing.T) {
+	testTools := Tools{MaxFileSize: 1024}
+
+	// A large Content-Length is rejected without reading the body
+	request := newUploadRequest(t, testFile{name: "notes.txt", content: []byte("some notes")})
+	body := &countingReader{r: request.Body}
+	request.Body = io.NopCloser(body)
+	request.ContentLength = 10 << 30
+	if _, err := testTools.UploadFiles(request, t.TempDir()); !errors.Is(err, ErrRequestTooLarge) {
+		t.Errorf("expected ErrRequestTooLarge, but got %v", err)
+	}
+	if body.n != 0 {
+		t.Errorf("expected no body bytes to be read, but %d were", body.n)
+	}
+
+	// Without a Content-Length, the body is cut off once it goes over the limit
+	payload := &bytes.Buffer{}
+	writer := multipart.NewWriter(payload)
+	_ = writer.WriteField("notes", strings.Repeat("x", 2*maxMultipartOverhead))
+	_ = writer.Close()
+	request = httptest.NewRequest("POST", "/", payload)
+	request.Header.Add("Content-Type", writer.FormDataContentType())
+	request.ContentLength = -1
+	if _, err := testTools.UploadFiles(request, t.TempDir()); !errors.Is(err, ErrRequestTooLarge) {
+		t.Errorf("chunked: expected ErrRequestTooLarge, but got %v", err)
+	}
+
+	// Files adding up to more than MaxFileSize get the same error
+	request = newUploadRequest(t, testFile{name: "big.txt", content: bytes.Repeat([]byte("x"), 1025)})
+	if _, err := testTools.UploadFiles(request, t.TempDir()); !errors.Is(err, ErrRequestTooLarge) {
+		t.Errorf("files: expected ErrRequestTooLarge, but got %v", err)
+	}
+}
+
+func TestTools_UploadFiles_Concurrent(t *testing.T) {
+	// A zero MaxFileSize gets a default, which must not be written back to the shared Tools
+	var testTools Tools
+	uploadDir := t.TempDir()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		request := newUploadRequest(t, testFile{name: "notes.txt", content: []byte("some notes")})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := testTools.UploadFiles(request, uploadDir); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if testTools.MaxFileSize != 0 {
+		t.Errorf("expected MaxFileSize to be left at 0, but it is %d", testTools.MaxFileSize)
+	}
+}
+
+// newParsedUploadRequest is like newUploadRequest, but parses the form before returning the request
+func newParsedUploadRequest(t testing.TB, files ...testFile) *http.Request {
+	t.Helper()
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for _, f := range files {
+		part, err := writer.CreateFormFile("file", f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = part.Write(f.content)
+	}
+	_ = writer.Close()
+
+	request := httptest.NewRequest("POST", "/", body)
+	request.Header.Add("Content-Type", writer.FormDataContentType())
+	if err := request.ParseMultipartForm(32 << 20); err != nil {
+		t.Fatal(err)
+	}
+	return request
+}
+
+func TestTools_UploadFiles_UploadConcurrency(t *testing.T) {
+	var files []testFile
+	for i := 0; i < 20; i++ {
+		files = append(files, testFile{name: fmt.Sprintf("notes-%02d.txt", i), content: []byte(fmt.Sprintf("notes number %d", i))})
+	}
+
+	for _, concurrency := range []int{0, 1, 4, 32} {
+		uploadDir := t.TempDir()
+		testTools := Tools{UploadConcurrency: concurrency}
+
+		uploadedFiles, err := testTools.UploadFiles(newParsedUploadRequest(t, files...), uploadDir, false)
+		if err != nil {
+			t.Errorf("concurrency %d: %s", concurrency, err)
+			continue
+		}
+		if len(uploadedFiles) != len(files) {
+			t.Errorf("concurrency %d: expected %d uploaded files, but got %d", concurrency, len(files), len(uploadedFiles))
+			continue
+		}
+
+		// The files are returned in the order of the form
+		for i, f := range uploadedFiles {
+			if f.OriginalFileName != files[i].name {
+				t.Errorf("concurrency %d: expected %s at position %d, but got %s", concurrency, files[i].name, i, f.OriginalFileName)
+			}
+			if data, _ := os.ReadFile(f.SavedPath); !bytes.Equal(data, files[i].content) {
+				t.Errorf("concurrency %d: wrong contents for %s", concurrency, f.NewFileName)
+			}
+		}
+	}
+
+	// Every file is attempted, and the errors are joined in the order of the form
+	testTools := Tools{UploadConcurrency: 4, DeniedFileExtensions: []string{".exe"}}
+	request := newParsedUploadRequest(t,
+		testFile{name: "one.exe", content: []byte("one")},
+		testFile{name: "two.txt", content: []byte("two")},
+		testFile{name: "three.exe", content: []byte("three")},
+	)
+	uploadedFiles, err := testTools.UploadFiles(request, t.TempDir(), false)
+	if len(uploadedFiles) != 1 || uploadedFiles[0].OriginalFileName != "two.txt" {
+		t.Errorf("expected only two.txt to be uploaded, but got %d files", len(uploadedFiles))
+	}
+	expected := "the uploaded file extension .exe is not permitted\nthe uploaded file extension .exe is not permitted"
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected joined errors, but got %v", err)
+	}
+
+	// The limits are checked before anything is saved
+	testTools = Tools{UploadConcurrency: 4, MaxFileSize: 4}
+	uploadDir := t.TempDir()
+	if _, err := testTools.UploadFiles(newParsedUploadRequest(t, files[:2]...), uploadDir); !errors.Is(err, ErrRequestTooLarge) {
+		t.Errorf("expected ErrRequestTooLarge, but got %v", err)
+	}
+	if entries, _ := os.ReadDir(uploadDir); len(entries) != 0 {
+		t.Errorf("expected no files in upload directory, but found %d", len(entries))
+	}
+}
+
+func BenchmarkTools_UploadFiles_UploadConcurrency(b *testing.B) {
+	img, err := os.ReadFile("./testdata/img.png")
+	if err != nil {
+		b.Fatal(err)
+	}
+	var files []testFile
+	for i := 0; i < 20; i++ {
+		files = append(files, testFile{name: fmt.Sprintf("photo-%02d.png", i), content: img})
+	}
+
+	for _, concurrency := range []int{1, 4} {
+		b.Run(fmt.Sprintf("concurrency-%d", concurrency), func(b *testing.B) {
+			testTools := Tools{UploadConcurrency: concurrency, Thumbnail: &ThumbnailOptions{Width: 100, Height: 100}}
+			uploadDir := b.TempDir()
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				request := newParsedUploadRequest(b, files...)
+				b.StartTimer()
+				if _, err := testTools.UploadFiles(request, uploadDir); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestTools_DirSize(t *testing.T) {
+	dir := t.TempDir()
+	_ = os.MkdirAll(filepath.Join(dir, "nested"), 0755)
+	_ = os.WriteFile(filepath.Join(dir, "one.txt"), make([]byte, 100), 0644)
+	_ = os.WriteFile(filepath.Join(dir, "nested", "two.txt"), make([]byte, 50), 0644)
+
+	var testTools Tools
+	size, err := testTools.DirSize(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != 150 {
+		t.Errorf("expected 150 bytes, but got %d", size)
+	}
+}
+
+func TestTools_UploadFiles_MaxDirSize(t *testing.T) {
+	uploadDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(uploadDir, "existing.bin"), make([]byte, 1000), 0644); err != nil {
+		t.Fatal(err)
+	}
+	testTools := Tools{MaxDirSize: 1024}
+
+	// A file fitting in what is left of the quota is saved
+	request := newUploadRequest(t, testFile{name: "small.txt", content: bytes.Repeat([]byte("x"), 20)})
+	if _, err := testTools.UploadFiles(request, uploadDir); err != nil {
+		t.Fatal(err)
+	}
+
+	// The next one would take the directory over its quota
+	request = newUploadRequest(t, testFile{name: "small.txt", content: bytes.Repeat([]byte("x"), 20)})
+	_, err := testTools.UploadFiles(request, uploadDir)
+	if !errors.Is(err, ErrQuotaExceeded) || !strings.Contains(err.Error(), "1020 of 1024 bytes are used") {
+		t.Errorf("expected a quota error reporting the usage, but got %v", err)
+	}
+	if size, _ := testTools.DirSize(uploadDir); size != 1020 {
+		t.Errorf("expected the directory to be left at 1020 bytes, but it is %d", size)
+	}
+}
+
+var extensionContentTests = []struct {
+	name          string
+	file          testFile
+	extra         map[string][]string
+	expectedError string
+}{
+	{name: "png named png", file: testFile{name: "img.png", content: pngHeader}},
+	{name: "png named PNG", file: testFile{name: "img.PNG", content: pngHeader}},
+	{name: "png named pdf", file: testFile{name: "img.pdf", content: pngHeader}, expectedError: "has the extension .pdf, which does not match its detected type image/png"},
+	{name: "executable named jpg", file: testFile{name: "malware.jpg", content: []byte("MZ\x90\x00\x03\x00\x00\x00\x04\x00\x00\x00\xff\xff")}, expectedError: "does not match its detected type application/octet-stream"},
+	{name: "text named txt", file: testFile{name: "notes.txt", content: []byte("some notes")}},
+	{name: "no extension", file: testFile{name: "notes", content: []byte("some notes")}},
+	{name: "custom extension", file: testFile{name: "img.apng", content: pngHeader}, extra: map[string][]string{"image/png": {".apng"}}},
+	{name: "custom wildcard", file: testFile{name: "notes.ini", content: []byte("some notes")}, extra: map[string][]string{"text/*": {".ini"}}},
+}
+
+func TestTools_UploadFiles_VerifyExtensionMatchesContent(t *testing.T) {
+	for _, e := range extensionContentTests {
+		testTools := Tools{VerifyExtensionMatchesContent: true, ContentTypeExtensions: e.extra}
+
+		_, err := testTools.UploadFiles(newUploadRequest(t, e.file), t.TempDir())
+		if e.expectedError != "" {
+			if err == nil || !strings.Contains(err.Error(), e.expectedError) {
+				t.Errorf("%s: expected error containing %q, but got %v", e.name, e.expectedError, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: error not expected, but one received: %s", e.name, err)
+		}
+	}
+}
+
+var uploadErrorTests = []struct {
+	name         string
+	tools        Tools
+	uploadDir    string
+	file         testFile
+	expected     error
+	expectedType string
+}{
+	{name: "denied type", tools: Tools{DeniedFileTypes: []string{"image/*"}}, file: testFile{name: "img.png", content: pngHeader}, expected: ErrFileTypeNotPermitted, expectedType: "image/png"},
+	{name: "type not allowed", tools: Tools{AllowedFileTypes: []string{"text/plain"}}, file: testFile{name: "img.png", content: pngHeader}, expected: ErrFileTypeNotPermitted, expectedType: "image/png"},
+	{name: "extension not allowed", tools: Tools{AllowedFileExtensions: []string{".txt"}}, file: testFile{name: "img.png", content: pngHeader}, expected: ErrFileTypeNotPermitted},
+	{name: "file too big", tools: Tools{MaxSingleFileSize: 4}, file: testFile{name: "notes.txt", content: []byte("some notes")}, expected: ErrFileTooLarge, expectedType: "text/plain; charset=utf-8"},
+	{name: "file too small", tools: Tools{MinFileSize: 20}, file: testFile{name: "notes.txt", content: []byte("some notes")}, expected: ErrFileTooSmall, expectedType: "text/plain; charset=utf-8"},
+	{name: "request too big", tools: Tools{MaxFileSize: 4}, file: testFile{name: "notes.txt", content: []byte("some notes")}, expected: ErrRequestTooLarge},
+	{name: "upload dir unavailable", uploadDir: "/dev/null/uploads", file: testFile{name: "notes.txt", content: []byte("some notes")}, expected: ErrUploadDirUnavailable},
+}
+
+func TestTools_UploadFiles_Errors(t *testing.T) {
+	for _, e := range uploadErrorTests {
+		uploadDir := e.uploadDir
+		if uploadDir == "" {
+			uploadDir = t.TempDir()
+		}
+
+		_, err := e.tools.UploadFiles(newUploadRequest(t, e.file), uploadDir)
+		if !errors.Is(err, e.expected) {
+			t.Errorf("%s: expected an error matching %q, but got %v", e.name, e.expected, err)
+			continue
+		}
+
+		// Errors about a file tell which one it was
+		var uploadErr *UploadError
+		if errors.As(err, &uploadErr) {
+			if uploadErr.FileName != e.file.name || uploadErr.FileType != e.expectedType {
+				t.Errorf("%s: wrong file name %q or type %q", e.name, uploadErr.FileName, uploadErr.FileType)
+			}
+		} else if e.expected == ErrFileTypeNotPermitted || e.expected == ErrFileTooLarge || e.expected == ErrFileTooSmall {
+			t.Errorf("%s: expected an *UploadError, but got %T", e.name, err)
+		}
+	}
+}
+
+func TestTools_UploadFiles_BodyLimit(t *testing.T) {
+	// Any temporary file would be created here
+	tempDir := t.TempDir()
+	t.Setenv("TMPDIR", tempDir)
+
+	const limit = 1 << 20
+	testTools := Tools{MaxFileSize: limit}
+	uploadDir := t.TempDir()
+
+	// A streamed body doesn't announce its size, and is much larger than the limit
+	request := syntheticUpload(16 * limit)
+	defer request.Body.Close()
+	body := &countingReader{r: request.Body}
+	request.Body = io.NopCloser(body)
+	request.ContentLength = -1
+
+	_, err := testTools.UploadFiles(request, uploadDir)
+	if !errors.Is(err, ErrRequestTooLarge) {
+		t.Errorf("expected ErrRequestTooLarge, but got %v", err)
+	}
+
+	// Reading stops soon after the limit, and nothing is left on disk
+	if max := int64(limit + maxMultipartOverhead + 64*1024); body.n > max {
+		t.Errorf("expected at most %d bytes to be read, but %d were", max, body.n)
+	}
+	for _, dir := range []string{tempDir, uploadDir} {
+		if size, _ := testTools.DirSize(dir); size != 0 {
+			t.Errorf("expected nothing to be left in %s, but found %d bytes", dir, size)
+		}
+	}
+}
+
+func TestTools_FS(t *testing.T) {
+	memoryFS := &MemoryFS{}
+	testTools := Tools{FS: memoryFS}
+
+	if err := testTools.CreateDirIfNotExists("users/42"); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := memoryFS.Stat("users/42"); err != nil || !info.IsDir() {
+		t.Errorf("expected users/42 to be a directory, but got %v", err)
+	}
+
+	request := newUploadRequest(t, testFile{name: "notes.txt", content: []byte("some notes")})
+	uploadedFiles, err := testTools.UploadFiles(request, "users/42/docs", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uploadedFiles[0].SavedPath != filepath.Join("users", "42", "docs", "notes.txt") {
+		t.Errorf("wrong saved path %s", uploadedFiles[0].SavedPath)
+	}
+	if data, _ := memoryFS.ReadFile(uploadedFiles[0].SavedPath); string(data) != "some notes" {
+		t.Errorf("expected file in memory, but got %q", data)
+	}
+	if _, err := os.Stat("users"); !os.IsNotExist(err) {
+		t.Error("expected nothing to be written to disk")
+	}
+
+	// Files are downloaded from FS too
+	rr := httptest.NewRecorder()
+	testTools.DownloadStaticFile(rr, httptest.NewRequest("GET", "/", nil), uploadedFiles[0].SavedPath, "my-notes.txt")
+	if rr.Body.String() != "some notes" || rr.Header().Get("Content-Disposition") != `attachment; filename="my-notes.txt"` {
+		t.Errorf("wrong download %q with headers %v", rr.Body.String(), rr.Header())
+	}
+	rr = httptest.NewRecorder()
+	testTools.DownloadStaticFile(rr, httptest.NewRequest("GET", "/", nil), "users/42/missing.txt", "missing.txt")
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a missing file, but got %d", rr.Code)
+	}
+
+	// Options that need the local disk are refused
+	testTools.MaxDirSize = 1024
+	request = newUploadRequest(t, testFile{name: "notes.txt", content: []byte("some notes")})
+	if _, err := testTools.UploadFiles(request, "users/42/docs"); err == nil {
+		t.Error("expected an error when MaxDirSize is used with FS")
+	}
+}
@@ -0,0 +1,94 @@
+package toolkit
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// ErrAlreadyWritten is returned by WriteJSON, ErrorJSON and the other writers of this package, without writing
+// anything, when the response writer is, or wraps, a ResponseWriterWrapper whose response was already written
+type ErrAlreadyWritten struct {
+	// Status is the status code the response was written with
+	Status int
+}
+
+func (e *ErrAlreadyWritten) Error() string {
+	return fmt.Sprintf("response was already written with status %d", e.Status)
+}
+
+// ResponseWriterWrapper wraps a response writer to remember the status code and the size of the response
+// written through it, for logging middleware, and so the writers of this package refuse to write a response
+// twice. A second call to WriteHeader is ignored rather than logged as superfluous by the server.
+type ResponseWriterWrapper struct {
+	http.ResponseWriter
+	status  int
+	written int64
+}
+
+// NewResponseWriterWrapper returns a ResponseWriterWrapper for writer, or writer itself when it is one already
+func NewResponseWriterWrapper(writer http.ResponseWriter) *ResponseWriterWrapper {
+	if w, ok := writer.(*ResponseWriterWrapper); ok {
+		return w
+	}
+	return &ResponseWriterWrapper{ResponseWriter: writer}
+}
+
+// WriteHeader sends the headers with the status code, unless they were sent already
+func (w *ResponseWriterWrapper) WriteHeader(status int) {
+	if w.status != 0 {
+		return
+	}
+	// Informational responses, such as 103 Early Hints, can be followed by the final one
+	if status >= 200 || status == http.StatusSwitchingProtocols {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write writes b to the body, after the headers with the status code 200 OK if they were not sent yet
+func (w *ResponseWriterWrapper) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.written += int64(n)
+	return n, err
+}
+
+// Flush sends what was written so far to the client, when the wrapped writer supports it
+func (w *ResponseWriterWrapper) Flush() {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap returns the wrapped response writer, for http.ResponseController
+func (w *ResponseWriterWrapper) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// Status returns the status code the response was written with, or 0 when it was not written yet
+func (w *ResponseWriterWrapper) Status() int { return w.status }
+
+// BytesWritten returns the number of bytes of the body written so far
+func (w *ResponseWriterWrapper) BytesWritten() int64 { return w.written }
+
+// Written reports whether the headers of the response were sent
+func (w *ResponseWriterWrapper) Written() bool { return w.status != 0 }
+
+// checkNotWritten returns an *ErrAlreadyWritten when writer is, or wraps, a ResponseWriterWrapper whose
+// response was already written
+func checkNotWritten(writer http.ResponseWriter) error {
+	for writer != nil {
+		if w, ok := writer.(*ResponseWriterWrapper); ok && w.Written() {
+			return &ErrAlreadyWritten{Status: w.Status()}
+		}
+		unwrapper, ok := writer.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return nil
+		}
+		writer = unwrapper.Unwrap()
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package toolkit
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var alreadyWrittenTests = []struct {
+	name  string
+	write func(t *Tools, w http.ResponseWriter) error
+}{
+	{name: "WriteJSON", write: func(t *Tools, w http.ResponseWriter) error { return t.WriteJSON(w, http.StatusOK, "second") }},
+	{name: "ErrorJSON", write: func(t *Tools, w http.ResponseWriter) error { return t.ErrorJSON(w, errors.New("second")) }},
+	{name: "NoContent", write: func(t *Tools, w http.ResponseWriter) error { return t.NoContent(w) }},
+	{name: "WriteXML", write: func(t *Tools, w http.ResponseWriter) error { return t.WriteXML(w, http.StatusOK, "second") }},
+	{name: "WriteJSONCached", write: func(t *Tools, w http.ResponseWriter) error {
+		return t.WriteJSONCached(w, httptest.NewRequest("GET", "/", nil), http.StatusOK, "second")
+	}},
+	{name: "WriteJSONCached not modified", write: func(t *Tools, w http.ResponseWriter) error {
+		request := httptest.NewRequest("GET", "/", nil)
+		request.Header.Set("If-None-Match", "*")
+		return t.WriteJSONCached(w, request, http.StatusOK, "second")
+	}},
+	{name: "WriteJSONStream", write: func(t *Tools, w http.ResponseWriter) error {
+		return t.WriteJSONStream(w, http.StatusOK, streamItems(1))
+	}},
+}
+
+func TestTools_WriteJSON_AlreadyWritten(t *testing.T) {
+	var testTools Tools
+
+	for _, e := range alreadyWrittenTests {
+		rr := httptest.NewRecorder()
+		w := NewResponseWriterWrapper(rr)
+		if err := testTools.WriteJSON(w, http.StatusCreated, "first"); err != nil {
+			t.Fatalf("%s: %v", e.name, err)
+		}
+
+		var alreadyWritten *ErrAlreadyWritten
+		err := e.write(&testTools, w)
+		if !errors.As(err, &alreadyWritten) || alreadyWritten.Status != http.StatusCreated {
+			t.Errorf("%s: expected an *ErrAlreadyWritten with status 201, but got %v", e.name, err)
+		}
+		if rr.Code != http.StatusCreated || rr.Body.String() != `"first"` || rr.Header().Get("Content-Length") != "7" {
+			t.Errorf("%s: expected the first response to be left as it was, but got %d %q", e.name, rr.Code, rr.Body.String())
+		}
+	}
+
+	// The wrapper is found through writers that wrap it, such as the one of NegotiateEncoding
+	rr := httptest.NewRecorder()
+	w := NewResponseWriterWrapper(rr)
+	w.WriteHeader(http.StatusAccepted)
+	var alreadyWritten *ErrAlreadyWritten
+	if err := testTools.WriteJSON(&encodingWriter{ResponseWriter: w}, http.StatusOK, "x"); !errors.As(err, &alreadyWritten) {
+		t.Errorf("expected an *ErrAlreadyWritten through a wrapping writer, but got %v", err)
+	}
+}
+
+func TestResponseWriterWrapper(t *testing.T) {
+	rr := httptest.NewRecorder()
+	w := NewResponseWriterWrapper(rr)
+	if NewResponseWriterWrapper(w) != w {
+		t.Error("expected a wrapper not to be wrapped again")
+	}
+	if w.Written() || w.Status() != 0 || w.BytesWritten() != 0 {
+		t.Errorf("expected nothing written yet, but got %t, %d, %d", w.Written(), w.Status(), w.BytesWritten())
+	}
+
+	_, _ = io.WriteString(w, "hello")
+	w.WriteHeader(http.StatusInternalServerError)
+	_, _ = io.WriteString(w, " world")
+	w.Flush()
+
+	if !w.Written() || w.Status() != http.StatusOK || w.BytesWritten() != 11 {
+		t.Errorf("expected 200 and 11 bytes, but got %t, %d, %d", w.Written(), w.Status(), w.BytesWritten())
+	}
+	if rr.Code != http.StatusOK || rr.Body.String() != "hello world" || !rr.Flushed {
+		t.Errorf("expected the body to be written and flushed with 200, but got %d %q", rr.Code, rr.Body.String())
+	}
+	if http.NewResponseController(w).Flush() != nil {
+		t.Error("expected http.ResponseController to reach the wrapped writer")
+	}
+}
+
+func TestTools_NegotiateEncoding_WrappedWriter(t *testing.T) {
+	testTools := Tools{CompressionThreshold: 10}
+	handler := testTools.NegotiateEncoding(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Logging middleware wraps the writer of NegotiateEncoding
+		wrapped := NewResponseWriterWrapper(w)
+		_ = testTools.WriteJSON(wrapped, http.StatusOK, strings.Repeat("a", 100))
+		if wrapped.BytesWritten() == 0 || wrapped.BytesWritten() >= 100 {
+			t.Errorf("expected the compressed size to be counted, but got %d", wrapped.BytesWritten())
+		}
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Header().Get("Content-Encoding") != "gzip" {
+		t.Errorf("expected the response to be gzipped through the wrapper, but got headers %v", rr.Header())
+	}
+}
@@ -0,0 +1,140 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// ErrMultipleXMLValues is returned by ReadXML for a body with anything but comments and white space after the
+// root element
+var ErrMultipleXMLValues = errors.New("body must contain only one XML document")
+
+// ErrMalformedXML is returned by ReadXML for a body that is not well-formed XML
+type ErrMalformedXML struct {
+	// Line is the line of the error, when it is known
+	Line int
+	// Err is the error of the decoder
+	Err error
+}
+
+func (e *ErrMalformedXML) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("body contains badly-formed XML (at line %d)", e.Line)
+	}
+	return "body contains badly-formed XML"
+}
+
+func (e *ErrMalformedXML) Unwrap() error { return e.Err }
+
+// XMLResponse is the body ErrorXML sends
+type XMLResponse struct {
+	XMLName xml.Name `xml:"response"`
+	Error   bool     `xml:"error"`
+	Message string   `xml:"message"`
+	// Code is a stable, machine readable code for an error, such as "user_not_found"
+	Code string `xml:"code,omitempty"`
+}
+
+// ReadXML reads the XML document in the body of a request into data, like ReadJSON does with JSON. The body
+// is limited to MaxJSONSize too, and data is validated once decoded when it implements Validator or
+// FieldValidator. The errors about the body match ErrBodyTooLarge, ErrEmptyBody or ErrMultipleXMLValues with
+// errors.Is, or are an *ErrMalformedXML
+func (t *Tools) ReadXML(writer http.ResponseWriter, request *http.Request, data any) error {
+	request.Body = http.MaxBytesReader(writer, request.Body, int64(t.maxJSONSize()))
+
+	decode := xml.NewDecoder(request.Body)
+	if err := decode.Decode(data); err != nil {
+		// The decoder skips text outside of elements, so a body without any looks empty to it
+		if err == io.EOF && decode.InputOffset() > 0 {
+			return &ErrMalformedXML{Err: errors.New("no root element")}
+		}
+		return xmlDecodeError(err)
+	}
+
+	// Only comments, processing instructions and white space may follow the root element
+	for {
+		token, err := decode.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return xmlDecodeError(err)
+		}
+		switch token := token.(type) {
+		case xml.Comment, xml.ProcInst:
+		case xml.CharData:
+			if len(bytes.TrimSpace(token)) > 0 {
+				return ErrMultipleXMLValues
+			}
+		default:
+			return ErrMultipleXMLValues
+		}
+	}
+
+	return validate(data)
+}
+
+// xmlDecodeError returns the error ReadXML returns for the error err of the decoder
+func xmlDecodeError(err error) error {
+	var syntaxError *xml.SyntaxError
+	var maxBytesError *http.MaxBytesError
+
+	switch {
+	case errors.As(err, &maxBytesError):
+		return bodyTooLarge(maxBytesError)
+
+	case errors.As(err, &syntaxError):
+		return &ErrMalformedXML{Line: syntaxError.Line, Err: err}
+
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return &ErrMalformedXML{Err: err}
+
+	case errors.Is(err, io.EOF):
+		return ErrEmptyBody
+
+	default:
+		return fmt.Errorf("error unmarshalling XML: %w", err)
+	}
+}
+
+// WriteXML writes data encoded as XML, after the standard XML header, with the status code and the optional
+// headers, as WriteJSON does with JSON
+func (t *Tools) WriteXML(writer http.ResponseWriter, status int, data any, headers ...http.Header) error {
+	if status == http.StatusNoContent || status == http.StatusNotModified {
+		setHeaders(writer, headers)
+		writer.WriteHeader(status)
+		t.observeResponse(status, 0, 0)
+		return nil
+	}
+
+	started := t.encodeStart()
+	buf := jsonBufferPool.Get().(*bytes.Buffer)
+	defer putJSONBuffer(buf)
+
+	buf.WriteString(xml.Header)
+	if err := xml.NewEncoder(buf).Encode(data); err != nil {
+		return err
+	}
+
+	return t.writeJSONBuffer(writer, status, "application/xml", buf, headers, started)
+}
+
+// ErrorXML sends err as an XMLResponse, with the optional status code, 400 Bad Request by default, as ErrorJSON
+// does with JSON. When err, or an error it wraps, implements ErrorCoder, its code is sent too
+func (t *Tools) ErrorXML(writer http.ResponseWriter, err error, status ...int) error {
+	statusCode := http.StatusBadRequest
+	if len(status) > 0 {
+		statusCode = status[0]
+	}
+
+	payload := XMLResponse{Error: true, Message: err.Error()}
+	var coder ErrorCoder
+	if errors.As(err, &coder) {
+		payload.Code = coder.ErrorCode()
+	}
+	return t.WriteXML(writer, statusCode, payload)
+}
@@ -0,0 +1,115 @@
+package toolkit
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var xmlTests = []struct {
+	name          string
+	xml           string
+	errorExpected bool
+	maxSize       int
+	expectedError error
+	expectedType  error
+	expectedLine  int
+}{
+	{name: "good xml", xml: `<payload><foo>bar</foo></payload>`, errorExpected: false, maxSize: 1024},
+	{name: "with header and comment", xml: xml.Header + `<payload><foo>bar</foo></payload>` + "\n<!-- end -->\n", errorExpected: false, maxSize: 1024},
+	{name: "badly formatted xml", xml: "<payload>\n<foo>bar</fo>\n</payload>", errorExpected: true, maxSize: 1024, expectedType: &ErrMalformedXML{}, expectedLine: 2},
+	{name: "unclosed element", xml: `<payload><foo>bar</foo>`, errorExpected: true, maxSize: 1024, expectedType: &ErrMalformedXML{}},
+	{name: "two documents", xml: `<payload><foo>1</foo></payload><payload></payload>`, errorExpected: true, maxSize: 1024, expectedError: ErrMultipleXMLValues},
+	{name: "trailing text", xml: `<payload><foo>1</foo></payload>garbage`, errorExpected: true, maxSize: 1024, expectedError: ErrMultipleXMLValues},
+	{name: "empty body", xml: ``, errorExpected: true, maxSize: 1024, expectedError: ErrEmptyBody},
+	{name: "file too large", xml: `<payload><foo>bar</foo></payload>`, errorExpected: true, maxSize: 4, expectedError: ErrBodyTooLarge},
+	{name: "not XML", xml: `hello error`, errorExpected: true, maxSize: 1024, expectedType: &ErrMalformedXML{}},
+}
+
+func TestTools_ReadXML(t *testing.T) {
+	var testTool Tools
+	for _, e := range xmlTests {
+		testTool.MaxJSONSize = e.maxSize
+
+		var decoded struct {
+			Foo string `xml:"foo"`
+		}
+		err := testTool.ReadXML(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader(e.xml)), &decoded)
+
+		if e.errorExpected && err == nil {
+			t.Errorf("%s: error expected, but none received", e.name)
+		}
+		if !e.errorExpected && err != nil {
+			t.Errorf("%s: error not expected, but one received: %s", e.name, err.Error())
+		}
+		if !e.errorExpected && decoded.Foo != "bar" {
+			t.Errorf("%s: expected foo to be bar, but got %q", e.name, decoded.Foo)
+		}
+		if e.expectedError != nil && !errors.Is(err, e.expectedError) {
+			t.Errorf("%s: expected an error matching %v, but got %v", e.name, e.expectedError, err)
+		}
+		if e.expectedType != nil && !errors.As(err, reflect.New(reflect.TypeOf(e.expectedType)).Interface()) {
+			t.Errorf("%s: expected an error of type %T, but got %T: %v", e.name, e.expectedType, err, err)
+		}
+		var malformed *ErrMalformedXML
+		if e.expectedLine > 0 && (!errors.As(err, &malformed) || malformed.Line != e.expectedLine) {
+			t.Errorf("%s: expected the error to be at line %d, but got %v", e.name, e.expectedLine, err)
+		}
+	}
+}
+
+func TestTools_WriteXML(t *testing.T) {
+	var testTools Tools
+
+	type payload struct {
+		XMLName xml.Name `xml:"payload"`
+		Foo     string   `xml:"foo"`
+	}
+	headers := make(http.Header)
+	headers.Add("FOO", "BAR")
+
+	rr := httptest.NewRecorder()
+	if err := testTools.WriteXML(rr, http.StatusCreated, payload{Foo: "a < b"}, headers); err != nil {
+		t.Fatal(err)
+	}
+	expected := xml.Header + `<payload><foo>a &lt; b</foo></payload>`
+	if rr.Code != http.StatusCreated || rr.Body.String() != expected {
+		t.Errorf("expected %d %s, but got %d %s", http.StatusCreated, expected, rr.Code, rr.Body.String())
+	}
+	if rr.Header().Get("Content-Type") != "application/xml" || rr.Header().Get("Foo") != "BAR" {
+		t.Errorf("wrong headers %v", rr.Header())
+	}
+
+	rr = httptest.NewRecorder()
+	if err := testTools.WriteXML(rr, http.StatusOK, make(chan int)); err == nil || rr.Body.Len() > 0 {
+		t.Error("expected an error, and nothing written, for a value XML cannot encode")
+	}
+}
+
+func TestTools_ErrorXML(t *testing.T) {
+	var testTools Tools
+
+	rr := httptest.NewRecorder()
+	if err := testTools.ErrorXML(rr, fmt.Errorf("loading: %w", notFoundError{what: "user"}), http.StatusNotFound); err != nil {
+		t.Fatal(err)
+	}
+
+	var response XMLResponse
+	if err := xml.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if rr.Code != http.StatusNotFound || !response.Error || response.Message == "" || response.Code != "user_not_found" {
+		t.Errorf("wrong response %d %+v", rr.Code, response)
+	}
+
+	rr = httptest.NewRecorder()
+	_ = testTools.ErrorXML(rr, errors.New("some error"))
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "<message>some error</message>") {
+		t.Errorf("wrong response %d %s", rr.Code, rr.Body.String())
+	}
+}
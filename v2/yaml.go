@@ -0,0 +1,144 @@
+package toolkit
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// YAMLCodec encodes and decodes YAML for ReadYAML and WriteYAML, which keeps the toolkit free of a YAML
+// dependency. An adapter for gopkg.in/yaml.v3 is a few lines long:
+//
+//	type yamlCodec struct{}
+//
+//	func (yamlCodec) NewDecoder(r io.Reader) toolkit.YAMLDecoder { return yaml.NewDecoder(r) }
+//	func (yamlCodec) Marshal(v any) ([]byte, error)              { return yaml.Marshal(v) }
+type YAMLCodec interface {
+	// NewDecoder returns a decoder reading the documents of r one after the other
+	NewDecoder(r io.Reader) YAMLDecoder
+	// Marshal encodes v as a YAML document
+	Marshal(v any) ([]byte, error)
+}
+
+// YAMLDecoder decodes the documents of a YAML stream
+type YAMLDecoder interface {
+	// Decode decodes the next document into v, and returns io.EOF when there is none left
+	Decode(v any) error
+}
+
+// ErrNoYAMLCodec is returned by ReadYAML and WriteYAML when Tools.YAML is not set
+var ErrNoYAMLCodec = errors.New("no YAML codec is set")
+
+// ErrMultipleYAMLDocuments is returned by ReadYAML for a body with more than one document, unless
+// AllowMultipleYAMLDocs is set
+var ErrMultipleYAMLDocuments = errors.New("body must contain only one YAML document")
+
+// ErrMalformedYAML is returned by ReadYAML for a body that is not valid YAML, or does not fit data
+type ErrMalformedYAML struct {
+	// Line is the line of the error, when it is known
+	Line int
+	// Column is the column of the error, when it is known
+	Column int
+	// Err is the error of the codec
+	Err error
+}
+
+func (e *ErrMalformedYAML) Error() string {
+	switch {
+	case e.Column > 0:
+		return fmt.Sprintf("body contains invalid YAML (at line %d, column %d): %s", e.Line, e.Column, yamlErrorDetail(e.Err))
+	case e.Line > 0:
+		return fmt.Sprintf("body contains invalid YAML (at line %d): %s", e.Line, yamlErrorDetail(e.Err))
+	default:
+		return fmt.Sprintf("body contains invalid YAML: %s", yamlErrorDetail(e.Err))
+	}
+}
+
+func (e *ErrMalformedYAML) Unwrap() error { return e.Err }
+
+// yamlPosition finds the line, and column, in the message of an error of a YAML parser, such as
+// "yaml: line 3: found character that cannot start any token" or "line 2, column 5: did not find expected key"
+var yamlPosition = regexp.MustCompile(`line (\d+)(?:, column (\d+))?:\s*`)
+
+// yamlErrorDetail returns the message of err, without the prefix and position the YAML parser starts it with
+func yamlErrorDetail(err error) string {
+	message := strings.TrimPrefix(err.Error(), "yaml: ")
+	if loc := yamlPosition.FindStringIndex(message); loc != nil && loc[0] == 0 {
+		message = message[loc[1]:]
+	}
+	return message
+}
+
+// ReadYAML reads the YAML document in the body of a request into data, with the codec set in Tools.YAML, and
+// with the same limit, MaxJSONSize, and validation as ReadJSON. The errors about the body match
+// ErrBodyTooLarge, ErrEmptyBody or ErrMultipleYAMLDocuments with errors.Is, or are an *ErrMalformedYAML with
+// the position of the error, when the parser gives it. Documents after the first are ignored when
+// AllowMultipleYAMLDocs is set
+func (t *Tools) ReadYAML(writer http.ResponseWriter, request *http.Request, data any) error {
+	if t.YAML == nil {
+		return ErrNoYAMLCodec
+	}
+	request.Body = http.MaxBytesReader(writer, request.Body, int64(t.maxJSONSize()))
+
+	decode := t.YAML.NewDecoder(request.Body)
+	if err := decode.Decode(data); err != nil {
+		return yamlDecodeError(err)
+	}
+
+	if !t.AllowMultipleYAMLDocs {
+		var next any
+		err := decode.Decode(&next)
+		if err == nil {
+			return ErrMultipleYAMLDocuments
+		}
+		if err != io.EOF {
+			return yamlDecodeError(err)
+		}
+	}
+	return validate(data)
+}
+
+// yamlDecodeError returns the error ReadYAML returns for the error err of the decoder
+func yamlDecodeError(err error) error {
+	var malformed *ErrMalformedYAML
+	var maxBytesError *http.MaxBytesError
+
+	switch {
+	case errors.As(err, &malformed):
+		return err
+
+	case errors.As(err, &maxBytesError):
+		return bodyTooLarge(maxBytesError)
+
+	case errors.Is(err, io.EOF):
+		return ErrEmptyBody
+
+	default:
+		malformed = &ErrMalformedYAML{Err: err}
+		if match := yamlPosition.FindStringSubmatch(err.Error()); match != nil {
+			malformed.Line, _ = strconv.Atoi(match[1])
+			malformed.Column, _ = strconv.Atoi(match[2])
+		}
+		return malformed
+	}
+}
+
+// WriteYAML writes data encoded as YAML, with the codec set in Tools.YAML, with the status code and the
+// optional headers, as WriteJSON does with JSON
+func (t *Tools) WriteYAML(writer http.ResponseWriter, status int, data any, headers ...http.Header) error {
+	if t.YAML == nil {
+		return ErrNoYAMLCodec
+	}
+	return t.writeEncoded(writer, status, "application/yaml", func(w io.Writer, data any) error {
+		out, err := t.YAML.Marshal(data)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(out)
+		return err
+	}, data, headers)
+}
@@ -0,0 +1,177 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// flatYAML is a YAMLCodec for the tests, which only knows documents of "key: value" lines, and reports errors
+// the way gopkg.in/yaml.v3 does
+type flatYAML struct{}
+
+func (flatYAML) NewDecoder(r io.Reader) YAMLDecoder { return &flatYAMLDecoder{r: r} }
+
+func (flatYAML) Marshal(v any) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+	var lines []string
+	for key, value := range fields {
+		lines = append(lines, fmt.Sprintf("%s: %v\n", key, value))
+	}
+	sort.Strings(lines)
+	return []byte(strings.Join(lines, "")), nil
+}
+
+// flatYAMLDecoder decodes the documents of a flatYAML stream
+type flatYAMLDecoder struct {
+	r         io.Reader
+	documents [][]string
+	first     []int
+	read      bool
+}
+
+func (d *flatYAMLDecoder) Decode(v any) error {
+	if !d.read {
+		d.read = true
+		b, err := io.ReadAll(d.r)
+		if err != nil {
+			return err
+		}
+		var document []string
+		start := 1
+		for i, line := range strings.Split(string(b), "\n") {
+			if line == "---" {
+				d.documents, d.first = append(d.documents, document), append(d.first, start)
+				document, start = nil, i+2
+				continue
+			}
+			document = append(document, line)
+		}
+		if strings.TrimSpace(strings.Join(document, "")) != "" || len(d.documents) > 0 {
+			d.documents, d.first = append(d.documents, document), append(d.first, start)
+		}
+	}
+	if len(d.documents) == 0 {
+		return io.EOF
+	}
+	document, first := d.documents[0], d.first[0]
+	d.documents, d.first = d.documents[1:], d.first[1:]
+
+	fields := make(map[string]any)
+	for i, line := range document {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "\t") {
+			return fmt.Errorf("yaml: line %d: found character that cannot start any token", first+i)
+		}
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			return fmt.Errorf("yaml: line %d: could not find expected ':'", first+i)
+		}
+		value = strings.TrimSpace(value)
+		if n, err := strconv.Atoi(value); err == nil {
+			fields[strings.TrimSpace(key)] = n
+		} else {
+			fields[strings.TrimSpace(key)] = value
+		}
+	}
+	b, _ := json.Marshal(fields)
+	return json.Unmarshal(b, v)
+}
+
+// yamlConfig is the struct the YAML tests decode
+type yamlConfig struct {
+	Name     string `json:"name"`
+	Replicas int    `json:"replicas"`
+}
+
+var yamlTests = []struct {
+	name          string
+	yaml          string
+	maxSize       int
+	allowMultiple bool
+	expectedError error
+	expectedLine  int
+	expected      yamlConfig
+}{
+	{name: "good yaml", yaml: "name: api\nreplicas: 3\n", expected: yamlConfig{Name: "api", Replicas: 3}},
+	{name: "tabs instead of spaces", yaml: "name: api\n\treplicas: 3\n", expectedLine: 2},
+	{name: "missing colon", yaml: "name: api\nreplicas\n", expectedLine: 2},
+	{name: "empty body", yaml: "", expectedError: ErrEmptyBody},
+	{name: "too large", yaml: "name: " + strings.Repeat("a", 100) + "\n", maxSize: 50, expectedError: ErrBodyTooLarge},
+	{name: "multiple documents", yaml: "name: api\n---\nname: worker\n", expectedError: ErrMultipleYAMLDocuments},
+	{name: "error in second document", yaml: "name: api\n---\n\treplicas: 1\n", expectedLine: 3},
+	{name: "multiple documents allowed", yaml: "name: api\n---\nname: worker\n", allowMultiple: true, expected: yamlConfig{Name: "api"}},
+}
+
+func TestTools_ReadYAML(t *testing.T) {
+	for _, e := range yamlTests {
+		testTools := Tools{YAML: flatYAML{}, MaxJSONSize: e.maxSize, AllowMultipleYAMLDocs: e.allowMultiple}
+
+		var decoded yamlConfig
+		err := testTools.ReadYAML(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader(e.yaml)), &decoded)
+
+		if e.expectedError == nil && e.expectedLine == 0 {
+			if err != nil {
+				t.Errorf("%s: error not expected, but one received: %s", e.name, err.Error())
+			}
+			if decoded != e.expected {
+				t.Errorf("%s: expected %+v, but got %+v", e.name, e.expected, decoded)
+			}
+			continue
+		}
+		if e.expectedError != nil && !errors.Is(err, e.expectedError) {
+			t.Errorf("%s: expected an error matching %v, but got %v", e.name, e.expectedError, err)
+		}
+		var malformed *ErrMalformedYAML
+		if e.expectedLine > 0 && (!errors.As(err, &malformed) || malformed.Line != e.expectedLine) {
+			t.Errorf("%s: expected an error at line %d, but got %v", e.name, e.expectedLine, err)
+		}
+	}
+
+	// The message keeps the detail of the parser, with the position in the same place whatever the parser
+	err := (&ErrMalformedYAML{Line: 2, Column: 5, Err: errors.New("yaml: line 2, column 5: did not find expected key")}).Error()
+	if err != "body contains invalid YAML (at line 2, column 5): did not find expected key" {
+		t.Errorf("wrong message %q", err)
+	}
+
+	var testTools Tools
+	if err := testTools.ReadYAML(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader("a: b")), &yamlConfig{}); !errors.Is(err, ErrNoYAMLCodec) {
+		t.Errorf("expected ErrNoYAMLCodec without a codec, but got %v", err)
+	}
+}
+
+func TestTools_WriteYAML(t *testing.T) {
+	testTools := Tools{YAML: flatYAML{}}
+	config := yamlConfig{Name: "api", Replicas: 3}
+
+	rr := httptest.NewRecorder()
+	if err := testTools.WriteYAML(rr, http.StatusOK, config); err != nil {
+		t.Fatal(err)
+	}
+	if rr.Header().Get("Content-Type") != "application/yaml" || rr.Body.String() != "name: api\nreplicas: 3\n" {
+		t.Errorf("wrong response %v %q", rr.Header(), rr.Body.String())
+	}
+
+	// Round trip the response back into the struct
+	var decoded yamlConfig
+	if err := testTools.ReadYAML(httptest.NewRecorder(), httptest.NewRequest("POST", "/", rr.Body), &decoded); err != nil || !reflect.DeepEqual(decoded, config) {
+		t.Errorf("expected %+v back, but got %+v, %v", config, decoded, err)
+	}
+}
@@ -0,0 +1,192 @@
+package toolkit
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// defaultMaxZipEntries is the number of entries accepted in a zip archive when MaxZipEntries is zero
+const defaultMaxZipEntries = 1000
+
+// UploadAndExtractZip saves the zip archive uploaded as the single file of the multipart request r to a
+// temporary file, and extracts it to destDir. Every entry is saved with the same checks and options as
+// UploadFiles, except that it is never renamed, and returned with NewFileName set to its path in the archive.
+//
+// Entries with an absolute path, or a path leading out of destDir, are rejected, as well as symbolic links.
+// To defend against zip bombs, MaxFileSize limits both the size of the archive and the total size of the
+// extracted files, MaxSingleFileSize the size of each of them, and MaxZipEntries the number of entries. Sizes
+// are checked against what is actually extracted, not what the archive claims.
+func (t *Tools) UploadAndExtractZip(r *http.Request, destDir string) (extractedFiles []*UploadedFile, err error) {
+	defer func() {
+		if err != nil && t.CleanupOnError {
+			t.deleteUploadedFiles(extractedFiles)
+			extractedFiles = nil
+		}
+	}()
+
+	maxSize := t.maxUploadSize()
+	archive, size, err := receiveZip(r, maxSize)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = archive.Close()
+		_ = os.Remove(archive.Name())
+	}()
+
+	zipReader, err := zip.NewReader(archive, size)
+	if err != nil {
+		return nil, fmt.Errorf("the uploaded file is not a valid zip archive: %w", err)
+	}
+
+	maxEntries := t.MaxZipEntries
+	if maxEntries == 0 {
+		maxEntries = defaultMaxZipEntries
+	}
+	if len(zipReader.File) > maxEntries {
+		return nil, fmt.Errorf("the zip archive has %d entries, more than the allowed %d", len(zipReader.File), maxEntries)
+	}
+
+	// Check every entry before extracting anything, so a malicious archive leaves nothing behind
+	var declared uint64
+	for _, entry := range zipReader.File {
+		if _, err := zipEntryPath(entry); err != nil {
+			return nil, err
+		}
+		declared += entry.UncompressedSize64
+	}
+	if declared > uint64(maxSize) {
+		return nil, ErrRequestTooLarge
+	}
+
+	remaining := maxSize
+	for _, entry := range zipReader.File {
+		if err := r.Context().Err(); err != nil {
+			return extractedFiles, err
+		}
+		if entry.FileInfo().IsDir() {
+			continue
+		}
+
+		extractedFile, err := t.extractZipEntry(r, entry, destDir, remaining)
+		if err != nil {
+			return extractedFiles, err
+		}
+		remaining -= extractedFile.FileSize
+		extractedFiles = append(extractedFiles, extractedFile)
+	}
+
+	return extractedFiles, nil
+}
+
+// extractZipEntry saves a file of a zip archive under destDir, refusing to write more than maxSize bytes
+func (t *Tools) extractZipEntry(r *http.Request, entry *zip.File, destDir string, maxSize int64) (*UploadedFile, error) {
+	entryPath, err := zipEntryPath(entry)
+	if err != nil {
+		return nil, err
+	}
+	dir, name := path.Split(entryPath)
+	uploadDir := filepath.Join(destDir, filepath.FromSlash(dir))
+	if err := t.prepareUploadDir(uploadDir); err != nil {
+		return nil, err
+	}
+
+	rc, err := entry.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	extractedFile, err := t.uploadPart(r.Context(), partInfo{fileName: name, request: r}, rc, uploadDir, false, maxSize)
+	if err != nil {
+		return nil, fmt.Errorf("could not extract %q: %w", entryPath, err)
+	}
+	extractedFile.NewFileName = path.Join(dir, extractedFile.NewFileName)
+	extractedFile.UploadDir = destDir
+	return extractedFile, nil
+}
+
+// zipEntryPath returns the cleaned, slash separated path of entry, and fails if it is absolute, leads out of
+// the directory the archive is extracted to, or is a symbolic link
+func zipEntryPath(entry *zip.File) (string, error) {
+	name := strings.ReplaceAll(entry.Name, "\\", "/")
+	clean := path.Clean(name)
+	switch {
+	case strings.HasPrefix(name, "/") || filepath.VolumeName(name) != "" || (len(name) > 1 && name[1] == ':'):
+		return "", fmt.Errorf("the zip archive entry %q has an absolute path", entry.Name)
+	case clean == ".." || strings.HasPrefix(clean, "../"):
+		return "", fmt.Errorf("the zip archive entry %q leads out of the destination directory", entry.Name)
+	case strings.ContainsRune(name, 0):
+		return "", fmt.Errorf("the zip archive entry %q has an invalid name", entry.Name)
+	case entry.Mode()&os.ModeSymlink != 0:
+		return "", fmt.Errorf("the zip archive entry %q is a symbolic link", entry.Name)
+	}
+	return clean, nil
+}
+
+// receiveZip copies the single file of the multipart request r to a temporary file, and returns it along with
+// its size. The file must be a zip archive of at most maxSize bytes.
+func receiveZip(r *http.Request, maxSize int64) (*os.File, int64, error) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var archive *os.File
+	var size int64
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return closeTempFile(archive, err)
+		}
+		if part.FileName() == "" {
+			continue
+		}
+		if archive != nil {
+			return closeTempFile(archive, errors.New("expected a single zip archive, but more than one file was uploaded"))
+		}
+
+		archive, err = os.CreateTemp("", "upload-*.zip")
+		if err != nil {
+			return nil, 0, err
+		}
+		size, err = io.Copy(archive, &contextReader{ctx: r.Context(), r: io.LimitReader(part, maxSize+1)})
+		if err != nil {
+			return closeTempFile(archive, err)
+		}
+		if size > maxSize {
+			return closeTempFile(archive, ErrRequestTooLarge)
+		}
+	}
+	if archive == nil {
+		return nil, 0, ErrNoFileUploaded
+	}
+
+	// Check the archive is a zip file from its first bytes, like the type of uploaded files
+	head := make([]byte, 512)
+	n, _ := archive.ReadAt(head, 0)
+	if fileType := http.DetectContentType(head[:n]); fileType != "application/zip" && !bytes.HasPrefix(head[:n], []byte("PK\x05\x06")) {
+		return closeTempFile(archive, fmt.Errorf("the uploaded file type %s is not a zip archive", fileType))
+	}
+	return archive, size, nil
+}
+
+// closeTempFile removes the temporary file f, if any, and returns err
+func closeTempFile(f *os.File, err error) (*os.File, int64, error) {
+	if f != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+	}
+	return nil, 0, err
+}
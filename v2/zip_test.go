@@ -0,0 +1,120 @@
+package toolkit
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// zipEntry is a file in a zip archive built by newZip
+type zipEntry struct {
+	name    string
+	content string
+}
+
+// newZip returns a zip archive holding entries
+func newZip(t *testing.T, entries ...zipEntry) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for _, e := range entries {
+		w, err := writer.Create(e.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = w.Write([]byte(e.content))
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestTools_UploadAndExtractZip(t *testing.T) {
+	archive := newZip(t,
+		zipEntry{name: "readme.txt", content: "read me"},
+		zipEntry{name: "a/b/c/d/e/f/deep.txt", content: "deep down"},
+		zipEntry{name: "a/b/"},
+		zipEntry{name: "a/./b/../b/notes.txt", content: "some notes"},
+	)
+	destDir := t.TempDir()
+
+	var testTools Tools
+	extractedFiles, err := testTools.UploadAndExtractZip(newUploadRequest(t, testFile{name: "assets.zip", content: archive}), destDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"readme.txt":           "read me",
+		"a/b/c/d/e/f/deep.txt": "deep down",
+		"a/b/notes.txt":        "some notes",
+	}
+	if len(extractedFiles) != len(expected) {
+		t.Fatalf("expected %d extracted files, but got %d", len(expected), len(extractedFiles))
+	}
+	for _, f := range extractedFiles {
+		content, ok := expected[f.NewFileName]
+		if !ok {
+			t.Errorf("unexpected extracted file %s", f.NewFileName)
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(destDir, filepath.FromSlash(f.NewFileName)))
+		if err != nil || string(data) != content {
+			t.Errorf("wrong contents for %s: %q", f.NewFileName, data)
+		}
+		if f.SavedPath != filepath.Join(destDir, filepath.FromSlash(f.NewFileName)) || f.UploadDir != destDir {
+			t.Errorf("wrong saved path %s or upload directory %s", f.SavedPath, f.UploadDir)
+		}
+	}
+}
+
+var zipErrorTests = []struct {
+	name          string
+	entries       []zipEntry
+	tools         Tools
+	expectedError string
+}{
+	{name: "zip slip", entries: []zipEntry{{name: "fine.txt", content: "fine"}, {name: "../evil.txt", content: "evil"}}, expectedError: "leads out of the destination directory"},
+	{name: "hidden zip slip", entries: []zipEntry{{name: "a/../../evil.txt", content: "evil"}}, expectedError: "leads out of the destination directory"},
+	{name: "windows zip slip", entries: []zipEntry{{name: "a\\..\\..\\evil.txt", content: "evil"}}, expectedError: "leads out of the destination directory"},
+	{name: "absolute path", entries: []zipEntry{{name: "/etc/evil.txt", content: "evil"}}, expectedError: "has an absolute path"},
+	{name: "too many entries", entries: []zipEntry{{name: "one.txt", content: "1"}, {name: "two.txt", content: "2"}}, tools: Tools{MaxZipEntries: 1}, expectedError: "more than the allowed 1"},
+	{name: "entry too big", entries: []zipEntry{{name: "big.txt", content: strings.Repeat("x", 100)}}, tools: Tools{MaxSingleFileSize: 50}, expectedError: "is too big"},
+	{name: "bomb", entries: []zipEntry{{name: "bomb.txt", content: strings.Repeat("0", 1<<20)}}, tools: Tools{MaxFileSize: 1 << 16}, expectedError: ErrRequestTooLarge.Error()},
+	{name: "type not allowed", entries: []zipEntry{{name: "notes.txt", content: "some notes"}}, tools: Tools{AllowedFileTypes: []string{"image/*"}}, expectedError: "not permitted"},
+}
+
+func TestTools_UploadAndExtractZip_Errors(t *testing.T) {
+	for _, e := range zipErrorTests {
+		parent := t.TempDir()
+		destDir := filepath.Join(parent, "dest")
+		e.tools.CleanupOnError = true
+
+		_, err := e.tools.UploadAndExtractZip(newUploadRequest(t, testFile{name: "assets.zip", content: newZip(t, e.entries...)}), destDir)
+		if err == nil || !strings.Contains(err.Error(), e.expectedError) {
+			t.Errorf("%s: expected error containing %q, but got %v", e.name, e.expectedError, err)
+		}
+
+		// Nothing is left behind, and above all nothing outside of the destination directory
+		if _, err := os.Stat(filepath.Join(parent, "evil.txt")); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%s: a file was written outside of the destination directory", e.name)
+		}
+		size, _ := e.tools.DirSize(destDir)
+		if size != 0 {
+			t.Errorf("%s: expected nothing to be extracted, but found %d bytes", e.name, size)
+		}
+	}
+
+	// Only a zip archive is accepted
+	var testTools Tools
+	_, err := testTools.UploadAndExtractZip(newUploadRequest(t, testFile{name: "notes.zip", content: []byte("some notes")}), t.TempDir())
+	if err == nil || !strings.Contains(err.Error(), "is not a zip archive") {
+		t.Errorf("expected an error for a file that is not a zip archive, but got %v", err)
+	}
+}